@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// requireAdmin guards operator endpoints with the ADMIN_TOKEN bearer token.
+// Without ADMIN_TOKEN set the endpoints are disabled.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// CacheStatsResponse lists every cache with its totals
+type CacheStatsResponse struct {
+	Caches     []CacheStats `json:"caches"`
+	TotalBytes int64        `json:"total_bytes"`
+	MaxBytes   int64        `json:"max_bytes"`
+}
+
+// adminCacheStatsHandler reports size, budget and hit/miss/eviction counters
+// for each cache
+func adminCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	resp := CacheStatsResponse{Caches: allCacheStats()}
+	for _, c := range resp.Caches {
+		resp.TotalBytes += c.Bytes
+		resp.MaxBytes += c.MaxBytes
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -1,19 +1,15 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"fmt"
-	"sort"
-	"strings"
-	"sync"
 	"time"
 )
 
-// ProfileCache stores profile information with TTL
+// ProfileCache stores profile information with TTL. Entries past the TTL are
+// still served for a grace window while a refresh runs in the background.
 type ProfileCache struct {
-	profiles sync.Map
+	profiles *BoundedCache[*cachedProfile]
 	ttl      time.Duration
+	grace    time.Duration
 }
 
 type cachedProfile struct {
@@ -21,31 +17,38 @@ type cachedProfile struct {
 	fetchedAt time.Time
 }
 
-// Global profile cache - 10 minute TTL
+// Global profile cache - 10 minute TTL, stale profiles served for up to an hour
 var profileCache = &ProfileCache{
-	ttl: 10 * time.Minute,
+	profiles: NewBoundedCache("profiles", cacheBudget("CACHE_PROFILES_MB", 32), func(pubkey string, c *cachedProfile) int64 {
+		size := int64(entryOverhead + len(pubkey))
+		if p := c.profile; p != nil {
+			size += int64(len(p.Name) + len(p.DisplayName) + len(p.Picture) + len(p.Nip05) +
+				len(p.About) + len(p.Banner) + len(p.Lud16) + len(p.Website) + 8*16)
+		}
+		return size
+	}),
+	ttl:   10 * time.Minute,
+	grace: 50 * time.Minute,
+}
+
+// usable reports whether a cached profile is within the TTL or grace window
+func (c *ProfileCache) usable(cached *cachedProfile, _ time.Time) bool {
+	return time.Since(cached.fetchedAt) <= c.ttl+c.grace
 }
 
-// Get retrieves a profile from cache if it exists and isn't expired
+// Get retrieves a profile from cache if it exists and is within the TTL or
+// grace window
 func (c *ProfileCache) Get(pubkey string) (*ProfileInfo, bool) {
-	val, ok := c.profiles.Load(pubkey)
+	cached, ok := c.profiles.Get(pubkey, c.usable)
 	if !ok {
 		return nil, false
 	}
-
-	cached := val.(*cachedProfile)
-	if time.Since(cached.fetchedAt) > c.ttl {
-		// Expired, remove from cache
-		c.profiles.Delete(pubkey)
-		return nil, false
-	}
-
 	return cached.profile, true
 }
 
 // Set stores a profile in the cache
 func (c *ProfileCache) Set(pubkey string, profile *ProfileInfo) {
-	c.profiles.Store(pubkey, &cachedProfile{
+	c.profiles.Set(pubkey, &cachedProfile{
 		profile:   profile,
 		fetchedAt: time.Now(),
 	})
@@ -60,214 +63,39 @@ func (c *ProfileCache) Delete(pubkey string) {
 func (c *ProfileCache) SetMultiple(profiles map[string]*ProfileInfo) {
 	now := time.Now()
 	for pubkey, profile := range profiles {
-		c.profiles.Store(pubkey, &cachedProfile{
+		c.profiles.Set(pubkey, &cachedProfile{
 			profile:   profile,
 			fetchedAt: now,
 		})
 	}
 }
 
-// GetMultiple retrieves multiple profiles, returning found ones and list of missing pubkeys
-func (c *ProfileCache) GetMultiple(pubkeys []string) (found map[string]*ProfileInfo, missing []string) {
+// GetMultiple retrieves multiple profiles, returning found ones, the list of
+// missing pubkeys, and the found pubkeys that are past the TTL and should be
+// refreshed
+func (c *ProfileCache) GetMultiple(pubkeys []string) (found map[string]*ProfileInfo, missing []string, stale []string) {
 	found = make(map[string]*ProfileInfo)
 	now := time.Now()
 
 	for _, pubkey := range pubkeys {
-		val, ok := c.profiles.Load(pubkey)
+		cached, ok := c.profiles.Get(pubkey, c.usable)
 		if !ok {
 			missing = append(missing, pubkey)
 			continue
 		}
-
-		cached := val.(*cachedProfile)
 		if now.Sub(cached.fetchedAt) > c.ttl {
-			c.profiles.Delete(pubkey)
-			missing = append(missing, pubkey)
-			continue
+			stale = append(stale, pubkey)
 		}
 
 		found[pubkey] = cached.profile
 	}
 
-	return found, missing
-}
-
-// EventCache provides in-memory caching for relay queries
-type EventCache struct {
-	mu      sync.RWMutex
-	entries map[string]*EventCacheEntry
-	maxSize int
-}
-
-// EventCacheEntry holds cached events with expiration
-type EventCacheEntry struct {
-	Events    []Event
-	EOSE      bool
-	ExpiresAt time.Time
-}
-
-// Global event cache - max 500 cached queries
-var eventCache = NewEventCache(500)
-
-// NewEventCache creates a new cache with the given max size
-func NewEventCache(maxSize int) *EventCache {
-	cache := &EventCache{
-		entries: make(map[string]*EventCacheEntry),
-		maxSize: maxSize,
-	}
-	// Start background cleanup
-	go cache.cleanupLoop()
-	return cache
-}
-
-// buildCacheKey creates a deterministic key from query parameters
-func buildEventCacheKey(relays []string, filter Filter) string {
-	// Sort relays for consistent keys
-	sortedRelays := make([]string, len(relays))
-	copy(sortedRelays, relays)
-	sort.Strings(sortedRelays)
-
-	// Sort authors for consistent keys
-	sortedAuthors := make([]string, len(filter.Authors))
-	copy(sortedAuthors, filter.Authors)
-	sort.Strings(sortedAuthors)
-
-	// Sort kinds for consistent keys
-	sortedKinds := make([]int, len(filter.Kinds))
-	copy(sortedKinds, filter.Kinds)
-	sort.Ints(sortedKinds)
-
-	// Build key string
-	var sb strings.Builder
-	sb.WriteString("relays:")
-	sb.WriteString(strings.Join(sortedRelays, ","))
-	sb.WriteString("|authors:")
-	sb.WriteString(strings.Join(sortedAuthors, ","))
-	sb.WriteString("|kinds:")
-	for i, k := range sortedKinds {
-		if i > 0 {
-			sb.WriteString(",")
-		}
-		sb.WriteString(fmt.Sprintf("%d", k))
-	}
-	sb.WriteString(fmt.Sprintf("|limit:%d", filter.Limit))
-	if filter.Until != nil {
-		sb.WriteString(fmt.Sprintf("|until:%d", *filter.Until))
-	}
-
-	// Hash the key to keep it short
-	hash := sha256.Sum256([]byte(sb.String()))
-	return hex.EncodeToString(hash[:16])
-}
-
-// getEventTTL returns appropriate TTL based on query type
-func getEventTTL(filter Filter) time.Duration {
-	if len(filter.Authors) == 0 {
-		// Global timeline - cache longer, high hit rate
-		return 60 * time.Second
-	}
-	if len(filter.Authors) <= 5 {
-		// Small author list (maybe a profile page)
-		return 45 * time.Second
-	}
-	// Large author list (follow list) - moderate cache
-	return 30 * time.Second
-}
-
-// Get retrieves cached events if available and not expired
-func (c *EventCache) Get(relays []string, filter Filter) ([]Event, bool, bool) {
-	key := buildEventCacheKey(relays, filter)
-
-	c.mu.RLock()
-	entry, ok := c.entries[key]
-	c.mu.RUnlock()
-
-	if !ok || time.Now().After(entry.ExpiresAt) {
-		return nil, false, false
-	}
-
-	// Return a copy to avoid race conditions
-	events := make([]Event, len(entry.Events))
-	copy(events, entry.Events)
-	return events, entry.EOSE, true
-}
-
-// Set stores events in the cache
-func (c *EventCache) Set(relays []string, filter Filter, events []Event, eose bool) {
-	key := buildEventCacheKey(relays, filter)
-	ttl := getEventTTL(filter)
-
-	// Make a copy of events to store
-	eventsCopy := make([]Event, len(events))
-	copy(eventsCopy, events)
-
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// Simple eviction if at max size: remove oldest entries
-	if len(c.entries) >= c.maxSize {
-		c.evictOldest()
-	}
-
-	c.entries[key] = &EventCacheEntry{
-		Events:    eventsCopy,
-		EOSE:      eose,
-		ExpiresAt: time.Now().Add(ttl),
-	}
-}
-
-// evictOldest removes the oldest 10% of entries (must hold write lock)
-func (c *EventCache) evictOldest() {
-	toRemove := c.maxSize / 10
-	if toRemove < 1 {
-		toRemove = 1
-	}
-
-	type keyExpiry struct {
-		key     string
-		expires time.Time
-	}
-
-	entries := make([]keyExpiry, 0, len(c.entries))
-	for k, v := range c.entries {
-		entries = append(entries, keyExpiry{k, v.ExpiresAt})
-	}
-
-	// Sort by expiration time (oldest first)
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].expires.Before(entries[j].expires)
-	})
-
-	// Remove oldest entries
-	for i := 0; i < toRemove && i < len(entries); i++ {
-		delete(c.entries, entries[i].key)
-	}
-}
-
-// cleanupLoop periodically removes expired entries
-func (c *EventCache) cleanupLoop() {
-	ticker := time.NewTicker(1 * time.Minute)
-	for range ticker.C {
-		c.cleanup()
-	}
-}
-
-// cleanup removes all expired entries
-func (c *EventCache) cleanup() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	now := time.Now()
-	for key, entry := range c.entries {
-		if now.After(entry.ExpiresAt) {
-			delete(c.entries, key)
-		}
-	}
+	return found, missing, stale
 }
 
 // ContactCache stores contact lists with short TTL
 type ContactCache struct {
-	contacts sync.Map
+	contacts *BoundedCache[*cachedContacts]
 	ttl      time.Duration
 }
 
@@ -278,37 +106,73 @@ type cachedContacts struct {
 
 // Global contact cache - 2 minute TTL (contacts change often)
 var contactCache = &ContactCache{
+	contacts: NewBoundedCache("contacts", cacheBudget("CACHE_CONTACTS_MB", 16), func(pubkey string, c *cachedContacts) int64 {
+		return int64(entryOverhead+len(pubkey)) + stringsSize(c.pubkeys)
+	}),
 	ttl: 2 * time.Minute,
 }
 
 // Get retrieves contacts from cache if not expired
 func (c *ContactCache) Get(pubkey string) ([]string, bool) {
-	val, ok := c.contacts.Load(pubkey)
+	cached, ok := c.contacts.Get(pubkey, func(cached *cachedContacts, _ time.Time) bool {
+		return time.Since(cached.fetchedAt) <= c.ttl
+	})
 	if !ok {
 		return nil, false
 	}
-
-	cached := val.(*cachedContacts)
-	if time.Since(cached.fetchedAt) > c.ttl {
-		c.contacts.Delete(pubkey)
-		return nil, false
-	}
-
 	return cached.pubkeys, true
 }
 
 // Set stores contacts in the cache
 func (c *ContactCache) Set(pubkey string, contacts []string) {
-	c.contacts.Store(pubkey, &cachedContacts{
+	c.contacts.Set(pubkey, &cachedContacts{
 		pubkeys:   contacts,
 		fetchedAt: time.Now(),
 	})
 }
 
+// FollowCountCache stores follower/following counts with TTL
+type FollowCountCache struct {
+	counts *BoundedCache[*cachedFollowCounts]
+	ttl    time.Duration
+}
+
+type cachedFollowCounts struct {
+	counts    *FollowCounts
+	fetchedAt time.Time
+}
+
+// Global follow count cache - 10 minute TTL (counting followers is expensive)
+var followCountCache = &FollowCountCache{
+	counts: NewBoundedCache("follow_counts", cacheBudget("CACHE_FOLLOW_COUNTS_MB", 2), func(pubkey string, c *cachedFollowCounts) int64 {
+		return int64(entryOverhead + len(pubkey) + 32)
+	}),
+	ttl: 10 * time.Minute,
+}
+
+// Get retrieves counts from cache if not expired
+func (c *FollowCountCache) Get(pubkey string) (*FollowCounts, bool) {
+	cached, ok := c.counts.Get(pubkey, func(cached *cachedFollowCounts, _ time.Time) bool {
+		return time.Since(cached.fetchedAt) <= c.ttl
+	})
+	if !ok {
+		return nil, false
+	}
+	return cached.counts, true
+}
+
+// Set stores counts in the cache
+func (c *FollowCountCache) Set(pubkey string, counts *FollowCounts) {
+	c.counts.Set(pubkey, &cachedFollowCounts{
+		counts:    counts,
+		fetchedAt: time.Now(),
+	})
+}
+
 // RelayListCache stores relay lists with TTL
 type RelayListCache struct {
-	relayLists sync.Map
-	ttl        time.Duration
+	relayLists  *BoundedCache[*cachedRelayList]
+	ttl         time.Duration
 	notFoundTTL time.Duration // shorter TTL for "not found" entries
 }
 
@@ -320,25 +184,28 @@ type cachedRelayList struct {
 
 // Global relay list cache - 30 minute TTL, 5 minute TTL for not-found
 var relayListCache = &RelayListCache{
-	ttl:        30 * time.Minute,
+	relayLists: NewBoundedCache("relay_lists", cacheBudget("CACHE_RELAY_LISTS_MB", 8), func(pubkey string, c *cachedRelayList) int64 {
+		size := int64(entryOverhead + len(pubkey))
+		if c.relayList != nil {
+			size += stringsSize(c.relayList.Read) + stringsSize(c.relayList.Write)
+		}
+		return size
+	}),
+	ttl:         30 * time.Minute,
 	notFoundTTL: 5 * time.Minute,
 }
 
 // Get retrieves a relay list from cache if not expired
 func (c *RelayListCache) Get(pubkey string) (*RelayList, bool, bool) {
-	val, ok := c.relayLists.Load(pubkey)
+	cached, ok := c.relayLists.Get(pubkey, func(cached *cachedRelayList, _ time.Time) bool {
+		ttl := c.ttl
+		if cached.notFound {
+			ttl = c.notFoundTTL
+		}
+		return time.Since(cached.fetchedAt) <= ttl
+	})
 	if !ok {
-		return nil, false, false // not in cache
-	}
-
-	cached := val.(*cachedRelayList)
-	ttl := c.ttl
-	if cached.notFound {
-		ttl = c.notFoundTTL
-	}
-	if time.Since(cached.fetchedAt) > ttl {
-		c.relayLists.Delete(pubkey)
-		return nil, false, false // expired
+		return nil, false, false // not in cache or expired
 	}
 
 	return cached.relayList, cached.notFound, true // found in cache
@@ -346,7 +213,7 @@ func (c *RelayListCache) Get(pubkey string) (*RelayList, bool, bool) {
 
 // Set stores a relay list in the cache
 func (c *RelayListCache) Set(pubkey string, relayList *RelayList) {
-	c.relayLists.Store(pubkey, &cachedRelayList{
+	c.relayLists.Set(pubkey, &cachedRelayList{
 		relayList: relayList,
 		fetchedAt: time.Now(),
 		notFound:  relayList == nil,
@@ -366,7 +233,7 @@ type LinkPreview struct {
 
 // LinkPreviewCache stores link previews with long TTL
 type LinkPreviewCache struct {
-	previews sync.Map
+	previews *BoundedCache[*cachedLinkPreview]
 	ttl      time.Duration
 	failTTL  time.Duration // shorter TTL for failed fetches
 }
@@ -378,33 +245,36 @@ type cachedLinkPreview struct {
 
 // Global link preview cache - 24 hour TTL for success, 1 hour for failures
 var linkPreviewCache = &LinkPreviewCache{
+	previews: NewBoundedCache("link_previews", cacheBudget("CACHE_LINK_PREVIEWS_MB", 16), func(url string, c *cachedLinkPreview) int64 {
+		p := c.preview
+		return int64(entryOverhead + len(url) + len(p.URL) + len(p.Title) + len(p.Description) +
+			len(p.Image) + len(p.SiteName) + 5*16)
+	}),
 	ttl:     24 * time.Hour,
 	failTTL: 1 * time.Hour,
 }
 
-// Get retrieves a link preview from cache if not expired
-func (c *LinkPreviewCache) Get(url string) (*LinkPreview, bool) {
-	val, ok := c.previews.Load(url)
-	if !ok {
-		return nil, false
-	}
-
-	cached := val.(*cachedLinkPreview)
+// usable reports whether a cached preview is within its TTL
+func (c *LinkPreviewCache) usable(cached *cachedLinkPreview, _ time.Time) bool {
 	ttl := c.ttl
 	if cached.preview.Failed {
 		ttl = c.failTTL
 	}
-	if time.Since(cached.fetchedAt) > ttl {
-		c.previews.Delete(url)
+	return time.Since(cached.fetchedAt) <= ttl
+}
+
+// Get retrieves a link preview from cache if not expired
+func (c *LinkPreviewCache) Get(url string) (*LinkPreview, bool) {
+	cached, ok := c.previews.Get(url, c.usable)
+	if !ok {
 		return nil, false
 	}
-
 	return cached.preview, true
 }
 
 // Set stores a link preview in the cache
 func (c *LinkPreviewCache) Set(url string, preview *LinkPreview) {
-	c.previews.Store(url, &cachedLinkPreview{
+	c.previews.Set(url, &cachedLinkPreview{
 		preview:   preview,
 		fetchedAt: time.Now(),
 	})
@@ -413,26 +283,13 @@ func (c *LinkPreviewCache) Set(url string, preview *LinkPreview) {
 // GetMultiple retrieves multiple previews, returning found ones and missing URLs
 func (c *LinkPreviewCache) GetMultiple(urls []string) (found map[string]*LinkPreview, missing []string) {
 	found = make(map[string]*LinkPreview)
-	now := time.Now()
 
 	for _, url := range urls {
-		val, ok := c.previews.Load(url)
+		cached, ok := c.previews.Get(url, c.usable)
 		if !ok {
 			missing = append(missing, url)
 			continue
 		}
-
-		cached := val.(*cachedLinkPreview)
-		ttl := c.ttl
-		if cached.preview.Failed {
-			ttl = c.failTTL
-		}
-		if now.Sub(cached.fetchedAt) > ttl {
-			c.previews.Delete(url)
-			missing = append(missing, url)
-			continue
-		}
-
 		found[url] = cached.preview
 	}
 
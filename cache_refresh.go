@@ -0,0 +1,183 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Background refresh: stale cache entries are served immediately while a
+// refresh runs in the background, and popular feed queries are kept warm
+// before they expire.
+
+var (
+	refreshingQueries  sync.Map // coalesceKey+until -> struct{}
+	refreshingProfiles sync.Map // pubkey -> struct{}
+)
+
+// refreshQueryAsync refetches a filter's window from relays in the
+// background, unless a refresh for it is already running
+func refreshQueryAsync(relays []string, filter Filter) {
+	refreshKey := coalesceKey(relays, filter) + "|until:"
+	if filter.Until != nil {
+		refreshKey += strconv.FormatInt(*filter.Until, 10)
+	}
+	if _, running := refreshingQueries.LoadOrStore(refreshKey, struct{}{}); running {
+		return
+	}
+
+	go func() {
+		defer refreshingQueries.Delete(refreshKey)
+		events, eose := fetchEventsFromRelays(relays, filter)
+		recordFetch(coverageKey(relays, filter), filter, events, eose)
+		slog.Debug("Refreshed query in background", "limit", filter.Limit, "authors", len(filter.Authors), "events", len(events))
+	}()
+}
+
+// refreshProfilesAsync refetches stale profiles in the background, skipping
+// pubkeys whose refresh is already running
+func refreshProfilesAsync(relays []string, pubkeys []string) {
+	var toRefresh []string
+	for _, pk := range pubkeys {
+		if _, running := refreshingProfiles.LoadOrStore(pk, struct{}{}); !running {
+			toRefresh = append(toRefresh, pk)
+		}
+	}
+	if len(toRefresh) == 0 {
+		return
+	}
+
+	go func() {
+		defer func() {
+			for _, pk := range toRefresh {
+				refreshingProfiles.Delete(pk)
+			}
+		}()
+		fetchProfilesCoalesced(relays, toRefresh)
+		slog.Debug("Refreshed stale profiles in background", "profiles", len(toRefresh))
+	}()
+}
+
+// QueryWarmer keeps popular feed queries (the global feed, follows feeds of
+// active sessions, ...) in the event store by refreshing them shortly before
+// their coverage expires. Popularity is a decaying count of observed requests.
+type QueryWarmer struct {
+	mu       sync.Mutex
+	queries  map[string]*warmQuery
+	interval time.Duration
+	minScore float64 // Decayed hits needed before a query is kept warm
+	maxWarm  int     // Queries refreshed per tick
+	idleTTL  time.Duration
+
+	done     chan struct{} // Closed by Stop to end the scheduler
+	stopOnce sync.Once
+}
+
+type warmQuery struct {
+	relays     []string
+	filter     Filter
+	score      float64 // Decayed hit count from previous ticks
+	windowHits int     // Hits since the last tick
+	lastHit    time.Time
+}
+
+// Global query warmer - ticks every 30s, warms up to 10 queries per tick
+var queryWarmer = NewQueryWarmer(30*time.Second, 2, 10, 10*time.Minute)
+
+// NewQueryWarmer creates a warmer and starts its scheduler
+func NewQueryWarmer(interval time.Duration, minScore float64, maxWarm int, idleTTL time.Duration) *QueryWarmer {
+	w := &QueryWarmer{
+		queries:  make(map[string]*warmQuery),
+		interval: interval,
+		minScore: minScore,
+		maxWarm:  maxWarm,
+		idleTTL:  idleTTL,
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Observe records a request for a feed-top filter (no until)
+func (w *QueryWarmer) Observe(relays []string, filter Filter) {
+	key := coverageKey(relays, filter)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	q, ok := w.queries[key]
+	if !ok {
+		q = &warmQuery{relays: append([]string(nil), relays...), filter: filter}
+		w.queries[key] = q
+	}
+	// Warm with the largest page anyone asked for
+	if filter.Limit == 0 || (q.filter.Limit != 0 && filter.Limit > q.filter.Limit) {
+		q.filter = filter
+	}
+	q.windowHits++
+	q.lastHit = time.Now()
+}
+
+func (w *QueryWarmer) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.tick()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Stop ends the scheduler; refreshes already started run to completion
+func (w *QueryWarmer) Stop() {
+	w.stopOnce.Do(func() { close(w.done) })
+}
+
+// tick decays scores, forgets idle queries and refreshes the most popular
+// ones whose coverage is missing or about to expire
+func (w *QueryWarmer) tick() {
+	now := time.Now()
+	type candidate struct {
+		key   string
+		query warmQuery
+	}
+	var candidates []candidate
+
+	w.mu.Lock()
+	for key, q := range w.queries {
+		q.score = q.score*0.5 + float64(q.windowHits)
+		q.windowHits = 0
+		if now.Sub(q.lastHit) > w.idleTTL {
+			delete(w.queries, key)
+			continue
+		}
+		if q.score >= w.minScore {
+			candidates = append(candidates, candidate{key, *q})
+		}
+	}
+	w.mu.Unlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].query.score > candidates[j].query.score
+	})
+
+	warmed := 0
+	for _, c := range candidates {
+		if warmed >= w.maxWarm {
+			break
+		}
+		if !eventStore.NeedsRefresh(c.key, c.query.filter, w.interval) {
+			continue
+		}
+		refreshQueryAsync(c.query.relays, c.query.filter)
+		warmed++
+	}
+	if warmed > 0 {
+		slog.Debug("Warming popular queries", "warming", warmed, "above_threshold", len(candidates))
+	}
+}
@@ -0,0 +1,604 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NIP-52 calendar events. Date-based (31922) and time-based (31923) events
+// are addressable, so they're referred to by "kind:pubkey:d" coordinates:
+// calendars (31924) list them in a tags, and RSVPs (31925) point at them the
+// same way. Events can be exported as iCalendar for ordinary calendar apps.
+
+const (
+	kindCalendarDateEvent = 31922
+	kindCalendarTimeEvent = 31923
+	kindCalendar          = 31924
+	kindCalendarRSVP      = 31925
+)
+
+const (
+	maxCalendarParticipants = 12  // Participants shown per event
+	calendarPageFetchLimit  = 500 // Events fetched for the calendar page, upcoming or not
+	calendarPageMaxEvents   = 100
+	calendarRSVPLimit       = 1000
+)
+
+// calendarDateLayout is the format of the start and end tags of date-based events
+const calendarDateLayout = "2006-01-02"
+
+// rsvpStatuses are the NIP-52 RSVP statuses, in the order the form offers them
+var rsvpStatuses = []string{"accepted", "tentative", "declined"}
+
+// CalendarParticipant is a p tag of a calendar event
+type CalendarParticipant struct {
+	Pubkey    string
+	Npub      string
+	NpubShort string
+	Role      string
+	Profile   *ProfileInfo
+}
+
+// HTMLCalendarEvent holds a parsed kind 31922 or 31923 event and its RSVPs
+type HTMLCalendarEvent struct {
+	ID           string
+	Kind         int
+	Pubkey       string
+	Coordinate   string // "kind:pubkey:d", what RSVPs and calendars reference
+	Naddr        string
+	Title        string
+	Summary      string
+	Image        string
+	Locations    []string
+	Hashtags     []string
+	AllDay       bool      // Date-based: Start and End are midnight UTC, End exclusive
+	Start        time.Time // In the event's start_tzid when it has a valid one
+	End          time.Time // Zero when the event has no end
+	TimeText     string
+	Ended        bool
+	Participants []CalendarParticipant
+	UpdatedAt    int64
+	// RSVP counts, and the reader's own status ("" if none)
+	Accepted  int
+	Tentative int
+	Declined  int
+	MyStatus  string
+	// RSVP form state for the page the event is rendered on
+	CanRSVP   bool
+	CSRFToken string
+	ReturnURL string
+}
+
+// isCalendarEventKind reports whether kind is a date- or time-based calendar event
+func isCalendarEventKind(kind int) bool {
+	return kind == kindCalendarDateEvent || kind == kindCalendarTimeEvent
+}
+
+// parseCalendarEvent reads a calendar event's tags. It returns nil for other
+// kinds and for events without a usable start.
+func parseCalendarEvent(evt Event) *HTMLCalendarEvent {
+	if !isCalendarEventKind(evt.Kind) {
+		return nil
+	}
+	dTag := extractDTag(evt.Tags)
+	cal := &HTMLCalendarEvent{
+		ID:         evt.ID,
+		Kind:       evt.Kind,
+		Pubkey:     evt.PubKey,
+		Coordinate: fmt.Sprintf("%d:%s:%s", evt.Kind, evt.PubKey, dTag),
+		AllDay:     evt.Kind == kindCalendarDateEvent,
+		UpdatedAt:  evt.CreatedAt,
+	}
+	cal.Naddr, _ = EncodeNAddr(uint32(evt.Kind), evt.PubKey, dTag)
+
+	var start, end, startTZ, endTZ, name string
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "title":
+			cal.Title = strings.TrimSpace(tag[1])
+		case "name": // Deprecated in favor of title
+			name = strings.TrimSpace(tag[1])
+		case "summary":
+			cal.Summary = strings.TrimSpace(tag[1])
+		case "image":
+			if strings.HasPrefix(tag[1], "https://") || strings.HasPrefix(tag[1], "http://") {
+				cal.Image = tag[1]
+			}
+		case "location":
+			if loc := strings.TrimSpace(tag[1]); loc != "" {
+				cal.Locations = append(cal.Locations, loc)
+			}
+		case "t":
+			cal.Hashtags = append(cal.Hashtags, tag[1])
+		case "start":
+			start = tag[1]
+		case "end":
+			end = tag[1]
+		case "start_tzid":
+			startTZ = tag[1]
+		case "end_tzid":
+			endTZ = tag[1]
+		case "p":
+			if !isValidEventID(tag[1]) || len(cal.Participants) >= maxCalendarParticipants {
+				continue
+			}
+			participant := CalendarParticipant{Pubkey: tag[1]}
+			if len(tag) >= 4 {
+				participant.Role = tag[3]
+			}
+			participant.Npub, _ = encodeBech32Pubkey(tag[1])
+			participant.NpubShort = formatNpubShort(participant.Npub)
+			cal.Participants = append(cal.Participants, participant)
+		}
+	}
+	if cal.Title == "" {
+		cal.Title = name
+	}
+	if cal.Title == "" {
+		cal.Title = "Untitled event"
+	}
+	cal.Hashtags = dedupeStrings(cal.Hashtags)
+
+	if cal.AllDay {
+		s, err := time.Parse(calendarDateLayout, start)
+		if err != nil {
+			return nil
+		}
+		cal.Start = s
+		if e, err := time.Parse(calendarDateLayout, end); err == nil && e.After(s) {
+			cal.End = e
+		}
+	} else {
+		s, err := strconv.ParseInt(start, 10, 64)
+		if err != nil || s <= 0 {
+			return nil
+		}
+		cal.Start = time.Unix(s, 0).In(calendarLocation(startTZ))
+		if e, err := strconv.ParseInt(end, 10, 64); err == nil && e > s {
+			if endTZ == "" {
+				endTZ = startTZ
+			}
+			cal.End = time.Unix(e, 0).In(calendarLocation(endTZ))
+		}
+	}
+
+	cal.Ended = cal.lastMoment().Before(time.Now())
+	cal.TimeText = cal.formatTime()
+	return cal
+}
+
+// calendarLocation loads an IANA time zone, falling back to UTC
+func calendarLocation(tzid string) *time.Location {
+	if tzid == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(tzid)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// lastMoment is when the event is over: its end, or the end of its start
+// day (date-based) or its start (time-based) when it has none
+func (c *HTMLCalendarEvent) lastMoment() time.Time {
+	switch {
+	case !c.End.IsZero():
+		return c.End
+	case c.AllDay:
+		return c.Start.AddDate(0, 0, 1)
+	default:
+		return c.Start
+	}
+}
+
+// formatTime describes when the event happens
+func (c *HTMLCalendarEvent) formatTime() string {
+	if c.AllDay {
+		const layout = "Mon, Jan 2, 2006"
+		if c.End.IsZero() || !c.End.After(c.Start.AddDate(0, 0, 1)) {
+			return c.Start.Format(layout)
+		}
+		// The end date is exclusive
+		return c.Start.Format(layout) + " – " + c.End.AddDate(0, 0, -1).Format(layout)
+	}
+	text := c.Start.Format("Mon, Jan 2, 2006 15:04")
+	switch {
+	case c.End.IsZero():
+		return text + " " + c.Start.Format("MST")
+	case c.End.Location().String() == c.Start.Location().String() && c.End.YearDay() == c.Start.YearDay() && c.End.Year() == c.Start.Year():
+		return text + " – " + c.End.Format("15:04 MST")
+	default:
+		return text + " " + c.Start.Format("MST") + " – " + c.End.Format("Mon, Jan 2, 2006 15:04 MST")
+	}
+}
+
+// parseCalendarCoordinate splits a "kind:pubkey:d" reference to a calendar event
+func parseCalendarCoordinate(coord string) (kind int, pubkey, dTag string, ok bool) {
+	parts := strings.SplitN(coord, ":", 3)
+	if len(parts) != 3 {
+		return 0, "", "", false
+	}
+	kind, err := strconv.Atoi(parts[0])
+	if err != nil || !isCalendarEventKind(kind) || !isValidEventID(parts[1]) {
+		return 0, "", "", false
+	}
+	return kind, parts[1], parts[2], true
+}
+
+// rsvpStatus reads the status of an RSVP, from its status tag or the older
+// "status" label
+func rsvpStatus(tags [][]string) string {
+	for _, tag := range tags {
+		if len(tag) >= 2 && tag[0] == "status" {
+			return tag[1]
+		}
+		if len(tag) >= 3 && tag[0] == "l" && tag[2] == "status" {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+// tallyRSVPs counts the latest RSVP of each pubkey per event. reader marks
+// the reader's own status.
+func tallyRSVPs(events []*HTMLCalendarEvent, rsvps []Event, reader string) {
+	byCoord := make(map[string]*HTMLCalendarEvent, len(events))
+	for _, cal := range events {
+		byCoord[cal.Coordinate] = cal
+	}
+
+	type vote struct {
+		status    string
+		createdAt int64
+	}
+	latest := make(map[string]map[string]vote) // coordinate -> pubkey -> vote
+	for _, rsvp := range rsvps {
+		if rsvp.Kind != kindCalendarRSVP {
+			continue
+		}
+		status := rsvpStatus(rsvp.Tags)
+		for _, tag := range rsvp.Tags {
+			if len(tag) < 2 || tag[0] != "a" || byCoord[tag[1]] == nil {
+				continue
+			}
+			if latest[tag[1]] == nil {
+				latest[tag[1]] = make(map[string]vote)
+			}
+			if prev, ok := latest[tag[1]][rsvp.PubKey]; !ok || rsvp.CreatedAt > prev.createdAt {
+				latest[tag[1]][rsvp.PubKey] = vote{status, rsvp.CreatedAt}
+			}
+		}
+	}
+
+	for coord, votes := range latest {
+		cal := byCoord[coord]
+		for pubkey, v := range votes {
+			switch v.status {
+			case "accepted":
+				cal.Accepted++
+			case "tentative":
+				cal.Tentative++
+			case "declined":
+				cal.Declined++
+			default:
+				continue
+			}
+			if pubkey == reader {
+				cal.MyStatus = v.status
+			}
+		}
+	}
+}
+
+// prepareCalendarEvents fetches participant profiles and RSVPs for the
+// calendar events on a page and sets up the RSVP forms. reader is the
+// logged-in user's hex pubkey, or "" for anonymous readers.
+func prepareCalendarEvents(events []*HTMLCalendarEvent, relays []string, reader, csrfToken, returnURL string) {
+	if len(events) == 0 {
+		return
+	}
+
+	coords := make([]string, 0, len(events))
+	var pubkeys []string
+	for _, cal := range events {
+		coords = append(coords, cal.Coordinate)
+		for _, p := range cal.Participants {
+			pubkeys = append(pubkeys, p.Pubkey)
+		}
+	}
+
+	var profiles map[string]*ProfileInfo
+	var rsvps []Event
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if len(pubkeys) > 0 {
+			profiles = fetchProfiles(profileRelays(), dedupeStrings(pubkeys))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		// Fetched fresh so an RSVP shows up on the page the reader returns to
+		rsvps, _ = fetchEventsFromRelays(relays, Filter{
+			Kinds: []int{kindCalendarRSVP},
+			Tags:  map[string][]string{"a": dedupeStrings(coords)},
+			Limit: calendarRSVPLimit,
+		})
+	}()
+	wg.Wait()
+
+	tallyRSVPs(events, rsvps, reader)
+	for _, cal := range events {
+		for i := range cal.Participants {
+			cal.Participants[i].Profile = profiles[cal.Participants[i].Pubkey]
+		}
+		cal.CanRSVP = reader != "" && !cal.Ended
+		cal.CSRFToken = csrfToken
+		cal.ReturnURL = returnURL
+	}
+}
+
+// collectCalendarEvents returns the calendar events among items
+func collectCalendarEvents(items []HTMLEventItem) []*HTMLCalendarEvent {
+	var events []*HTMLCalendarEvent
+	for i := range items {
+		if items[i].Calendar != nil {
+			events = append(events, items[i].Calendar)
+		}
+	}
+	return events
+}
+
+// newestAddressable keeps the newest version of each addressable event
+func newestAddressable(events []Event) []Event {
+	newest := make(map[string]Event, len(events))
+	for _, evt := range events {
+		key := replaceableKey(evt)
+		if existing, ok := newest[key]; !ok || evt.CreatedAt > existing.CreatedAt ||
+			(evt.CreatedAt == existing.CreatedAt && evt.ID < existing.ID) {
+			newest[key] = evt
+		}
+	}
+	result := make([]Event, 0, len(newest))
+	for _, evt := range newest {
+		result = append(result, evt)
+	}
+	return result
+}
+
+// HTMLCalendarData is the data passed to the calendar page template
+type HTMLCalendarData struct {
+	HTMLPageChrome
+	Events []*HTMLCalendarEvent
+}
+
+var htmlCalendarTemplate = `{{define "page-style"}}{{template "calendar-style"}}{{end}}{{template "page-head" .}}
+    {{template "page-nav" .}}
+    <main>
+      <h2>Upcoming events</h2>
+      <p class="text-sm text-muted" style="margin-bottom: 16px;">Calendar events (NIP-52) from people you follow, soonest first. Each has an .ics link for adding it to your calendar app.</p>
+      {{range .Events}}
+      <div class="card">
+        {{template "calendar-event" .}}
+        <a href="/html/thread/{{.ID}}" class="text-link text-sm">View event &rarr;</a>
+      </div>
+      {{else}}
+      <div class="empty-state">
+        <p>No upcoming events</p>
+        <p class="empty-state-hint">Nobody you follow has published a calendar event that is still to come.</p>
+      </div>
+      {{end}}
+    </main>
+    {{template "page-footer" .}}`
+
+var cachedCalendarTemplate *template.Template
+
+// htmlCalendarTemplateBlocks renders a calendar event: when and where, who
+// is taking part, RSVP counts and, for logged-in readers, the RSVP form. It's
+// added to the timeline, thread and calendar templates, which call
+// "calendar-event" with an *HTMLCalendarEvent and include "calendar-style".
+var htmlCalendarTemplateBlocks = `{{define "calendar-event"}}
+        <div class="calendar-event">
+          {{if .Image}}<img src="{{proxyImage .Image 800}}" alt="" class="calendar-event-image" loading="lazy">{{end}}
+          <div class="calendar-event-title">{{.Title}}</div>
+          <div class="calendar-event-when">🗓 {{.TimeText}}{{if .Ended}} <span class="calendar-event-ended">(ended)</span>{{end}}</div>
+          {{range .Locations}}<div class="calendar-event-where">📍 {{.}}</div>{{end}}
+          {{if .Summary}}<div class="calendar-event-summary">{{.Summary}}</div>{{end}}
+          {{if .Participants}}
+          <div class="calendar-event-participants">
+            {{range .Participants}}
+            <a href="/html/profile/{{.Npub}}" class="calendar-participant">{{if and .Profile (or .Profile.DisplayName .Profile.Name)}}{{if .Profile.DisplayName}}{{.Profile.DisplayName}}{{else}}{{.Profile.Name}}{{end}}{{else}}{{.NpubShort}}{{end}}{{if .Role}} <span class="calendar-participant-role">{{.Role}}</span>{{end}}</a>
+            {{end}}
+          </div>
+          {{end}}
+          <div class="calendar-event-rsvps">{{.Accepted}} going · {{.Tentative}} maybe · {{.Declined}} can't go{{if .Naddr}} · <a href="/calendar/{{.Naddr}}.ics" class="text-link">Add to calendar (.ics)</a>{{end}}</div>
+          {{if .CanRSVP}}
+          <form method="POST" action="/html/calendar/rsvp" class="calendar-rsvp-form">
+            <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+            <input type="hidden" name="a" value="{{.Coordinate}}">
+            <input type="hidden" name="event_id" value="{{.ID}}">
+            <input type="hidden" name="return_url" value="{{.ReturnURL}}">
+            <button type="submit" name="status" value="accepted" class="calendar-rsvp-button{{if eq .MyStatus "accepted"}} chosen{{end}}">Going</button>
+            <button type="submit" name="status" value="tentative" class="calendar-rsvp-button{{if eq .MyStatus "tentative"}} chosen{{end}}">Maybe</button>
+            <button type="submit" name="status" value="declined" class="calendar-rsvp-button{{if eq .MyStatus "declined"}} chosen{{end}}">Can't go</button>
+          </form>
+          {{end}}
+        </div>
+{{end}}{{define "calendar-style"}}
+    /* Calendar event (kind 31922/31923) styles */
+    .calendar-event { margin: 10px 0; padding: 12px; border: 1px solid var(--border-color); border-radius: 8px; background: var(--bg-secondary); }
+    .calendar-event-image { width: 100%; max-height: 220px; object-fit: cover; border-radius: 6px; margin-bottom: 8px; }
+    .calendar-event-title { font-weight: 600; font-size: 1.05rem; margin-bottom: 4px; }
+    .calendar-event-when, .calendar-event-where { font-size: 14px; color: var(--text-secondary); }
+    .calendar-event-ended { color: var(--text-muted); }
+    .calendar-event-summary { margin-top: 6px; font-size: 14px; }
+    .calendar-event-participants { display: flex; flex-wrap: wrap; gap: 6px; margin-top: 8px; }
+    .calendar-participant { font-size: 12px; padding: 2px 8px; border-radius: 10px; background: var(--bg-badge); color: var(--text-secondary); text-decoration: none; }
+    .calendar-participant-role { color: var(--text-muted); }
+    .calendar-event-rsvps { font-size: 12px; color: var(--text-muted); margin-top: 8px; }
+    .calendar-rsvp-form { display: flex; gap: 8px; flex-wrap: wrap; margin-top: 8px; }
+    .calendar-rsvp-button { padding: 4px 12px; border: 1px solid var(--border-color); border-radius: 4px; background: var(--bg-card); color: var(--text-primary); font-size: 13px; cursor: pointer; }
+    .calendar-rsvp-button.chosen { background: var(--accent); border-color: var(--accent); color: white; }
+{{end}}`
+
+// htmlCalendarHandler lists upcoming calendar events from the people the
+// user follows
+func htmlCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session := getSessionFromRequest(r)
+	if session == nil || !session.Connected {
+		http.Redirect(w, r, "/html/login?error=Please+login+first", http.StatusSeeOther)
+		return
+	}
+
+	pubkeyHex := hex.EncodeToString(session.UserPubKey)
+	readRelays, _ := sessionRelays(session)
+
+	contacts, ok := contactCache.Get(pubkeyHex)
+	if !ok {
+		contacts = fetchContactList(readRelays, pubkeyHex)
+		if contacts != nil {
+			contactCache.Set(pubkeyHex, contacts)
+		}
+	}
+	authors := dedupeStrings(append([]string{pubkeyHex}, contacts...))
+
+	fetched, _ := fetchEventsFromRelaysCached(readRelays, Filter{
+		Kinds:   []int{kindCalendarDateEvent, kindCalendarTimeEvent},
+		Authors: authors,
+		Limit:   calendarPageFetchLimit,
+	})
+
+	var events []*HTMLCalendarEvent
+	for _, evt := range newestAddressable(fetched) {
+		if cal := parseCalendarEvent(evt); cal != nil && !cal.Ended {
+			events = append(events, cal)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+	if len(events) > calendarPageMaxEvents {
+		events = events[:calendarPageMaxEvents]
+	}
+
+	data := HTMLCalendarData{
+		HTMLPageChrome: newPageChrome("Calendar", r, session, readRelays),
+		Events:         events,
+	}
+	data.NavTab = "calendar"
+	prepareCalendarEvents(events, readRelays, pubkeyHex, data.CSRFToken, "/html/calendar")
+
+	html, err := executePageTemplate(cachedCalendarTemplate, data)
+	if err != nil {
+		slog.Error("Error rendering calendar", "error", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(html))
+}
+
+// htmlCalendarRSVPHandler signs and publishes a kind 31925 RSVP
+func htmlCalendarRSVPHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/html/calendar", http.StatusSeeOther)
+		return
+	}
+
+	session := getSessionFromRequest(r)
+	if session == nil || !session.Connected {
+		http.Redirect(w, r, "/html/login?error=Please+login+first", http.StatusSeeOther)
+		return
+	}
+
+	if !validateCSRFToken(session.ID, r.FormValue("csrf_token")) {
+		http.Error(w, "Invalid or expired CSRF token", http.StatusForbidden)
+		return
+	}
+
+	returnURL := sanitizeReturnURL(strings.TrimSpace(r.FormValue("return_url")))
+	separator := "?"
+	if strings.Contains(returnURL, "?") {
+		separator = "&"
+	}
+
+	coord := strings.TrimSpace(r.FormValue("a"))
+	_, authorPubkey, _, ok := parseCalendarCoordinate(coord)
+	if !ok {
+		http.Redirect(w, r, returnURL+separator+"error=Invalid+event", http.StatusSeeOther)
+		return
+	}
+	status := r.FormValue("status")
+	valid := false
+	for _, s := range rsvpStatuses {
+		valid = valid || s == status
+	}
+	if !valid {
+		http.Redirect(w, r, returnURL+separator+"error=Invalid+RSVP+status", http.StatusSeeOther)
+		return
+	}
+
+	// The d tag is derived from the event, so changing an RSVP replaces it
+	sum := sha256.Sum256([]byte(coord))
+	tags := [][]string{
+		{"a", coord},
+		{"d", hex.EncodeToString(sum[:8])},
+		{"status", status},
+		{"p", authorPubkey},
+	}
+	if eventID := strings.TrimSpace(r.FormValue("event_id")); isValidEventID(eventID) {
+		tags = append(tags, []string{"e", eventID})
+	}
+	if status != "declined" {
+		fb := "busy"
+		if status == "tentative" {
+			fb = "free"
+		}
+		tags = append(tags, []string{"fb", fb})
+	}
+
+	event := UnsignedEvent{
+		Kind:      kindCalendarRSVP,
+		Content:   "",
+		Tags:      tags,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
+	defer cancel()
+
+	signedEvent, err := session.SignEvent(ctx, event)
+	if err != nil {
+		slog.Warn("Failed to sign RSVP", "event", coord, "error", err)
+		http.Redirect(w, r, returnURL+separator+"error="+escapeURLParam(sanitizeErrorForUser("Sign event", err)), http.StatusSeeOther)
+		return
+	}
+
+	_, writeRelays := sessionRelays(session)
+	publishEvent(ctx, writeRelays, signedEvent)
+
+	slog.Info("Published RSVP", "event", coord, "status", status)
+	http.Redirect(w, r, returnURL+separator+"success=RSVP+sent", http.StatusSeeOther)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Request coalescing: concurrent requests for the same relay data share one
+// relay round-trip instead of each fanning out on their own.
+
+// CoalescingStats counts shared relay round-trips
+type CoalescingStats struct {
+	Queries          int64 `json:"queries"`           // Filter queries started
+	QueriesIdentical int64 `json:"queries_identical"` // Joined an identical in-flight query
+	QueriesSubsumed  int64 `json:"queries_subsumed"`  // Answered from a broader in-flight query
+	ProfileLookups   int64 `json:"profile_lookups"`   // Pubkeys looked up on relays
+	ProfilesShared   int64 `json:"profiles_shared"`   // Pubkeys taken from another in-flight batch
+	ReactionLookups  int64 `json:"reaction_lookups"`  // Reaction fetches started
+	ReactionsShared  int64 `json:"reactions_shared"`  // Joined an identical in-flight reaction fetch
+}
+
+type coalescingCounters struct {
+	queries          atomic.Int64
+	queriesIdentical atomic.Int64
+	queriesSubsumed  atomic.Int64
+	profileLookups   atomic.Int64
+	profilesShared   atomic.Int64
+	reactionLookups  atomic.Int64
+	reactionsShared  atomic.Int64
+}
+
+var coalescing coalescingCounters
+
+// Snapshot returns the current counter values
+func (c *coalescingCounters) Snapshot() CoalescingStats {
+	return CoalescingStats{
+		Queries:          c.queries.Load(),
+		QueriesIdentical: c.queriesIdentical.Load(),
+		QueriesSubsumed:  c.queriesSubsumed.Load(),
+		ProfileLookups:   c.profileLookups.Load(),
+		ProfilesShared:   c.profilesShared.Load(),
+		ReactionLookups:  c.reactionLookups.Load(),
+		ReactionsShared:  c.reactionsShared.Load(),
+	}
+}
+
+// inflightQuery is a relay query other callers can wait on
+type inflightQuery struct {
+	filter Filter
+	done   chan struct{}
+	events []Event
+	eose   bool
+}
+
+// queryCoalescer tracks in-flight filter queries by shape
+type queryCoalescer struct {
+	mu       sync.Mutex
+	inflight map[string][]*inflightQuery
+}
+
+var queryGroup = &queryCoalescer{inflight: make(map[string][]*inflightQuery)}
+
+// Do runs fetch for filter unless an in-flight query with the same shape
+// already covers it, in which case it waits for that query's result
+func (c *queryCoalescer) Do(relays []string, filter Filter, fetch func() ([]Event, bool)) ([]Event, bool) {
+	key := coalesceKey(relays, filter)
+
+	c.mu.Lock()
+	for _, q := range c.inflight[key] {
+		if !filterSubsumes(q.filter, filter) {
+			continue
+		}
+		identical := filtersEqual(q.filter, filter)
+		c.mu.Unlock()
+
+		if identical {
+			coalescing.queriesIdentical.Add(1)
+		} else {
+			coalescing.queriesSubsumed.Add(1)
+		}
+		<-q.done
+		return narrowResult(q.events, filter), q.eose
+	}
+
+	q := &inflightQuery{filter: filter, done: make(chan struct{})}
+	c.inflight[key] = append(c.inflight[key], q)
+	c.mu.Unlock()
+	coalescing.queries.Add(1)
+
+	// Deferred so a panicking fetch doesn't leave waiters blocked forever
+	defer func() {
+		close(q.done)
+
+		c.mu.Lock()
+		queries := c.inflight[key]
+		for i, other := range queries {
+			if other == q {
+				queries = append(queries[:i], queries[i+1:]...)
+				break
+			}
+		}
+		if len(queries) == 0 {
+			delete(c.inflight, key)
+		} else {
+			c.inflight[key] = queries
+		}
+		c.mu.Unlock()
+	}()
+
+	q.events, q.eose = fetch()
+	return narrowResult(q.events, filter), q.eose
+}
+
+// coalesceKey is the filter shape plus its IDs; queries only share results
+// within the same key
+func coalesceKey(relays []string, filter Filter) string {
+	ids := append([]string(nil), filter.IDs...)
+	sort.Strings(ids)
+	return coverageKey(relays, filter) + "|ids:" + strings.Join(ids, ",")
+}
+
+// filterSubsumes reports whether broad (of the same shape) returns everything
+// narrow would: same until, an earlier or equal since, and at least as many
+// results
+func filterSubsumes(broad, narrow Filter) bool {
+	if (broad.Until == nil) != (narrow.Until == nil) {
+		return false
+	}
+	if broad.Until != nil && *broad.Until != *narrow.Until {
+		return false
+	}
+	if broad.Since != nil && (narrow.Since == nil || *narrow.Since < *broad.Since) {
+		return false
+	}
+	if broad.Limit > 0 && (narrow.Limit == 0 || narrow.Limit > broad.Limit) {
+		return false
+	}
+	return true
+}
+
+func filtersEqual(a, b Filter) bool {
+	return filterSubsumes(a, b) && filterSubsumes(b, a)
+}
+
+// narrowResult applies filter's since and limit to a shared result, copying
+// so callers can't modify each other's slices
+func narrowResult(events []Event, filter Filter) []Event {
+	result := make([]Event, 0, len(events))
+	for _, evt := range events {
+		if filter.Since != nil && evt.CreatedAt < *filter.Since {
+			continue
+		}
+		result = append(result, evt)
+		if filter.Limit > 0 && len(result) >= filter.Limit {
+			break
+		}
+	}
+	return result
+}
+
+// profileBatch is an in-flight profile fetch for a set of pubkeys
+type profileBatch struct {
+	done     chan struct{}
+	profiles map[string]*ProfileInfo
+}
+
+var (
+	profileInflightMu sync.Mutex
+	profileInflight   = make(map[string]*profileBatch) // pubkey -> batch fetching it
+)
+
+// fetchProfilesCoalesced fetches profiles for pubkeys, waiting on in-flight
+// batches for pubkeys someone else is already fetching and fetching only the
+// rest itself
+func fetchProfilesCoalesced(relays []string, pubkeys []string) map[string]*ProfileInfo {
+	own := &profileBatch{done: make(chan struct{})}
+	var ownPubkeys []string
+	waitFor := make(map[*profileBatch]bool)
+
+	profileInflightMu.Lock()
+	for _, pk := range pubkeys {
+		if batch, ok := profileInflight[pk]; ok {
+			waitFor[batch] = true
+			coalescing.profilesShared.Add(1)
+			continue
+		}
+		profileInflight[pk] = own
+		ownPubkeys = append(ownPubkeys, pk)
+	}
+	profileInflightMu.Unlock()
+
+	result := make(map[string]*ProfileInfo)
+	if len(ownPubkeys) > 0 {
+		coalescing.profileLookups.Add(int64(len(ownPubkeys)))
+		func() {
+			defer func() {
+				close(own.done)
+
+				profileInflightMu.Lock()
+				for _, pk := range ownPubkeys {
+					if profileInflight[pk] == own {
+						delete(profileInflight, pk)
+					}
+				}
+				profileInflightMu.Unlock()
+			}()
+			own.profiles = fetchProfilesFromRelays(relays, ownPubkeys)
+		}()
+
+		for pk, p := range own.profiles {
+			result[pk] = p
+		}
+	}
+
+	for batch := range waitFor {
+		<-batch.done
+		for _, pk := range pubkeys {
+			if p, ok := batch.profiles[pk]; ok {
+				result[pk] = p
+			}
+		}
+	}
+	return result
+}
+
+// reactionFlight is an in-flight reactions fetch
+type reactionFlight struct {
+	done   chan struct{}
+	events []Event
+	eose   bool
+}
+
+var (
+	reactionInflightMu sync.Mutex
+	reactionInflight   = make(map[string]*reactionFlight)
+)
+
+// fetchReactionEventsCoalesced shares identical in-flight reaction fetches
+func fetchReactionEventsCoalesced(relays []string, eventIDs []string, limit int, fetch func() ([]Event, bool)) ([]Event, bool) {
+	sortedRelays := append([]string(nil), relays...)
+	sort.Strings(sortedRelays)
+	sortedIDs := append([]string(nil), eventIDs...)
+	sort.Strings(sortedIDs)
+	key := strings.Join(sortedRelays, ",") + "|" + strings.Join(sortedIDs, ",") + "|" + strconv.Itoa(limit)
+
+	reactionInflightMu.Lock()
+	if flight, ok := reactionInflight[key]; ok {
+		reactionInflightMu.Unlock()
+		coalescing.reactionsShared.Add(1)
+		<-flight.done
+		// Each caller gets its own slice, as narrowResult does for queries
+		return append([]Event(nil), flight.events...), flight.eose
+	}
+	flight := &reactionFlight{done: make(chan struct{})}
+	reactionInflight[key] = flight
+	reactionInflightMu.Unlock()
+	coalescing.reactionLookups.Add(1)
+
+	// Deferred so a panicking fetch doesn't leave waiters blocked forever
+	defer func() {
+		close(flight.done)
+
+		reactionInflightMu.Lock()
+		delete(reactionInflight, key)
+		reactionInflightMu.Unlock()
+	}()
+
+	flight.events, flight.eose = fetch()
+	return append([]Event(nil), flight.events...), flight.eose
+}
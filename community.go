@@ -0,0 +1,676 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NIP-72 moderated communities. A kind 34550 event defines a community and
+// its moderators; posts carry the community's a tag, and moderators approve
+// them with kind 4550 events. Only approved posts are shown.
+
+const (
+	kindCommunity         = 34550
+	kindCommunityApproval = 4550
+	kindCommunityPost     = 1111 // NIP-22 comment, used for new community posts
+	kindCommunitiesList   = 10004
+)
+
+const (
+	communityPageLimit     = 20 // Approved posts per page
+	maxCommunityModerators = 50
+	maxCommunityRelays     = 3 // Community relay tags and naddr hints queried alongside the defaults
+	maxCommunitiesListed   = 50
+)
+
+// CommunityMember is the owner or a moderator of a community
+type CommunityMember struct {
+	Pubkey    string
+	Npub      string
+	NpubShort string
+	Profile   *ProfileInfo
+}
+
+// HTMLCommunity is a parsed kind 34550 community definition
+type HTMLCommunity struct {
+	Coordinate  string // 34550:<owner>:<d>
+	Naddr       string
+	Name        string
+	Description string
+	Image       string
+	Owner       CommunityMember
+	Moderators  []CommunityMember
+	Relays      []string // Relays the community asks posts and approvals to go to
+}
+
+// HTMLCommunityPost is an approved community post
+type HTMLCommunityPost struct {
+	ID                string
+	Pubkey            string
+	Npub              string
+	NpubShort         string
+	Profile           *ProfileInfo
+	CreatedAt         int64
+	ContentHTML       template.HTML
+	ContentWarning    string
+	HasContentWarning bool
+}
+
+// newCommunityMember fills in the npub forms of a pubkey
+func newCommunityMember(pubkey string) CommunityMember {
+	npub, _ := encodeBech32Pubkey(pubkey)
+	return CommunityMember{Pubkey: pubkey, Npub: npub, NpubShort: formatNpubShort(npub)}
+}
+
+// parseCommunity reads a kind 34550 event, or returns nil if it isn't one
+func parseCommunity(evt Event) *HTMLCommunity {
+	if evt.Kind != kindCommunity {
+		return nil
+	}
+	dTag := extractDTag(evt.Tags)
+	c := &HTMLCommunity{
+		Coordinate: fmt.Sprintf("%d:%s:%s", kindCommunity, evt.PubKey, dTag),
+		Name:       dTag,
+		Owner:      newCommunityMember(evt.PubKey),
+	}
+	c.Naddr, _ = EncodeNAddr(kindCommunity, evt.PubKey, dTag)
+
+	seen := map[string]bool{evt.PubKey: true}
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "name":
+			if name := strings.TrimSpace(tag[1]); name != "" {
+				c.Name = name
+			}
+		case "description":
+			c.Description = strings.TrimSpace(tag[1])
+		case "image":
+			if strings.HasPrefix(tag[1], "https://") || strings.HasPrefix(tag[1], "http://") {
+				c.Image = tag[1]
+			}
+		case "p":
+			// Moderators are p tags with the "moderator" role
+			if len(tag) >= 4 && tag[3] == "moderator" && isValidEventID(tag[1]) && !seen[tag[1]] &&
+				len(c.Moderators) < maxCommunityModerators {
+				seen[tag[1]] = true
+				c.Moderators = append(c.Moderators, newCommunityMember(tag[1]))
+			}
+		case "relay":
+			if relay, ok := normalizeRelayURL(tag[1]); ok && len(c.Relays) < maxCommunityRelays {
+				c.Relays = append(c.Relays, relay)
+			}
+		}
+	}
+	c.Relays = dedupeStrings(c.Relays)
+	return c
+}
+
+// approvers returns the pubkeys whose approvals count: the owner and the moderators
+func (c *HTMLCommunity) approvers() []string {
+	pubkeys := []string{c.Owner.Pubkey}
+	for _, m := range c.Moderators {
+		pubkeys = append(pubkeys, m.Pubkey)
+	}
+	return pubkeys
+}
+
+// tagsCommunity reports whether an event is posted to a community (a or A tag)
+func tagsCommunity(tags [][]string, coord string) bool {
+	for _, tag := range tags {
+		if len(tag) >= 2 && (tag[0] == "a" || tag[0] == "A") && tag[1] == coord {
+			return true
+		}
+	}
+	return false
+}
+
+// approvedPost returns the post id an approval is for, and the post itself
+// when the approval embeds it as JSON and it checks out
+func approvedPost(approval Event) (string, *Event) {
+	postID := ""
+	for _, tag := range approval.Tags {
+		if len(tag) >= 2 && tag[0] == "e" && isValidEventID(tag[1]) {
+			postID = tag[1]
+			break
+		}
+	}
+	if postID == "" {
+		return "", nil
+	}
+	var post Event
+	if err := json.Unmarshal([]byte(approval.Content), &post); err != nil || post.ID != postID {
+		return postID, nil
+	}
+	if calculateEventID(&post) != post.ID || !validateEventSignature(&post) {
+		return postID, nil
+	}
+	return postID, &post
+}
+
+// fetchCommunity looks up the newest version of a community definition
+func fetchCommunity(relays []string, pubkey, dTag string) *HTMLCommunity {
+	found := fetchReplaceable(relays, Filter{
+		Kinds:   []int{kindCommunity},
+		Authors: []string{pubkey},
+		Tags:    map[string][]string{"d": {dTag}},
+		Limit:   1,
+	}).Events
+	if len(found) == 0 {
+		return nil
+	}
+	return parseCommunity(found[0])
+}
+
+// communityRelays adds a community's relays and up to maxCommunityRelays
+// naddr hints to the reader's relays
+func communityRelays(read []string, hints []string, community *HTMLCommunity) []string {
+	relays := append([]string(nil), read...)
+	added := 0
+	for _, hint := range hints {
+		if relay, ok := normalizeRelayURL(hint); ok && added < maxCommunityRelays {
+			relays = append(relays, relay)
+			added++
+		}
+	}
+	if community != nil {
+		relays = append(relays, community.Relays...)
+	}
+	return dedupeStrings(relays)
+}
+
+// fetchApprovedPosts returns a page of posts approved by the community's
+// moderators, most recently approved first, and the until for the next page
+func fetchApprovedPosts(relays []string, c *HTMLCommunity, until *int64) ([]Event, *int64) {
+	approvals, _ := fetchEventsFromRelaysCached(relays, Filter{
+		Kinds:   []int{kindCommunityApproval},
+		Authors: c.approvers(),
+		Tags:    map[string][]string{"a": {c.Coordinate}},
+		Limit:   communityPageLimit + 1,
+		Until:   until,
+	})
+	sortEventsNewestFirst(approvals)
+
+	var next *int64
+	if len(approvals) > communityPageLimit {
+		approvals = approvals[:communityPageLimit]
+		nextUntil := approvals[len(approvals)-1].CreatedAt
+		next = &nextUntil
+	}
+
+	var order []string
+	posts := make(map[string]*Event)
+	var missing []string
+	for _, approval := range approvals {
+		postID, post := approvedPost(approval)
+		if postID == "" || containsString(order, postID) {
+			continue
+		}
+		order = append(order, postID)
+		if post != nil {
+			posts[postID] = post
+		} else {
+			missing = append(missing, postID)
+		}
+	}
+	if len(missing) > 0 {
+		fetched, _ := fetchEventsFromRelaysCached(relays, Filter{IDs: missing, Limit: len(missing)})
+		for i := range fetched {
+			posts[fetched[i].ID] = &fetched[i]
+		}
+	}
+
+	var events []Event
+	for _, id := range order {
+		if post, ok := posts[id]; ok && tagsCommunity(post.Tags, c.Coordinate) {
+			events = append(events, *post)
+		}
+	}
+	return events, next
+}
+
+// HTMLCommunityData is the data for a community page
+type HTMLCommunityData struct {
+	HTMLPageChrome
+	Community  *HTMLCommunity
+	Posts      []HTMLCommunityPost
+	Pagination *HTMLPagination
+	ReturnURL  string
+	Naddr      string // As requested, so posting finds the community through the same relay hints
+}
+
+var htmlCommunityTemplate = `{{define "page-style"}}{{template "emoji-style"}}{{template "community-style"}}{{end}}{{template "page-head" .}}
+    {{template "page-nav" .}}
+    <main>
+      {{with .Community}}
+      <div class="card community-header">
+        {{if .Image}}<img src="{{proxyImage .Image 800}}" alt="" class="community-image" loading="lazy">{{end}}
+        <h2>{{.Name}}</h2>
+        {{if .Description}}<p class="community-description">{{.Description}}</p>{{end}}
+        <div class="text-sm community-moderators">
+          Owner: <a href="/html/profile/{{.Owner.Npub}}" class="text-link">{{template "community-member" .Owner}}</a>
+          {{if .Moderators}} · Moderators: {{range $i, $m := .Moderators}}{{if $i}}, {{end}}<a href="/html/profile/{{$m.Npub}}" class="text-link">{{template "community-member" $m}}</a>{{end}}{{end}}
+        </div>
+      </div>
+      {{end}}
+      {{if .LoggedIn}}
+      <form method="POST" action="/html/community/post" class="card">
+        <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+        <input type="hidden" name="naddr" value="{{.Naddr}}">
+        <input type="hidden" name="return_url" value="{{.ReturnURL}}">
+        <label for="community-content" class="sr-only">Post to {{.Community.Name}}</label>
+        <textarea id="community-content" name="content" class="text-input wide" rows="3" placeholder="Post to {{.Community.Name}}" required></textarea>
+        <div class="form-row" style="margin-top: 8px;">
+          <label class="text-sm"><input type="checkbox" name="cw" value="1"> Content warning</label>
+          <label for="community-cw" class="sr-only">Content warning reason</label>
+          <input id="community-cw" type="text" name="content_warning" class="text-input" placeholder="Warning reason (optional)" maxlength="200">
+          <button type="submit" class="primary-btn">Submit post</button>
+          <span class="text-sm text-muted">Posts appear once a moderator approves them.</span>
+        </div>
+      </form>
+      {{end}}
+      <h3>Approved posts</h3>
+      {{range .Posts}}
+      <article class="card">
+        <div class="text-sm">
+          <a href="/html/profile/{{.Npub}}" class="card-title">{{if and .Profile (or .Profile.DisplayName .Profile.Name)}}{{if .Profile.DisplayName}}{{.Profile.DisplayName}}{{else}}{{.Profile.Name}}{{end}}{{else}}{{.NpubShort}}{{end}}</a>
+          <a href="/html/thread/{{.ID}}" class="card-meta">{{formatTime .CreatedAt}}</a>
+        </div>
+        {{if .HasContentWarning}}
+        <details class="community-cw">
+          <summary>Content warning{{if .ContentWarning}}: {{.ContentWarning}}{{end}}</summary>
+          <div class="community-post-content">{{.ContentHTML}}</div>
+        </details>
+        {{else}}
+        <div class="community-post-content">{{.ContentHTML}}</div>
+        {{end}}
+        <a href="/html/thread/{{.ID}}" class="text-link text-sm">Replies &rarr;</a>
+      </article>
+      {{else}}
+      <div class="empty-state">
+        <p>No approved posts yet.</p>
+      </div>
+      {{end}}
+      {{if .Pagination}}
+      <div class="pagination">
+        <a href="{{.Pagination.Next}}" class="link">Older &rarr;</a>
+      </div>
+      {{end}}
+    </main>
+    {{template "page-footer" .}}`
+
+// htmlCommunityBlocks are shared by the community and communities pages
+var htmlCommunityBlocks = `{{define "community-member"}}{{if and .Profile (or .Profile.DisplayName .Profile.Name)}}{{if .Profile.DisplayName}}{{.Profile.DisplayName}}{{else}}{{.Profile.Name}}{{end}}{{else}}{{.NpubShort}}{{end}}{{end}}
+{{define "community-style"}}
+    .community-image { width: 100%; max-height: 240px; object-fit: cover; border-radius: 6px; margin-bottom: 10px; }
+    .community-description { color: var(--text-secondary); white-space: pre-wrap; margin-bottom: 8px; }
+    .community-moderators { color: var(--text-secondary); }
+    .community-post-content { margin: 8px 0; white-space: pre-wrap; word-break: break-word; }
+    .community-post-content img, .community-post-content video { max-width: 100%; height: auto; border-radius: 6px; }
+    .community-cw summary { cursor: pointer; color: var(--text-secondary); font-size: 13px; margin: 8px 0; }
+    .community-list-item { display: flex; justify-content: space-between; align-items: center; gap: 8px; }
+{{end}}`
+
+var cachedCommunityTemplate *template.Template
+
+// htmlCommunityHandler shows a community: /html/community/{naddr}?until=...
+func htmlCommunityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	naddr := strings.TrimPrefix(r.URL.Path, "/html/community/")
+	if naddr == "" {
+		// The "open a community" form on the communities page
+		naddr = strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("naddr")), "nostr:")
+		if naddr == "" {
+			http.Redirect(w, r, "/html/communities", http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/html/community/"+url.PathEscape(naddr), http.StatusSeeOther)
+		return
+	}
+	addr, err := DecodeNAddr(naddr)
+	if err != nil || addr.Kind != kindCommunity {
+		http.Error(w, "Invalid community address", http.StatusBadRequest)
+		return
+	}
+
+	session := getSessionFromRequest(r)
+	readRelays, _ := sessionRelays(session)
+	relays := communityRelays(readRelays, addr.RelayHints, nil)
+
+	community := fetchCommunity(relays, addr.Author, addr.DTag)
+	if community == nil {
+		http.Error(w, "Community not found", http.StatusNotFound)
+		return
+	}
+	relays = communityRelays(relays, nil, community)
+
+	until := parseInt64(r.URL.Query().Get("until"))
+	events, next := fetchApprovedPosts(relays, community, until)
+
+	pubkeys := community.approvers()
+	for _, evt := range events {
+		pubkeys = append(pubkeys, evt.PubKey)
+	}
+	profiles := fetchProfiles(profileRelays(), dedupeStrings(pubkeys))
+	community.Owner.Profile = profiles[community.Owner.Pubkey]
+	for i := range community.Moderators {
+		community.Moderators[i].Profile = profiles[community.Moderators[i].Pubkey]
+	}
+
+	media := newMediaBlur(r, session)
+	posts := make([]HTMLCommunityPost, len(events))
+	for i, evt := range events {
+		npub, _ := encodeBech32Pubkey(evt.PubKey)
+		post := HTMLCommunityPost{
+			ID:          evt.ID,
+			Pubkey:      evt.PubKey,
+			Npub:        npub,
+			NpubShort:   formatNpubShort(npub),
+			Profile:     profiles[evt.PubKey],
+			CreatedAt:   evt.CreatedAt,
+			ContentHTML: template.HTML(replaceCustomEmoji(string(processContentToHTML(evt.Content)), emojiTags(evt.Tags))),
+		}
+		post.ContentWarning, post.HasContentWarning = extractContentWarning(evt.Tags)
+		if media.blurs(evt.PubKey) {
+			post.ContentHTML = blurMediaHTML(post.ContentHTML)
+		}
+		posts[i] = post
+	}
+
+	returnURL := "/html/community/" + naddr
+	data := HTMLCommunityData{
+		HTMLPageChrome: newPageChrome(community.Name, r, session, readRelays),
+		Community:      community,
+		Posts:          posts,
+		ReturnURL:      returnURL,
+		Naddr:          naddr,
+	}
+	data.NavTab = "communities"
+	if next != nil {
+		data.Pagination = &HTMLPagination{Next: fmt.Sprintf("%s?until=%d", returnURL, *next)}
+	}
+
+	html, err := executePageTemplate(cachedCommunityTemplate, data)
+	if err != nil {
+		slog.Error("Error rendering community", "error", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(html))
+}
+
+// htmlCommunityPostHandler signs and publishes a post to a community. New
+// posts are NIP-22 comments on the community, tagged with its coordinate as
+// both root (A) and parent (a).
+func htmlCommunityPostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/html/communities", http.StatusSeeOther)
+		return
+	}
+
+	session := getSessionFromRequest(r)
+	if session == nil || !session.Connected {
+		http.Redirect(w, r, "/html/login?error=Please+login+first", http.StatusSeeOther)
+		return
+	}
+
+	if !validateCSRFToken(session.ID, r.FormValue("csrf_token")) {
+		http.Error(w, "Invalid or expired CSRF token", http.StatusForbidden)
+		return
+	}
+
+	returnURL := sanitizeReturnURL(strings.TrimSpace(r.FormValue("return_url")))
+	separator := "?"
+	if strings.Contains(returnURL, "?") {
+		separator = "&"
+	}
+
+	addr, err := DecodeNAddr(strings.TrimSpace(r.FormValue("naddr")))
+	if err != nil || addr.Kind != kindCommunity {
+		http.Redirect(w, r, returnURL+separator+"error=Invalid+community", http.StatusSeeOther)
+		return
+	}
+	content := strings.TrimSpace(r.FormValue("content"))
+	if content == "" {
+		http.Redirect(w, r, returnURL+separator+"error=Post+content+is+required", http.StatusSeeOther)
+		return
+	}
+
+	readRelays, writeRelays := sessionRelays(session)
+	// Look in the same places the community page did
+	community := fetchCommunity(communityRelays(readRelays, addr.RelayHints, nil), addr.Author, addr.DTag)
+	if community == nil {
+		http.Redirect(w, r, returnURL+separator+"error=Community+not+found", http.StatusSeeOther)
+		return
+	}
+
+	relayHint := ""
+	if len(community.Relays) > 0 {
+		relayHint = community.Relays[0]
+	}
+	kind := fmt.Sprint(kindCommunity)
+	tags := [][]string{
+		{"A", community.Coordinate, relayHint},
+		{"a", community.Coordinate, relayHint},
+		{"P", community.Owner.Pubkey},
+		{"p", community.Owner.Pubkey},
+		{"K", kind},
+		{"k", kind},
+	}
+	if cw := contentWarningTag(r); cw != nil {
+		tags = append(tags, cw)
+	}
+
+	event := UnsignedEvent{
+		Kind:      kindCommunityPost,
+		Content:   content,
+		Tags:      tags,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
+	defer cancel()
+
+	signedEvent, err := session.SignEvent(ctx, event)
+	if err != nil {
+		slog.Warn("Failed to sign community post", "community", community.Coordinate, "error", err)
+		http.Redirect(w, r, returnURL+separator+"error="+escapeURLParam(sanitizeErrorForUser("Sign event", err)), http.StatusSeeOther)
+		return
+	}
+
+	publishEvent(ctx, dedupeStrings(append(append([]string(nil), writeRelays...), community.Relays...)), signedEvent)
+
+	slog.Info("Published community post", "event", signedEvent.ID, "community", community.Coordinate)
+	http.Redirect(w, r, returnURL+separator+"success="+escapeURLParam("Post submitted; it will appear once a moderator approves it"), http.StatusSeeOther)
+}
+
+// HTMLCommunityListItem is a community or group on the communities page
+type HTMLCommunityListItem struct {
+	Name string
+	URL  string
+	Note string // The group's relay, or the community's description
+}
+
+// HTMLCommunitiesData is the data for the communities page
+type HTMLCommunitiesData struct {
+	HTMLPageChrome
+	Communities []HTMLCommunityListItem
+	Groups      []HTMLCommunityListItem
+}
+
+var htmlCommunitiesTemplate = `{{define "page-style"}}{{template "community-style"}}{{end}}{{template "page-head" .}}
+    {{template "page-nav" .}}
+    <main>
+      <h2>Communities</h2>
+      <p class="text-sm text-muted" style="margin-bottom: 12px;">Moderated communities (NIP-72) from your kind 10004 list.</p>
+      {{range .Communities}}
+      <div class="card community-list-item">
+        <div>
+          <a href="{{.URL}}" class="card-title">{{.Name}}</a>
+          {{if .Note}}<div class="card-meta">{{.Note}}</div>{{end}}
+        </div>
+      </div>
+      {{else}}
+      <p class="text-sm text-muted">You haven't joined any communities.</p>
+      {{end}}
+      <form method="GET" action="/html/community/" class="form-row" style="margin-top: 12px;">
+        <label for="community-naddr" class="sr-only">Community address</label>
+        <input id="community-naddr" type="text" name="naddr" class="text-input wide" placeholder="naddr1… of a community" required>
+        <button type="submit" class="secondary-btn">Open</button>
+      </form>
+
+      <h2 style="margin-top: 24px;">Group chats</h2>
+      <p class="text-sm text-muted" style="margin-bottom: 12px;">Relay-based groups (NIP-29) from your kind 10009 list.</p>
+      {{range .Groups}}
+      <div class="card community-list-item">
+        <div>
+          <a href="{{.URL}}" class="card-title">{{.Name}}</a>
+          <div class="card-meta">{{.Note}}</div>
+        </div>
+      </div>
+      {{else}}
+      <p class="text-sm text-muted">You haven't saved any groups.</p>
+      {{end}}
+      <form method="GET" action="/html/group" class="form-row" style="margin-top: 12px;">
+        <label for="group-relay" class="sr-only">Group relay</label>
+        <input id="group-relay" type="text" name="relay" class="text-input" placeholder="wss://groups.example.com" required>
+        <label for="group-id" class="sr-only">Group id</label>
+        <input id="group-id" type="text" name="id" class="text-input" placeholder="group id" required>
+        <button type="submit" class="secondary-btn">Open</button>
+      </form>
+    </main>
+    {{template "page-footer" .}}`
+
+var cachedCommunitiesTemplate *template.Template
+
+// htmlCommunitiesHandler lists the communities (kind 10004) and groups
+// (kind 10009) the user follows
+func htmlCommunitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session := getSessionFromRequest(r)
+	if session == nil || !session.Connected {
+		http.Redirect(w, r, "/html/login?error=Please+login+first", http.StatusSeeOther)
+		return
+	}
+
+	pubkeyHex := hex.EncodeToString(session.UserPubKey)
+	readRelays, writeRelays := sessionRelays(session)
+	relays := dedupeStrings(append(append([]string(nil), readRelays...), writeRelays...))
+
+	var communities, groups []HTMLCommunityListItem
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		communities = followedCommunities(relays, pubkeyHex)
+	}()
+	go func() {
+		defer wg.Done()
+		groups = savedGroups(relays, pubkeyHex)
+	}()
+	wg.Wait()
+
+	data := HTMLCommunitiesData{
+		HTMLPageChrome: newPageChrome("Communities", r, session, readRelays),
+		Communities:    communities,
+		Groups:         groups,
+	}
+	data.NavTab = "communities"
+
+	html, err := executePageTemplate(cachedCommunitiesTemplate, data)
+	if err != nil {
+		slog.Error("Error rendering communities", "error", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(html))
+}
+
+// followedCommunities returns the communities in a user's kind 10004 list,
+// with names from their definitions
+func followedCommunities(relays []string, pubkey string) []HTMLCommunityListItem {
+	lists := fetchReplaceable(relays, Filter{
+		Kinds:   []int{kindCommunitiesList},
+		Authors: []string{pubkey},
+		Limit:   1,
+	}).Events
+	if len(lists) == 0 {
+		return nil
+	}
+
+	var coords, authors, dTags []string
+	for _, tag := range lists[0].Tags {
+		if len(tag) < 2 || tag[0] != "a" || len(coords) >= maxCommunitiesListed {
+			continue
+		}
+		parts := strings.SplitN(tag[1], ":", 3)
+		if len(parts) != 3 || parts[0] != fmt.Sprint(kindCommunity) || !isValidEventID(parts[1]) || containsString(coords, tag[1]) {
+			continue
+		}
+		coords = append(coords, tag[1])
+		authors = append(authors, parts[1])
+		dTags = append(dTags, parts[2])
+	}
+	if len(coords) == 0 {
+		return nil
+	}
+
+	defs := make(map[string]*HTMLCommunity)
+	for _, evt := range fetchReplaceable(relays, Filter{
+		Kinds:   []int{kindCommunity},
+		Authors: dedupeStrings(authors),
+		Tags:    map[string][]string{"d": dedupeStrings(dTags)},
+		Limit:   len(coords) * 2,
+	}).Events {
+		if c := parseCommunity(evt); c != nil {
+			defs[c.Coordinate] = c
+		}
+	}
+
+	items := make([]HTMLCommunityListItem, 0, len(coords))
+	for i, coord := range coords {
+		naddr, err := EncodeNAddr(kindCommunity, authors[i], dTags[i])
+		if err != nil {
+			continue
+		}
+		item := HTMLCommunityListItem{Name: dTags[i], URL: "/html/community/" + naddr}
+		if c, ok := defs[coord]; ok {
+			item.Name = c.Name
+			item.Note = c.Description
+			if runes := []rune(item.Note); len(runes) > 140 {
+				item.Note = string(runes[:140]) + "…"
+			}
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return strings.ToLower(items[i].Name) < strings.ToLower(items[j].Name)
+	})
+	return items
+}
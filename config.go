@@ -0,0 +1,603 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Deployment settings: the relay sets, timeouts, cache budgets and limits.
+// They're read from a JSON file (CONFIG_FILE, default config.json) and then
+// environment overrides, once at startup and again on SIGHUP. A reload that
+// fails validation keeps the running config.
+
+// Config holds the settings that can change without a rebuild
+type Config struct {
+	Relays     RelayConfig
+	Timeouts   TimeoutConfig
+	CacheMB    map[string]int // Per-cache budgets by cache name, e.g. "profiles"
+	Limits     LimitConfig
+	RateLimits RateLimitConfig
+	TrustProxy bool // Take the client IP from X-Forwarded-For (behind a reverse proxy)
+	ImageCache ImageCacheConfig
+	Schedule   ScheduleConfig
+}
+
+// RelayConfig holds the default relay sets used when a request or session
+// doesn't name its own
+type RelayConfig struct {
+	Default      []string // Read relays for timelines, threads and profiles
+	Publish      []string // Write relays for logged-in users without a NIP-65 list
+	Indexers     []string // Relay list (kind 10002) lookups and publishing
+	Profile      []string // Tried first for kind 0 lookups
+	NostrConnect []string // NIP-46 nostrconnect:// listener and login URLs
+}
+
+// TimeoutConfig holds how long relay operations wait
+type TimeoutConfig struct {
+	Query       time.Duration // Plain REQ queries
+	Replaceable time.Duration // Replaceable lookups waiting for an EOSE quorum
+	Count       time.Duration // NIP-45 COUNT requests
+	DVM         time.Duration // NIP-90 feed requests
+	Sign        time.Duration // Remote signer round trips
+}
+
+// LimitConfig holds request limits
+type LimitConfig struct {
+	MaxPageSize         int // Largest accepted ?limit=
+	MaxRelaysPerRequest int // Distinct relays a request may name with ?relays=
+	MaxPoolConnections  int // Pooled relay connections, not counting configured relays
+}
+
+// RateLimitConfig holds the per-client token buckets
+type RateLimitConfig struct {
+	Read         RateLimit // GET requests
+	CustomRelays RateLimit // Relays outside the configured sets named with ?relays=
+	LinkPreviews RateLimit // Link preview fetches that miss the cache
+	Images       RateLimit // Image proxy fetches that miss the cache
+}
+
+// RateLimit is a token bucket refilled at PerMinute and holding up to
+// Burst tokens. PerMinute 0 disables the limit.
+type RateLimit struct {
+	PerMinute float64 `json:"per_minute"`
+	Burst     int     `json:"burst"`
+}
+
+// ImageCacheConfig holds where the image proxy keeps resized images
+type ImageCacheConfig struct {
+	Dir   string
+	MaxMB int
+}
+
+// ScheduleConfig holds where scheduled posts wait to be published. The file
+// is read when the server starts, so changing it needs a restart.
+type ScheduleConfig struct {
+	File string
+}
+
+// configFile is the on-disk JSON shape; timeouts are Go duration strings
+type configFile struct {
+	Relays struct {
+		Default      []string `json:"default"`
+		Publish      []string `json:"publish"`
+		Indexers     []string `json:"indexers"`
+		Profile      []string `json:"profile"`
+		NostrConnect []string `json:"nostrconnect"`
+	} `json:"relays"`
+	Timeouts struct {
+		Query       string `json:"query"`
+		Replaceable string `json:"replaceable"`
+		Count       string `json:"count"`
+		DVM         string `json:"dvm"`
+		Sign        string `json:"sign"`
+	} `json:"timeouts"`
+	CacheMB map[string]int `json:"cache_mb"`
+	Limits  struct {
+		MaxPageSize         int `json:"max_page_size"`
+		MaxRelaysPerRequest int `json:"max_relays_per_request"`
+		MaxPoolConnections  int `json:"max_pool_connections"`
+	} `json:"limits"`
+	RateLimits struct {
+		Read         *RateLimit `json:"read"`
+		CustomRelays *RateLimit `json:"custom_relays"`
+		LinkPreviews *RateLimit `json:"link_previews"`
+		Images       *RateLimit `json:"images"`
+	} `json:"rate_limits"`
+	TrustProxy *bool `json:"trust_proxy"`
+	ImageCache struct {
+		Dir   string `json:"dir"`
+		MaxMB int    `json:"max_mb"`
+	} `json:"image_cache"`
+	Schedule struct {
+		File string `json:"file"`
+	} `json:"schedule"`
+}
+
+// defaultConfig returns the built-in settings used for anything the file
+// and environment leave out
+func defaultConfig() *Config {
+	return &Config{
+		Relays: RelayConfig{
+			Default: []string{
+				"wss://relay.damus.io",
+				"wss://relay.nostr.band",
+				"wss://relay.primal.net",
+				"wss://nos.lol",
+				"wss://nostr.mom",
+			},
+			Publish: []string{
+				"wss://relay.damus.io",
+				"wss://relay.nostr.band",
+				"wss://relay.primal.net",
+				"wss://nos.lol",
+			},
+			Indexers: []string{
+				"wss://purplepag.es",
+				"wss://relay.nostr.band",
+				"wss://relay.damus.io",
+			},
+			Profile: []string{
+				"wss://purplepag.es",
+			},
+			NostrConnect: []string{
+				"wss://relay.nsec.app",
+				"wss://relay.damus.io",
+			},
+		},
+		Timeouts: TimeoutConfig{
+			Query:       1500 * time.Millisecond,
+			Replaceable: 4 * time.Second,
+			Count:       2 * time.Second,
+			DVM:         12 * time.Second,
+			Sign:        30 * time.Second,
+		},
+		CacheMB: map[string]int{},
+		Limits: LimitConfig{
+			MaxPageSize:         200,
+			MaxRelaysPerRequest: 10,
+			MaxPoolConnections:  200,
+		},
+		RateLimits: RateLimitConfig{
+			Read:         RateLimit{PerMinute: 120, Burst: 60},
+			CustomRelays: RateLimit{PerMinute: 20, Burst: 10},
+			LinkPreviews: RateLimit{PerMinute: 60, Burst: 30},
+			Images:       RateLimit{PerMinute: 300, Burst: 150},
+		},
+		ImageCache: ImageCacheConfig{
+			Dir:   filepath.Join(os.TempDir(), "nostr-hypermedia-images"),
+			MaxMB: 512,
+		},
+		Schedule: ScheduleConfig{
+			File: "scheduled-events.json",
+		},
+	}
+}
+
+var activeConfig atomic.Pointer[Config]
+
+func init() {
+	activeConfig.Store(defaultConfig())
+}
+
+// currentConfig returns the active config; callers must not modify it
+func currentConfig() *Config {
+	return activeConfig.Load()
+}
+
+// defaultReadRelays returns a copy of the default read relays
+func defaultReadRelays() []string {
+	return append([]string(nil), currentConfig().Relays.Default...)
+}
+
+// defaultPublishRelays returns a copy of the default write relays
+func defaultPublishRelays() []string {
+	return append([]string(nil), currentConfig().Relays.Publish...)
+}
+
+// indexerRelays returns a copy of the relay list indexers
+func indexerRelays() []string {
+	return append([]string(nil), currentConfig().Relays.Indexers...)
+}
+
+// profileRelays returns a copy of the relays tried first for profiles
+func profileRelays() []string {
+	return append([]string(nil), currentConfig().Relays.Profile...)
+}
+
+// nostrConnectRelays returns a copy of the NIP-46 nostrconnect relays
+func nostrConnectRelays() []string {
+	return append([]string(nil), currentConfig().Relays.NostrConnect...)
+}
+
+// isConfiguredRelay reports whether a relay URL is in any of the configured
+// relay sets
+func isConfiguredRelay(relayURL string) bool {
+	relayURL, ok := normalizeRelayURL(relayURL)
+	if !ok {
+		return false
+	}
+	r := currentConfig().Relays
+	for _, set := range [][]string{r.Default, r.Publish, r.Indexers, r.Profile, r.NostrConnect} {
+		for _, configured := range set {
+			if configured == relayURL {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// configPath returns the config file path and whether it was set explicitly
+func configPath() (string, bool) {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path, true
+	}
+	return "config.json", false
+}
+
+// loadConfig builds a config from the defaults, the config file and the
+// environment, in that order of increasing precedence
+func loadConfig() (*Config, error) {
+	cfg := defaultConfig()
+
+	path, explicit := configPath()
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := applyConfigFile(cfg, data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+		// No config file; defaults and environment only
+	default:
+		return nil, err
+	}
+
+	if err := applyConfigEnv(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyConfigFile overlays the settings present in a JSON config file
+func applyConfigFile(cfg *Config, data []byte) error {
+	var file configFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return err
+	}
+
+	relaySets := []struct {
+		dst *[]string
+		src []string
+	}{
+		{&cfg.Relays.Default, file.Relays.Default},
+		{&cfg.Relays.Publish, file.Relays.Publish},
+		{&cfg.Relays.Indexers, file.Relays.Indexers},
+		{&cfg.Relays.Profile, file.Relays.Profile},
+		{&cfg.Relays.NostrConnect, file.Relays.NostrConnect},
+	}
+	for _, set := range relaySets {
+		if set.src != nil {
+			*set.dst = set.src
+		}
+	}
+
+	timeouts := []struct {
+		name string
+		dst  *time.Duration
+		src  string
+	}{
+		{"timeouts.query", &cfg.Timeouts.Query, file.Timeouts.Query},
+		{"timeouts.replaceable", &cfg.Timeouts.Replaceable, file.Timeouts.Replaceable},
+		{"timeouts.count", &cfg.Timeouts.Count, file.Timeouts.Count},
+		{"timeouts.dvm", &cfg.Timeouts.DVM, file.Timeouts.DVM},
+		{"timeouts.sign", &cfg.Timeouts.Sign, file.Timeouts.Sign},
+	}
+	for _, t := range timeouts {
+		if t.src == "" {
+			continue
+		}
+		d, err := time.ParseDuration(t.src)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.name, err)
+		}
+		*t.dst = d
+	}
+
+	for name, mb := range file.CacheMB {
+		cfg.CacheMB[name] = mb
+	}
+	limits := []struct {
+		dst *int
+		src int
+	}{
+		{&cfg.Limits.MaxPageSize, file.Limits.MaxPageSize},
+		{&cfg.Limits.MaxRelaysPerRequest, file.Limits.MaxRelaysPerRequest},
+		{&cfg.Limits.MaxPoolConnections, file.Limits.MaxPoolConnections},
+	}
+	for _, l := range limits {
+		if l.src != 0 {
+			*l.dst = l.src
+		}
+	}
+
+	rateLimits := []struct {
+		dst *RateLimit
+		src *RateLimit
+	}{
+		{&cfg.RateLimits.Read, file.RateLimits.Read},
+		{&cfg.RateLimits.CustomRelays, file.RateLimits.CustomRelays},
+		{&cfg.RateLimits.LinkPreviews, file.RateLimits.LinkPreviews},
+		{&cfg.RateLimits.Images, file.RateLimits.Images},
+	}
+	for _, rl := range rateLimits {
+		if rl.src != nil {
+			*rl.dst = *rl.src
+		}
+	}
+	if file.TrustProxy != nil {
+		cfg.TrustProxy = *file.TrustProxy
+	}
+	if file.ImageCache.Dir != "" {
+		cfg.ImageCache.Dir = file.ImageCache.Dir
+	}
+	if file.ImageCache.MaxMB != 0 {
+		cfg.ImageCache.MaxMB = file.ImageCache.MaxMB
+	}
+	if file.Schedule.File != "" {
+		cfg.Schedule.File = file.Schedule.File
+	}
+	return nil
+}
+
+// applyConfigEnv overlays environment overrides. Relay sets are
+// comma-separated URLs and timeouts are Go durations such as "1.5s".
+// CACHE_<NAME>_MB budgets are read by the caches themselves.
+func applyConfigEnv(cfg *Config) error {
+	relaySets := []struct {
+		env string
+		dst *[]string
+	}{
+		{"RELAYS_DEFAULT", &cfg.Relays.Default},
+		{"RELAYS_PUBLISH", &cfg.Relays.Publish},
+		{"RELAYS_INDEXERS", &cfg.Relays.Indexers},
+		{"RELAYS_PROFILE", &cfg.Relays.Profile},
+		{"RELAYS_NOSTRCONNECT", &cfg.Relays.NostrConnect},
+	}
+	for _, set := range relaySets {
+		if v := os.Getenv(set.env); v != "" {
+			*set.dst = parseStringList(v)
+		}
+	}
+
+	timeouts := []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"TIMEOUT_QUERY", &cfg.Timeouts.Query},
+		{"TIMEOUT_REPLACEABLE", &cfg.Timeouts.Replaceable},
+		{"TIMEOUT_COUNT", &cfg.Timeouts.Count},
+		{"TIMEOUT_DVM", &cfg.Timeouts.DVM},
+		{"TIMEOUT_SIGN", &cfg.Timeouts.Sign},
+	}
+	for _, t := range timeouts {
+		v := os.Getenv(t.env)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.env, err)
+		}
+		*t.dst = d
+	}
+
+	ints := []struct {
+		env string
+		dst *int
+	}{
+		{"MAX_PAGE_SIZE", &cfg.Limits.MaxPageSize},
+		{"MAX_RELAYS_PER_REQUEST", &cfg.Limits.MaxRelaysPerRequest},
+		{"MAX_POOL_CONNECTIONS", &cfg.Limits.MaxPoolConnections},
+		{"IMAGE_CACHE_MB", &cfg.ImageCache.MaxMB},
+	}
+	for _, i := range ints {
+		v := os.Getenv(i.env)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", i.env, err)
+		}
+		*i.dst = n
+	}
+
+	rates := []struct {
+		env string
+		dst *float64
+	}{
+		{"RATE_READ_PER_MIN", &cfg.RateLimits.Read.PerMinute},
+		{"RATE_CUSTOM_RELAYS_PER_MIN", &cfg.RateLimits.CustomRelays.PerMinute},
+		{"RATE_LINK_PREVIEWS_PER_MIN", &cfg.RateLimits.LinkPreviews.PerMinute},
+		{"RATE_IMAGES_PER_MIN", &cfg.RateLimits.Images.PerMinute},
+	}
+	for _, r := range rates {
+		v := os.Getenv(r.env)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.env, err)
+		}
+		*r.dst = n
+	}
+
+	if v := os.Getenv("TRUST_PROXY"); v != "" {
+		trust, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("TRUST_PROXY: %w", err)
+		}
+		cfg.TrustProxy = trust
+	}
+	if v := os.Getenv("IMAGE_CACHE_DIR"); v != "" {
+		cfg.ImageCache.Dir = v
+	}
+	if v := os.Getenv("SCHEDULE_FILE"); v != "" {
+		cfg.Schedule.File = v
+	}
+	return nil
+}
+
+// validate normalizes relay URLs and rejects settings the server can't run with
+func (cfg *Config) validate() error {
+	relaySets := []struct {
+		name string
+		set  *[]string
+	}{
+		{"relays.default", &cfg.Relays.Default},
+		{"relays.publish", &cfg.Relays.Publish},
+		{"relays.indexers", &cfg.Relays.Indexers},
+		{"relays.profile", &cfg.Relays.Profile},
+		{"relays.nostrconnect", &cfg.Relays.NostrConnect},
+	}
+	for _, rs := range relaySets {
+		var urls []string
+		for _, raw := range *rs.set {
+			u, ok := normalizeRelayURL(raw)
+			if !ok {
+				return fmt.Errorf("%s: invalid relay URL %q", rs.name, raw)
+			}
+			urls = append(urls, u)
+		}
+		urls = dedupeStrings(urls)
+		if len(urls) == 0 && rs.name != "relays.profile" {
+			return fmt.Errorf("%s: at least one relay is required", rs.name)
+		}
+		*rs.set = urls
+	}
+
+	timeouts := map[string]time.Duration{
+		"query":       cfg.Timeouts.Query,
+		"replaceable": cfg.Timeouts.Replaceable,
+		"count":       cfg.Timeouts.Count,
+		"dvm":         cfg.Timeouts.DVM,
+		"sign":        cfg.Timeouts.Sign,
+	}
+	for name, d := range timeouts {
+		if d <= 0 || d > 5*time.Minute {
+			return fmt.Errorf("timeouts.%s: %v is outside (0, 5m]", name, d)
+		}
+	}
+
+	for name, mb := range cfg.CacheMB {
+		if mb <= 0 {
+			return fmt.Errorf("cache_mb.%s: must be positive", name)
+		}
+	}
+	if cfg.Limits.MaxPageSize < 1 || cfg.Limits.MaxPageSize > 1000 {
+		return fmt.Errorf("limits.max_page_size: %d is outside [1, 1000]", cfg.Limits.MaxPageSize)
+	}
+	if cfg.Limits.MaxRelaysPerRequest < 1 {
+		return fmt.Errorf("limits.max_relays_per_request: must be positive")
+	}
+	if cfg.Limits.MaxPoolConnections < 1 {
+		return fmt.Errorf("limits.max_pool_connections: must be positive")
+	}
+
+	rateLimits := map[string]RateLimit{
+		"read":          cfg.RateLimits.Read,
+		"custom_relays": cfg.RateLimits.CustomRelays,
+		"link_previews": cfg.RateLimits.LinkPreviews,
+		"images":        cfg.RateLimits.Images,
+	}
+	for name, rl := range rateLimits {
+		if rl.PerMinute < 0 {
+			return fmt.Errorf("rate_limits.%s.per_minute: must not be negative", name)
+		}
+		if rl.PerMinute > 0 && rl.Burst < 1 {
+			return fmt.Errorf("rate_limits.%s.burst: must be at least 1", name)
+		}
+	}
+	if cfg.ImageCache.Dir == "" {
+		return fmt.Errorf("image_cache.dir: must not be empty")
+	}
+	if cfg.ImageCache.MaxMB < 1 {
+		return fmt.Errorf("image_cache.max_mb: must be positive")
+	}
+	return nil
+}
+
+// applyCacheBudgets resizes registered caches to the config's budgets. A
+// CACHE_<NAME>_MB environment variable wins; caches the config doesn't
+// mention go back to their built-in budget.
+func applyCacheBudgets(cfg *Config) {
+	known := make(map[string]bool)
+	for _, c := range registeredCaches() {
+		name := c.provider.Stats().Name
+		known[name] = true
+		if os.Getenv("CACHE_"+strings.ToUpper(name)+"_MB") != "" {
+			continue
+		}
+		budget := c.defaultBytes
+		if mb, ok := cfg.CacheMB[name]; ok {
+			budget = int64(mb) << 20
+		}
+		c.provider.SetMaxBytes(budget)
+	}
+	for name := range cfg.CacheMB {
+		if !known[name] {
+			slog.Warn("Config: ignoring budget for unknown cache", "cache", name)
+		}
+	}
+}
+
+// initConfig loads the config at startup, exiting on errors
+func initConfig() {
+	cfg, err := loadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+	activeConfig.Store(cfg)
+	applyCacheBudgets(cfg)
+	path, _ := configPath()
+	slog.Info("Config loaded", "path", path, "default_relays", len(cfg.Relays.Default),
+		"publish_relays", len(cfg.Relays.Publish), "indexers", len(cfg.Relays.Indexers))
+}
+
+// reloadConfigOnSIGHUP re-reads the config whenever the process gets SIGHUP
+func reloadConfigOnSIGHUP() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			cfg, err := loadConfig()
+			if err != nil {
+				slog.Error("Config reload failed, keeping current config", "error", err)
+				continue
+			}
+			activeConfig.Store(cfg)
+			applyCacheBudgets(cfg)
+			slog.Info("Config reloaded", "default_relays", len(cfg.Relays.Default),
+				"publish_relays", len(cfg.Relays.Publish), "indexers", len(cfg.Relays.Indexers))
+		}
+	}()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// NIP-36 content warnings, and the reader's preference to blur media from
+// authors they don't follow. Both are zero-JS: hidden content sits in a
+// <details> element, and blurred images are the <summary> of one, so a
+// click opens it and CSS drops the blur.
+
+// blurMediaCookieName holds the blur preference ("1" when on)
+const blurMediaCookieName = "blur_media"
+
+// maxContentWarningLength caps the reason accepted from the compose forms
+const maxContentWarningLength = 200
+
+// blurrableMediaRegex matches media in rendered note content: image
+// galleries, single images and videos
+var blurrableMediaRegex = regexp.MustCompile(`<div class="image-gallery">(?:\s*<img [^>]+>)+\s*</div>|<img [^>]+>|<video [^>]*></video>`)
+
+// extractContentWarning returns the reason from a content-warning tag and
+// whether the event has one. The reason is optional.
+func extractContentWarning(tags [][]string) (string, bool) {
+	for _, tag := range tags {
+		if len(tag) >= 1 && tag[0] == "content-warning" {
+			if len(tag) >= 2 {
+				return strings.TrimSpace(tag[1]), true
+			}
+			return "", true
+		}
+	}
+	return "", false
+}
+
+// contentWarningProperty returns the content_warning value for JSON and
+// Siren responses: the reason (possibly empty), or nil without a warning
+func contentWarningProperty(tags [][]string) *string {
+	reason, ok := extractContentWarning(tags)
+	if !ok {
+		return nil
+	}
+	return &reason
+}
+
+// setContentWarning marks an item whose event carries a content warning
+func (item *HTMLEventItem) setContentWarning(tags [][]string) {
+	item.ContentWarning, item.HasContentWarning = extractContentWarning(tags)
+}
+
+// contentWarningTag returns the tag asked for by a compose form's "cw"
+// checkbox and "content_warning" reason field, or nil
+func contentWarningTag(r *http.Request) []string {
+	reason := strings.TrimSpace(r.FormValue("content_warning"))
+	if r.FormValue("cw") != "1" && reason == "" {
+		return nil
+	}
+	if reason == "" {
+		return []string{"content-warning"}
+	}
+	if runes := []rune(reason); len(runes) > maxContentWarningLength {
+		reason = string(runes[:maxContentWarningLength])
+	}
+	return []string{"content-warning", reason}
+}
+
+// blurMediaEnabled reports whether the reader turned on blurring
+func blurMediaEnabled(r *http.Request) bool {
+	cookie, err := r.Cookie(blurMediaCookieName)
+	return err == nil && cookie.Value == "1"
+}
+
+// mediaBlur decides whose media is blurred for one reader. A nil
+// *mediaBlur blurs nothing.
+type mediaBlur struct {
+	self    string
+	follows map[string]bool
+}
+
+// newMediaBlur returns the reader's blur policy, or nil when the preference
+// is off or nobody is logged in (there's no follow list to go by)
+func newMediaBlur(r *http.Request, session *BunkerSession) *mediaBlur {
+	if !blurMediaEnabled(r) || session == nil || !session.Connected {
+		return nil
+	}
+	m := &mediaBlur{
+		self:    hex.EncodeToString(session.UserPubKey),
+		follows: make(map[string]bool, len(session.FollowingPubkeys)),
+	}
+	for _, pk := range session.FollowingPubkeys {
+		m.follows[pk] = true
+	}
+	return m
+}
+
+// blurs reports whether media from pubkey is blurred
+func (m *mediaBlur) blurs(pubkey string) bool {
+	return m != nil && pubkey != m.self && !m.follows[pubkey]
+}
+
+// apply blurs the media of an item and of the notes it reposts or quotes,
+// each according to its own author
+func (m *mediaBlur) apply(item *HTMLEventItem) {
+	if item == nil || m == nil {
+		return
+	}
+	if m.blurs(item.Pubkey) {
+		item.ContentHTML = blurMediaHTML(item.ContentHTML)
+		if item.ImagesHTML != "" {
+			item.ImagesHTML = template.HTML(blurredMediaBlock(string(item.ImagesHTML)))
+		}
+		item.BlurMedia = true
+	}
+	m.apply(item.RepostedEvent)
+	m.apply(item.QuotedEvent)
+}
+
+// blurMediaHTML wraps each image, gallery and video in rendered content so
+// it starts out hidden. Link preview thumbnails and custom emoji are left alone.
+func blurMediaHTML(content template.HTML) template.HTML {
+	return template.HTML(blurrableMediaRegex.ReplaceAllStringFunc(string(content), func(match string) string {
+		if strings.Contains(match, "link-preview-image") || strings.HasPrefix(match, `<img class="custom-emoji"`) {
+			return match
+		}
+		if strings.HasPrefix(match, "<video") {
+			// Controls inside a <summary> would toggle it, so videos go behind a button
+			return `<details class="blurred-media blurred-video"><summary>Show video</summary>` + match + `</details>`
+		}
+		return blurredMediaBlock(match)
+	}))
+}
+
+// blurredMediaBlock puts media in a <summary> that is blurred until opened
+func blurredMediaBlock(media string) string {
+	return `<details class="blurred-media"><summary title="Show media">` + media + `</summary></details>`
+}
+
+// htmlBlurMediaHandler toggles the blur preference and returns to the page
+// the form was on, like htmlThemeHandler
+func htmlBlurMediaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/html/timeline?kinds=1&limit=20", http.StatusSeeOther)
+		return
+	}
+
+	value := "1"
+	if blurMediaEnabled(r) {
+		value = ""
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     blurMediaCookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	returnURL := ""
+	if parsed, err := url.Parse(r.Header.Get("Referer")); err == nil && parsed.Path != "" {
+		returnURL = parsed.Path
+		if parsed.RawQuery != "" {
+			returnURL += "?" + parsed.RawQuery
+		}
+	}
+	http.Redirect(w, r, sanitizeReturnURL(returnURL), http.StatusSeeOther)
+}
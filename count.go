@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NIP-45 COUNT: ask relays how many events match instead of downloading
+// them. Relays that refuse or ignore COUNT are skipped for a while, and
+// callers fall back to downloading and counting.
+
+const (
+	countUnsupportedTTL   = time.Hour
+	countTimeoutStrikes   = 3   // Unanswered COUNT rounds in a row before a relay is skipped
+	countPerRelayInFlight = 8   // Concurrent COUNTs per relay connection
+	followerFallbackLimit = 500 // Contact lists downloaded when no relay answers COUNT
+)
+
+// countSupported reports whether COUNT is worth trying on relayURL
+func (p *RelayPool) countSupported(relayURL string) bool {
+	p.countMu.Lock()
+	defer p.countMu.Unlock()
+	retryAt, known := p.countUnsupported[relayURL]
+	return !known || time.Now().After(retryAt)
+}
+
+// markCountUnsupported skips COUNT on relayURL for countUnsupportedTTL
+func (p *RelayPool) markCountUnsupported(relayURL string, reason error) {
+	p.countMu.Lock()
+	p.countUnsupported[relayURL] = time.Now().Add(countUnsupportedTTL)
+	p.countMu.Unlock()
+	slog.Info("Relay doesn't answer COUNT, skipping it", "relay", relayURL, "retry_in", countUnsupportedTTL, "error", reason)
+}
+
+// countTimedOut records a COUNT round relayURL didn't answer in time. A slow
+// relay may still support COUNT, so it's only skipped after
+// countTimeoutStrikes rounds in a row.
+func (p *RelayPool) countTimedOut(relayURL string, reason error) {
+	p.countMu.Lock()
+	p.countTimeouts[relayURL]++
+	strikes := p.countTimeouts[relayURL]
+	if strikes >= countTimeoutStrikes {
+		delete(p.countTimeouts, relayURL)
+	}
+	p.countMu.Unlock()
+	if strikes >= countTimeoutStrikes {
+		p.markCountUnsupported(relayURL, reason)
+	}
+}
+
+// countAnswered clears relayURL's unanswered COUNT rounds
+func (p *RelayPool) countAnswered(relayURL string) {
+	p.countMu.Lock()
+	delete(p.countTimeouts, relayURL)
+	p.countMu.Unlock()
+}
+
+// countRelays returns the relays worth sending COUNT to
+func countRelays(relays []string) []string {
+	var supported []string
+	for _, relay := range relays {
+		if relayPool.countSupported(relay) {
+			supported = append(supported, relay)
+		}
+	}
+	return supported
+}
+
+// countEach runs one COUNT per filter against every relay that supports it
+// and returns, per filter index, the highest count any relay reported.
+// Counts from different relays overlap, so the highest is the best estimate.
+// Filters no relay answered are missing from the result.
+func countEach(relays []string, filters []Filter) map[int]CountResult {
+	results := make(map[int]CountResult)
+	relays = countRelays(relays)
+	if len(relays) == 0 || len(filters) == 0 {
+		return results
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Count)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, relay := range relays {
+		wg.Add(1)
+		go func(relayURL string) {
+			defer wg.Done()
+
+			var answered atomic.Int32
+			var refusal atomic.Value // error
+			sem := make(chan struct{}, countPerRelayInFlight)
+			var relayWG sync.WaitGroup
+
+		sendLoop:
+			for i, filter := range filters {
+				if refusal.Load() != nil {
+					break
+				}
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					break sendLoop
+				}
+				relayWG.Add(1)
+				go func(i int, filter Filter) {
+					defer func() {
+						<-sem
+						relayWG.Done()
+					}()
+					res, err := relayPool.Count(ctx, relayURL, buildReqFilter(filter))
+					if err != nil {
+						if errors.Is(err, errCountRefused) {
+							refusal.Store(err)
+						}
+						return
+					}
+					answered.Add(1)
+					mu.Lock()
+					if cur, ok := results[i]; !ok || res.Count > cur.Count {
+						results[i] = res
+					}
+					mu.Unlock()
+				}(i, filter)
+			}
+			relayWG.Wait()
+
+			// Relays without NIP-45 either refuse the message or ignore it
+			if answered.Load() > 0 {
+				relayPool.countAnswered(relayURL)
+			} else if err, ok := refusal.Load().(error); ok {
+				relayPool.markCountUnsupported(relayURL, err)
+			} else if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				relayPool.countTimedOut(relayURL, ctx.Err())
+			}
+		}(relay)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// countByTagValue counts events of kinds carrying each tag value, e.g. the
+// replies to each event ID with tagName "e"
+func countByTagValue(relays []string, kinds []int, tagName string, values []string) map[string]CountResult {
+	filters := make([]Filter, len(values))
+	for i, value := range values {
+		filters[i] = Filter{Kinds: kinds, Tags: map[string][]string{tagName: {value}}}
+	}
+
+	counts := make(map[string]CountResult)
+	for i, res := range countEach(relays, filters) {
+		counts[values[i]] = res
+	}
+	return counts
+}
+
+// FollowCounts is how many accounts follow a profile and how many it follows
+type FollowCounts struct {
+	Followers   int  `json:"followers"`
+	Following   int  `json:"following"`
+	Approximate bool `json:"approximate,omitempty"` // Followers is an estimate or lower bound
+}
+
+// fetchFollowCounts counts a profile's followers (contact lists tagging it)
+// with COUNT, falling back to downloading contact lists, and its following
+// from its own contact list. Returns nil if no relay could be asked.
+func fetchFollowCounts(relays []string, pubkey string) *FollowCounts {
+	if counts, ok := followCountCache.Get(pubkey); ok {
+		return counts
+	}
+
+	counts := &FollowCounts{}
+	followersKnown := true
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if res, ok := countEach(relays, []Filter{{Kinds: []int{3}, PTags: []string{pubkey}}})[0]; ok {
+			counts.Followers = res.Count
+			counts.Approximate = res.Approximate
+			return
+		}
+
+		// Each follower has one current contact list; count distinct authors
+		filter := Filter{Kinds: []int{3}, PTags: []string{pubkey}, Limit: followerFallbackLimit}
+		events, eose := fetchEventsFromRelaysDirect(relays, filter, 3*time.Second)
+		if len(events) == 0 && !eose {
+			followersKnown = false
+			return
+		}
+		followers := make(map[string]bool, len(events))
+		for _, evt := range events {
+			followers[evt.PubKey] = true
+		}
+		counts.Followers = len(followers)
+		counts.Approximate = len(events) >= followerFallbackLimit
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		contacts, ok := contactCache.Get(pubkey)
+		if !ok {
+			contacts = fetchContactList(relays, pubkey)
+			if contacts != nil {
+				contactCache.Set(pubkey, contacts)
+			}
+		}
+		counts.Following = len(dedupeStrings(contacts))
+	}()
+
+	wg.Wait()
+	if !followersKnown {
+		return nil
+	}
+	followCountCache.Set(pubkey, counts)
+	return counts
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NIP-90 content discovery (and NIP-89 handler announcement) kinds
+const (
+	kindDVMContentRequest = 5300
+	kindDVMContentResult  = 6300
+	kindDVMFeedback       = 7000
+	kindHandlerInfo       = 31990
+)
+
+// DVMInfo describes a content discovery DVM from its NIP-89 announcement
+type DVMInfo struct {
+	Pubkey  string
+	Name    string
+	About   string
+	Picture string
+}
+
+// dvmResultCache keeps DVM answers briefly so paging and refreshes don't
+// publish a new job every time
+type dvmResultCache struct {
+	mu      sync.Mutex
+	results map[string]cachedDVMResult
+	ttl     time.Duration
+}
+
+type cachedDVMResult struct {
+	ids       []string
+	fetchedAt time.Time
+}
+
+var dvmResults = &dvmResultCache{
+	results: make(map[string]cachedDVMResult),
+	ttl:     2 * time.Minute,
+}
+
+func (c *dvmResultCache) Get(key string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.results[key]
+	if !ok || time.Since(cached.fetchedAt) > c.ttl {
+		delete(c.results, key)
+		return nil, false
+	}
+	return cached.ids, true
+}
+
+func (c *dvmResultCache) Set(key string, ids []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[key] = cachedDVMResult{ids: ids, fetchedAt: time.Now()}
+}
+
+// fetchContentDVMs lists DVMs that announce support for kind 5300 jobs
+func fetchContentDVMs(relays []string) []DVMInfo {
+	filter := Filter{
+		Kinds: []int{kindHandlerInfo},
+		Tags:  map[string][]string{"k": {strconv.Itoa(kindDVMContentRequest)}},
+		Limit: 100,
+	}
+	events, _ := fetchEventsFromRelaysWithTimeout(relays, filter, 3*time.Second)
+
+	// One entry per DVM pubkey, newest announcement wins
+	newest := make(map[string]Event)
+	for _, evt := range events {
+		if existing, ok := newest[evt.PubKey]; !ok || evt.CreatedAt > existing.CreatedAt {
+			newest[evt.PubKey] = evt
+		}
+	}
+
+	dvms := make([]DVMInfo, 0, len(newest))
+	for pubkey, evt := range newest {
+		info := DVMInfo{Pubkey: pubkey}
+		var meta struct {
+			Name        string `json:"name"`
+			DisplayName string `json:"display_name"`
+			About       string `json:"about"`
+			Picture     string `json:"picture"`
+			Image       string `json:"image"`
+		}
+		if err := json.Unmarshal([]byte(evt.Content), &meta); err == nil {
+			info.Name = meta.Name
+			if info.Name == "" {
+				info.Name = meta.DisplayName
+			}
+			info.About = meta.About
+			info.Picture = meta.Picture
+			if info.Picture == "" {
+				info.Picture = meta.Image
+			}
+		}
+		if info.Name == "" {
+			// Unnamed announcements are usually test DVMs
+			continue
+		}
+		dvms = append(dvms, info)
+	}
+	return dvms
+}
+
+// fetchDVMFeedIDs publishes a kind 5300 job request to a DVM and waits for its
+// kind 6300 result, returning the recommended event IDs in ranked order.
+// The request is signed with the server keypair; userPubkey (optional) lets
+// the DVM personalize results.
+func fetchDVMFeedIDs(relays []string, dvmPubkey, userPubkey string, maxResults int) ([]string, error) {
+	cacheKey := dvmPubkey + ":" + userPubkey
+	if ids, ok := dvmResults.Get(cacheKey); ok {
+		slog.Debug("DVM cache hit", "dvm", shortID(dvmPubkey), "results", len(ids))
+		return ids, nil
+	}
+
+	kp, err := GetServerKeypair()
+	if err != nil {
+		return nil, fmt.Errorf("server keypair unavailable: %v", err)
+	}
+
+	// Ask the DVM to publish results to (a few of) the relays we listen on
+	resultRelays := relays
+	if len(resultRelays) > 5 {
+		resultRelays = resultRelays[:5]
+	}
+	tags := [][]string{
+		{"p", dvmPubkey},
+		append([]string{"relays"}, resultRelays...),
+		{"param", "max_results", strconv.Itoa(maxResults)},
+	}
+	if userPubkey != "" {
+		tags = append(tags, []string{"param", "user", userPubkey})
+	}
+
+	request := &Event{
+		PubKey:    hex.EncodeToString(kp.PubKey),
+		CreatedAt: time.Now().Unix(),
+		Kind:      kindDVMContentRequest,
+		Tags:      tags,
+		Content:   "",
+	}
+	request.ID = calculateEventID(request)
+	request.Sig = signEvent(kp.PrivKey, request.ID)
+	if request.Sig == "" {
+		return nil, errors.New("failed to sign DVM request")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.DVM)
+
+	// Subscribe for results before publishing so a fast DVM isn't missed
+	reqFilter := map[string]interface{}{
+		"kinds":   []int{kindDVMContentResult, kindDVMFeedback},
+		"authors": []string{dvmPubkey},
+		"#e":      []string{request.ID},
+		"since":   request.CreatedAt - 5,
+	}
+
+	responses := make(chan Event, 10)
+	var wg sync.WaitGroup
+	for _, relayURL := range resultRelays {
+		wg.Add(1)
+		go func(relayURL string) {
+			defer wg.Done()
+			sub, err := relayPool.Subscribe(ctx, relayURL, "dvm-"+randomString(8), reqFilter)
+			if err != nil {
+				slog.Warn("DVM: failed to subscribe", "relay", relayURL, "error", err)
+				return
+			}
+			defer relayPool.Unsubscribe(relayURL, sub)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-sub.Done:
+					return
+				case <-sub.EOSEChan:
+					// Keep listening; results arrive after EOSE
+				case evt := <-sub.EventChan:
+					select {
+					case responses <- evt:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}(relayURL)
+	}
+	// Cancel first so the listeners exit, then wait for them
+	defer wg.Wait()
+	defer cancel()
+
+	publishEvent(ctx, resultRelays, request)
+	slog.Info("DVM: published job", "job", shortID(request.ID), "dvm", shortID(dvmPubkey))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, errors.New("the feed service didn't answer in time")
+		case evt := <-responses:
+			if evt.Kind == kindDVMFeedback {
+				status, message := dvmFeedbackStatus(evt)
+				slog.Info("DVM: feedback", "status", status, "dvm", shortID(dvmPubkey), "message", message)
+				if status == "error" || status == "payment-required" {
+					if message == "" {
+						message = status
+					}
+					return nil, fmt.Errorf("feed service: %s", message)
+				}
+				continue
+			}
+
+			ids, err := parseDVMResultIDs(evt.Content)
+			if err != nil {
+				return nil, err
+			}
+			if len(ids) > maxResults {
+				ids = ids[:maxResults]
+			}
+			dvmResults.Set(cacheKey, ids)
+			slog.Info("DVM: returned events", "dvm", shortID(dvmPubkey), "events", len(ids))
+			return ids, nil
+		}
+	}
+}
+
+// dvmFeedbackStatus extracts the status and message from a kind 7000 event
+func dvmFeedbackStatus(evt Event) (string, string) {
+	for _, tag := range evt.Tags {
+		if len(tag) >= 2 && tag[0] == "status" {
+			message := evt.Content
+			if len(tag) >= 3 && tag[2] != "" {
+				message = tag[2]
+			}
+			return tag[1], message
+		}
+	}
+	return "", evt.Content
+}
+
+// parseDVMResultIDs reads the stringified tag array in a kind 6300 result
+func parseDVMResultIDs(content string) ([]string, error) {
+	var tags [][]string
+	if err := json.Unmarshal([]byte(content), &tags); err != nil {
+		return nil, errors.New("feed service returned an invalid result")
+	}
+	ids := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if len(tag) >= 2 && tag[0] == "e" && isValidEventID(tag[1]) && !seen[tag[1]] {
+			seen[tag[1]] = true
+			ids = append(ids, tag[1])
+		}
+	}
+	return ids, nil
+}
+
+// orderEventsByIDs returns events in the order of ids, dropping missing ones
+func orderEventsByIDs(events []Event, ids []string) []Event {
+	byID := make(map[string]Event, len(events))
+	for _, evt := range events {
+		byID[evt.ID] = evt
+	}
+	ordered := make([]Event, 0, len(ids))
+	for _, id := range ids {
+		if evt, ok := byID[id]; ok {
+			ordered = append(ordered, evt)
+		}
+	}
+	return ordered
+}
+
+// parseDVMPubkey accepts a DVM pubkey as hex or npub
+func parseDVMPubkey(identifier string) (string, bool) {
+	if strings.HasPrefix(identifier, "npub1") {
+		pubkey, err := decodeBech32Pubkey(identifier)
+		return pubkey, err == nil
+	}
+	identifier = strings.ToLower(identifier)
+	return identifier, isValidEventID(identifier)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/hex"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// NIP-30 custom emoji. An event's "emoji" tags map :shortcode: to an image
+// URL; the shortcodes are swapped for inline images in note content and
+// reactions. A user's kind 10030 emoji list (and the kind 30030 sets it
+// points to) supplies the emoji offered when reacting.
+
+const (
+	kindEmojiList = 10030
+	kindEmojiSet  = 30030
+)
+
+// maxUserEmojis caps the emoji offered on a react form
+const maxUserEmojis = 40
+
+// maxEmojiSets caps the kind 30030 sets looked up from one emoji list
+const maxEmojiSets = 10
+
+// customEmojiRegex matches a :shortcode: in text
+var customEmojiRegex = regexp.MustCompile(`:([A-Za-z0-9_-]+):`)
+
+// emojiShortcodeRegex matches a valid shortcode on its own
+var emojiShortcodeRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// CustomEmoji is a shortcode and the image it stands for
+type CustomEmoji struct {
+	Shortcode string
+	URL       string
+}
+
+// EmojiReaction counts reactions with one custom emoji image
+type EmojiReaction struct {
+	Shortcode string `json:"shortcode"`
+	URL       string `json:"url"`
+	Count     int    `json:"count"`
+}
+
+// emojiTags returns the shortcode → image URL map of an event's emoji tags.
+// Only http(s) images with valid shortcodes are kept.
+func emojiTags(tags [][]string) map[string]string {
+	var emojis map[string]string
+	for _, tag := range tags {
+		if len(tag) < 3 || tag[0] != "emoji" || !emojiShortcodeRegex.MatchString(tag[1]) {
+			continue
+		}
+		if !strings.HasPrefix(tag[2], "https://") && !strings.HasPrefix(tag[2], "http://") {
+			continue
+		}
+		if emojis == nil {
+			emojis = make(map[string]string)
+		}
+		if _, ok := emojis[tag[1]]; !ok {
+			emojis[tag[1]] = tag[2]
+		}
+	}
+	return emojis
+}
+
+// customEmojiHTML renders one emoji as an inline image
+func customEmojiHTML(shortcode, url string) string {
+	code := html.EscapeString(":" + shortcode + ":")
+	return `<img class="custom-emoji" src="` + html.EscapeString(proxyImageURL(url, imageWidthAvatar)) +
+		`" alt="` + code + `" title="` + code + `" loading="lazy">`
+}
+
+// replaceCustomEmoji swaps the shortcodes in rendered HTML for images. Only
+// text between tags is touched, so shortcodes inside links and attributes
+// stay as they are.
+func replaceCustomEmoji(content string, emojis map[string]string) string {
+	if len(emojis) == 0 || !strings.Contains(content, ":") {
+		return content
+	}
+	replace := func(match string) string {
+		code := match[1 : len(match)-1]
+		if url, ok := emojis[code]; ok {
+			return customEmojiHTML(code, url)
+		}
+		return match
+	}
+
+	var sb strings.Builder
+	for content != "" {
+		lt := strings.IndexByte(content, '<')
+		if lt < 0 {
+			sb.WriteString(customEmojiRegex.ReplaceAllStringFunc(content, replace))
+			break
+		}
+		sb.WriteString(customEmojiRegex.ReplaceAllStringFunc(content[:lt], replace))
+		gt := strings.IndexByte(content[lt:], '>')
+		if gt < 0 {
+			sb.WriteString(content[lt:])
+			break
+		}
+		sb.WriteString(content[lt : lt+gt+1])
+		content = content[lt+gt+1:]
+	}
+	return sb.String()
+}
+
+// setCustomEmoji renders the custom emoji in an item's content
+func (item *HTMLEventItem) setCustomEmoji(tags [][]string) {
+	if emojis := emojiTags(tags); len(emojis) > 0 {
+		item.ContentHTML = template.HTML(replaceCustomEmoji(string(item.ContentHTML), emojis))
+	}
+}
+
+// reactionEmoji resolves a :shortcode: reaction against the reaction's own
+// emoji tags
+func reactionEmoji(evt Event) (CustomEmoji, bool) {
+	if !isCustomEmojiShortcode(evt.Content) {
+		return CustomEmoji{}, false
+	}
+	code := evt.Content[1 : len(evt.Content)-1]
+	url, ok := emojiTags(evt.Tags)[code]
+	if !ok {
+		return CustomEmoji{}, false
+	}
+	return CustomEmoji{Shortcode: code, URL: url}, true
+}
+
+// addEmoji counts a custom emoji reaction. Reactions are grouped by image,
+// so the same image under different shortcodes adds up.
+func (s *ReactionsSummary) addEmoji(emoji CustomEmoji) {
+	if s.ByEmoji == nil {
+		s.ByEmoji = make(map[string]*EmojiReaction)
+	}
+	if r, ok := s.ByEmoji[emoji.URL]; ok {
+		r.Count++
+		return
+	}
+	s.ByEmoji[emoji.URL] = &EmojiReaction{Shortcode: emoji.Shortcode, URL: emoji.URL, Count: 1}
+}
+
+// EmojiListCache stores users' emoji lists with TTL
+type EmojiListCache struct {
+	lists *BoundedCache[*cachedEmojiList]
+	ttl   time.Duration
+}
+
+type cachedEmojiList struct {
+	emojis    []CustomEmoji
+	fetchedAt time.Time
+}
+
+// Global emoji list cache - 10 minute TTL (lists rarely change)
+var emojiListCache = &EmojiListCache{
+	lists: NewBoundedCache("emoji_lists", cacheBudget("CACHE_EMOJI_LISTS_MB", 4), func(pubkey string, c *cachedEmojiList) int64 {
+		size := int64(entryOverhead + len(pubkey))
+		for _, e := range c.emojis {
+			size += int64(len(e.Shortcode) + len(e.URL) + 2*16)
+		}
+		return size
+	}),
+	ttl: 10 * time.Minute,
+}
+
+// Get retrieves an emoji list from cache if not expired
+func (c *EmojiListCache) Get(pubkey string) ([]CustomEmoji, bool) {
+	cached, ok := c.lists.Get(pubkey, func(cached *cachedEmojiList, _ time.Time) bool {
+		return time.Since(cached.fetchedAt) <= c.ttl
+	})
+	if !ok {
+		return nil, false
+	}
+	return cached.emojis, true
+}
+
+// Set stores an emoji list in the cache
+func (c *EmojiListCache) Set(pubkey string, emojis []CustomEmoji) {
+	c.lists.Set(pubkey, &cachedEmojiList{
+		emojis:    emojis,
+		fetchedAt: time.Now(),
+	})
+}
+
+// userEmojis returns the emoji a logged-in user can react with: their kind
+// 10030 list's own emoji tags, then those of the sets it references
+func userEmojis(session *BunkerSession) []CustomEmoji {
+	if session == nil || !session.Connected {
+		return nil
+	}
+	pubkey := hex.EncodeToString(session.UserPubKey)
+	if emojis, ok := emojiListCache.Get(pubkey); ok {
+		return emojis
+	}
+
+	_, write := sessionRelays(session)
+	relays := dedupeStrings(append(append([]string(nil), write...), defaultReadRelays()...))
+	emojis := fetchEmojiList(relays, pubkey)
+	emojiListCache.Set(pubkey, emojis)
+	return emojis
+}
+
+// fetchEmojiList looks up a user's kind 10030 emoji list and the kind 30030
+// sets it references, keeping the first image for each shortcode
+func fetchEmojiList(relays []string, pubkey string) []CustomEmoji {
+	lists := fetchReplaceable(relays, Filter{
+		Kinds:   []int{kindEmojiList},
+		Authors: []string{pubkey},
+		Limit:   1,
+	}).Events
+	if len(lists) == 0 {
+		return nil
+	}
+	list := lists[0]
+
+	seen := make(map[string]bool)
+	var emojis []CustomEmoji
+	add := func(tags [][]string) {
+		for _, tag := range tags {
+			if len(emojis) >= maxUserEmojis {
+				return
+			}
+			if len(tag) < 3 || tag[0] != "emoji" || seen[tag[1]] {
+				continue
+			}
+			if url, ok := emojiTags([][]string{tag})[tag[1]]; ok {
+				seen[tag[1]] = true
+				emojis = append(emojis, CustomEmoji{Shortcode: tag[1], URL: url})
+			}
+		}
+	}
+	add(list.Tags)
+
+	wanted := make(map[string]bool)
+	var authors, dTags []string
+	for _, tag := range list.Tags {
+		if len(tag) < 2 || tag[0] != "a" || len(wanted) >= maxEmojiSets {
+			continue
+		}
+		parts := strings.SplitN(tag[1], ":", 3)
+		if len(parts) != 3 || parts[0] != "30030" || !isValidEventID(parts[1]) {
+			continue
+		}
+		wanted[tag[1]] = true
+		authors = append(authors, parts[1])
+		dTags = append(dTags, parts[2])
+	}
+	if len(wanted) == 0 || len(emojis) >= maxUserEmojis {
+		return emojis
+	}
+
+	sets := fetchReplaceable(relays, Filter{
+		Kinds:   []int{kindEmojiSet},
+		Authors: dedupeStrings(authors),
+		Tags:    map[string][]string{"d": dedupeStrings(dTags)},
+		Limit:   len(wanted) * 2,
+	}).Events
+	for _, set := range sets {
+		if wanted[replaceableKey(set)] {
+			add(set.Tags)
+		}
+	}
+	return emojis
+}
+
+// findUserEmoji looks up a shortcode in a user's emoji list
+func findUserEmoji(emojis []CustomEmoji, shortcode string) (CustomEmoji, bool) {
+	for _, e := range emojis {
+		if e.Shortcode == shortcode {
+			return e, true
+		}
+	}
+	return CustomEmoji{}, false
+}
+
+// htmlCustomEmojiStyle is the CSS for inline emoji and the emoji reaction
+// badges, shared by the timeline, thread and profile templates
+const htmlCustomEmojiStyle = `{{define "emoji-style"}}
+    img.custom-emoji {
+      display: inline-block;
+      height: 1.4em;
+      width: auto;
+      max-width: 4em;
+      margin: 0 1px;
+      vertical-align: middle;
+      border-radius: 0;
+    }
+{{end}}
+{{define "emoji-badges"}}
+{{range .}}<span class="reaction-badge"><img class="custom-emoji" src="{{proxyImage .URL 96}}" alt=":{{.Shortcode}}:" title=":{{.Shortcode}}:" loading="lazy"> {{.Count}}</span>
+{{end}}
+{{end}}
+`
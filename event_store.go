@@ -0,0 +1,652 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventStore is an event-level cache. Events are stored once, indexed by id,
+// author, kind and single-letter tags, and filters are matched against them
+// locally. Coverage ranges record which created_at windows have already been
+// fetched from relays for a given filter shape, so only the uncovered part of
+// a query has to go back to the relays.
+type EventStore struct {
+	mu         sync.RWMutex
+	events     map[string]*storedEvent
+	byAuthor   map[string]map[string]struct{}
+	byKind     map[int]map[string]struct{}
+	byTag      map[string]map[string]struct{} // "<tag>:<value>" -> event IDs
+	coverage   map[string][]coverageRange     // filter shape -> fetched windows (newest first)
+	bytes      int64                          // Estimated size of stored events
+	maxBytes   int64
+	eventTTL   time.Duration
+	staleGrace time.Duration // How long expired coverage may still be served while refreshing
+
+	hits        atomic.Int64
+	partialHits atomic.Int64
+	misses      atomic.Int64
+	evictions   atomic.Int64
+	expirations atomic.Int64
+
+	done      chan struct{} // Closed by Close to stop the cleanup loop
+	closeOnce sync.Once
+}
+
+type storedEvent struct {
+	event    Event
+	size     int64
+	storedAt time.Time
+}
+
+// coverageRange is a created_at window [since, until] for which the store
+// holds every event relays returned for a filter shape
+type coverageRange struct {
+	since     int64
+	until     int64
+	open      bool // Fetched without an until, so it reaches "now" while fresh
+	complete  bool // All relays sent EOSE
+	fetchedAt time.Time
+	expiresAt time.Time
+}
+
+// Global event store - 128 MB by default, events kept 10 minutes after last
+// seen, expired coverage served stale for up to 2 minutes
+var eventStore = NewEventStore(cacheBudget("CACHE_EVENTS_MB", 128), 10*time.Minute, 2*time.Minute)
+
+// NewEventStore creates a store holding roughly maxBytes of events and
+// registers it for stats. staleGrace must stay well below eventTTL so stale
+// coverage never outlives its events.
+func NewEventStore(maxBytes int64, eventTTL, staleGrace time.Duration) *EventStore {
+	s := &EventStore{
+		events:     make(map[string]*storedEvent),
+		byAuthor:   make(map[string]map[string]struct{}),
+		byKind:     make(map[int]map[string]struct{}),
+		byTag:      make(map[string]map[string]struct{}),
+		coverage:   make(map[string][]coverageRange),
+		maxBytes:   maxBytes,
+		eventTTL:   eventTTL,
+		staleGrace: staleGrace,
+		done:       make(chan struct{}),
+	}
+	registerCache(s)
+	go s.cleanupLoop()
+	return s
+}
+
+// coverageKey identifies a filter's shape: everything except ids, the time
+// window and the limit
+func coverageKey(relays []string, filter Filter) string {
+	sortedRelays := append([]string(nil), relays...)
+	sort.Strings(sortedRelays)
+	sortedAuthors := append([]string(nil), filter.Authors...)
+	sort.Strings(sortedAuthors)
+	sortedKinds := append([]int(nil), filter.Kinds...)
+	sort.Ints(sortedKinds)
+	sortedPTags := append([]string(nil), filter.PTags...)
+	sort.Strings(sortedPTags)
+
+	var sb strings.Builder
+	sb.WriteString("relays:")
+	sb.WriteString(strings.Join(sortedRelays, ","))
+	sb.WriteString("|authors:")
+	sb.WriteString(strings.Join(sortedAuthors, ","))
+	sb.WriteString("|kinds:")
+	for i, k := range sortedKinds {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(strconv.Itoa(k))
+	}
+	sb.WriteString("|p:")
+	sb.WriteString(strings.Join(sortedPTags, ","))
+
+	tagNames := make([]string, 0, len(filter.Tags))
+	for name := range filter.Tags {
+		tagNames = append(tagNames, name)
+	}
+	sort.Strings(tagNames)
+	for _, name := range tagNames {
+		values := append([]string(nil), filter.Tags[name]...)
+		sort.Strings(values)
+		sb.WriteString("|#" + name + ":")
+		sb.WriteString(strings.Join(values, ","))
+	}
+
+	// Hash the key to keep it short
+	hash := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(hash[:16])
+}
+
+// getCoverageTTL returns how long fetched coverage stays fresh for a query type
+func getCoverageTTL(filter Filter) time.Duration {
+	if len(filter.Authors) == 0 {
+		// Global timeline - cache longer, high hit rate
+		return 60 * time.Second
+	}
+	if len(filter.Authors) <= 5 {
+		// Small author list (maybe a profile page)
+		return 45 * time.Second
+	}
+	// Large author list (follow list) - moderate cache
+	return 30 * time.Second
+}
+
+// Add stores events and indexes them, refreshing ones already present
+func (s *EventStore) Add(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, evt := range events {
+		if existing, ok := s.events[evt.ID]; ok {
+			existing.storedAt = now
+			existing.event.RelaysSeen = mergeRelaysSeen(existing.event.RelaysSeen, evt.RelaysSeen)
+			continue
+		}
+		evt.RelaysSeen = append([]string(nil), evt.RelaysSeen...)
+		size := eventSize(evt)
+		s.events[evt.ID] = &storedEvent{event: evt, size: size, storedAt: now}
+		s.bytes += size
+		addToIndex(s.byAuthor, evt.PubKey, evt.ID)
+		addToIndex(s.byKind, evt.Kind, evt.ID)
+		for _, tag := range evt.Tags {
+			if len(tag) >= 2 && len(tag[0]) == 1 {
+				addToIndex(s.byTag, tag[0]+":"+tag[1], evt.ID)
+			}
+		}
+	}
+
+	if s.bytes > s.maxBytes {
+		s.evictOldest()
+	}
+}
+
+// GetByIDs returns the stored events among ids and the IDs that are missing
+func (s *EventStore) GetByIDs(ids []string) (found []Event, missing []string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, id := range ids {
+		if stored, ok := s.events[id]; ok {
+			found = append(found, copyEvent(stored.event))
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return found, missing
+}
+
+// Query matches filter against stored events, newest first, honoring the limit
+func (s *EventStore) Query(filter Filter) []Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var results []Event
+	for _, id := range s.candidates(filter) {
+		stored, ok := s.events[id]
+		if ok && eventMatchesFilter(stored.event, filter) {
+			results = append(results, copyEvent(stored.event))
+		}
+	}
+	sortEventsNewestFirst(results)
+	if filter.Limit > 0 && len(results) > filter.Limit {
+		results = results[:filter.Limit]
+	}
+	return results
+}
+
+// candidates returns the IDs from the most selective index for filter (must hold lock)
+func (s *EventStore) candidates(filter Filter) []string {
+	if len(filter.IDs) > 0 {
+		return filter.IDs
+	}
+
+	var best []map[string]struct{}
+	bestSize := -1
+	consider := func(sets []map[string]struct{}) {
+		size := 0
+		for _, set := range sets {
+			size += len(set)
+		}
+		if bestSize < 0 || size < bestSize {
+			best, bestSize = sets, size
+		}
+	}
+
+	if len(filter.Authors) > 0 {
+		sets := make([]map[string]struct{}, 0, len(filter.Authors))
+		for _, author := range filter.Authors {
+			sets = append(sets, s.byAuthor[author])
+		}
+		consider(sets)
+	}
+	if len(filter.Kinds) > 0 {
+		sets := make([]map[string]struct{}, 0, len(filter.Kinds))
+		for _, kind := range filter.Kinds {
+			sets = append(sets, s.byKind[kind])
+		}
+		consider(sets)
+	}
+	if len(filter.PTags) > 0 {
+		sets := make([]map[string]struct{}, 0, len(filter.PTags))
+		for _, pk := range filter.PTags {
+			sets = append(sets, s.byTag["p:"+pk])
+		}
+		consider(sets)
+	}
+	for name, values := range filter.Tags {
+		if len(values) == 0 {
+			continue
+		}
+		sets := make([]map[string]struct{}, 0, len(values))
+		for _, v := range values {
+			sets = append(sets, s.byTag[name+":"+v])
+		}
+		consider(sets)
+	}
+
+	if bestSize < 0 {
+		// Unconstrained filter - scan everything
+		ids := make([]string, 0, len(s.events))
+		for id := range s.events {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	seen := make(map[string]bool, bestSize)
+	ids := make([]string, 0, bestSize)
+	for _, set := range best {
+		for id := range set {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// Covered reports the lowest created_at down to which the filter's window is
+// continuously covered, starting from its until (or now). ok is false when
+// the top of the window hasn't been fetched at all; stale is true when part of
+// the covered window is past its TTL but still within the grace window.
+func (s *EventStore) Covered(key string, filter Filter) (low int64, complete, stale, ok bool) {
+	now := time.Now()
+	top := now.Unix()
+	if filter.Until != nil {
+		top = *filter.Until
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Ranges don't overlap and are sorted newest first, so the covered window
+	// is the range containing the top followed by the adjacent ranges below it
+	for _, r := range s.coverage[key] {
+		if s.coverageDead(r, now) {
+			if ok && r.until+1 >= low {
+				break
+			}
+			continue
+		}
+		if !ok {
+			reachesTop := r.until >= top || (r.open && filter.Until == nil)
+			if r.since <= top && reachesTop {
+				ok = true
+				low, complete, stale = r.since, r.complete, now.After(r.expiresAt)
+			}
+			continue
+		}
+		if r.until+1 < low {
+			break
+		}
+		low = r.since
+		complete = complete && r.complete
+		stale = stale || now.After(r.expiresAt)
+	}
+	return low, complete, stale, ok
+}
+
+// coverageDead reports whether a range is past both its TTL and the grace window
+func (s *EventStore) coverageDead(r coverageRange, now time.Time) bool {
+	return now.After(r.expiresAt.Add(s.staleGrace))
+}
+
+// MarkCovered records that [since, until] was fetched for a filter shape.
+// open means the fetch had no until and reached the present. fetchedAt must
+// be taken before the fetched events were added, so evicting any of them
+// also invalidates this range. Older ranges overlapping the new one are
+// trimmed to the parts it doesn't cover.
+func (s *EventStore) MarkCovered(key string, since, until int64, open, complete bool, fetchedAt time.Time, ttl time.Duration) {
+	if since > until {
+		return
+	}
+	now := time.Now()
+	added := coverageRange{
+		since:     since,
+		until:     until,
+		open:      open,
+		complete:  complete,
+		fetchedAt: fetchedAt,
+		expiresAt: fetchedAt.Add(ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := make([]coverageRange, 0, len(s.coverage[key])+2)
+	for _, r := range s.coverage[key] {
+		if s.coverageDead(r, now) {
+			continue
+		}
+		if r.until < added.since || r.since > added.until {
+			kept = append(kept, r)
+			continue
+		}
+		if r.since < added.since {
+			lower := r
+			lower.until = added.since - 1
+			lower.open = false
+			kept = append(kept, lower)
+		}
+		if r.until > added.until {
+			upper := r
+			upper.since = added.until + 1
+			kept = append(kept, upper)
+		}
+	}
+	kept = append(kept, added)
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].until > kept[j].until
+	})
+	s.coverage[key] = kept
+}
+
+// NeedsRefresh reports whether the top of the filter's window is uncovered or
+// its coverage expires within the given duration
+func (s *EventStore) NeedsRefresh(key string, filter Filter, within time.Duration) bool {
+	now := time.Now()
+	top := now.Unix()
+	if filter.Until != nil {
+		top = *filter.Until
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.coverage[key] {
+		reachesTop := r.until >= top || (r.open && filter.Until == nil)
+		if r.since <= top && reachesTop && !s.coverageDead(r, now) {
+			return now.Add(within).After(r.expiresAt)
+		}
+	}
+	return true
+}
+
+// removeEvent drops an event and its index entries (must hold write lock)
+func (s *EventStore) removeEvent(id string) {
+	stored, ok := s.events[id]
+	if !ok {
+		return
+	}
+	delete(s.events, id)
+	s.bytes -= stored.size
+	removeFromIndex(s.byAuthor, stored.event.PubKey, id)
+	removeFromIndex(s.byKind, stored.event.Kind, id)
+	for _, tag := range stored.event.Tags {
+		if len(tag) >= 2 && len(tag[0]) == 1 {
+			removeFromIndex(s.byTag, tag[0]+":"+tag[1], id)
+		}
+	}
+}
+
+// evictOldest removes the least recently stored events until the store is
+// back under 90% of its byte budget (must hold write lock). Coverage fetched
+// before the evicted events were last stored no longer holds, so it is
+// dropped too.
+func (s *EventStore) evictOldest() {
+	target := s.maxBytes / 10 * 9
+
+	type idStored struct {
+		id       string
+		storedAt time.Time
+	}
+	entries := make([]idStored, 0, len(s.events))
+	for id, stored := range s.events {
+		entries = append(entries, idStored{id, stored.storedAt})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].storedAt.Before(entries[j].storedAt)
+	})
+
+	var newestEvicted time.Time
+	for i := 0; i < len(entries) && s.bytes > target; i++ {
+		s.removeEvent(entries[i].id)
+		s.evictions.Add(1)
+		newestEvicted = entries[i].storedAt
+	}
+	s.dropCoverageBefore(newestEvicted)
+}
+
+// dropCoverageBefore removes coverage fetched at or before t (must hold write lock)
+func (s *EventStore) dropCoverageBefore(t time.Time) {
+	for key, ranges := range s.coverage {
+		kept := ranges[:0]
+		for _, r := range ranges {
+			if r.fetchedAt.After(t) {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.coverage, key)
+		} else {
+			s.coverage[key] = kept
+		}
+	}
+}
+
+// cleanupLoop periodically removes expired events and coverage until Close
+func (s *EventStore) cleanupLoop() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.cleanup()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close stops the cleanup loop
+func (s *EventStore) Close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// cleanup removes events not seen within the TTL and coverage past its grace window
+func (s *EventStore) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var newestEvicted time.Time
+	for id, stored := range s.events {
+		if now.Sub(stored.storedAt) > s.eventTTL {
+			if stored.storedAt.After(newestEvicted) {
+				newestEvicted = stored.storedAt
+			}
+			s.removeEvent(id)
+			s.expirations.Add(1)
+		}
+	}
+	if !newestEvicted.IsZero() {
+		s.dropCoverageBefore(newestEvicted)
+	}
+
+	for key, ranges := range s.coverage {
+		kept := ranges[:0]
+		for _, r := range ranges {
+			if !s.coverageDead(r, now) {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.coverage, key)
+		} else {
+			s.coverage[key] = kept
+		}
+	}
+}
+
+// recordLookup counts how a query was answered: fully from the store,
+// partly, or not at all
+func (s *EventStore) recordLookup(covered, partial bool) {
+	switch {
+	case partial:
+		s.partialHits.Add(1)
+	case covered:
+		s.hits.Add(1)
+	default:
+		s.misses.Add(1)
+	}
+}
+
+// SetMaxBytes changes the byte budget, evicting if the store is now over it
+func (s *EventStore) SetMaxBytes(maxBytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxBytes = maxBytes
+	if s.bytes > s.maxBytes {
+		s.evictOldest()
+	}
+}
+
+// Stats returns the store's size and counters
+func (s *EventStore) Stats() CacheStats {
+	s.mu.RLock()
+	entries, bytes, maxBytes := len(s.events), s.bytes, s.maxBytes
+	s.mu.RUnlock()
+	return CacheStats{
+		Name:        "events",
+		Entries:     entries,
+		Bytes:       bytes,
+		MaxBytes:    maxBytes,
+		Hits:        s.hits.Load(),
+		PartialHits: s.partialHits.Load(),
+		Misses:      s.misses.Load(),
+		Evictions:   s.evictions.Load(),
+		Expirations: s.expirations.Load(),
+	}
+}
+
+// eventMatchesFilter applies NIP-01 filter semantics to a single event
+func eventMatchesFilter(evt Event, filter Filter) bool {
+	if len(filter.IDs) > 0 && !containsString(filter.IDs, evt.ID) {
+		return false
+	}
+	if len(filter.Authors) > 0 && !containsString(filter.Authors, evt.PubKey) {
+		return false
+	}
+	if len(filter.Kinds) > 0 {
+		found := false
+		for _, k := range filter.Kinds {
+			if k == evt.Kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if filter.Since != nil && evt.CreatedAt < *filter.Since {
+		return false
+	}
+	if filter.Until != nil && evt.CreatedAt > *filter.Until {
+		return false
+	}
+	if len(filter.PTags) > 0 && !eventHasTagValue(evt, "p", filter.PTags) {
+		return false
+	}
+	for name, values := range filter.Tags {
+		if len(values) > 0 && !eventHasTagValue(evt, name, values) {
+			return false
+		}
+	}
+	return true
+}
+
+// eventHasTagValue checks whether evt has a tag named name with one of values
+func eventHasTagValue(evt Event, name string, values []string) bool {
+	for _, tag := range evt.Tags {
+		if len(tag) >= 2 && tag[0] == name && containsString(values, tag[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sortEventsNewestFirst sorts by created_at DESC, then by ID DESC for tie-break
+func sortEventsNewestFirst(events []Event) {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].CreatedAt != events[j].CreatedAt {
+			return events[i].CreatedAt > events[j].CreatedAt
+		}
+		return events[i].ID > events[j].ID
+	})
+}
+
+// copyEvent returns evt with its own RelaysSeen slice so callers can't race
+// with later merges
+func copyEvent(evt Event) Event {
+	evt.RelaysSeen = append([]string(nil), evt.RelaysSeen...)
+	return evt
+}
+
+func mergeRelaysSeen(existing, incoming []string) []string {
+	for _, relay := range incoming {
+		if !containsString(existing, relay) {
+			existing = append(existing, relay)
+		}
+	}
+	return existing
+}
+
+func addToIndex[K comparable](index map[K]map[string]struct{}, key K, id string) {
+	set, ok := index[key]
+	if !ok {
+		set = make(map[string]struct{})
+		index[key] = set
+	}
+	set[id] = struct{}{}
+}
+
+func removeFromIndex[K comparable](index map[K]map[string]struct{}, key K, id string) {
+	set, ok := index[key]
+	if !ok {
+		return
+	}
+	delete(set, id)
+	if len(set) == 0 {
+		delete(index, key)
+	}
+}
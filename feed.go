@@ -0,0 +1,574 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Syndication feeds (RSS 2.0, Atom 1.0 and JSON Feed 1.1) for timelines,
+// profiles and hashtags, for feed readers and other tools that don't speak Nostr.
+
+const (
+	mimeRSS      = "application/rss+xml"
+	mimeAtom     = "application/atom+xml"
+	mimeJSONFeed = "application/feed+json"
+)
+
+// Feed item kinds: short notes and NIP-23 long-form articles
+var feedKinds = []int{1, 30023}
+
+const feedTitleLength = 80
+
+// feedFormat returns the first feed media type named in an Accept header,
+// or "" when the client didn't ask for a feed
+func feedFormat(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case mimeRSS:
+			return mimeRSS
+		case mimeAtom:
+			return mimeAtom
+		case mimeJSONFeed:
+			return mimeJSONFeed
+		}
+	}
+	return ""
+}
+
+// feedMeta describes a feed as a whole; Link and Image may be site-relative
+type feedMeta struct {
+	Title       string
+	Description string
+	Link        string
+	Image       string
+}
+
+// feedEntry is a format-neutral feed item
+type feedEntry struct {
+	ID        string
+	URL       string
+	Title     string
+	Summary   string
+	HTML      string
+	Author    string
+	Published time.Time
+	Updated   time.Time
+	Tags      []string
+}
+
+// requestBaseURL returns the scheme and host the client used to reach us.
+// X-Forwarded-Proto is only believed behind a trusted proxy.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	} else if currentConfig().TrustProxy && r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// absoluteURLs rewrites site-relative href and src attributes, since feed
+// readers show item content away from our pages
+func absoluteURLs(content, base string) string {
+	content = strings.ReplaceAll(content, `href="/`, `href="`+base+`/`)
+	return strings.ReplaceAll(content, `src="/`, `src="`+base+`/`)
+}
+
+// feedAuthorName picks the best available name for an event's author
+func feedAuthorName(pubkey string, profile *ProfileInfo) string {
+	if profile != nil {
+		if profile.DisplayName != "" {
+			return profile.DisplayName
+		}
+		if profile.Name != "" {
+			return profile.Name
+		}
+	}
+	if npub, err := encodeBech32Pubkey(pubkey); err == nil {
+		return npub[:16] + "..."
+	}
+	return shortID(pubkey)
+}
+
+// noteTitle derives a title from the first line of a note, without the
+// URLs and nostr: references that make poor titles
+func noteTitle(content string) string {
+	content = nostrRefRegex.ReplaceAllString(urlRegex.ReplaceAllString(content, ""), "")
+	line, _, _ := strings.Cut(strings.TrimSpace(content), "\n")
+	line = strings.Join(strings.Fields(line), " ")
+	if utf8.RuneCountInString(line) <= feedTitleLength {
+		return line
+	}
+	runes := []rune(line)
+	return strings.TrimSpace(string(runes[:feedTitleLength-3])) + "..."
+}
+
+// buildFeedEntries renders items to HTML. nostr: references become plain
+// links instead of being fetched, to keep feed requests to one relay query.
+func buildFeedEntries(items []EventItem, relays []string, base string) []feedEntry {
+	noRefs := map[string]string{}
+	entries := make([]feedEntry, 0, len(items))
+	for _, item := range items {
+		entry := feedEntry{
+			ID:      "nostr:" + item.ID,
+			URL:     base + "/html/thread/" + item.ID,
+			Author:  feedAuthorName(item.Pubkey, item.AuthorProfile),
+			Updated: time.Unix(item.CreatedAt, 0).UTC(),
+		}
+		if note, err := encodeBech32EventID(item.ID); err == nil {
+			entry.ID = "nostr:" + note
+		}
+		entry.Published = entry.Updated
+		for _, tag := range item.Tags {
+			if len(tag) >= 2 && tag[0] == "t" && tag[1] != "" {
+				entry.Tags = append(entry.Tags, tag[1])
+			}
+		}
+
+		if item.Kind == 30023 {
+			entry.Title = extractTitle(item.Tags)
+			entry.Summary = extractSummary(item.Tags)
+			entry.HTML = string(renderMarkdown(item.Content))
+			if image := extractHeaderImage(item.Tags); image != "" {
+				entry.HTML = `<p><img src="` + html.EscapeString(image) + `" alt=""></p>` + entry.HTML
+			}
+			if published := extractPublishedAt(item.Tags); published > 0 {
+				entry.Published = time.Unix(published, 0).UTC()
+			}
+			if naddr, err := EncodeNAddr(30023, item.Pubkey, extractDTag(item.Tags)); err == nil {
+				entry.ID = "nostr:" + naddr
+			}
+		} else {
+			entry.HTML = string(processContentToHTMLFull(item.Content, relays, noRefs, nil))
+		}
+		if entry.Title == "" {
+			entry.Title = noteTitle(item.Content)
+		}
+		if entry.Title == "" {
+			entry.Title = "Note by " + entry.Author
+		}
+		entry.HTML = absoluteURLs(entry.HTML, base)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// writeFeed renders items in the requested feed format
+func writeFeed(w http.ResponseWriter, r *http.Request, format string, meta feedMeta, items []EventItem, relays []string) {
+	base := requestBaseURL(r)
+	self := base + r.URL.RequestURI()
+	link := base + meta.Link
+	image := meta.Image
+	if strings.HasPrefix(image, "/") {
+		image = base + image
+	}
+	entries := buildFeedEntries(items, relays, base)
+
+	updated := time.Now().UTC()
+	if len(entries) > 0 {
+		updated = entries[0].Updated
+	}
+
+	var err error
+	switch format {
+	case mimeAtom:
+		err = writeAtom(w, meta, self, link, image, updated, entries)
+	case mimeJSONFeed:
+		err = writeJSONFeed(w, meta, self, link, image, entries)
+	default:
+		err = writeRSS(w, meta, self, link, image, updated, entries)
+	}
+	if err != nil {
+		slog.Warn("Failed to write feed", "format", format, "error", err)
+	}
+}
+
+// RSS 2.0
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      rssSelf   `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Image         *rssImage `xml:"image,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssSelf struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Creator     string   `xml:"dc:creator"`
+	Categories  []string `xml:"category"`
+	Description rssCDATA `xml:"description"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssCDATA struct {
+	Value string `xml:",cdata"`
+}
+
+func writeRSS(w http.ResponseWriter, meta feedMeta, self, link, image string, updated time.Time, entries []feedEntry) error {
+	channel := rssChannel{
+		Title:         meta.Title,
+		Link:          link,
+		Description:   meta.Description,
+		AtomLink:      rssSelf{Href: self, Rel: "self", Type: mimeRSS},
+		LastBuildDate: updated.Format(time.RFC1123Z),
+		Items:         make([]rssItem, len(entries)),
+	}
+	if image != "" {
+		channel.Image = &rssImage{URL: image, Title: meta.Title, Link: link}
+	}
+	for i, e := range entries {
+		channel.Items[i] = rssItem{
+			Title:       e.Title,
+			Link:        e.URL,
+			GUID:        rssGUID{Value: e.ID},
+			PubDate:     e.Published.Format(time.RFC1123Z),
+			Creator:     e.Author,
+			Categories:  e.Tags,
+			Description: rssCDATA{Value: e.HTML},
+		}
+	}
+
+	w.Header().Set("Content-Type", mimeRSS+"; charset=utf-8")
+	return writeXML(w, rssDocument{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: channel,
+	})
+}
+
+// Atom 1.0
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Icon     string      `xml:"icon,omitempty"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     atomAuthor     `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary,omitempty"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func writeAtom(w http.ResponseWriter, meta feedMeta, self, link, image string, updated time.Time, entries []feedEntry) error {
+	feed := atomFeed{
+		ID:       self,
+		Title:    meta.Title,
+		Subtitle: meta.Description,
+		Updated:  updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: self, Rel: "self", Type: mimeAtom},
+			{Href: link, Rel: "alternate", Type: "text/html"},
+		},
+		Icon:    image,
+		Entries: make([]atomEntry, len(entries)),
+	}
+	for i, e := range entries {
+		entry := atomEntry{
+			ID:        e.ID,
+			Title:     e.Title,
+			Link:      atomLink{Href: e.URL, Rel: "alternate", Type: "text/html"},
+			Published: e.Published.Format(time.RFC3339),
+			Updated:   e.Updated.Format(time.RFC3339),
+			Author:    atomAuthor{Name: e.Author},
+			Summary:   e.Summary,
+			Content:   atomContent{Type: "html", Value: e.HTML},
+		}
+		for _, t := range e.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: t})
+		}
+		feed.Entries[i] = entry
+	}
+
+	w.Header().Set("Content-Type", mimeAtom+"; charset=utf-8")
+	return writeXML(w, feed)
+}
+
+func writeXML(w http.ResponseWriter, v any) error {
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(v)
+}
+
+// JSON Feed 1.1
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Icon        string         `json:"icon,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title,omitempty"`
+	Summary       string           `json:"summary,omitempty"`
+	ContentHTML   string           `json:"content_html"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+func writeJSONFeed(w http.ResponseWriter, meta feedMeta, self, link, image string, entries []feedEntry) error {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       meta.Title,
+		HomePageURL: link,
+		FeedURL:     self,
+		Description: meta.Description,
+		Icon:        image,
+		Items:       make([]jsonFeedItem, len(entries)),
+	}
+	for i, e := range entries {
+		item := jsonFeedItem{
+			ID:            e.ID,
+			URL:           e.URL,
+			Title:         e.Title,
+			Summary:       e.Summary,
+			ContentHTML:   e.HTML,
+			DatePublished: e.Published.Format(time.RFC3339),
+			Authors:       []jsonFeedAuthor{{Name: e.Author}},
+			Tags:          e.Tags,
+		}
+		if !e.Updated.Equal(e.Published) {
+			item.DateModified = e.Updated.Format(time.RFC3339)
+		}
+		feed.Items[i] = item
+	}
+
+	w.Header().Set("Content-Type", mimeJSONFeed+"; charset=utf-8")
+	return json.NewEncoder(w).Encode(feed)
+}
+
+// fetchFeedItems fetches top-level notes and articles matching filter and
+// attaches author profiles
+func fetchFeedItems(relays []string, filter Filter) []EventItem {
+	limit := filter.Limit
+	filter.Kinds = feedKinds
+	filter.Limit = limit * 2 // Fetch more since we'll filter out replies
+	events, _ := fetchEventsFromRelaysCached(relays, filter)
+
+	topLevel := make([]Event, 0, len(events))
+	pubkeySet := make(map[string]bool)
+	for _, evt := range events {
+		if evt.Kind == 1 && isReply(evt) {
+			continue
+		}
+		topLevel = append(topLevel, evt)
+		pubkeySet[evt.PubKey] = true
+		if len(topLevel) == limit {
+			break
+		}
+	}
+
+	pubkeys := make([]string, 0, len(pubkeySet))
+	for pk := range pubkeySet {
+		pubkeys = append(pubkeys, pk)
+	}
+	profiles := fetchProfiles(relays, pubkeys)
+
+	items := make([]EventItem, len(topLevel))
+	for i, evt := range topLevel {
+		items[i] = EventItem{
+			ID:            evt.ID,
+			Kind:          evt.Kind,
+			Pubkey:        evt.PubKey,
+			CreatedAt:     evt.CreatedAt,
+			Content:       evt.Content,
+			Tags:          evt.Tags,
+			Sig:           evt.Sig,
+			RelaysSeen:    evt.RelaysSeen,
+			AuthorProfile: profiles[evt.PubKey],
+		}
+	}
+	return items
+}
+
+// serveFeed answers a /feed/ request: RSS unless Accept asks for Atom or
+// JSON Feed, with an ETag so readers polling an unchanged feed get a 304
+func serveFeed(w http.ResponseWriter, r *http.Request, meta feedMeta, items []EventItem, relays []string) {
+	w.Header().Set("Vary", "Accept")
+	etag := generateETag(items)
+	w.Header().Set("ETag", etag)
+	if len(items) > 0 {
+		w.Header().Set("Last-Modified", time.Unix(items[0].CreatedAt, 0).UTC().Format(http.TimeFormat))
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" && match == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Cache-Control", "max-age=300")
+
+	format := feedFormat(r.Header.Get("Accept"))
+	if format == "" {
+		format = mimeRSS
+	}
+	writeFeed(w, r, format, meta, items, relays)
+}
+
+// feedProfileHandler serves /feed/profile/{npub}.xml
+func feedProfileHandler(w http.ResponseWriter, r *http.Request) {
+	pubkey := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/feed/profile/"), ".xml")
+	npub := pubkey
+	if strings.HasPrefix(pubkey, "npub1") {
+		hexPubkey, err := decodeBech32Pubkey(pubkey)
+		if err != nil {
+			http.Error(w, "Invalid npub format", http.StatusBadRequest)
+			return
+		}
+		pubkey = hexPubkey
+	} else if encoded, err := encodeBech32Pubkey(pubkey); err == nil {
+		npub = encoded
+	}
+	if !isValidEventID(pubkey) {
+		http.Error(w, "Pubkey required (hex or npub)", http.StatusBadRequest)
+		return
+	}
+
+	relays, ok := parseRequestRelays(w, r)
+	if !ok {
+		return
+	}
+	if len(relays) == 0 {
+		relays = defaultReadRelays()
+	}
+	limit := parseLimit(r.URL.Query().Get("limit"), 20)
+
+	var items []EventItem
+	var profile *ProfileInfo
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		items = fetchFeedItems(relays, Filter{Authors: []string{pubkey}, Limit: limit})
+	}()
+	go func() {
+		defer wg.Done()
+		profile = fetchProfiles(relays, []string{pubkey})[pubkey]
+	}()
+	wg.Wait()
+
+	name := feedAuthorName(pubkey, profile)
+	meta := feedMeta{
+		Title:       name,
+		Description: fmt.Sprintf("Notes and articles by %s on Nostr", name),
+		Link:        "/html/profile/" + npub,
+	}
+	if profile != nil {
+		if profile.About != "" {
+			meta.Description = profile.About
+		}
+		meta.Image = profile.Picture
+	}
+	serveFeed(w, r, meta, items, relays)
+}
+
+// feedTagHandler serves /feed/tag/{hashtag}.xml
+func feedTagHandler(w http.ResponseWriter, r *http.Request) {
+	hashtag := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/feed/tag/"), ".xml")
+	hashtag = strings.ToLower(strings.TrimPrefix(hashtag, "#"))
+	if hashtag == "" || len(hashtag) > 64 || strings.ContainsAny(hashtag, "/ ") {
+		http.Error(w, "Hashtag required", http.StatusBadRequest)
+		return
+	}
+
+	relays, ok := parseRequestRelays(w, r)
+	if !ok {
+		return
+	}
+	if len(relays) == 0 {
+		relays = defaultReadRelays()
+	}
+	limit := parseLimit(r.URL.Query().Get("limit"), 20)
+
+	items := fetchFeedItems(relays, Filter{Tags: map[string][]string{"t": {hashtag}}, Limit: limit})
+	meta := feedMeta{
+		Title:       "#" + hashtag,
+		Description: fmt.Sprintf("Nostr notes and articles tagged #%s", hashtag),
+		Link:        "/html/timeline?kinds=1&limit=20",
+	}
+	serveFeed(w, r, meta, items, relays)
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NIP-29 relay-based groups. A group lives on one relay, which publishes its
+// metadata (kind 39000) and member list (kind 39002). Members chat with kind
+// 9 messages carrying the group's h tag, and ask to join with kind 9021.
+
+const (
+	kindGroupChat     = 9
+	kindGroupJoin     = 9021
+	kindGroupMetadata = 39000
+	kindGroupMembers  = 39002
+	kindGroupsList    = 10009
+)
+
+const (
+	groupChatLimit       = 50 // Messages per page
+	maxGroupPreviousRefs = 3  // Recent messages referenced by a new message's previous tag
+	maxGroupsListed      = 50
+)
+
+// groupIDRegex matches the group ids NIP-29 allows
+var groupIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// HTMLGroup is a group's metadata and the reader's membership
+type HTMLGroup struct {
+	ID       string
+	Relay    string
+	Name     string
+	About    string
+	Picture  string
+	Closed   bool // Join requests need approval
+	Private  bool // Only members can read
+	Members  int  // From the relay's member list, 0 when not published
+	IsMember bool
+}
+
+// HTMLGroupMessage is a chat message in a group
+type HTMLGroupMessage struct {
+	ID          string
+	Pubkey      string
+	Npub        string
+	NpubShort   string
+	Profile     *ProfileInfo
+	CreatedAt   int64
+	ContentHTML template.HTML
+	IsMine      bool
+}
+
+// parseGroupRef validates a group's relay and id from a request
+func parseGroupRef(relay, id string) (string, string, bool) {
+	relayURL, ok := normalizeRelayURL(relay)
+	id = strings.TrimSpace(id)
+	if !ok || !groupIDRegex.MatchString(id) {
+		return "", "", false
+	}
+	return relayURL, id, true
+}
+
+// groupURL is the page of a group
+func groupURL(relay, id string) string {
+	return "/html/group?relay=" + url.QueryEscape(relay) + "&id=" + url.QueryEscape(id)
+}
+
+// applyGroupMetadata fills a group from its kind 39000 event
+func (g *HTMLGroup) applyGroupMetadata(evt Event) {
+	for _, tag := range evt.Tags {
+		if len(tag) == 0 {
+			continue
+		}
+		switch tag[0] {
+		case "name":
+			if len(tag) >= 2 && strings.TrimSpace(tag[1]) != "" {
+				g.Name = strings.TrimSpace(tag[1])
+			}
+		case "about":
+			if len(tag) >= 2 {
+				g.About = strings.TrimSpace(tag[1])
+			}
+		case "picture":
+			if len(tag) >= 2 && (strings.HasPrefix(tag[1], "https://") || strings.HasPrefix(tag[1], "http://")) {
+				g.Picture = tag[1]
+			}
+		case "closed":
+			g.Closed = true
+		case "private":
+			g.Private = true
+		}
+	}
+}
+
+// HTMLGroupData is the data for a group page
+type HTMLGroupData struct {
+	HTMLPageChrome
+	Group      *HTMLGroup
+	Messages   []HTMLGroupMessage // Oldest first, like a chat
+	Previous   string             // Comma-separated previous refs for the post form
+	Pagination *HTMLPagination
+	ReturnURL  string
+}
+
+var htmlGroupTemplate = `{{define "page-style"}}{{template "emoji-style"}}{{template "community-style"}}
+    .group-header { display: flex; gap: 12px; align-items: center; }
+    .group-picture { width: 56px; height: 56px; border-radius: 8px; object-fit: cover; flex-shrink: 0; }
+    .group-message { padding: 8px 0; border-bottom: 1px solid var(--border-color); }
+    .group-message:last-child { border-bottom: none; }
+    .group-message.mine .card-title { color: var(--accent); }
+{{end}}{{template "page-head" .}}
+    {{template "page-nav" .}}
+    <main>
+      {{with .Group}}
+      <div class="card">
+        <div class="group-header">
+          {{if .Picture}}<img src="{{proxyImage .Picture 96}}" alt="" class="group-picture" loading="lazy">{{end}}
+          <div>
+            <h2 style="margin-bottom: 2px;">{{.Name}}</h2>
+            <div class="card-meta">{{.Relay}}{{if .Members}} · {{.Members}} members{{end}}{{if .Closed}} · closed{{end}}{{if .Private}} · private{{end}}</div>
+          </div>
+        </div>
+        {{if .About}}<p class="community-description" style="margin-top: 8px;">{{.About}}</p>{{end}}
+      </div>
+      {{end}}
+      {{if .Pagination}}
+      <div class="pagination" style="border-top: none; margin-top: 0;">
+        <a href="{{.Pagination.Next}}" class="link">&larr; Older messages</a>
+      </div>
+      {{end}}
+      <div class="card">
+        {{range .Messages}}
+        <div class="group-message{{if .IsMine}} mine{{end}}">
+          <div class="text-sm">
+            <a href="/html/profile/{{.Npub}}" class="card-title">{{if and .Profile (or .Profile.DisplayName .Profile.Name)}}{{if .Profile.DisplayName}}{{.Profile.DisplayName}}{{else}}{{.Profile.Name}}{{end}}{{else}}{{.NpubShort}}{{end}}</a>
+            <span class="card-meta">{{formatTime .CreatedAt}}</span>
+          </div>
+          <div class="community-post-content">{{.ContentHTML}}</div>
+        </div>
+        {{else}}
+        <div class="empty-state">
+          <p>No messages.</p>
+          {{if .Group.Private}}<p class="empty-state-hint">This group is private; its relay only shows messages to members.</p>{{end}}
+        </div>
+        {{end}}
+      </div>
+      {{if .LoggedIn}}
+      {{if .Group.IsMember}}
+      <form method="POST" action="/html/group/post" class="card">
+        <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+        <input type="hidden" name="relay" value="{{.Group.Relay}}">
+        <input type="hidden" name="id" value="{{.Group.ID}}">
+        <input type="hidden" name="previous" value="{{.Previous}}">
+        <label for="group-content" class="sr-only">Message</label>
+        <textarea id="group-content" name="content" class="text-input wide" rows="2" placeholder="Message {{.Group.Name}}" required></textarea>
+        <div class="form-row" style="margin-top: 8px;">
+          <button type="submit" class="primary-btn">Send</button>
+        </div>
+      </form>
+      {{else}}
+      <form method="POST" action="/html/group/join" class="card form-row">
+        <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+        <input type="hidden" name="relay" value="{{.Group.Relay}}">
+        <input type="hidden" name="id" value="{{.Group.ID}}">
+        {{if .Group.Closed}}
+        <label for="group-code" class="sr-only">Invite code</label>
+        <input id="group-code" type="text" name="code" class="text-input" placeholder="Invite code (optional)">
+        {{end}}
+        <button type="submit" class="primary-btn">{{if .Group.Closed}}Request to join{{else}}Join group{{end}}</button>
+      </form>
+      {{end}}
+      {{end}}
+    </main>
+    {{template "page-footer" .}}`
+
+var cachedGroupTemplate *template.Template
+
+// htmlGroupHandler shows a group's chat: /html/group?relay=...&id=...&until=...
+func htmlGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	relay, id, ok := parseGroupRef(q.Get("relay"), q.Get("id"))
+	if !ok {
+		http.Error(w, "Invalid group relay or id", http.StatusBadRequest)
+		return
+	}
+	// Group relays are chosen by the reader, so they count as custom relays
+	if !chargeCustomRelays(w, r, []string{relay}) {
+		return
+	}
+
+	session := getSessionFromRequest(r)
+	readRelays, _ := sessionRelays(session)
+	viewer := ""
+	if session != nil && session.Connected {
+		viewer = hex.EncodeToString(session.UserPubKey)
+	}
+	until := parseInt64(q.Get("until"))
+	relays := []string{relay}
+
+	group := &HTMLGroup{ID: id, Relay: relay, Name: id}
+	var messages []Event
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		// Metadata and members are addressable events the relay signs itself
+		for _, evt := range fetchReplaceable(relays, Filter{
+			Kinds: []int{kindGroupMetadata, kindGroupMembers},
+			Tags:  map[string][]string{"d": {id}},
+			Limit: 2,
+		}).Events {
+			switch evt.Kind {
+			case kindGroupMetadata:
+				group.applyGroupMetadata(evt)
+			case kindGroupMembers:
+				for _, tag := range evt.Tags {
+					if len(tag) >= 2 && tag[0] == "p" {
+						group.Members++
+						if tag[1] == viewer {
+							group.IsMember = true
+						}
+					}
+				}
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		// Chat is live, so it skips the event store
+		messages, _ = fetchEventsFromRelays(relays, Filter{
+			Kinds: []int{kindGroupChat},
+			Tags:  map[string][]string{"h": {id}},
+			Limit: groupChatLimit + 1,
+			Until: until,
+		})
+	}()
+	wg.Wait()
+
+	sortEventsNewestFirst(messages)
+	var next *int64
+	if len(messages) > groupChatLimit {
+		messages = messages[:groupChatLimit]
+		nextUntil := messages[len(messages)-1].CreatedAt
+		next = &nextUntil
+	}
+
+	// A relay that doesn't publish member lists still accepts its members' messages
+	for _, evt := range messages {
+		if evt.PubKey == viewer {
+			group.IsMember = true
+			break
+		}
+	}
+
+	var previous []string
+	pubkeys := make([]string, 0, len(messages))
+	for i, evt := range messages {
+		pubkeys = append(pubkeys, evt.PubKey)
+		if i < maxGroupPreviousRefs && until == nil {
+			previous = append(previous, evt.ID[:8])
+		}
+	}
+	profiles := fetchProfiles(profileRelays(), dedupeStrings(pubkeys))
+
+	media := newMediaBlur(r, session)
+	items := make([]HTMLGroupMessage, len(messages))
+	for i, evt := range messages {
+		npub, _ := encodeBech32Pubkey(evt.PubKey)
+		item := HTMLGroupMessage{
+			ID:          evt.ID,
+			Pubkey:      evt.PubKey,
+			Npub:        npub,
+			NpubShort:   formatNpubShort(npub),
+			Profile:     profiles[evt.PubKey],
+			CreatedAt:   evt.CreatedAt,
+			ContentHTML: template.HTML(replaceCustomEmoji(string(processContentToHTML(evt.Content)), emojiTags(evt.Tags))),
+			IsMine:      evt.PubKey == viewer,
+		}
+		if media.blurs(evt.PubKey) {
+			item.ContentHTML = blurMediaHTML(item.ContentHTML)
+		}
+		// Chats read top to bottom, oldest first
+		items[len(messages)-1-i] = item
+	}
+
+	returnURL := groupURL(relay, id)
+	data := HTMLGroupData{
+		HTMLPageChrome: newPageChrome(group.Name, r, session, readRelays),
+		Group:          group,
+		Messages:       items,
+		Previous:       strings.Join(previous, ","),
+		ReturnURL:      returnURL,
+	}
+	data.NavTab = "communities"
+	if next != nil {
+		data.Pagination = &HTMLPagination{Next: fmt.Sprintf("%s&until=%d", returnURL, *next)}
+	}
+
+	html, err := executePageTemplate(cachedGroupTemplate, data)
+	if err != nil {
+		slog.Error("Error rendering group", "error", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(html))
+}
+
+// htmlGroupJoinHandler sends a kind 9021 join request to the group's relay
+func htmlGroupJoinHandler(w http.ResponseWriter, r *http.Request) {
+	signGroupEvent(w, r, "join", func(r *http.Request, id string) (UnsignedEvent, string) {
+		tags := [][]string{{"h", id}}
+		if code := strings.TrimSpace(r.FormValue("code")); code != "" {
+			tags = append(tags, []string{"code", truncateString(code, 128)})
+		}
+		return UnsignedEvent{Kind: kindGroupJoin, Tags: tags}, ""
+	})
+}
+
+// htmlGroupPostHandler sends a kind 9 chat message to the group's relay
+func htmlGroupPostHandler(w http.ResponseWriter, r *http.Request) {
+	signGroupEvent(w, r, "message", func(r *http.Request, id string) (UnsignedEvent, string) {
+		content := strings.TrimSpace(r.FormValue("content"))
+		if content == "" {
+			return UnsignedEvent{}, "Message content is required"
+		}
+		tags := [][]string{{"h", id}}
+		// References to recent messages help the relay keep one timeline
+		previous := []string{"previous"}
+		for _, ref := range strings.Split(r.FormValue("previous"), ",") {
+			if len(ref) == 8 && isHex(ref) && len(previous) <= maxGroupPreviousRefs {
+				previous = append(previous, ref)
+			}
+		}
+		if len(previous) > 1 {
+			tags = append(tags, previous)
+		}
+		return UnsignedEvent{Kind: kindGroupChat, Content: content, Tags: tags}, ""
+	})
+}
+
+// signGroupEvent handles the shared part of the group forms: login, CSRF,
+// the group reference, signing and sending to the group's relay. Unlike
+// other publishes it waits for the relay's answer, since a group relay
+// refuses events from non-members and that's worth telling the user.
+func signGroupEvent(w http.ResponseWriter, r *http.Request, what string, build func(r *http.Request, id string) (UnsignedEvent, string)) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/html/communities", http.StatusSeeOther)
+		return
+	}
+
+	session := getSessionFromRequest(r)
+	if session == nil || !session.Connected {
+		http.Redirect(w, r, "/html/login?error=Please+login+first", http.StatusSeeOther)
+		return
+	}
+
+	if !validateCSRFToken(session.ID, r.FormValue("csrf_token")) {
+		http.Error(w, "Invalid or expired CSRF token", http.StatusForbidden)
+		return
+	}
+
+	relay, id, ok := parseGroupRef(r.FormValue("relay"), r.FormValue("id"))
+	if !ok {
+		http.Redirect(w, r, "/html/communities?error=Invalid+group", http.StatusSeeOther)
+		return
+	}
+	returnURL := groupURL(relay, id)
+
+	event, problem := build(r, id)
+	if problem != "" {
+		http.Redirect(w, r, returnURL+"&error="+escapeURLParam(problem), http.StatusSeeOther)
+		return
+	}
+	event.CreatedAt = time.Now().Unix()
+
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
+	defer cancel()
+
+	signedEvent, err := session.SignEvent(ctx, event)
+	if err != nil {
+		slog.Warn("Failed to sign group "+what, "group", id, "error", err)
+		http.Redirect(w, r, returnURL+"&error="+escapeURLParam(sanitizeErrorForUser("Sign event", err)), http.StatusSeeOther)
+		return
+	}
+
+	if err := publishToRelay(ctx, relay, signedEvent); err != nil {
+		slog.Warn("Group relay refused "+what, "relay", relay, "group", id, "error", err)
+		http.Redirect(w, r, returnURL+"&error="+escapeURLParam("The group relay didn't accept your "+what+": "+groupRelayReason(err)), http.StatusSeeOther)
+		return
+	}
+
+	slog.Info("Published group "+what, "event", signedEvent.ID, "relay", relay, "group", id)
+	success := "Message sent"
+	if event.Kind == kindGroupJoin {
+		success = "Join request sent"
+	}
+	http.Redirect(w, r, returnURL+"&success="+escapeURLParam(success), http.StatusSeeOther)
+}
+
+// groupRelayReason extracts the relay's message from a publish error
+func groupRelayReason(err error) string {
+	msg := err.Error()
+	if i := strings.Index(msg, ": "); i >= 0 && strings.HasPrefix(msg, "relay rejected event") && i+2 < len(msg) {
+		return msg[i+2:]
+	}
+	return "it could not be reached"
+}
+
+// isHex reports whether s is lowercase hex
+func isHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// savedGroups returns the groups in a user's kind 10009 list
+func savedGroups(relays []string, pubkey string) []HTMLCommunityListItem {
+	lists := fetchReplaceable(relays, Filter{
+		Kinds:   []int{kindGroupsList},
+		Authors: []string{pubkey},
+		Limit:   1,
+	}).Events
+	if len(lists) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var items []HTMLCommunityListItem
+	for _, tag := range lists[0].Tags {
+		// ["group", <id>, <relay>, <optional name>]
+		if len(tag) < 3 || tag[0] != "group" || len(items) >= maxGroupsListed {
+			continue
+		}
+		relay, id, ok := parseGroupRef(tag[2], tag[1])
+		if !ok || seen[relay+"'"+id] {
+			continue
+		}
+		seen[relay+"'"+id] = true
+		name := id
+		if len(tag) >= 4 && strings.TrimSpace(tag[3]) != "" {
+			name = strings.TrimSpace(tag[3])
+		}
+		items = append(items, HTMLCommunityListItem{Name: name, URL: groupURL(relay, id), Note: relay})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return strings.ToLower(items[i].Name) < strings.ToLower(items[j].Name)
+	})
+	return items
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"sort"
 	"strconv"
@@ -31,6 +32,9 @@ type EventItem struct {
 	AuthorProfile *ProfileInfo      `json:"author_profile,omitempty"`
 	Reactions     *ReactionsSummary `json:"reactions,omitempty"`
 	ReplyCount    int               `json:"reply_count"`
+
+	// NIP-36 content-warning reason; present (possibly empty) only when the event has the tag
+	ContentWarning *string `json:"content_warning,omitempty"`
 }
 
 type ProfileInfo struct {
@@ -47,6 +51,7 @@ type ProfileInfo struct {
 type ReactionsSummary struct {
 	Total   int            `json:"total"`
 	ByType  map[string]int `json:"by_type"`
+	ByEmoji map[string]*EmojiReaction `json:"by_emoji,omitempty"` // NIP-30 custom emoji, keyed by image URL
 }
 
 type PageInfo struct {
@@ -69,6 +74,7 @@ type ThreadResponse struct {
 type ProfileResponse struct {
 	Pubkey  string           `json:"pubkey"`
 	Profile *ProfileInfo     `json:"profile"`
+	Counts  *FollowCounts    `json:"counts,omitempty"`
 	Notes   TimelineResponse `json:"notes"`
 }
 
@@ -88,15 +94,12 @@ func timelineHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse query parameters
 	q := r.URL.Query()
 
-	relays := parseStringList(q.Get("relays"))
+	relays, ok := parseRequestRelays(w, r)
+	if !ok {
+		return
+	}
 	if len(relays) == 0 {
-		relays = []string{
-			"wss://relay.damus.io",
-			"wss://relay.nostr.band",
-			"wss://relay.primal.net",
-			"wss://nos.lol",
-			"wss://nostr.mom",
-		}
+		relays = defaultReadRelays()
 	}
 
 	authors := parseStringList(q.Get("authors"))
@@ -119,10 +122,10 @@ func timelineHandler(w http.ResponseWriter, r *http.Request) {
 	noReplies := q.Get("no_replies") != "0" // Default to filtering replies
 
 	// Fetch events from relays (with caching)
-	log.Printf("Fetching events: kinds=%v, authors=%v, limit=%d", kinds, authors, limit)
+	slog.Debug("Fetching events", "kinds", kinds, "authors", len(authors), "limit", limit)
 	start := time.Now()
 	events, eose := fetchEventsFromRelaysCached(relays, filter)
-	log.Printf("Fetched %d events in %v (eose=%v)", len(events), time.Since(start), eose)
+	slog.Debug("Fetched events", "events", len(events), "duration", time.Since(start), "eose", eose)
 
 	// Filter out replies (events with e tags) from main timeline
 	// Note: kind 6 (reposts) use e tags to reference the reposted event, not as replies
@@ -134,7 +137,7 @@ func timelineHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		events = filtered
-		log.Printf("After filtering replies: %d events", len(events))
+		slog.Debug("Filtered replies", "events", len(events))
 	}
 
 	// Filter out kind 30311 (live events) that don't have a streaming or recording URL
@@ -157,7 +160,7 @@ func timelineHandler(w http.ResponseWriter, r *http.Request) {
 			filtered = append(filtered, evt)
 		}
 		if len(filtered) != len(events) {
-			log.Printf("After filtering non-streaming live events: %d events (removed %d)", len(filtered), len(events)-len(filtered))
+			slog.Debug("Filtered non-streaming live events", "events", len(filtered), "removed", len(events)-len(filtered))
 		}
 		events = filtered
 	}
@@ -181,13 +184,13 @@ func timelineHandler(w http.ResponseWriter, r *http.Request) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			log.Printf("Fetching profiles for %d authors", len(pubkeySet))
+			slog.Debug("Fetching profiles", "authors", len(pubkeySet))
 			pubkeys := make([]string, 0, len(pubkeySet))
 			for pk := range pubkeySet {
 				pubkeys = append(pubkeys, pk)
 			}
 			profiles = fetchProfiles(relays, pubkeys)
-			log.Printf("Fetched %d profiles", len(profiles))
+			slog.Debug("Fetched profiles", "profiles", len(profiles))
 		}()
 	}
 
@@ -196,17 +199,17 @@ func timelineHandler(w http.ResponseWriter, r *http.Request) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			log.Printf("Fetching reactions for %d events", len(eventIDs))
+			slog.Debug("Fetching reactions", "events", len(eventIDs))
 			reactions = fetchReactions(relays, eventIDs)
-			log.Printf("Fetched reactions for %d events", len(reactions))
+			slog.Debug("Fetched reactions", "events", len(reactions))
 		}()
 
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			log.Printf("Fetching reply counts for %d events", len(eventIDs))
+			slog.Debug("Fetching reply counts", "events", len(eventIDs))
 			replyCounts = fetchReplyCounts(relays, eventIDs)
-			log.Printf("Fetched reply counts: %d events have replies", len(replyCounts))
+			slog.Debug("Fetched reply counts", "with_replies", len(replyCounts))
 		}()
 	}
 
@@ -228,6 +231,7 @@ func timelineHandler(w http.ResponseWriter, r *http.Request) {
 			Reactions:     reactions[evt.ID],
 			ReplyCount:    replyCounts[evt.ID],
 		}
+		items[i].ContentWarning = contentWarningProperty(evt.Tags)
 	}
 
 	resp := TimelineResponse{
@@ -282,8 +286,14 @@ func timelineHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Cache-Control", "max-age=5")
 
-	// Check Accept header for hypermedia format
-	if strings.Contains(accept, "application/vnd.siren+json") {
+	// Check Accept header for feed and hypermedia formats
+	if format := feedFormat(accept); format != "" {
+		writeFeed(w, r, format, feedMeta{
+			Title:       "Nostr timeline",
+			Description: "Notes from " + strconv.Itoa(len(relays)) + " Nostr relays",
+			Link:        "/html/timeline?kinds=1&limit=20",
+		}, items, relays)
+	} else if strings.Contains(accept, "application/vnd.siren+json") {
 		w.Header().Set("Content-Type", "application/vnd.siren+json")
 		siren := toSirenTimeline(resp, relays, authors, kinds, limit, fast)
 		json.NewEncoder(w).Encode(siren)
@@ -319,7 +329,7 @@ func parseLimit(s string, defaultLimit int) int {
 		return defaultLimit
 	}
 	n, err := strconv.Atoi(s)
-	if err != nil || n <= 0 || n > 200 {
+	if err != nil || n <= 0 || n > currentConfig().Limits.MaxPageSize {
 		return defaultLimit
 	}
 	return n
@@ -370,19 +380,15 @@ func threadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	q := r.URL.Query()
-	relays := parseStringList(q.Get("relays"))
+	relays, ok := parseRequestRelays(w, r)
+	if !ok {
+		return
+	}
 	if len(relays) == 0 {
-		relays = []string{
-			"wss://relay.damus.io",
-			"wss://relay.nostr.band",
-			"wss://relay.primal.net",
-			"wss://nos.lol",
-			"wss://nostr.mom",
-		}
+		relays = defaultReadRelays()
 	}
 
-	log.Printf("Fetching thread for event: %s", eventID)
+	slog.Debug("Fetching thread", "event", eventID)
 
 	// Fetch the root event and replies in parallel
 	var rootEvent *Event
@@ -447,6 +453,7 @@ func threadHandler(w http.ResponseWriter, r *http.Request) {
 		RelaysSeen:    rootEvent.RelaysSeen,
 		AuthorProfile: profiles[rootEvent.PubKey],
 	}
+	rootItem.ContentWarning = contentWarningProperty(rootEvent.Tags)
 
 	replyItems := make([]EventItem, len(replies))
 	for i, evt := range replies {
@@ -461,6 +468,7 @@ func threadHandler(w http.ResponseWriter, r *http.Request) {
 			RelaysSeen:    evt.RelaysSeen,
 			AuthorProfile: profiles[evt.PubKey],
 		}
+		replyItems[i].ContentWarning = contentWarningProperty(evt.Tags)
 	}
 
 	// Sort replies by created_at ASC (oldest first for reading order)
@@ -483,6 +491,70 @@ func threadHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// clientSignableKinds are the event kinds the Siren client may sign itself
+// (via NIP-07) and hand to the server for publishing.
+var clientSignableKinds = map[int]bool{
+	1: true, // note / reply
+	6: true, // repost
+	7: true, // reaction
+}
+
+// PublishResponse is returned after a client-signed event is accepted
+type PublishResponse struct {
+	ID     string   `json:"id"`
+	Relays []string `json:"relays"` // Relays that accepted the event
+}
+
+// publishEventHandler accepts an event signed by the client (e.g. with a
+// NIP-07 browser extension), verifies it, and publishes it to relays.
+func publishEventHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var evt Event
+	if err := json.NewDecoder(r.Body).Decode(&evt); err != nil {
+		http.Error(w, "Invalid event JSON", http.StatusBadRequest)
+		return
+	}
+
+	if !clientSignableKinds[evt.Kind] {
+		http.Error(w, "Event kind not accepted", http.StatusBadRequest)
+		return
+	}
+
+	// Reject events too far in the future
+	if evt.CreatedAt > time.Now().Add(10*time.Minute).Unix() {
+		http.Error(w, "Event created_at is in the future", http.StatusBadRequest)
+		return
+	}
+
+	if calculateEventID(&evt) != evt.ID {
+		http.Error(w, "Event ID does not match content", http.StatusBadRequest)
+		return
+	}
+	if !validateEventSignature(&evt) {
+		http.Error(w, "Invalid event signature", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	accepted := publishEventAccepted(ctx, defaultPublishRelays(), &evt)
+	if len(accepted) == 0 {
+		slog.Warn("No relay accepted client-signed event", "event", evt.ID, "kind", evt.Kind)
+		http.Error(w, "No relay accepted the event", http.StatusBadGateway)
+		return
+	}
+
+	slog.Info("Published client-signed event", "event", evt.ID, "kind", evt.Kind, "relays", len(accepted))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(PublishResponse{ID: evt.ID, Relays: accepted})
+}
+
 // isReply checks if an event is a reply (has e tags)
 func isReply(evt Event) bool {
 	for _, tag := range evt.Tags {
@@ -514,3 +586,144 @@ func buildPaginationURL(path string, relays []string, authors []string, kinds []
 
 	return strings.Join(parts, "&")
 }
+
+// profileHandler serves a profile with follow counts and its latest notes
+func profileHandler(w http.ResponseWriter, r *http.Request) {
+	// Tell browser to cache based on Accept header
+	w.Header().Set("Vary", "Accept")
+
+	// Extract pubkey from path: /profile/{pubkey}
+	pubkey := strings.TrimPrefix(r.URL.Path, "/profile/")
+	if strings.HasPrefix(pubkey, "npub1") {
+		hexPubkey, err := decodeBech32Pubkey(pubkey)
+		if err != nil {
+			http.Error(w, "Invalid npub format", http.StatusBadRequest)
+			return
+		}
+		pubkey = hexPubkey
+	}
+	if !isValidEventID(pubkey) {
+		http.Error(w, "Pubkey required (hex or npub)", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	relays, ok := parseRequestRelays(w, r)
+	if !ok {
+		return
+	}
+	if len(relays) == 0 {
+		relays = defaultReadRelays()
+	}
+	limit := parseLimit(q.Get("limit"), 20)
+	until := parseInt64(q.Get("until"))
+
+	slog.Debug("Fetching profile", "pubkey", shortID(pubkey))
+	resp := fetchProfilePage(relays, pubkey, limit, until, func(until int64) string {
+		return buildProfileURL(pubkey, relays, limit, &until)
+	})
+
+	w.Header().Set("Cache-Control", "max-age=30")
+	if strings.Contains(r.Header.Get("Accept"), "application/vnd.siren+json") {
+		w.Header().Set("Content-Type", "application/vnd.siren+json")
+		json.NewEncoder(w).Encode(toSirenProfile(resp, relays, limit))
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// fetchProfilePage fetches a profile, its follow counts and its latest
+// top-level notes in parallel. nextURL builds the link to the next page.
+func fetchProfilePage(relays []string, pubkey string, limit int, until *int64, nextURL func(until int64) string) ProfileResponse {
+	var profile *ProfileInfo
+	var counts *FollowCounts
+	var events []Event
+	var wg sync.WaitGroup
+
+	// Fetch profile (kind 0)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		profiles := fetchProfiles(relays, []string{pubkey})
+		profile = profiles[pubkey]
+	}()
+
+	// Follower counts only describe the profile, not a page of its notes
+	if until == nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counts = fetchFollowCounts(relays, pubkey)
+		}()
+	}
+
+	// Fetch user's top-level notes (kind 1, filtered to exclude replies)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		filter := Filter{
+			Authors: []string{pubkey},
+			Kinds:   []int{1},
+			Limit:   limit * 2, // Fetch more since we'll filter out replies
+			Until:   until,
+		}
+		events, _ = fetchEventsFromRelays(relays, filter)
+	}()
+
+	wg.Wait()
+
+	// Filter out replies (notes with e tags)
+	topLevelNotes := make([]Event, 0, len(events))
+	for _, evt := range events {
+		if !isReply(evt) {
+			topLevelNotes = append(topLevelNotes, evt)
+		}
+	}
+
+	// Apply limit after filtering
+	if len(topLevelNotes) > limit {
+		topLevelNotes = topLevelNotes[:limit]
+	}
+
+	// Build response items with enrichment
+	items := make([]EventItem, len(topLevelNotes))
+	for i, evt := range topLevelNotes {
+		items[i] = EventItem{
+			ID:            evt.ID,
+			Kind:          evt.Kind,
+			Pubkey:        evt.PubKey,
+			CreatedAt:     evt.CreatedAt,
+			Content:       evt.Content,
+			Tags:          evt.Tags,
+			Sig:           evt.Sig,
+			RelaysSeen:    evt.RelaysSeen,
+			AuthorProfile: profile, // Use the fetched profile for all notes
+		}
+		items[i].ContentWarning = contentWarningProperty(evt.Tags)
+	}
+
+	// Build pagination
+	var page PageInfo
+	if len(items) > 0 {
+		lastCreatedAt := items[len(items)-1].CreatedAt
+		next := nextURL(lastCreatedAt)
+		page.Until = &lastCreatedAt
+		page.Next = &next
+	}
+
+	return ProfileResponse{
+		Pubkey:  pubkey,
+		Profile: profile,
+		Counts:  counts,
+		Notes: TimelineResponse{
+			Items: items,
+			Page:  page,
+			Meta: MetaInfo{
+				QueriedRelays: len(relays),
+				EOSE:          true,
+				GeneratedAt:   time.Now(),
+			},
+		},
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"html"
 	"html/template"
 	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -108,29 +109,49 @@ func initTemplates() {
 		"gt": func(a, b int) bool {
 			return a > b
 		},
+		"hasPrefix": func(s, prefix string) bool {
+			return strings.HasPrefix(s, prefix)
+		},
+		"trimPrefix": func(s, prefix string) string {
+			return strings.TrimPrefix(s, prefix)
+		},
+		"proxyImage": proxyImageURL,
+		"scheduleFields": defaultScheduleFields,
 	}
 
 	var err error
 
 	// Compile main HTML template
-	cachedHTMLTemplate, err = template.New("html").Funcs(templateFuncMap).Parse(htmlTemplate)
+	cachedHTMLTemplate, err = template.New("html").Funcs(templateFuncMap).Parse(htmlTemplate + htmlPollTemplate + htmlCalendarTemplateBlocks + htmlCustomEmojiStyle + htmlReactionPickerTemplate + htmlScheduleTemplateBlocks)
 	if err != nil {
 		log.Fatalf("Failed to compile HTML template: %v", err)
 	}
 
 	// Compile thread template
-	cachedThreadTemplate, err = template.New("thread").Funcs(templateFuncMap).Parse(htmlThreadTemplate)
+	cachedThreadTemplate, err = template.New("thread").Funcs(templateFuncMap).Parse(htmlThreadTemplate + htmlPollTemplate + htmlCalendarTemplateBlocks + htmlCustomEmojiStyle + htmlReactionPickerTemplate + htmlScheduleTemplateBlocks)
 	if err != nil {
 		log.Fatalf("Failed to compile thread template: %v", err)
 	}
 
 	// Compile profile template
-	cachedProfileTemplate, err = template.New("profile").Funcs(templateFuncMap).Parse(htmlProfileTemplate)
+	cachedProfileTemplate, err = template.New("profile").Funcs(templateFuncMap).Parse(htmlProfileTemplate + htmlCustomEmojiStyle + htmlReactionPickerTemplate)
 	if err != nil {
 		log.Fatalf("Failed to compile profile template: %v", err)
 	}
 
-	log.Printf("All HTML templates compiled successfully")
+	// Compile pages built on the shared page chrome
+	cachedRelaySettingsTemplate = compilePageTemplate("relay-settings", htmlRelaySettingsTemplate)
+	cachedListsTemplate = compilePageTemplate("lists", htmlListsTemplate)
+	cachedDVMsTemplate = compilePageTemplate("dvms", htmlDVMsTemplate)
+	cachedWriteTemplate = compilePageTemplate("write", htmlWriteTemplate+htmlScheduleTemplateBlocks)
+	cachedCalendarTemplate = compilePageTemplate("calendar", htmlCalendarTemplate+htmlCalendarTemplateBlocks)
+	cachedReactionsTemplate = compilePageTemplate("reactions", htmlReactionsTemplate+htmlCustomEmojiStyle)
+	cachedCommunityTemplate = compilePageTemplate("community", htmlCommunityTemplate+htmlCommunityBlocks+htmlCustomEmojiStyle)
+	cachedCommunitiesTemplate = compilePageTemplate("communities", htmlCommunitiesTemplate+htmlCommunityBlocks)
+	cachedGroupTemplate = compilePageTemplate("group", htmlGroupTemplate+htmlCommunityBlocks+htmlCustomEmojiStyle)
+	cachedScheduledTemplate = compilePageTemplate("scheduled", htmlScheduledTemplate)
+
+	slog.Info("All HTML templates compiled successfully")
 }
 
 // getThemeFromRequest reads the theme cookie and returns (themeClass, themeLabel)
@@ -427,6 +448,32 @@ var htmlTemplate = `<!DOCTYPE html>
     .post-form:focus-within button[type="submit"] {
       display: block;
     }
+    .post-media {
+      display: none;
+      gap: 8px;
+      align-items: center;
+      flex-wrap: wrap;
+      margin-bottom: 10px;
+      font-size: 13px;
+      color: var(--text-secondary);
+    }
+    .post-form:focus-within .post-media { display: flex; }
+    .post-media input[type="text"] {
+      flex: 1;
+      min-width: 160px;
+      padding: 6px 10px;
+      border: 1px solid var(--border-color);
+      border-radius: 4px;
+      font-size: 13px;
+      font-family: inherit;
+      background: var(--bg-input);
+      color: var(--text-primary);
+    }
+    .post-media-kind { display: flex; align-items: center; gap: 4px; }
+    .post-poll { flex-basis: 100%; }
+    .post-poll summary { cursor: pointer; }
+    .post-poll-settings { display: flex; align-items: center; gap: 8px; flex-wrap: wrap; }
+    {{template "schedule-style"}}
     .nav-tab {
       padding: 8px 16px;
       background: var(--bg-badge);
@@ -501,6 +548,34 @@ var htmlTemplate = `<!DOCTYPE html>
       transition: box-shadow 0.2s;
     }
     .note:hover { box-shadow: 0 2px 8px var(--shadow); }
+    details.content-warning {
+      margin: 8px 0;
+      padding: 8px 12px;
+      border: 1px solid var(--border-color);
+      border-radius: 6px;
+    }
+    details.content-warning > summary {
+      cursor: pointer;
+      font-size: 14px;
+      color: var(--text-secondary);
+    }
+    details.content-warning[open] > summary { margin-bottom: 8px; }
+    details.blurred-media > summary {
+      display: block;
+      list-style: none;
+      cursor: pointer;
+      overflow: hidden;
+      border-radius: 8px;
+    }
+    details.blurred-media > summary::-webkit-details-marker { display: none; }
+    details.blurred-media:not([open]) img { filter: blur(24px); }
+    details.blurred-video > summary {
+      display: inline-block;
+      padding: 6px 12px;
+      border: 1px dashed var(--border-color);
+      font-size: 13px;
+      color: var(--text-secondary);
+    }
     .note-content {
       font-size: 15px;
       line-height: 1.6;
@@ -913,6 +988,10 @@ var htmlTemplate = `<!DOCTYPE html>
     .recording-btn:hover {
       background: var(--bg-secondary);
     }
+    {{template "poll-style"}}
+    {{template "calendar-style"}}
+    {{template "emoji-style"}}
+    {{template "reaction-picker-style"}}
     /* Highlight (kind 9802) styles */
     .highlight {
       padding: 16px 20px;
@@ -1890,10 +1969,13 @@ var htmlTemplate = `<!DOCTYPE html>
         {{if .LoggedIn}}
         <a href="?kinds=1&limit=20&feed=follows{{if not .ShowReactions}}&fast=1{{end}}" class="nav-tab{{if eq .FeedMode "follows"}} active{{end}}">Follows</a>
         {{end}}
-        <a href="?kinds=1&limit=20&feed=global{{if not .ShowReactions}}&fast=1{{end}}" class="nav-tab{{if or (eq .FeedMode "global") (not .LoggedIn)}} active{{end}}">Global</a>
+        <a href="?kinds=1&limit=20&feed=global{{if not .ShowReactions}}&fast=1{{end}}" class="nav-tab{{if or (eq .FeedMode "global") (and (not .LoggedIn) (not (hasPrefix .FeedMode "dvm:")))}} active{{end}}">Global</a>
         {{if .LoggedIn}}
         <a href="?kinds=1&limit=20&feed=me{{if not .ShowReactions}}&fast=1{{end}}" class="nav-tab{{if eq .FeedMode "me"}} active{{end}}">Me</a>
+        <a href="/html/lists" class="nav-tab{{if hasPrefix .FeedMode "list:"}} active{{end}}">{{if hasPrefix .FeedMode "list:"}}List: {{trimPrefix .FeedMode "list:"}}{{else}}Lists{{end}}</a>
+        <a href="/html/write" class="nav-tab">Write</a>
         {{end}}
+        <a href="/html/dvms" class="nav-tab{{if hasPrefix .FeedMode "dvm:"}} active{{end}}">Discover</a>
         <div class="ml-auto flex-center gap-md">
           {{if .LoggedIn}}
           <a href="/html/notifications" class="notification-bell" title="Notifications">🔔{{if .HasUnreadNotifications}}<span class="notification-badge"></span>{{end}}</a>
@@ -1912,6 +1994,15 @@ var htmlTemplate = `<!DOCTYPE html>
                   <button type="submit" class="ghost-btn text-xs">Theme: {{.ThemeLabel}}</button>
                 </form>
               </div>
+              {{if .LoggedIn}}
+              <div class="settings-item">
+                <form method="POST" action="/html/blur-media" class="inline-form">
+                  <button type="submit" class="ghost-btn text-xs">Unfollowed media: {{if .BlurMedia}}Blurred{{else}}Shown{{end}}</button>
+                </form>
+              </div>
+              <div class="settings-item"><a href="/html/settings/relays" class="text-muted text-xs">Relays</a></div>
+              <div class="settings-item"><a href="/html/scheduled" class="text-muted text-xs">Scheduled posts</a></div>
+              {{end}}
               {{if .ActiveRelays}}
               <div class="settings-divider">
                 <div class="settings-item">{{len .ActiveRelays}} relay{{if gt (len .ActiveRelays) 1}}s{{end}}:</div>
@@ -1928,7 +2019,7 @@ var htmlTemplate = `<!DOCTYPE html>
         </div>
       </nav>
       <div class="kind-filter">
-        <a href="/html/timeline?kinds=1,6,20,30023,9802,30311&limit=20&feed={{.FeedMode}}{{if not .ShowReactions}}&fast=1{{end}}" class="{{if eq .KindFilter "all"}}active{{end}}">All</a>
+        <a href="/html/timeline?kinds=1,6,20,30023,9802,30311,1068,31922,31923&limit=20&feed={{.FeedMode}}{{if not .ShowReactions}}&fast=1{{end}}" class="{{if eq .KindFilter "all"}}active{{end}}">All</a>
         <a href="/html/timeline?kinds=1&limit=20&feed={{.FeedMode}}{{if not .ShowReactions}}&fast=1{{end}}" class="{{if eq .KindFilter "notes"}}active{{end}}">Notes</a>
         <a href="/html/timeline?kinds=20&limit=20&feed={{.FeedMode}}{{if not .ShowReactions}}&fast=1{{end}}" class="{{if eq .KindFilter "photos"}}active{{end}}">Photos</a>
         <a href="/html/timeline?kinds=30023&limit=20&feed={{.FeedMode}}{{if not .ShowReactions}}&fast=1{{end}}" class="{{if eq .KindFilter "reads"}}active{{end}}">Longform</a>
@@ -1938,10 +2029,37 @@ var htmlTemplate = `<!DOCTYPE html>
         {{if eq .FeedMode "me"}}<span class="kind-filter-spacer"></span><a href="/html/profile/edit" class="edit-profile-link">Edit Profile</a>{{end}}
       </div>
       {{if .LoggedIn}}
-      <form method="POST" action="/html/post" class="post-form">
+      <form method="POST" action="/html/post" class="post-form" enctype="multipart/form-data">
         <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
         <label for="post-content" class="sr-only">Write a new note</label>
-        <textarea id="post-content" name="content" placeholder="What's on your mind?" required></textarea>
+        <textarea id="post-content" name="content" placeholder="What's on your mind?"></textarea>
+        <div class="post-media">
+          <label for="post-media" class="sr-only">Attach an image or video</label>
+          <input id="post-media" type="file" name="media" accept="image/*,video/*">
+          <label for="post-media-alt" class="sr-only">Image description</label>
+          <input id="post-media-alt" type="text" name="media_alt" placeholder="Image description (alt text)">
+          <label class="post-media-kind"><input type="checkbox" name="post_kind" value="20"> Picture post</label>
+          <label class="post-media-kind"><input type="checkbox" name="cw" value="1"> Content warning</label>
+          <label for="post-cw" class="sr-only">Content warning reason</label>
+          <input id="post-cw" type="text" name="content_warning" placeholder="Warning reason (optional)" maxlength="200">
+          <details class="post-poll">
+            <summary>Add a poll</summary>
+            <label for="post-poll-options" class="sr-only">Poll options</label>
+            <textarea id="post-poll-options" name="poll_options" rows="3" placeholder="One option per line (the note is the question)"></textarea>
+            <div class="post-poll-settings">
+              <label class="post-media-kind"><input type="checkbox" name="poll_multiple" value="1"> Multiple choice</label>
+              <label for="post-poll-ends">Closes</label>
+              <select id="post-poll-ends" name="poll_ends">
+                <option value="1h">in 1 hour</option>
+                <option value="1d" selected>in 1 day</option>
+                <option value="3d">in 3 days</option>
+                <option value="1w">in 1 week</option>
+                <option value="">never</option>
+              </select>
+            </div>
+          </details>
+          {{template "schedule-fields" (scheduleFields "post")}}
+        </div>
         <button type="submit">Post</button>
       </form>
       {{end}}
@@ -1992,7 +2110,7 @@ var htmlTemplate = `<!DOCTYPE html>
       <article class="note live-event">
         <div class="live-event-thumbnail">
           {{if .LiveImage}}
-          <img src="{{.LiveImage}}" alt="{{.LiveTitle}}">
+          <img src="{{proxyImage .LiveImage 800}}" alt="{{.LiveTitle}}">
           {{else}}
           <div class="live-event-thumbnail-placeholder"><span>LIVE</span></div>
           {{end}}
@@ -2019,7 +2137,7 @@ var htmlTemplate = `<!DOCTYPE html>
             {{range .LiveParticipants}}{{if eq .Role "host"}}
             <span class="host-label">Host:</span>
             <a href="/html/profile/{{.Npub}}" class="host-link" title="{{.NpubShort}}">
-              {{if and .Profile .Profile.Picture}}<img class="host-avatar" src="{{.Profile.Picture}}" alt="{{if .Profile.DisplayName}}{{.Profile.DisplayName}}{{else if .Profile.Name}}{{.Profile.Name}}{{else}}Host{{end}}'s avatar">{{end}}
+              {{if and .Profile .Profile.Picture}}<img class="host-avatar" src="{{proxyImage .Profile.Picture 96}}" alt="{{if .Profile.DisplayName}}{{.Profile.DisplayName}}{{else if .Profile.Name}}{{.Profile.Name}}{{else}}Host{{end}}'s avatar">{{end}}
               <span class="host-name">{{if and .Profile .Profile.DisplayName}}{{.Profile.DisplayName}}{{else if and .Profile .Profile.Name}}{{.Profile.Name}}{{else}}{{.NpubShort}}{{end}}</span>
             </a>
             {{end}}{{end}}
@@ -2116,7 +2234,7 @@ var htmlTemplate = `<!DOCTYPE html>
           <div class="bookmarks-author">
             <a href="/html/profile/{{.Npub}}">
               {{if and .AuthorProfile .AuthorProfile.Picture}}
-              <img class="bookmarks-author-avatar" src="{{.AuthorProfile.Picture}}" alt="{{if .AuthorProfile.DisplayName}}{{.AuthorProfile.DisplayName}}{{else if .AuthorProfile.Name}}{{.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
+              <img class="bookmarks-author-avatar" src="{{proxyImage .AuthorProfile.Picture 96}}" alt="{{if .AuthorProfile.DisplayName}}{{.AuthorProfile.DisplayName}}{{else if .AuthorProfile.Name}}{{.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
               {{else}}
               <img class="bookmarks-author-avatar" src="/static/avatar.jpg" alt="Default avatar">
               {{end}}
@@ -2150,7 +2268,7 @@ var htmlTemplate = `<!DOCTYPE html>
           <div class="highlight-author">
             <a href="/html/profile/{{.Npub}}">
               {{if and .AuthorProfile .AuthorProfile.Picture}}
-              <img class="highlight-author-avatar" src="{{.AuthorProfile.Picture}}" alt="{{if .AuthorProfile.DisplayName}}{{.AuthorProfile.DisplayName}}{{else if .AuthorProfile.Name}}{{.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
+              <img class="highlight-author-avatar" src="{{proxyImage .AuthorProfile.Picture 96}}" alt="{{if .AuthorProfile.DisplayName}}{{.AuthorProfile.DisplayName}}{{else if .AuthorProfile.Name}}{{.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
               {{else}}
               <img class="highlight-author-avatar" src="/static/avatar.jpg" alt="Default avatar">
               {{end}}
@@ -2169,7 +2287,7 @@ var htmlTemplate = `<!DOCTYPE html>
         <div class="note-author">
           <a href="/html/profile/{{.Npub}}" class="text-muted">
           {{if and .AuthorProfile .AuthorProfile.Picture}}
-          <img class="author-avatar" src="{{.AuthorProfile.Picture}}" alt="{{if .AuthorProfile.DisplayName}}{{.AuthorProfile.DisplayName}}{{else if .AuthorProfile.Name}}{{.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
+          <img class="author-avatar" src="{{proxyImage .AuthorProfile.Picture 96}}" alt="{{if .AuthorProfile.DisplayName}}{{.AuthorProfile.DisplayName}}{{else if .AuthorProfile.Name}}{{.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
           {{else}}
           <img class="author-avatar" src="/static/avatar.jpg" alt="Default avatar">
           {{end}}
@@ -2192,6 +2310,7 @@ var htmlTemplate = `<!DOCTYPE html>
             <span class="author-time">{{formatTime .CreatedAt}}</span>
           </div>
         </div>
+        {{if .HasContentWarning}}<details class="content-warning"><summary>Content warning{{if .ContentWarning}}: {{.ContentWarning}}{{end}}</summary>{{end}}
         {{if eq .Kind 6}}
         {{if .RepostedEvent}}
         <div class="repost-indicator">reposted</div>
@@ -2199,7 +2318,7 @@ var htmlTemplate = `<!DOCTYPE html>
           <div class="note-author">
             <span class="text-muted">
             {{if and .RepostedEvent.AuthorProfile .RepostedEvent.AuthorProfile.Picture}}
-            <img class="author-avatar" src="{{.RepostedEvent.AuthorProfile.Picture}}" alt="{{if .RepostedEvent.AuthorProfile.DisplayName}}{{.RepostedEvent.AuthorProfile.DisplayName}}{{else if .RepostedEvent.AuthorProfile.Name}}{{.RepostedEvent.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
+            <img class="author-avatar" src="{{proxyImage .RepostedEvent.AuthorProfile.Picture 96}}" alt="{{if .RepostedEvent.AuthorProfile.DisplayName}}{{.RepostedEvent.AuthorProfile.DisplayName}}{{else if .RepostedEvent.AuthorProfile.Name}}{{.RepostedEvent.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
             {{else}}
             <img class="author-avatar" src="/static/avatar.jpg" alt="Default avatar">
             {{end}}
@@ -2243,17 +2362,19 @@ var htmlTemplate = `<!DOCTYPE html>
         </div>
         {{else if eq .Kind 30023}}
         <div class="article-preview">
-          {{if .HeaderImage}}<img src="{{.HeaderImage}}" alt="" class="article-preview-image">{{end}}
+          {{if .HeaderImage}}<img src="{{proxyImage .HeaderImage 800}}" alt="" class="article-preview-image">{{end}}
           {{if .Title}}<h3 class="article-preview-title">{{.Title}}</h3>{{end}}
           {{if .Summary}}<p class="article-preview-summary">{{.Summary}}</p>{{end}}
         </div>
         {{else}}
+        {{if .Calendar}}{{template "calendar-event" .Calendar}}{{end}}
         <div class="note-content">{{.ContentHTML}}</div>
+        {{if .Poll}}{{template "poll" .Poll}}{{end}}
         {{if .QuotedEvent}}
         <div class="quoted-note">
           <div class="quoted-author">
             {{if and .QuotedEvent.AuthorProfile .QuotedEvent.AuthorProfile.Picture}}
-            <img src="{{.QuotedEvent.AuthorProfile.Picture}}" alt="{{if .QuotedEvent.AuthorProfile.DisplayName}}{{.QuotedEvent.AuthorProfile.DisplayName}}{{else if .QuotedEvent.AuthorProfile.Name}}{{.QuotedEvent.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
+            <img src="{{proxyImage .QuotedEvent.AuthorProfile.Picture 96}}" alt="{{if .QuotedEvent.AuthorProfile.DisplayName}}{{.QuotedEvent.AuthorProfile.DisplayName}}{{else if .QuotedEvent.AuthorProfile.Name}}{{.QuotedEvent.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
             {{else}}
             <img src="/static/avatar.jpg" alt="Default avatar">
             {{end}}
@@ -2274,7 +2395,9 @@ var htmlTemplate = `<!DOCTYPE html>
           {{if .QuotedEvent.Summary}}<div class="quoted-article-summary">{{.QuotedEvent.Summary}}</div>{{end}}
           <a href="/html/thread/{{.QuotedEvent.ID}}" class="view-note-link">Read article &rarr;</a>
           {{else}}
+          {{if .QuotedEvent.HasContentWarning}}<details class="content-warning"><summary>Content warning{{if .QuotedEvent.ContentWarning}}: {{.QuotedEvent.ContentWarning}}{{end}}</summary>{{end}}
           <div class="note-content">{{.QuotedEvent.ContentHTML}}</div>
+          {{if .QuotedEvent.HasContentWarning}}</details>{{end}}
           <a href="/html/thread/{{.QuotedEvent.ID}}" class="view-note-link">View quoted note &rarr;</a>
           {{end}}
         </div>
@@ -2284,6 +2407,7 @@ var htmlTemplate = `<!DOCTYPE html>
         </div>
         {{end}}
         {{end}}
+        {{if .HasContentWarning}}</details>{{end}}
         <div class="note-footer">
           <div class="note-footer-actions">
           {{if $.LoggedIn}}
@@ -2304,8 +2428,8 @@ var htmlTemplate = `<!DOCTYPE html>
               <input type="hidden" name="event_id" value="{{.RepostedEvent.ID}}">
               <input type="hidden" name="event_pubkey" value="{{.RepostedEvent.Pubkey}}">
               <input type="hidden" name="return_url" value="{{$.CurrentURL}}">
-              <input type="hidden" name="reaction" value="❤️">
-              <button type="submit" class="text-link">Like</button>
+              <button type="submit" name="reaction" value="❤️" class="text-link">Like</button>
+              {{template "reaction-picker" $.ReactionPicker}}
             </form>
             <form method="POST" action="/html/bookmark" class="inline-form">
               <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
@@ -2335,8 +2459,8 @@ var htmlTemplate = `<!DOCTYPE html>
               <input type="hidden" name="event_id" value="{{$item.ID}}">
               <input type="hidden" name="event_pubkey" value="{{$item.Pubkey}}">
               <input type="hidden" name="return_url" value="{{$.CurrentURL}}">
-              <input type="hidden" name="reaction" value="❤️">
-              <button type="submit" class="text-link">Like</button>
+              <button type="submit" name="reaction" value="❤️" class="text-link">Like</button>
+              {{template "reaction-picker" $.ReactionPicker}}
             </form>
             <form method="POST" action="/html/bookmark" class="inline-form">
               <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
@@ -2371,6 +2495,8 @@ var htmlTemplate = `<!DOCTYPE html>
             {{range $type, $count := .Reactions.ByType}}
             <span class="reaction-badge">{{$type}} {{$count}}</span>
             {{end}}
+            {{template "emoji-badges" .Reactions.ByEmoji}}
+            <a href="/html/reactions/{{.ID}}" class="text-link text-sm" title="Who reacted and reposted">Details</a>
             {{end}}
           </div>
           {{end}}
@@ -2453,8 +2579,10 @@ type HTMLPageData struct {
 	CurrentURL             string   // Current page URL for reaction redirects
 	ThemeClass             string   // "dark", "light", or "" for system default
 	ThemeLabel             string   // Label for theme toggle button
+	BlurMedia              bool     // Media from authors the reader doesn't follow is blurred
 	CSRFToken              string   // CSRF token for form submission
 	HasUnreadNotifications bool     // Whether there are notifications newer than last seen
+	ReactionPicker         *ReactionPicker // Reaction choices for the react forms (nil when logged out)
 }
 
 type HTMLEventItem struct {
@@ -2471,6 +2599,9 @@ type HTMLEventItem struct {
 	Summary       string        // Summary from summary tag (kind 30023)
 	HeaderImage   string        // Header image URL from image tag (kind 30023)
 	PublishedAt   int64         // Published timestamp from published_at tag (kind 30023)
+	ContentWarning    string        // Reason from a NIP-36 content-warning tag (may be empty)
+	HasContentWarning bool          // Collapse the content behind a warning
+	BlurMedia         bool          // Media is blurred (reader blurs authors they don't follow)
 	RelaysSeen    []string
 	Links         []string
 	AuthorProfile *ProfileInfo
@@ -2520,6 +2651,10 @@ type HTMLEventItem struct {
 	BookmarkCount       int           // Total bookmark count
 	// Bookmark state for current user
 	IsBookmarked        bool          // Whether logged-in user has bookmarked this item
+	// Kind 1068 poll options and results
+	Poll                *HTMLPoll
+	// Kind 31922/31923 calendar event details and RSVPs
+	Calendar            *HTMLCalendarEvent
 }
 
 // LiveParticipant represents a participant in a live event
@@ -2609,7 +2744,7 @@ func batchResolveNostrRefs(identifiers []string, relays []string) map[string]str
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 
-	log.Printf("Batch resolving %d nostr references...", len(identifiers))
+	slog.Debug("Batch resolving nostr references", "references", len(identifiers))
 
 	for _, id := range identifiers {
 		wg.Add(1)
@@ -2623,7 +2758,7 @@ func batchResolveNostrRefs(identifiers []string, relays []string) map[string]str
 	}
 
 	wg.Wait()
-	log.Printf("Batch resolved %d nostr references", len(resolved))
+	slog.Debug("Batch resolved nostr references", "resolved", len(resolved))
 	return resolved
 }
 
@@ -2700,7 +2835,7 @@ func extractImetaImages(tags [][]string) template.HTML {
 			alt = "image"
 		}
 		sb.WriteString(`<img src="`)
-		sb.WriteString(html.EscapeString(img.URL))
+		sb.WriteString(html.EscapeString(proxyImageURL(img.URL, imageWidthContent)))
 		sb.WriteString(`" alt="`)
 		sb.WriteString(html.EscapeString(alt))
 		sb.WriteString(`" loading="lazy" class="picture-image">`)
@@ -2768,7 +2903,7 @@ func renderMarkdown(content string) template.HTML {
 		// Fallback to escaped plain text if markdown parsing fails
 		return template.HTML(html.EscapeString(content))
 	}
-	return template.HTML(buf.String())
+	return template.HTML(proxyImagesInHTML(buf.String(), imageWidthContent))
 }
 
 // parseRepostedEvent parses the embedded event JSON from a kind 6 repost's content field
@@ -2785,7 +2920,7 @@ func parseRepostedEvent(content string, relays []string, resolvedRefs map[string
 	}
 
 	if err := json.Unmarshal([]byte(content), &embeddedEvent); err != nil {
-		log.Printf("Failed to parse reposted event JSON: %v", err)
+		slog.Warn("Failed to parse reposted event JSON", "error", err)
 		return nil
 	}
 
@@ -2803,6 +2938,8 @@ func parseRepostedEvent(content string, relays []string, resolvedRefs map[string
 		ContentHTML:   processContentToHTMLFull(embeddedEvent.Content, relays, resolvedRefs, linkPreviews),
 		AuthorProfile: profiles[embeddedEvent.PubKey],
 	}
+	reposted.setContentWarning(embeddedEvent.Tags)
+	reposted.setCustomEmoji(embeddedEvent.Tags)
 
 	// Handle kind 20 (picture notes) within reposts
 	if embeddedEvent.Kind == 20 {
@@ -3092,7 +3229,7 @@ func processContentToHTMLFull(content string, relays []string, resolvedRefs map[
 		// Unescape the URL (it was escaped above)
 		url = html.UnescapeString(url)
 		if imageExtRegex.MatchString(url) {
-			return fmt.Sprintf(`<img src="%s" alt="image" loading="lazy">`, html.EscapeString(url))
+			return fmt.Sprintf(`<img src="%s" alt="image" loading="lazy">`, html.EscapeString(proxyImageURL(url, imageWidthContent)))
 		}
 		if videoExtRegex.MatchString(url) {
 			return fmt.Sprintf(`<video src="%s" controls preload="metadata" class="note-video"></video>`, html.EscapeString(url))
@@ -3136,7 +3273,7 @@ func renderLinkPreview(url string, preview *LinkPreview) string {
 	// Image on the left (if available)
 	if preview.Image != "" {
 		sb.WriteString(`<img src="`)
-		sb.WriteString(html.EscapeString(preview.Image))
+		sb.WriteString(html.EscapeString(proxyImageURL(preview.Image, imageWidthProfile)))
 		sb.WriteString(`" alt="" class="link-preview-image" loading="lazy">`)
 	}
 
@@ -3548,7 +3685,7 @@ func computeKindFilter(kinds []int) string {
 	return "all" // Unknown filter pattern, default to all
 }
 
-func renderHTML(resp TimelineResponse, relays []string, authors []string, kinds []int, limit int, session *BunkerSession, errorMsg, successMsg string, showReactions bool, feedMode string, currentURL string, themeClass, themeLabel string, csrfToken string, hasUnreadNotifs bool) (string, error) {
+func renderHTML(resp TimelineResponse, relays []string, authors []string, kinds []int, limit int, session *BunkerSession, errorMsg, successMsg string, showReactions bool, feedMode string, currentURL string, themeClass, themeLabel string, csrfToken string, hasUnreadNotifs, freshPolls bool, media *mediaBlur, client string) (string, error) {
 	// Pre-fetch all nostr: references in parallel for much faster rendering
 	contents := make([]string, len(resp.Items))
 	for i, item := range resp.Items {
@@ -3562,9 +3699,9 @@ func renderHTML(resp TimelineResponse, relays []string, authors []string, kinds
 	for _, content := range contents {
 		allURLs = append(allURLs, ExtractPreviewableURLs(content)...)
 	}
-	linkPreviews := FetchLinkPreviews(allURLs)
+	linkPreviews := FetchLinkPreviews(allURLs, client)
 
-	// Pre-fetch profiles for live event participants from purplepag.es
+	// Pre-fetch profiles for live event participants from the profile relays
 	liveParticipantPubkeys := make(map[string]bool)
 	for _, item := range resp.Items {
 		if item.Kind == 30311 {
@@ -3582,8 +3719,8 @@ func renderHTML(resp TimelineResponse, relays []string, authors []string, kinds
 		for pk := range liveParticipantPubkeys {
 			pubkeys = append(pubkeys, pk)
 		}
-		// Fetch from purplepag.es for better profile coverage
-		liveParticipantProfiles = fetchProfiles([]string{"wss://purplepag.es"}, pubkeys)
+		// Fetch from the profile relays for better coverage
+		liveParticipantProfiles = fetchProfiles(profileRelays(), pubkeys)
 	}
 
 	// Pre-fetch quoted events for quote posts (notes with q tag)
@@ -3626,7 +3763,7 @@ func renderHTML(resp TimelineResponse, relays []string, authors []string, kinds
 			for pk := range pubkeys {
 				pks = append(pks, pk)
 			}
-			quotedEventProfiles = fetchProfiles([]string{"wss://purplepag.es"}, pks)
+			quotedEventProfiles = fetchProfiles(profileRelays(), pks)
 		}
 	}
 
@@ -3651,6 +3788,7 @@ func renderHTML(resp TimelineResponse, relays []string, authors []string, kinds
 			Reactions:     item.Reactions,
 			ReplyCount:    item.ReplyCount,
 		}
+		items[i].setContentWarning(item.Tags)
 
 		// Extract imeta images and title for kind 20 (picture notes)
 		if item.Kind == 20 {
@@ -3678,6 +3816,10 @@ func renderHTML(resp TimelineResponse, relays []string, authors []string, kinds
 				}
 			}
 			items[i].RepostedEvent = parseRepostedEvent(item.Content, relays, resolvedRefs, linkPreviews, profilesMap)
+			// The repost shows the original note, so it carries the original's warning
+			if reposted := items[i].RepostedEvent; reposted != nil && reposted.HasContentWarning {
+				items[i].ContentWarning, items[i].HasContentWarning = reposted.ContentWarning, true
+			}
 		}
 
 		// Attach quoted event for quote posts (kind 1 with q tag)
@@ -3704,6 +3846,8 @@ func renderHTML(resp TimelineResponse, relays []string, authors []string, kinds
 							ContentHTML:   processContentToHTMLFull(qev.Content, relays, resolvedRefs, linkPreviews),
 							AuthorProfile: quotedEventProfiles[qev.PubKey],
 						}
+						quotedItem.setContentWarning(qev.Tags)
+						quotedItem.setCustomEmoji(qev.Tags)
 						// For kind 30023 (longform articles), extract title and summary
 						if qev.Kind == 30023 {
 							quotedItem.Title = extractTitle(qev.Tags)
@@ -3776,7 +3920,7 @@ func renderHTML(resp TimelineResponse, relays []string, authors []string, kinds
 					}
 				}
 
-				// Build participant list with profiles from purplepag.es
+				// Build participant list with profiles from the profile relays
 				participants := make([]LiveParticipant, 0, len(liveInfo.ParticipantPubkeys))
 				for _, pk := range liveInfo.ParticipantPubkeys {
 					npub, _ := encodeBech32Pubkey(pk)
@@ -3804,6 +3948,16 @@ func renderHTML(resp TimelineResponse, relays []string, authors []string, kinds
 			}
 		}
 
+		// Parse poll for kind 1068
+		if item.Kind == kindPoll {
+			items[i].Poll = parsePoll(item.ID, item.Tags)
+		}
+
+		// Parse calendar events for kinds 31922 and 31923
+		if isCalendarEventKind(item.Kind) {
+			items[i].Calendar = parseCalendarEvent(Event{ID: item.ID, PubKey: item.Pubkey, Kind: item.Kind, Tags: item.Tags, CreatedAt: item.CreatedAt})
+		}
+
 		// Parse bookmarks for kind 10003
 		if item.Kind == 10003 {
 			bookmarkInfo := parseBookmarks(item.Tags)
@@ -3823,7 +3977,18 @@ func renderHTML(resp TimelineResponse, relays []string, authors []string, kinds
 				break
 			}
 		}
+
+		items[i].setCustomEmoji(item.Tags)
+		media.apply(&items[i])
+	}
+
+	// Tally poll responses and set up vote forms
+	var readerPubkey string
+	if session != nil && session.Connected {
+		readerPubkey = hex.EncodeToString(session.UserPubKey)
 	}
+	preparePolls(collectPolls(items), relays, readerPubkey, csrfToken, currentURL, freshPolls)
+	prepareCalendarEvents(collectCalendarEvents(items), relays, readerPubkey, csrfToken, currentURL)
 
 	// Build pagination
 	var pagination *HTMLPagination
@@ -3849,6 +4014,7 @@ func renderHTML(resp TimelineResponse, relays []string, authors []string, kinds
 		CurrentURL:    currentURL,
 		ThemeClass:    themeClass,
 		ThemeLabel:    themeLabel,
+		BlurMedia:     media != nil,
 		CSRFToken:     csrfToken,
 	}
 
@@ -3859,6 +4025,7 @@ func renderHTML(resp TimelineResponse, relays []string, authors []string, kinds
 		data.UserPubKey = pubkeyHex
 		data.UserDisplayName = getUserDisplayName(pubkeyHex)
 		data.HasUnreadNotifications = hasUnreadNotifs
+		data.ReactionPicker = reactionPicker(session)
 	}
 
 	// Use cached template for better performance
@@ -4224,6 +4391,34 @@ var htmlThreadTemplate = `<!DOCTYPE html>
       border: 1px solid var(--border-color);
       background: var(--bg-card);
     }
+    details.content-warning {
+      margin: 8px 0;
+      padding: 8px 12px;
+      border: 1px solid var(--border-color);
+      border-radius: 6px;
+    }
+    details.content-warning > summary {
+      cursor: pointer;
+      font-size: 14px;
+      color: var(--text-secondary);
+    }
+    details.content-warning[open] > summary { margin-bottom: 8px; }
+    details.blurred-media > summary {
+      display: block;
+      list-style: none;
+      cursor: pointer;
+      overflow: hidden;
+      border-radius: 8px;
+    }
+    details.blurred-media > summary::-webkit-details-marker { display: none; }
+    details.blurred-media:not([open]) img { filter: blur(24px); }
+    details.blurred-video > summary {
+      display: inline-block;
+      padding: 6px 12px;
+      border: 1px dashed var(--border-color);
+      font-size: 13px;
+      color: var(--text-secondary);
+    }
     .note-content {
       font-size: 15px;
       line-height: 1.6;
@@ -4636,6 +4831,10 @@ var htmlThreadTemplate = `<!DOCTYPE html>
     .recording-btn:hover {
       background: var(--bg-secondary);
     }
+    {{template "poll-style"}}
+    {{template "calendar-style"}}
+    {{template "emoji-style"}}
+    {{template "reaction-picker-style"}}
     /* Highlight (kind 9802) styles */
     .highlight {
       padding: 16px 20px;
@@ -5382,6 +5581,28 @@ var htmlThreadTemplate = `<!DOCTYPE html>
       border: 1px solid var(--border-color);
       margin: 16px 0;
     }
+    .reply-form .post-media {
+      display: flex;
+      gap: 8px;
+      align-items: center;
+      flex-wrap: wrap;
+      margin: 8px 0;
+      font-size: 13px;
+      color: var(--text-secondary);
+    }
+    .reply-form .post-media-kind { display: flex; align-items: center; gap: 4px; }
+    {{template "schedule-style"}}
+    .reply-form .post-media input[type="text"] {
+      flex: 1;
+      min-width: 160px;
+      padding: 6px 10px;
+      border: 1px solid var(--border-color);
+      border-radius: 4px;
+      font-size: 13px;
+      font-family: inherit;
+      background: var(--bg-input);
+      color: var(--text-primary);
+    }
     .reply-form textarea {
       width: 100%;
       padding: 12px;
@@ -5478,6 +5699,15 @@ var htmlThreadTemplate = `<!DOCTYPE html>
                 <button type="submit" class="ghost-btn text-xs">Theme: {{.ThemeLabel}}</button>
               </form>
             </div>
+            {{if .LoggedIn}}
+            <div class="settings-item">
+              <form method="POST" action="/html/blur-media" class="inline-form">
+                <button type="submit" class="ghost-btn text-xs">Unfollowed media: {{if .BlurMedia}}Blurred{{else}}Shown{{end}}</button>
+              </form>
+            </div>
+            <div class="settings-item"><a href="/html/settings/relays" class="text-muted text-xs">Relays</a></div>
+            <div class="settings-item"><a href="/html/scheduled" class="text-muted text-xs">Scheduled posts</a></div>
+            {{end}}
           </div>
         </details>
         {{if .LoggedIn}}
@@ -5498,7 +5728,7 @@ var htmlThreadTemplate = `<!DOCTYPE html>
         <div class="note-author">
           <a href="/html/profile/{{.Root.Npub}}" class="text-link">
           {{if and .Root.AuthorProfile .Root.AuthorProfile.Picture}}
-          <img class="author-avatar" src="{{.Root.AuthorProfile.Picture}}" alt="{{if .Root.AuthorProfile.DisplayName}}{{.Root.AuthorProfile.DisplayName}}{{else if .Root.AuthorProfile.Name}}{{.Root.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
+          <img class="author-avatar" src="{{proxyImage .Root.AuthorProfile.Picture 96}}" alt="{{if .Root.AuthorProfile.DisplayName}}{{.Root.AuthorProfile.DisplayName}}{{else if .Root.AuthorProfile.Name}}{{.Root.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
           {{else}}
           <img class="author-avatar" src="/static/avatar.jpg" alt="Default avatar">
           {{end}}
@@ -5521,22 +5751,26 @@ var htmlThreadTemplate = `<!DOCTYPE html>
             <span class="author-time">{{formatTime .Root.CreatedAt}}</span>
           </div>
         </div>
+        {{if .Root.HasContentWarning}}<details class="content-warning"><summary>Content warning{{if .Root.ContentWarning}}: {{.Root.ContentWarning}}{{end}}</summary>{{end}}
         {{if eq .Root.Kind 30023}}
         <article class="long-form-article">
-          {{if .Root.HeaderImage}}<img src="{{.Root.HeaderImage}}" alt="Article header" class="article-header-image">{{end}}
+          {{if .Root.HeaderImage}}<img src="{{proxyImage .Root.HeaderImage 800}}" alt="Article header" class="article-header-image">{{end}}
           {{if .Root.Title}}<h2 class="article-title">{{.Root.Title}}</h2>{{end}}
           {{if .Root.Summary}}<p class="article-summary">{{.Root.Summary}}</p>{{end}}
           {{if .Root.PublishedAt}}<div class="article-published">Published: {{formatTime .Root.PublishedAt}}</div>{{end}}
           <div class="article-content">{{.Root.ContentHTML}}</div>
         </article>
         {{else}}
+        {{if .Root.Calendar}}{{template "calendar-event" .Root.Calendar}}{{end}}
         <div class="note-content">{{.Root.ContentHTML}}</div>
+        {{if .Root.Poll}}{{template "poll" .Root.Poll}}{{end}}
         {{end}}
+        {{if .Root.HasContentWarning}}</details>{{end}}
         {{if .Root.QuotedEvent}}
         <div class="quoted-note">
           <div class="quoted-author">
             {{if and .Root.QuotedEvent.AuthorProfile .Root.QuotedEvent.AuthorProfile.Picture}}
-            <img src="{{.Root.QuotedEvent.AuthorProfile.Picture}}" alt="{{if .Root.QuotedEvent.AuthorProfile.DisplayName}}{{.Root.QuotedEvent.AuthorProfile.DisplayName}}{{else if .Root.QuotedEvent.AuthorProfile.Name}}{{.Root.QuotedEvent.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
+            <img src="{{proxyImage .Root.QuotedEvent.AuthorProfile.Picture 96}}" alt="{{if .Root.QuotedEvent.AuthorProfile.DisplayName}}{{.Root.QuotedEvent.AuthorProfile.DisplayName}}{{else if .Root.QuotedEvent.AuthorProfile.Name}}{{.Root.QuotedEvent.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
             {{end}}
             <span class="quoted-author-name">
               {{if .Root.QuotedEvent.AuthorProfile}}
@@ -5555,7 +5789,9 @@ var htmlThreadTemplate = `<!DOCTYPE html>
           {{if .Root.QuotedEvent.Summary}}<div class="quoted-article-summary">{{.Root.QuotedEvent.Summary}}</div>{{end}}
           <a href="/html/thread/{{.Root.QuotedEvent.ID}}" class="view-note-link">Read article &rarr;</a>
           {{else}}
+          {{if .Root.QuotedEvent.HasContentWarning}}<details class="content-warning"><summary>Content warning{{if .Root.QuotedEvent.ContentWarning}}: {{.Root.QuotedEvent.ContentWarning}}{{end}}</summary>{{end}}
           <div class="quoted-content">{{.Root.QuotedEvent.ContentHTML}}</div>
+          {{if .Root.QuotedEvent.HasContentWarning}}</details>{{end}}
           <a href="/html/thread/{{.Root.QuotedEvent.ID}}" class="view-note-link">View quoted note &rarr;</a>
           {{end}}
         </div>
@@ -5580,8 +5816,8 @@ var htmlThreadTemplate = `<!DOCTYPE html>
             <input type="hidden" name="event_id" value="{{.Root.ID}}">
             <input type="hidden" name="event_pubkey" value="{{.Root.Pubkey}}">
             <input type="hidden" name="return_url" value="{{$.CurrentURL}}">
-            <input type="hidden" name="reaction" value="❤️">
-            <button type="submit" class="text-link">Like</button>
+            <button type="submit" name="reaction" value="❤️" class="text-link">Like</button>
+            {{template "reaction-picker" $.ReactionPicker}}
           </form>
           <form method="POST" action="/html/bookmark" class="inline-form">
             <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
@@ -5605,13 +5841,15 @@ var htmlThreadTemplate = `<!DOCTYPE html>
             {{range $type, $count := .Root.Reactions.ByType}}
             <span class="reaction-badge">{{$type}} {{$count}}</span>
             {{end}}
+            {{template "emoji-badges" .Root.Reactions.ByEmoji}}
+            <a href="/html/reactions/{{.Root.ID}}" class="text-link text-sm" title="Who reacted and reposted">Details</a>
           </div>
           {{end}}
         </div>
       </article>
 
       {{if .LoggedIn}}
-      <form method="POST" action="/html/reply" class="reply-form">
+      <form method="POST" action="/html/reply" class="reply-form" enctype="multipart/form-data">
         <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
         <input type="hidden" name="reply_to" value="{{.Root.ID}}">
         <input type="hidden" name="reply_to_pubkey" value="{{.Root.Pubkey}}">
@@ -5619,7 +5857,17 @@ var htmlThreadTemplate = `<!DOCTYPE html>
           Replying as: <span class="reply-author">{{.UserDisplayName}}</span>
         </div>
         <label for="reply-content" class="sr-only">Write a reply</label>
-        <textarea id="reply-content" name="content" placeholder="Write a reply..." required></textarea>
+        <textarea id="reply-content" name="content" placeholder="Write a reply..."></textarea>
+        <div class="post-media">
+          <label for="reply-media" class="sr-only">Attach an image or video</label>
+          <input id="reply-media" type="file" name="media" accept="image/*,video/*">
+          <label for="reply-media-alt" class="sr-only">Image description</label>
+          <input id="reply-media-alt" type="text" name="media_alt" placeholder="Image description (alt text)">
+          <label class="post-media-kind"><input type="checkbox" name="cw" value="1"> Content warning</label>
+          <label for="reply-cw" class="sr-only">Content warning reason</label>
+          <input id="reply-cw" type="text" name="content_warning" placeholder="Warning reason (optional)" maxlength="200">
+          {{template "schedule-fields" (scheduleFields "reply")}}
+        </div>
         <button type="submit">Reply</button>
       </form>
       {{else}}
@@ -5637,7 +5885,7 @@ var htmlThreadTemplate = `<!DOCTYPE html>
           <div class="note-author">
             <a href="/html/profile/{{.Npub}}" class="text-link">
             {{if and .AuthorProfile .AuthorProfile.Picture}}
-            <img class="author-avatar" src="{{.AuthorProfile.Picture}}" alt="{{if .AuthorProfile.DisplayName}}{{.AuthorProfile.DisplayName}}{{else if .AuthorProfile.Name}}{{.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
+            <img class="author-avatar" src="{{proxyImage .AuthorProfile.Picture 96}}" alt="{{if .AuthorProfile.DisplayName}}{{.AuthorProfile.DisplayName}}{{else if .AuthorProfile.Name}}{{.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
             {{else}}
             <img class="author-avatar" src="/static/avatar.jpg" alt="Default avatar">
             {{end}}
@@ -5660,12 +5908,14 @@ var htmlThreadTemplate = `<!DOCTYPE html>
               <span class="author-time">{{formatTime .CreatedAt}}</span>
             </div>
           </div>
+          {{if .HasContentWarning}}<details class="content-warning"><summary>Content warning{{if .ContentWarning}}: {{.ContentWarning}}{{end}}</summary>{{end}}
           <div class="note-content">{{.ContentHTML}}</div>
+          {{if .HasContentWarning}}</details>{{end}}
           {{if .QuotedEvent}}
           <div class="quoted-note">
             <div class="quoted-author">
               {{if and .QuotedEvent.AuthorProfile .QuotedEvent.AuthorProfile.Picture}}
-              <img src="{{.QuotedEvent.AuthorProfile.Picture}}" alt="{{if .QuotedEvent.AuthorProfile.DisplayName}}{{.QuotedEvent.AuthorProfile.DisplayName}}{{else if .QuotedEvent.AuthorProfile.Name}}{{.QuotedEvent.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
+              <img src="{{proxyImage .QuotedEvent.AuthorProfile.Picture 96}}" alt="{{if .QuotedEvent.AuthorProfile.DisplayName}}{{.QuotedEvent.AuthorProfile.DisplayName}}{{else if .QuotedEvent.AuthorProfile.Name}}{{.QuotedEvent.AuthorProfile.Name}}{{else}}User{{end}}'s avatar">
               {{end}}
               <span class="quoted-author-name">
                 {{if .QuotedEvent.AuthorProfile}}
@@ -5684,7 +5934,9 @@ var htmlThreadTemplate = `<!DOCTYPE html>
             {{if .QuotedEvent.Summary}}<div class="quoted-article-summary">{{.QuotedEvent.Summary}}</div>{{end}}
             <a href="/html/thread/{{.QuotedEvent.ID}}" class="view-note-link">Read article &rarr;</a>
             {{else}}
+            {{if .QuotedEvent.HasContentWarning}}<details class="content-warning"><summary>Content warning{{if .QuotedEvent.ContentWarning}}: {{.QuotedEvent.ContentWarning}}{{end}}</summary>{{end}}
             <div class="quoted-content">{{.QuotedEvent.ContentHTML}}</div>
+            {{if .QuotedEvent.HasContentWarning}}</details>{{end}}
             <a href="/html/thread/{{.QuotedEvent.ID}}" class="view-note-link">View quoted note &rarr;</a>
             {{end}}
           </div>
@@ -5710,8 +5962,8 @@ var htmlThreadTemplate = `<!DOCTYPE html>
               <input type="hidden" name="event_id" value="{{$reply.ID}}">
               <input type="hidden" name="event_pubkey" value="{{$reply.Pubkey}}">
               <input type="hidden" name="return_url" value="{{$.CurrentURL}}">
-              <input type="hidden" name="reaction" value="❤️">
-              <button type="submit" class="text-link">Like</button>
+              <button type="submit" name="reaction" value="❤️" class="text-link">Like</button>
+              {{template "reaction-picker" $.ReactionPicker}}
             </form>
             <form method="POST" action="/html/bookmark" class="inline-form">
               <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
@@ -5735,6 +5987,8 @@ var htmlThreadTemplate = `<!DOCTYPE html>
               {{range $type, $count := .Reactions.ByType}}
               <span class="reaction-badge">{{$type}} {{$count}}</span>
               {{end}}
+              {{template "emoji-badges" .Reactions.ByEmoji}}
+              <a href="/html/reactions/{{.ID}}" class="text-link text-sm" title="Who reacted and reposted">Details</a>
             </div>
             {{end}}
           </div>
@@ -5771,9 +6025,11 @@ type HTMLThreadData struct {
 	CurrentURL             string
 	ThemeClass             string // "dark", "light", or "" for system default
 	ThemeLabel             string // Label for theme toggle button
+	BlurMedia              bool   // Media from authors the reader doesn't follow is blurred
 	Success                string
 	CSRFToken              string // CSRF token for form submission
 	HasUnreadNotifications bool   // Whether there are notifications newer than last seen
+	ReactionPicker         *ReactionPicker // Reaction choices for the react forms (nil when logged out)
 }
 
 // extractParentID extracts the parent event ID from the "e" tags
@@ -5793,7 +6049,7 @@ func extractParentID(tags [][]string) string {
 	return parentID
 }
 
-func renderThreadHTML(resp ThreadResponse, relays []string, session *BunkerSession, currentURL string, themeClass, themeLabel, successMsg, csrfToken string, hasUnreadNotifs bool) (string, error) {
+func renderThreadHTML(resp ThreadResponse, relays []string, session *BunkerSession, currentURL string, themeClass, themeLabel, successMsg, csrfToken string, hasUnreadNotifs, freshPolls bool, media *mediaBlur, client string) (string, error) {
 	// Pre-fetch all nostr: references in parallel for much faster rendering
 	contents := make([]string, 1+len(resp.Replies))
 	contents[0] = resp.Root.Content
@@ -5808,7 +6064,7 @@ func renderThreadHTML(resp ThreadResponse, relays []string, session *BunkerSessi
 	for _, content := range contents {
 		allURLs = append(allURLs, ExtractPreviewableURLs(content)...)
 	}
-	linkPreviews := FetchLinkPreviews(allURLs)
+	linkPreviews := FetchLinkPreviews(allURLs, client)
 
 	// Collect q tags for quote post processing
 	quotedEventIDs := make(map[string]bool)
@@ -5875,6 +6131,7 @@ func renderThreadHTML(resp ThreadResponse, relays []string, session *BunkerSessi
 		ReplyCount:    resp.Root.ReplyCount,
 		ParentID:      extractParentID(resp.Root.Tags),
 	}
+	root.setContentWarning(resp.Root.Tags)
 
 	// Handle kind 30023 (long-form articles) - extract metadata and render markdown
 	if resp.Root.Kind == 30023 {
@@ -5885,6 +6142,25 @@ func renderThreadHTML(resp ThreadResponse, relays []string, session *BunkerSessi
 		root.ContentHTML = renderMarkdown(resp.Root.Content)
 	}
 
+	// Handle kind 1068 (polls) and 31922/31923 (calendar events), which
+	// show their details and vote or RSVP forms with the content
+	var readerPubkey string
+	if session != nil && session.Connected {
+		readerPubkey = hex.EncodeToString(session.UserPubKey)
+	}
+	if resp.Root.Kind == kindPoll {
+		root.Poll = parsePoll(resp.Root.ID, resp.Root.Tags)
+		if root.Poll != nil {
+			preparePolls([]*HTMLPoll{root.Poll}, relays, readerPubkey, csrfToken, currentURL, freshPolls)
+		}
+	}
+	if isCalendarEventKind(resp.Root.Kind) {
+		root.Calendar = parseCalendarEvent(Event{ID: resp.Root.ID, PubKey: resp.Root.Pubkey, Kind: resp.Root.Kind, Tags: resp.Root.Tags, CreatedAt: resp.Root.CreatedAt})
+		if root.Calendar != nil {
+			prepareCalendarEvents([]*HTMLCalendarEvent{root.Calendar}, relays, readerPubkey, csrfToken, currentURL)
+		}
+	}
+
 	// Handle quote posts for root event (kind 1 with q tag)
 	if resp.Root.Kind == 1 {
 		for _, tag := range resp.Root.Tags {
@@ -5908,6 +6184,8 @@ func renderThreadHTML(resp ThreadResponse, relays []string, session *BunkerSessi
 						ContentHTML:   processContentToHTMLFull(qev.Content, relays, resolvedRefs, linkPreviews),
 						AuthorProfile: quotedEventProfiles[qev.PubKey],
 					}
+					quotedItem.setContentWarning(qev.Tags)
+					quotedItem.setCustomEmoji(qev.Tags)
 					// For kind 30023 (longform articles), extract title and summary
 					if qev.Kind == 30023 {
 						quotedItem.Title = extractTitle(qev.Tags)
@@ -5938,6 +6216,7 @@ func renderThreadHTML(resp ThreadResponse, relays []string, session *BunkerSessi
 			ReplyCount:    item.ReplyCount,
 			ParentID:      extractParentID(item.Tags),
 		}
+		replies[i].setContentWarning(item.Tags)
 
 		// Handle quote posts for replies (kind 1 with q tag)
 		if item.Kind == 1 {
@@ -5962,6 +6241,8 @@ func renderThreadHTML(resp ThreadResponse, relays []string, session *BunkerSessi
 							ContentHTML:   processContentToHTMLFull(qev.Content, relays, resolvedRefs, linkPreviews),
 							AuthorProfile: quotedEventProfiles[qev.PubKey],
 						}
+						quotedItem.setContentWarning(qev.Tags)
+						quotedItem.setCustomEmoji(qev.Tags)
 						// For kind 30023 (longform articles), extract title and summary
 						if qev.Kind == 30023 {
 							quotedItem.Title = extractTitle(qev.Tags)
@@ -5973,7 +6254,11 @@ func renderThreadHTML(resp ThreadResponse, relays []string, session *BunkerSessi
 				}
 			}
 		}
+		replies[i].setCustomEmoji(item.Tags)
+		media.apply(&replies[i])
 	}
+	root.setCustomEmoji(resp.Root.Tags)
+	media.apply(root)
 
 	data := HTMLThreadData{
 		Title:      "Thread",
@@ -5983,6 +6268,7 @@ func renderThreadHTML(resp ThreadResponse, relays []string, session *BunkerSessi
 		CurrentURL: currentURL,
 		ThemeClass: themeClass,
 		ThemeLabel: themeLabel,
+		BlurMedia:  media != nil,
 		Success:    successMsg,
 		CSRFToken:  csrfToken,
 	}
@@ -5994,6 +6280,7 @@ func renderThreadHTML(resp ThreadResponse, relays []string, session *BunkerSessi
 		data.UserPubKey = pubkeyHex
 		data.UserDisplayName = getUserDisplayName(pubkeyHex)
 		data.HasUnreadNotifications = hasUnreadNotifs
+		data.ReactionPicker = reactionPicker(session)
 	}
 
 	// Use cached template for better performance
@@ -6012,6 +6299,7 @@ var htmlProfileTemplate = `<!DOCTYPE html>
   <meta name="viewport" content="width=device-width, initial-scale=1.0">
   <title>{{.Title}} - Nostr Hypermedia</title>
   <link rel="icon" href="/static/favicon.ico" />
+  <link rel="alternate" type="application/rss+xml" title="{{.Title}}" href="/feed/profile/{{.Npub}}.xml">
   <style>
     :root {
       --bg-page: #f5f5f5;
@@ -6356,6 +6644,32 @@ var htmlProfileTemplate = `<!DOCTYPE html>
       color: #dc2626;
       border-color: #dc2626;
     }
+    .lists-dropdown { position: relative; }
+    .lists-toggle {
+      cursor: pointer;
+      list-style: none;
+      padding: 8px 16px;
+      font-size: 14px;
+      font-weight: 600;
+      border-radius: 20px;
+      border: 1px solid var(--border-color);
+      color: var(--text-secondary);
+    }
+    .lists-menu {
+      position: absolute;
+      left: 0;
+      top: 100%;
+      margin-top: 6px;
+      background: var(--bg-card);
+      border: 1px solid var(--border-color);
+      border-radius: 4px;
+      padding: 8px 12px;
+      box-shadow: 0 4px 12px var(--shadow);
+      z-index: 100;
+      white-space: nowrap;
+      font-size: 13px;
+    }
+    .lists-menu-item { display: block; margin: 4px 0; }
     .edit-profile-btn {
       padding: 8px 20px;
       font-size: 14px;
@@ -6477,6 +6791,16 @@ var htmlProfileTemplate = `<!DOCTYPE html>
       display: inline-block;
       margin-bottom: 8px;
     }
+    .profile-counts {
+      display: flex;
+      gap: 16px;
+      font-size: 14px;
+      color: var(--text-secondary);
+      margin-bottom: 8px;
+    }
+    .profile-counts strong {
+      color: var(--text-primary);
+    }
     .profile-about {
       font-size: 14px;
       color: var(--text-secondary);
@@ -6491,6 +6815,34 @@ var htmlProfileTemplate = `<!DOCTYPE html>
       transition: box-shadow 0.2s;
     }
     .note:hover { box-shadow: 0 2px 8px var(--shadow); }
+    details.content-warning {
+      margin: 8px 0;
+      padding: 8px 12px;
+      border: 1px solid var(--border-color);
+      border-radius: 6px;
+    }
+    details.content-warning > summary {
+      cursor: pointer;
+      font-size: 14px;
+      color: var(--text-secondary);
+    }
+    details.content-warning[open] > summary { margin-bottom: 8px; }
+    details.blurred-media > summary {
+      display: block;
+      list-style: none;
+      cursor: pointer;
+      overflow: hidden;
+      border-radius: 8px;
+    }
+    details.blurred-media > summary::-webkit-details-marker { display: none; }
+    details.blurred-media:not([open]) img { filter: blur(24px); }
+    details.blurred-video > summary {
+      display: inline-block;
+      padding: 6px 12px;
+      border: 1px dashed var(--border-color);
+      font-size: 13px;
+      color: var(--text-secondary);
+    }
     .note-content {
       font-size: 15px;
       line-height: 1.6;
@@ -6903,6 +7255,8 @@ var htmlProfileTemplate = `<!DOCTYPE html>
     .recording-btn:hover {
       background: var(--bg-secondary);
     }
+    {{template "emoji-style"}}
+    {{template "reaction-picker-style"}}
     /* Highlight (kind 9802) styles */
     .highlight {
       padding: 16px 20px;
@@ -7581,6 +7935,15 @@ var htmlProfileTemplate = `<!DOCTYPE html>
                 <button type="submit" class="ghost-btn text-xs">Theme: {{.ThemeLabel}}</button>
               </form>
             </div>
+            {{if .LoggedIn}}
+            <div class="settings-item">
+              <form method="POST" action="/html/blur-media" class="inline-form">
+                <button type="submit" class="ghost-btn text-xs">Unfollowed media: {{if .BlurMedia}}Blurred{{else}}Shown{{end}}</button>
+              </form>
+            </div>
+            <div class="settings-item"><a href="/html/settings/relays" class="text-muted text-xs">Relays</a></div>
+            <div class="settings-item"><a href="/html/scheduled" class="text-muted text-xs">Scheduled posts</a></div>
+            {{end}}
           </div>
         </details>
         {{if .LoggedIn}}
@@ -7594,7 +7957,7 @@ var htmlProfileTemplate = `<!DOCTYPE html>
     <main>
       <div class="profile-header">
         {{if and .Profile .Profile.Picture}}
-        <img class="profile-avatar" src="{{.Profile.Picture}}" alt="{{if .Profile.DisplayName}}{{.Profile.DisplayName}}{{else if .Profile.Name}}{{.Profile.Name}}{{else}}User{{end}}'s avatar">
+        <img class="profile-avatar" src="{{proxyImage .Profile.Picture 256}}" alt="{{if .Profile.DisplayName}}{{.Profile.DisplayName}}{{else if .Profile.Name}}{{.Profile.Name}}{{else}}User{{end}}'s avatar">
         {{else}}
         <img class="profile-avatar" src="/static/avatar.jpg" alt="Default avatar">
         {{end}}
@@ -7626,11 +7989,40 @@ var htmlProfileTemplate = `<!DOCTYPE html>
             {{if and .LoggedIn .IsSelf}}
             <a href="/html/profile/edit" class="edit-profile-btn">Edit Profile</a>
             {{end}}
+            {{if and .LoggedIn (not .IsSelf)}}
+            <details class="lists-dropdown">
+              <summary class="lists-toggle">Lists</summary>
+              <div class="lists-menu">
+                {{range .ListMemberships}}
+                <form method="POST" action="/html/lists" class="lists-menu-item">
+                  <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
+                  <input type="hidden" name="list" value="{{.Key}}">
+                  <input type="hidden" name="pubkey" value="{{$.Pubkey}}">
+                  <input type="hidden" name="return_url" value="{{$.CurrentURL}}">
+                  {{if .Contains}}
+                  <input type="hidden" name="action" value="remove">
+                  <button type="submit" class="ghost-btn">✓ {{.Title}}</button>
+                  {{else}}
+                  <input type="hidden" name="action" value="add">
+                  <button type="submit" class="ghost-btn">+ {{.Title}}</button>
+                  {{end}}
+                </form>
+                {{end}}
+                <a href="/html/lists" class="lists-menu-item text-link">Manage lists…</a>
+              </div>
+            </details>
+            {{end}}
           </div>
           {{if and .Profile .Profile.Nip05}}
           <div class="profile-nip05">{{.Profile.Nip05}}</div>
           {{end}}
           <div class="profile-npub" title="{{.Pubkey}}">{{.NpubShort}}</div>
+          {{if .FollowCounts}}
+          <div class="profile-counts">
+            <span><strong>{{.FollowCounts.Following}}</strong> following</span>
+            <span><strong>{{.FollowCounts.Followers}}{{if .FollowCounts.Approximate}}+{{end}}</strong> followers</span>
+          </div>
+          {{end}}
           {{if and .Profile .Profile.About}}
           <div class="profile-about">{{.Profile.About}}</div>
           {{end}}
@@ -7646,9 +8038,12 @@ var htmlProfileTemplate = `<!DOCTYPE html>
         {{if .Success}}
         <div class="flash-message">{{.Success}}</div>
         {{end}}
+        {{if .ProfileUnverified}}
+        <div class="edit-form-error">Couldn't load your current profile from enough relays, so saving now could overwrite newer changes. <a href="/html/profile/edit">Try again</a></div>
+        {{else}}
         <form method="POST" action="/html/profile/edit">
           <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
-          <input type="hidden" name="raw_content" value="{{.RawContent}}">
+          <input type="hidden" name="profile_event_id" value="{{.ProfileEventID}}">
           <div class="edit-form-group">
             <label for="display_name">Display Name</label>
             <input type="text" id="display_name" name="display_name" value="{{if .Profile}}{{.Profile.DisplayName}}{{end}}" placeholder="Your display name">
@@ -7689,6 +8084,7 @@ var htmlProfileTemplate = `<!DOCTYPE html>
             <a href="/html/profile/{{.Npub}}" class="edit-form-btn edit-form-btn-secondary">Cancel</a>
           </div>
         </form>
+        {{end}}
       </div>
       {{else}}
       <div class="notes-section">
@@ -7697,7 +8093,7 @@ var htmlProfileTemplate = `<!DOCTYPE html>
           <div class="note-author">
             <a href="/html/profile/{{$.Npub}}" class="text-muted">
             {{if and $.Profile $.Profile.Picture}}
-            <img class="author-avatar" src="{{$.Profile.Picture}}" alt="{{if $.Profile.DisplayName}}{{$.Profile.DisplayName}}{{else if $.Profile.Name}}{{$.Profile.Name}}{{else}}User{{end}}'s avatar">
+            <img class="author-avatar" src="{{proxyImage $.Profile.Picture 96}}" alt="{{if $.Profile.DisplayName}}{{$.Profile.DisplayName}}{{else if $.Profile.Name}}{{$.Profile.Name}}{{else}}User{{end}}'s avatar">
             {{end}}
             </a>
             <div class="author-info">
@@ -7711,7 +8107,9 @@ var htmlProfileTemplate = `<!DOCTYPE html>
               <span class="author-time">{{formatTime .CreatedAt}}</span>
             </div>
           </div>
+          {{if .HasContentWarning}}<details class="content-warning"><summary>Content warning{{if .ContentWarning}}: {{.ContentWarning}}{{end}}</summary>{{end}}
           <div class="note-content">{{.ContentHTML}}</div>
+          {{if .HasContentWarning}}</details>{{end}}
           <div class="note-footer">
             <div class="note-footer-actions">
             {{if $.LoggedIn}}
@@ -7731,8 +8129,8 @@ var htmlProfileTemplate = `<!DOCTYPE html>
                 <input type="hidden" name="event_id" value="{{.ID}}">
                 <input type="hidden" name="event_pubkey" value="{{.Pubkey}}">
                 <input type="hidden" name="return_url" value="{{$.CurrentURL}}">
-                <input type="hidden" name="reaction" value="❤️">
-                <button type="submit" class="text-link">Like</button>
+                <button type="submit" name="reaction" value="❤️" class="text-link">Like</button>
+                {{template "reaction-picker" $.ReactionPicker}}
               </form>
               <form method="POST" action="/html/bookmark" class="inline-form">
                 <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
@@ -7796,20 +8194,25 @@ type HTMLProfileData struct {
 	Meta                   *MetaInfo
 	ThemeClass             string // "dark", "light", or "" for system default
 	ThemeLabel             string // Label for theme toggle button
+	BlurMedia              bool   // Media from authors the reader doesn't follow is blurred
 	LoggedIn               bool
 	CurrentURL             string
 	CSRFToken              string // CSRF token for form submission
 	IsFollowing            bool   // Whether logged-in user follows this profile
 	IsSelf                 bool   // Whether this is the logged-in user's own profile
 	HasUnreadNotifications bool   // Whether there are notifications newer than last seen
+	ListMemberships        []HTMLListMembership // The logged-in user's NIP-51 lists and whether they include this profile
+	FollowCounts           *FollowCounts        // Follower/following counts, nil if not fetched
+	ReactionPicker         *ReactionPicker      // Reaction choices for the react forms (nil when logged out)
 	// Edit mode fields
 	EditMode   bool   // Whether showing edit form instead of notes
-	RawContent string // JSON of raw profile content (for preserving unknown fields)
+	ProfileEventID string // ID of the kind 0 the form was filled from; saving is refused once it's been replaced
+	ProfileUnverified bool // Current profile couldn't be loaded from enough relays; editing is disabled
 	Error      string // Error message for edit form
 	Success    string // Success message for edit form
 }
 
-func renderProfileHTML(resp ProfileResponse, relays []string, limit int, themeClass, themeLabel string, loggedIn bool, currentURL, csrfToken string, isFollowing, isSelf, hasUnreadNotifs bool) (string, error) {
+func renderProfileHTML(resp ProfileResponse, relays []string, limit int, themeClass, themeLabel string, loggedIn bool, currentURL, csrfToken string, isFollowing, isSelf, hasUnreadNotifs bool, memberships []HTMLListMembership, picker *ReactionPicker, media *mediaBlur, client string) (string, error) {
 	// Pre-fetch all nostr: references in parallel for much faster rendering
 	contents := make([]string, len(resp.Notes.Items))
 	for i, item := range resp.Notes.Items {
@@ -7823,7 +8226,7 @@ func renderProfileHTML(resp ProfileResponse, relays []string, limit int, themeCl
 	for _, content := range contents {
 		allURLs = append(allURLs, ExtractPreviewableURLs(content)...)
 	}
-	linkPreviews := FetchLinkPreviews(allURLs)
+	linkPreviews := FetchLinkPreviews(allURLs, client)
 
 	// Generate npub from hex pubkey
 	npub, _ := encodeBech32Pubkey(resp.Pubkey)
@@ -7841,6 +8244,9 @@ func renderProfileHTML(resp ProfileResponse, relays []string, limit int, themeCl
 			RelaysSeen:    item.RelaysSeen,
 			AuthorProfile: item.AuthorProfile,
 		}
+		items[i].setContentWarning(item.Tags)
+		items[i].setCustomEmoji(item.Tags)
+		media.apply(&items[i])
 	}
 
 	// Build pagination
@@ -7872,12 +8278,16 @@ func renderProfileHTML(resp ProfileResponse, relays []string, limit int, themeCl
 		Meta:                   &resp.Notes.Meta,
 		ThemeClass:             themeClass,
 		ThemeLabel:             themeLabel,
+		BlurMedia:              media != nil,
 		LoggedIn:               loggedIn,
 		CurrentURL:             currentURL,
 		CSRFToken:              csrfToken,
 		IsFollowing:            isFollowing,
 		IsSelf:                 isSelf,
 		HasUnreadNotifications: hasUnreadNotifs,
+		ListMemberships:        memberships,
+		FollowCounts:           resp.Counts,
+		ReactionPicker:         picker,
 	}
 
 	// Use cached template for better performance
@@ -7894,7 +8304,7 @@ type HTMLNotificationItem struct {
 	Event             *Event
 	Type              NotificationType
 	TypeLabel         string // Human-readable label: "replied", "mentioned", "reacted", "reposted"
-	TypeIcon          string // Emoji icon for the notification type
+	TypeIcon          template.HTML // Emoji icon for the notification type (a custom emoji image for NIP-30 reactions)
 	TargetEventID     string
 	TargetContentHTML template.HTML // Content of the target event (for reactions/reposts to show what was reacted to)
 	AuthorProfile     *ProfileInfo
@@ -7909,6 +8319,7 @@ type HTMLNotificationsData struct {
 	Title           string
 	ThemeClass      string
 	ThemeLabel      string
+	BlurMedia       bool
 	UserDisplayName string
 	UserPubKey      string
 	Items           []HTMLNotificationItem
@@ -8265,6 +8676,32 @@ var htmlNotificationsTemplate = `<!DOCTYPE html>
     .post-form:focus-within button[type="submit"] {
       display: block;
     }
+    .post-media {
+      display: none;
+      gap: 8px;
+      align-items: center;
+      flex-wrap: wrap;
+      margin-bottom: 10px;
+      font-size: 13px;
+      color: var(--text-secondary);
+    }
+    .post-form:focus-within .post-media { display: flex; }
+    .post-media input[type="text"] {
+      flex: 1;
+      min-width: 160px;
+      padding: 6px 10px;
+      border: 1px solid var(--border-color);
+      border-radius: 4px;
+      font-size: 13px;
+      font-family: inherit;
+      background: var(--bg-input);
+      color: var(--text-primary);
+    }
+    .post-media-kind { display: flex; align-items: center; gap: 4px; }
+    .post-poll { flex-basis: 100%; }
+    .post-poll summary { cursor: pointer; }
+    .post-poll-settings { display: flex; align-items: center; gap: 8px; flex-wrap: wrap; }
+    {{template "schedule-style"}}
     /* Notification items */
     .notification-list {
       display: flex;
@@ -8292,6 +8729,13 @@ var htmlNotificationsTemplate = `<!DOCTYPE html>
       font-size: 1.5rem;
       flex-shrink: 0;
     }
+    img.custom-emoji {
+      display: inline-block;
+      height: 1.4em;
+      width: auto;
+      max-width: 4em;
+      vertical-align: middle;
+    }
     .notification-meta { flex: 1; }
     .notification-author {
       font-weight: 600;
@@ -8305,6 +8749,10 @@ var htmlNotificationsTemplate = `<!DOCTYPE html>
       font-size: 0.85rem;
       margin-left: 8px;
     }
+    .content-warning-label {
+      font-style: italic;
+      color: var(--text-secondary);
+    }
     .notification-content {
       margin-left: 44px;
       padding: 12px;
@@ -8374,6 +8822,13 @@ var htmlNotificationsTemplate = `<!DOCTYPE html>
                   <button type="submit" class="ghost-btn text-xs">Theme: {{.ThemeLabel}}</button>
                 </form>
               </div>
+              <div class="settings-item">
+                <form method="POST" action="/html/blur-media" class="inline-form">
+                  <button type="submit" class="ghost-btn text-xs">Unfollowed media: {{if .BlurMedia}}Blurred{{else}}Shown{{end}}</button>
+                </form>
+              </div>
+              <div class="settings-item"><a href="/html/settings/relays" class="text-muted text-xs">Relays</a></div>
+              <div class="settings-item"><a href="/html/scheduled" class="text-muted text-xs">Scheduled posts</a></div>
             </div>
           </details>
           <a href="/html/logout" class="text-muted text-sm">Logout</a>
@@ -8392,9 +8847,36 @@ var htmlNotificationsTemplate = `<!DOCTYPE html>
       </div>
     </div>
 
-    <form method="POST" action="/html/post" class="post-form">
+    <form method="POST" action="/html/post" class="post-form" enctype="multipart/form-data">
       <label for="notif-post-content" class="sr-only">Write a new note</label>
-      <textarea id="notif-post-content" name="content" placeholder="What's on your mind?" required></textarea>
+      <textarea id="notif-post-content" name="content" placeholder="What's on your mind?"></textarea>
+      <div class="post-media">
+        <label for="notif-post-media" class="sr-only">Attach an image or video</label>
+        <input id="notif-post-media" type="file" name="media" accept="image/*,video/*">
+        <label for="notif-post-media-alt" class="sr-only">Image description</label>
+        <input id="notif-post-media-alt" type="text" name="media_alt" placeholder="Image description (alt text)">
+        <label class="post-media-kind"><input type="checkbox" name="post_kind" value="20"> Picture post</label>
+        <label class="post-media-kind"><input type="checkbox" name="cw" value="1"> Content warning</label>
+        <label for="notif-post-cw" class="sr-only">Content warning reason</label>
+        <input id="notif-post-cw" type="text" name="content_warning" placeholder="Warning reason (optional)" maxlength="200">
+        <details class="post-poll">
+          <summary>Add a poll</summary>
+          <label for="notif-post-poll-options" class="sr-only">Poll options</label>
+          <textarea id="notif-post-poll-options" name="poll_options" rows="3" placeholder="One option per line (the note is the question)"></textarea>
+          <div class="post-poll-settings">
+            <label class="post-media-kind"><input type="checkbox" name="poll_multiple" value="1"> Multiple choice</label>
+            <label for="notif-post-poll-ends">Closes</label>
+            <select id="notif-post-poll-ends" name="poll_ends">
+              <option value="1h">in 1 hour</option>
+              <option value="1d" selected>in 1 day</option>
+              <option value="3d">in 3 days</option>
+              <option value="1w">in 1 week</option>
+              <option value="">never</option>
+            </select>
+          </div>
+        </details>
+        {{template "schedule-fields" (scheduleFields "notif-post")}}
+      </div>
       <button type="submit" class="post-btn">Post</button>
     </form>
 
@@ -8459,13 +8941,13 @@ var cachedNotificationsTemplate *template.Template
 
 func initNotificationsTemplate() {
 	var err error
-	cachedNotificationsTemplate, err = template.New("notifications").Parse(htmlNotificationsTemplate)
+	cachedNotificationsTemplate, err = template.New("notifications").Funcs(template.FuncMap{"scheduleFields": defaultScheduleFields}).Parse(htmlNotificationsTemplate + htmlScheduleTemplateBlocks)
 	if err != nil {
 		log.Fatalf("Failed to compile notifications template: %v", err)
 	}
 }
 
-func renderNotificationsHTML(notifications []Notification, profiles map[string]*ProfileInfo, targetEvents map[string]*Event, themeClass, themeLabel, userDisplayName, userPubKey string, pagination *HTMLPagination) (string, error) {
+func renderNotificationsHTML(notifications []Notification, profiles map[string]*ProfileInfo, targetEvents map[string]*Event, themeClass, themeLabel, userDisplayName, userPubKey string, blurMedia bool, pagination *HTMLPagination) (string, error) {
 	// Initialize template if not done
 	if cachedNotificationsTemplate == nil {
 		initNotificationsTemplate()
@@ -8478,7 +8960,8 @@ func renderNotificationsHTML(notifications []Notification, profiles map[string]*
 		npub, _ := encodeBech32Pubkey(notif.Event.PubKey)
 
 		// Determine type label and icon
-		var typeLabel, typeIcon string
+		var typeLabel string
+		var typeIcon template.HTML
 		switch notif.Type {
 		case NotificationMention:
 			typeLabel = "mentioned you"
@@ -8490,8 +8973,10 @@ func renderNotificationsHTML(notifications []Notification, profiles map[string]*
 			typeLabel = "reacted to your note"
 			typeIcon = "❤️"
 			// Use the actual reaction content as icon if it's an emoji
-			if len(notif.Event.Content) > 0 && len(notif.Event.Content) < 10 {
-				typeIcon = notif.Event.Content
+			if emoji, ok := reactionEmoji(notif.Event); ok {
+				typeIcon = template.HTML(customEmojiHTML(emoji.Shortcode, emoji.URL))
+			} else if len(notif.Event.Content) > 0 && len(notif.Event.Content) < 10 {
+				typeIcon = template.HTML(html.EscapeString(notif.Event.Content))
 				if typeIcon == "+" || typeIcon == "" {
 					typeIcon = "❤️"
 				}
@@ -8508,7 +8993,15 @@ func renderNotificationsHTML(notifications []Notification, profiles map[string]*
 			if len(content) > 200 {
 				content = content[:200] + "..."
 			}
-			contentHTML = template.HTML(html.EscapeString(content))
+			contentHTML = template.HTML(replaceCustomEmoji(html.EscapeString(content), emojiTags(notif.Event.Tags)))
+			if reason, ok := extractContentWarning(notif.Event.Tags); ok {
+				// Keep the preview short; the warning applies to the whole note
+				label := "Content warning"
+				if reason != "" {
+					label += ": " + reason
+				}
+				contentHTML = template.HTML(`<span class="content-warning-label">` + html.EscapeString(label) + `</span>`)
+			}
 		}
 
 		// For reactions/reposts, show a preview of the target note content
@@ -8519,7 +9012,7 @@ func renderNotificationsHTML(notifications []Notification, profiles map[string]*
 				if len(targetContent) > 150 {
 					targetContent = targetContent[:150] + "..."
 				}
-				targetContentHTML = template.HTML(html.EscapeString(targetContent))
+				targetContentHTML = template.HTML(replaceCustomEmoji(html.EscapeString(targetContent), emojiTags(targetEvent.Tags)))
 			}
 		}
 
@@ -8542,6 +9035,7 @@ func renderNotificationsHTML(notifications []Notification, profiles map[string]*
 		Title:           "Notifications",
 		ThemeClass:      themeClass,
 		ThemeLabel:      themeLabel,
+		BlurMedia:       blurMedia,
 		UserDisplayName: userDisplayName,
 		UserPubKey:      userPubKey,
 		Items:           items,
@@ -9,11 +9,13 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/skip2/go-qrcode"
 )
@@ -25,7 +27,7 @@ const sessionMaxAge = 24 * time.Hour
 // This prevents leaking internal details like relay URLs, file paths, etc.
 func sanitizeErrorForUser(context string, err error) string {
 	// Log the full error for debugging
-	log.Printf("%s: %v", context, err)
+	slog.Warn(context, "error", err)
 
 	// Return generic messages based on context
 	errStr := err.Error()
@@ -60,6 +62,7 @@ func initAuthTemplates() {
 		"formatTime": func(ts int64) string {
 			return formatRelativeTime(ts)
 		},
+		"proxyImage": proxyImageURL,
 	}).Parse(htmlQuoteTemplate)
 	if err != nil {
 		log.Fatalf("Failed to compile quote template: %v", err)
@@ -71,14 +74,14 @@ func initAuthTemplates() {
 		log.Fatalf("Failed to compile login template: %v", err)
 	}
 
-	log.Printf("Auth templates compiled successfully")
+	slog.Info("Auth templates compiled successfully")
 }
 
 // generateQRCodeDataURL creates a QR code as a base64 data URL
 func generateQRCodeDataURL(content string) string {
 	png, err := qrcode.Encode(content, qrcode.Medium, 256)
 	if err != nil {
-		log.Printf("Failed to generate QR code: %v", err)
+		slog.Error("Failed to generate QR code", "error", err)
 		return ""
 	}
 	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
@@ -88,7 +91,7 @@ func generateQRCodeDataURL(content string) string {
 // This should be called after login to ensure the profile is ready for display
 func prefetchUserProfile(pubkeyHex string, relays []string) {
 	go func() {
-		log.Printf("Prefetching profile for logged-in user: %s", pubkeyHex[:16])
+		slog.Debug("Prefetching profile for logged-in user", "pubkey", shortID(pubkeyHex))
 		fetchProfiles(relays, []string{pubkeyHex})
 	}()
 }
@@ -98,14 +101,14 @@ func prefetchUserProfile(pubkeyHex string, relays []string) {
 func prefetchUserContactList(session *BunkerSession, relays []string) {
 	go func() {
 		pubkeyHex := hex.EncodeToString(session.UserPubKey)
-		log.Printf("Prefetching contact list for logged-in user: %s", pubkeyHex[:16])
+		slog.Debug("Prefetching contact list for logged-in user", "pubkey", shortID(pubkeyHex))
 
 		contacts := fetchContactList(relays, pubkeyHex)
 		if contacts != nil {
 			session.mu.Lock()
 			session.FollowingPubkeys = contacts
 			session.mu.Unlock()
-			log.Printf("Cached %d followed pubkeys for user %s", len(contacts), pubkeyHex[:16])
+			slog.Debug("Cached followed pubkeys", "contacts", len(contacts), "pubkey", shortID(pubkeyHex))
 		}
 	}()
 }
@@ -144,9 +147,9 @@ func htmlLoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate nostrconnect:// URL for the user
-	nostrConnectURL, secret, err := GenerateNostrConnectURL(defaultNostrConnectRelays)
+	nostrConnectURL, secret, err := GenerateNostrConnectURL(nostrConnectRelays())
 	if err != nil {
-		log.Printf("Failed to generate nostrconnect URL: %v", err)
+		slog.Error("Failed to generate nostrconnect URL", "error", err)
 	}
 
 	// Generate QR code
@@ -213,7 +216,7 @@ func htmlLoginSubmitHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	log.Printf("Connecting to bunker...")
+	slog.Debug("Connecting to bunker")
 	if err := session.Connect(ctx); err != nil {
 		http.Redirect(w, r, "/html/login?error="+escapeURLParam(sanitizeErrorForUser("Connect to bunker", err)), http.StatusSeeOther)
 		return
@@ -232,7 +235,7 @@ func htmlLoginSubmitHandler(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteLaxMode,
 	})
 
-	log.Printf("User logged in: %s", hex.EncodeToString(session.UserPubKey))
+	slog.Info("User logged in", "pubkey", hex.EncodeToString(session.UserPubKey), "via", "bunker")
 
 	// Prefetch user profile and contact list in background so they're ready for display
 	prefetchUserProfile(hex.EncodeToString(session.UserPubKey), session.Relays)
@@ -268,7 +271,7 @@ func htmlCheckConnectionHandler(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteLaxMode,
 	})
 
-	log.Printf("User logged in via nostrconnect: %s", hex.EncodeToString(session.UserPubKey))
+	slog.Info("User logged in", "pubkey", hex.EncodeToString(session.UserPubKey), "via", "nostrconnect")
 
 	// Prefetch user profile and contact list in background so they're ready for display
 	prefetchUserProfile(hex.EncodeToString(session.UserPubKey), session.Relays)
@@ -307,9 +310,9 @@ func htmlReconnectHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Attempting to reconnect to signer...")
+	slog.Debug("Attempting to reconnect to signer")
 
-	session, err := TryReconnectToSigner(signerPubKey, defaultNostrConnectRelays)
+	session, err := TryReconnectToSigner(signerPubKey, nostrConnectRelays())
 	if err != nil {
 		http.Redirect(w, r, "/html/login?error="+escapeURLParam(sanitizeErrorForUser("Reconnect to signer", err)), http.StatusSeeOther)
 		return
@@ -327,7 +330,7 @@ func htmlReconnectHandler(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteLaxMode,
 	})
 
-	log.Printf("User logged in via reconnect: %s", hex.EncodeToString(session.UserPubKey))
+	slog.Info("User logged in", "pubkey", hex.EncodeToString(session.UserPubKey), "via", "reconnect")
 
 	// Prefetch user profile and contact list in background so they're ready for display
 	prefetchUserProfile(hex.EncodeToString(session.UserPubKey), session.Relays)
@@ -555,6 +558,9 @@ func htmlPostNoteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Extended before the form is read, since it may carry a large file
+	uploadBy := uploadDeadline(w, r)
+
 	// Validate CSRF token
 	csrfToken := r.FormValue("csrf_token")
 	if !validateCSRFToken(session.ID, csrfToken) {
@@ -562,48 +568,113 @@ func htmlPostNoteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A scheduled note is signed now with its future created_at
+	scheduleAt, scheduleZone, err := parseScheduleForm(r)
+	if err != nil {
+		http.Redirect(w, r, "/html/timeline?kinds=1&limit=20&error="+escapeURLParam(err.Error()), http.StatusSeeOther)
+		return
+	}
+	createdAt := time.Now().Unix()
+	if scheduleAt > 0 {
+		createdAt = scheduleAt
+	}
+
 	content := strings.TrimSpace(r.FormValue("content"))
-	if content == "" {
+	picturePost := r.FormValue("post_kind") == "20"
+
+	// Upload an attached file first; its URL goes into the note
+	media, err := uploadFormMedia(r, session, uploadBy)
+	if err != nil {
+		http.Redirect(w, r, "/html/timeline?kinds=1&limit=20&error="+escapeURLParam(uploadErrorMessage(err)), http.StatusSeeOther)
+		return
+	}
+	if content == "" && media == nil {
 		http.Redirect(w, r, "/html/timeline?kinds=1&limit=20&error=Note+content+is+required", http.StatusSeeOther)
 		return
 	}
+	if picturePost && (media == nil || !strings.HasPrefix(media.MimeType, "image/")) {
+		http.Redirect(w, r, "/html/timeline?kinds=1&limit=20&error=Picture+posts+need+an+attached+image", http.StatusSeeOther)
+		return
+	}
+
+	kind := 1
+	tags := [][]string{}
+	if media != nil {
+		tags = append(tags, media.imetaTag())
+		if picturePost {
+			// NIP-68 picture post: the image lives in imeta, content is the caption
+			kind = 20
+			tags = append(tags, []string{"m", media.MimeType})
+			if media.SHA256 != "" {
+				tags = append(tags, []string{"x", media.SHA256})
+			}
+		} else {
+			content = strings.TrimSpace(content + "\n\n" + media.URL)
+		}
+	}
+	if cw := contentWarningTag(r); cw != nil {
+		tags = append(tags, cw)
+	}
+
+	// Publish to relays
+	relays := defaultPublishRelays()
+
+	// NIP-88 poll: the note is the question, options come from the poll fields
+	pollTags, err := pollTagsFromForm(r, relays, createdAt)
+	if err != nil {
+		http.Redirect(w, r, "/html/timeline?kinds=1&limit=20&error="+escapeURLParam(err.Error()), http.StatusSeeOther)
+		return
+	}
+	if pollTags != nil {
+		if picturePost {
+			http.Redirect(w, r, "/html/timeline?kinds=1&limit=20&error=A+poll+can%27t+be+a+picture+post", http.StatusSeeOther)
+			return
+		}
+		if strings.TrimSpace(r.FormValue("content")) == "" {
+			http.Redirect(w, r, "/html/timeline?kinds=1&limit=20&error=A+poll+needs+a+question", http.StatusSeeOther)
+			return
+		}
+		kind = kindPoll
+		tags = append(tags, pollTags...)
+	}
 
 	// Create unsigned event
 	event := UnsignedEvent{
-		Kind:      1,
+		Kind:      kind,
 		Content:   content,
-		Tags:      [][]string{},
-		CreatedAt: time.Now().Unix(),
+		Tags:      tags,
+		CreatedAt: createdAt,
 	}
 
 	// Sign via bunker
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
 	defer cancel()
 
 	signedEvent, err := session.SignEvent(ctx, event)
 	if err != nil {
-		log.Printf("Failed to sign event: %v", err)
+		slog.Warn("Failed to sign note", "error", err)
 		http.Redirect(w, r, "/html/timeline?kinds=1&limit=20&error="+escapeURLParam(sanitizeErrorForUser("Sign event", err)), http.StatusSeeOther)
 		return
 	}
 
-	// Publish to relays
-	relays := []string{
-		"wss://relay.damus.io",
-		"wss://relay.nostr.band",
-		"wss://relay.primal.net",
-		"wss://nos.lol",
+	if scheduleAt > 0 {
+		scheduleSigned(w, r, signedEvent, relays, "note", scheduleZone, "/html/timeline?kinds=1&limit=20")
+		return
 	}
 
 	publishEvent(ctx, relays, signedEvent)
 
-	log.Printf("Published note: %s", signedEvent.ID)
+	slog.Info("Published note", "event", signedEvent.ID, "kind", kind)
+	if kind == kindPoll {
+		http.Redirect(w, r, "/html/thread/"+signedEvent.ID+"?success=Poll+published", http.StatusSeeOther)
+		return
+	}
 	http.Redirect(w, r, "/html/timeline?kinds=1&limit=20&success=Note+published", http.StatusSeeOther)
 }
 
 // htmlReplyHandler handles replying to a note via POST form
 func htmlReplyHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Reply handler called: method=%s", r.Method)
+	slog.Debug("Reply handler called", "method", r.Method)
 
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/html/timeline?kinds=1&limit=20", http.StatusSeeOther)
@@ -612,16 +683,19 @@ func htmlReplyHandler(w http.ResponseWriter, r *http.Request) {
 
 	session := getSessionFromRequest(r)
 	if session == nil {
-		log.Printf("Reply failed: no session found")
+		slog.Debug("Reply failed: no session found")
 		http.Redirect(w, r, "/html/login?error=Please+login+first", http.StatusSeeOther)
 		return
 	}
 	if !session.Connected {
-		log.Printf("Reply failed: session not connected")
+		slog.Debug("Reply failed: session not connected")
 		http.Redirect(w, r, "/html/login?error=Please+login+first", http.StatusSeeOther)
 		return
 	}
 
+	// Extended before the form is read, since it may carry a large file
+	uploadBy := uploadDeadline(w, r)
+
 	// Validate CSRF token
 	csrfToken := r.FormValue("csrf_token")
 	if !validateCSRFToken(session.ID, csrfToken) {
@@ -629,7 +703,7 @@ func htmlReplyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Reply: session valid, user=%s", hex.EncodeToString(session.UserPubKey)[:16])
+	slog.Debug("Reply: session valid", "pubkey", shortID(hex.EncodeToString(session.UserPubKey)))
 
 	content := strings.TrimSpace(r.FormValue("content"))
 	replyTo := strings.TrimSpace(r.FormValue("reply_to"))
@@ -641,6 +715,25 @@ func htmlReplyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scheduleAt, scheduleZone, err := parseScheduleForm(r)
+	if err != nil {
+		http.Redirect(w, r, "/html/thread/"+replyTo+"?error="+escapeURLParam(err.Error()), http.StatusSeeOther)
+		return
+	}
+	createdAt := time.Now().Unix()
+	if scheduleAt > 0 {
+		createdAt = scheduleAt
+	}
+
+	media, err := uploadFormMedia(r, session, uploadBy)
+	if err != nil {
+		http.Redirect(w, r, "/html/thread/"+replyTo+"?error="+escapeURLParam(uploadErrorMessage(err)), http.StatusSeeOther)
+		return
+	}
+	if media != nil {
+		content = strings.TrimSpace(content + "\n\n" + media.URL)
+	}
+
 	if content == "" {
 		http.Redirect(w, r, "/html/thread/"+replyTo+"?error=Reply+content+is+required", http.StatusSeeOther)
 		return
@@ -654,37 +747,43 @@ func htmlReplyHandler(w http.ResponseWriter, r *http.Request) {
 	if replyToPubkey != "" {
 		tags = append(tags, []string{"p", replyToPubkey})
 	}
+	if media != nil {
+		tags = append(tags, media.imetaTag())
+	}
+	if cw := contentWarningTag(r); cw != nil {
+		tags = append(tags, cw)
+	}
 
 	// Create unsigned event
 	event := UnsignedEvent{
 		Kind:      1,
 		Content:   content,
 		Tags:      tags,
-		CreatedAt: time.Now().Unix(),
+		CreatedAt: createdAt,
 	}
 
 	// Sign via bunker
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
 	defer cancel()
 
 	signedEvent, err := session.SignEvent(ctx, event)
 	if err != nil {
-		log.Printf("Failed to sign reply: %v", err)
+		slog.Warn("Failed to sign reply", "error", err)
 		http.Redirect(w, r, "/html/thread/"+replyTo+"?error="+escapeURLParam(sanitizeErrorForUser("Sign event", err)), http.StatusSeeOther)
 		return
 	}
 
 	// Publish to relays
-	relays := []string{
-		"wss://relay.damus.io",
-		"wss://relay.nostr.band",
-		"wss://relay.primal.net",
-		"wss://nos.lol",
+	relays := defaultPublishRelays()
+
+	if scheduleAt > 0 {
+		scheduleSigned(w, r, signedEvent, relays, "reply", scheduleZone, "/html/thread/"+replyTo)
+		return
 	}
 
 	publishEvent(ctx, relays, signedEvent)
 
-	log.Printf("Published reply: %s (to %s)", signedEvent.ID, replyTo)
+	slog.Info("Published reply", "event", signedEvent.ID, "reply_to", replyTo)
 	http.Redirect(w, r, "/html/thread/"+replyTo+"?success=Reply+published", http.StatusSeeOther)
 }
 
@@ -721,6 +820,30 @@ func htmlReactHandler(w http.ResponseWriter, r *http.Request) {
 	if reaction == "" {
 		reaction = "+"
 	}
+	if len(reaction) > maxReactionLength || !utf8.ValidString(reaction) {
+		separator := "?"
+		if strings.Contains(returnURL, "?") {
+			separator = "&"
+		}
+		http.Redirect(w, r, returnURL+separator+"error=Invalid+reaction", http.StatusSeeOther)
+		return
+	}
+
+	// A NIP-30 custom emoji from the user's emoji list carries its image in an emoji tag
+	var emojiTag []string
+	if code := strings.TrimSpace(r.FormValue("emoji")); code != "" {
+		emoji, ok := findUserEmoji(userEmojis(session), code)
+		if !ok {
+			separator := "?"
+			if strings.Contains(returnURL, "?") {
+				separator = "&"
+			}
+			http.Redirect(w, r, returnURL+separator+"error=Unknown+emoji", http.StatusSeeOther)
+			return
+		}
+		reaction = ":" + emoji.Shortcode + ":"
+		emojiTag = []string{"emoji", emoji.Shortcode, emoji.URL}
+	}
 
 	// Build tags for reaction (NIP-25)
 	tags := [][]string{
@@ -730,6 +853,9 @@ func htmlReactHandler(w http.ResponseWriter, r *http.Request) {
 	if eventPubkey != "" {
 		tags = append(tags, []string{"p", eventPubkey})
 	}
+	if emojiTag != nil {
+		tags = append(tags, emojiTag)
+	}
 
 	// Create unsigned event
 	event := UnsignedEvent{
@@ -740,12 +866,12 @@ func htmlReactHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Sign via bunker
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
 	defer cancel()
 
 	signedEvent, err := session.SignEvent(ctx, event)
 	if err != nil {
-		log.Printf("Failed to sign reaction: %v", err)
+		slog.Warn("Failed to sign reaction", "error", err)
 		separator := "?"
 		if strings.Contains(returnURL, "?") {
 			separator = "&"
@@ -755,18 +881,15 @@ func htmlReactHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get relays to publish to
-	relays := []string{
-		"wss://relay.damus.io",
-		"wss://relay.nostr.band",
-		"wss://nos.lol",
-	}
+	relays := defaultPublishRelays()
 	if session.UserRelayList != nil && len(session.UserRelayList.Write) > 0 {
 		relays = session.UserRelayList.Write
 	}
 
 	publishEvent(ctx, relays, signedEvent)
+	recentReactionCache.Remember(hex.EncodeToString(session.UserPubKey), normalizeReaction(reaction))
 
-	log.Printf("Published reaction %s to event %s", reaction, eventID)
+	slog.Info("Published reaction", "reaction", reaction, "target", eventID)
 	http.Redirect(w, r, returnURL, http.StatusSeeOther)
 }
 
@@ -817,12 +940,12 @@ func htmlRepostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Sign via bunker
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
 	defer cancel()
 
 	signedEvent, err := session.SignEvent(ctx, event)
 	if err != nil {
-		log.Printf("Failed to sign repost: %v", err)
+		slog.Warn("Failed to sign repost", "error", err)
 		separator := "?"
 		if strings.Contains(returnURL, "?") {
 			separator = "&"
@@ -832,19 +955,14 @@ func htmlRepostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get relays to publish to
-	relays := []string{
-		"wss://relay.damus.io",
-		"wss://relay.nostr.band",
-		"wss://relay.primal.net",
-		"wss://nos.lol",
-	}
+	relays := defaultPublishRelays()
 	if session.UserRelayList != nil && len(session.UserRelayList.Write) > 0 {
 		relays = session.UserRelayList.Write
 	}
 
 	publishEvent(ctx, relays, signedEvent)
 
-	log.Printf("Published repost: %s (reposting %s)", signedEvent.ID, eventID)
+	slog.Info("Published repost", "event", signedEvent.ID, "target", eventID)
 
 	// Add success message to return URL
 	if strings.Contains(returnURL, "?") {
@@ -888,24 +1006,29 @@ func htmlBookmarkHandler(w http.ResponseWriter, r *http.Request) {
 		action = "add"
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
 	defer cancel()
 
 	userPubkey := hex.EncodeToString(session.UserPubKey)
 
 	// Get relays
-	relays := []string{
-		"wss://relay.damus.io",
-		"wss://relay.nostr.band",
-		"wss://nos.lol",
-	}
+	relays := defaultPublishRelays()
 	if session.UserRelayList != nil && len(session.UserRelayList.Write) > 0 {
 		relays = session.UserRelayList.Write
 	}
 
 	// Fetch user's current bookmark list (kind 10003)
 	existingTags := [][]string{}
-	bookmarkEvents := fetchKind10003(relays, userPubkey)
+	bookmarkEvents, confident := fetchKind10003(relays, userPubkey)
+	if !confident {
+		// Publishing on top of a list we couldn't verify could drop bookmarks
+		separator := "?"
+		if strings.Contains(returnURL, "?") {
+			separator = "&"
+		}
+		http.Redirect(w, r, returnURL+separator+"error="+escapeURLParam("Couldn't load your current bookmarks from enough relays; please try again"), http.StatusSeeOther)
+		return
+	}
 	if len(bookmarkEvents) > 0 {
 		// Use the most recent bookmark list
 		existingTags = bookmarkEvents[0].Tags
@@ -948,7 +1071,7 @@ func htmlBookmarkHandler(w http.ResponseWriter, r *http.Request) {
 	// Sign via bunker
 	signedEvent, err := session.SignEvent(ctx, event)
 	if err != nil {
-		log.Printf("Failed to sign bookmark list: %v", err)
+		slog.Warn("Failed to sign bookmark list", "error", err)
 		separator := "?"
 		if strings.Contains(returnURL, "?") {
 			separator = "&"
@@ -960,20 +1083,21 @@ func htmlBookmarkHandler(w http.ResponseWriter, r *http.Request) {
 	// Publish to relays
 	publishEvent(ctx, relays, signedEvent)
 
-	log.Printf("Published bookmark list update: %s (action=%s, event=%s)", signedEvent.ID, action, eventID)
+	slog.Info("Published bookmark list update", "event", signedEvent.ID, "action", action, "target", eventID)
 	http.Redirect(w, r, returnURL, http.StatusSeeOther)
 }
 
-// fetchKind10003 fetches the user's bookmark list (kind 10003)
-func fetchKind10003(relays []string, pubkey string) []Event {
+// fetchKind10003 fetches the user's bookmark list (kind 10003). The bool reports whether
+// enough relays answered to trust it as the current version.
+func fetchKind10003(relays []string, pubkey string) ([]Event, bool) {
 	filter := Filter{
 		Kinds:   []int{10003},
 		Authors: []string{pubkey},
 		Limit:   1,
 	}
 
-	events, _ := fetchEventsFromRelays(relays, filter)
-	return events
+	result := fetchReplaceable(relays, filter)
+	return result.Events, result.Confident
 }
 
 // htmlQuoteHandler handles both displaying the quote form (GET) and submitting (POST)
@@ -1016,7 +1140,7 @@ func htmlQuoteHandler(w http.ResponseWriter, r *http.Request) {
 		// Convert event ID to note1 bech32 format for embedding in content
 		noteID, err := encodeBech32EventID(eventID)
 		if err != nil {
-			log.Printf("Failed to encode event ID: %v", err)
+			slog.Error("Failed to encode event ID", "error", err)
 			noteID = eventID // fallback to hex
 		}
 
@@ -1041,42 +1165,31 @@ func htmlQuoteHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Sign via bunker
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
 		defer cancel()
 
 		signedEvent, err := session.SignEvent(ctx, event)
 		if err != nil {
-			log.Printf("Failed to sign quote: %v", err)
+			slog.Warn("Failed to sign quote", "error", err)
 			http.Redirect(w, r, "/html/quote/"+eventID+"?error="+escapeURLParam(sanitizeErrorForUser("Sign event", err)), http.StatusSeeOther)
 			return
 		}
 
 		// Publish to relays
-		relays := []string{
-			"wss://relay.damus.io",
-			"wss://relay.nostr.band",
-			"wss://relay.primal.net",
-			"wss://nos.lol",
-		}
+		relays := defaultPublishRelays()
 		if session.UserRelayList != nil && len(session.UserRelayList.Write) > 0 {
 			relays = session.UserRelayList.Write
 		}
 
 		publishEvent(ctx, relays, signedEvent)
 
-		log.Printf("Published quote: %s (quoting %s)", signedEvent.ID, eventID)
+		slog.Info("Published quote", "event", signedEvent.ID, "target", eventID)
 		http.Redirect(w, r, "/html/timeline?kinds=1&limit=20&success=Quote+published", http.StatusSeeOther)
 		return
 	}
 
 	// GET: Show quote form with preview of the quoted note
-	relays := []string{
-		"wss://relay.damus.io",
-		"wss://relay.nostr.band",
-		"wss://relay.primal.net",
-		"wss://nos.lol",
-		"wss://nostr.mom",
-	}
+	relays := defaultReadRelays()
 
 	// Fetch the event to be quoted
 	events := fetchEventByID(relays, eventID)
@@ -1189,9 +1302,9 @@ func publishEvent(ctx context.Context, relays []string, event *Event) {
 	for _, relay := range relays {
 		go func(relayURL string) {
 			if err := publishToRelay(ctx, relayURL, event); err != nil {
-				log.Printf("Failed to publish to %s: %v", relayURL, err)
+				slog.Warn("Failed to publish", "relay", relayURL, "error", err)
 			} else {
-				log.Printf("Published to %s", relayURL)
+				slog.Debug("Published to relay", "relay", relayURL)
 			}
 		}(relay)
 	}
@@ -1199,6 +1312,32 @@ func publishEvent(ctx context.Context, relays []string, event *Event) {
 	time.Sleep(500 * time.Millisecond)
 }
 
+// publishEventAccepted publishes a signed event to relays, waits for each
+// relay's OK, and returns the relays that accepted it
+func publishEventAccepted(ctx context.Context, relays []string, event *Event) []string {
+	type outcome struct {
+		relay string
+		err   error
+	}
+	outcomes := make(chan outcome, len(relays))
+	for _, relay := range relays {
+		go func(relayURL string) {
+			outcomes <- outcome{relayURL, publishToRelay(ctx, relayURL, event)}
+		}(relay)
+	}
+
+	accepted := []string{}
+	for range relays {
+		o := <-outcomes
+		if o.err != nil {
+			slog.Warn("Failed to publish", "relay", o.relay, "error", o.err)
+			continue
+		}
+		accepted = append(accepted, o.relay)
+	}
+	return accepted
+}
+
 func publishToRelay(ctx context.Context, relayURL string, event *Event) error {
 	pc, err := relayPool.Get(ctx, relayURL)
 	if err != nil {
@@ -1232,7 +1371,7 @@ func publishToRelay(ctx context.Context, relayURL string, event *Event) error {
 			if !success {
 				return fmt.Errorf("relay rejected event %s: %s", eventID, reason)
 			}
-			log.Printf("Relay %s accepted event %s", relayURL, eventID[:16])
+			slog.Debug("Relay accepted event", "relay", relayURL, "event", shortID(eventID))
 		}
 	}
 
@@ -1529,7 +1668,7 @@ var htmlQuoteTemplate = `<!DOCTYPE html>
       <div class="quoted-note">
         <div class="quoted-author">
           {{if and .AuthorProfile .AuthorProfile.Picture}}
-          <img class="quoted-avatar" src="{{.AuthorProfile.Picture}}" alt="">
+          <img class="quoted-avatar" src="{{proxyImage .AuthorProfile.Picture 96}}" alt="">
           {{else}}
           <img class="quoted-avatar" src="/static/avatar.jpg" alt="">
           {{end}}
@@ -2057,22 +2196,27 @@ func htmlFollowHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
 	defer cancel()
 
 	// Get relays to use
-	relays := []string{
-		"wss://relay.damus.io",
-		"wss://relay.nostr.band",
-		"wss://nos.lol",
-	}
+	relays := defaultPublishRelays()
 	if session.UserRelayList != nil && len(session.UserRelayList.Write) > 0 {
 		relays = session.UserRelayList.Write
 	}
 
 	// Fetch user's current contact list (kind 3)
 	existingTags := [][]string{}
-	contactEvents := fetchKind3(relays, userPubkey)
+	contactEvents, confident := fetchKind3(relays, userPubkey)
+	if !confident {
+		// Publishing on top of a list we couldn't verify could drop follows
+		separator := "?"
+		if strings.Contains(returnURL, "?") {
+			separator = "&"
+		}
+		http.Redirect(w, r, returnURL+separator+"error="+escapeURLParam("Couldn't load your current contact list from enough relays; please try again"), http.StatusSeeOther)
+		return
+	}
 	if len(contactEvents) > 0 {
 		existingTags = contactEvents[0].Tags
 	}
@@ -2114,7 +2258,7 @@ func htmlFollowHandler(w http.ResponseWriter, r *http.Request) {
 	// Sign via bunker
 	signedEvent, err := session.SignEvent(ctx, event)
 	if err != nil {
-		log.Printf("Failed to sign contact list: %v", err)
+		slog.Warn("Failed to sign contact list", "error", err)
 		separator := "?"
 		if strings.Contains(returnURL, "?") {
 			separator = "&"
@@ -2142,32 +2286,34 @@ func htmlFollowHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	session.mu.Unlock()
 
-	log.Printf("Published contact list update: %s (action=%s, target=%s)", signedEvent.ID, action, targetPubkey[:16])
+	slog.Info("Published contact list update", "event", signedEvent.ID, "action", action, "target", shortID(targetPubkey))
 	http.Redirect(w, r, returnURL, http.StatusSeeOther)
 }
 
-// fetchKind3 fetches the user's contact list (kind 3)
-func fetchKind3(relays []string, pubkey string) []Event {
+// fetchKind3 fetches the user's contact list (kind 3). The bool reports whether
+// enough relays answered to trust it as the current version.
+func fetchKind3(relays []string, pubkey string) ([]Event, bool) {
 	filter := Filter{
 		Kinds:   []int{3},
 		Authors: []string{pubkey},
 		Limit:   1,
 	}
 
-	events, _ := fetchEventsFromRelays(relays, filter)
-	return events
+	result := fetchReplaceable(relays, filter)
+	return result.Events, result.Confident
 }
 
-// fetchKind0 fetches the user's profile metadata (kind 0)
-func fetchKind0(relays []string, pubkey string) []Event {
+// fetchKind0 fetches the user's profile metadata (kind 0). The bool reports whether
+// enough relays answered to trust it as the current version.
+func fetchKind0(relays []string, pubkey string) ([]Event, bool) {
 	filter := Filter{
 		Kinds:   []int{0},
 		Authors: []string{pubkey},
 		Limit:   1,
 	}
 
-	events, _ := fetchEventsFromRelays(relays, filter)
-	return events
+	result := fetchReplaceable(relays, filter)
+	return result.Events, result.Confident
 }
 
 // htmlProfileEditHandler handles GET and POST for /html/profile/edit
@@ -2181,40 +2327,33 @@ func htmlProfileEditHandler(w http.ResponseWriter, r *http.Request) {
 
 	userPubKeyHex := hex.EncodeToString(session.UserPubKey)
 
+	// The profile is read from and published to the user's write relays
+	var relays []string
+	session.mu.Lock()
+	if session.UserRelayList != nil {
+		relays = session.UserRelayList.Write
+	}
+	session.mu.Unlock()
+	if len(relays) == 0 {
+		relays = session.Relays
+	}
+	if len(relays) == 0 {
+		relays = nostrConnectRelays()
+	}
+
 	if r.Method == "GET" {
 		// Fetch current profile
-		var relays []string
-		session.mu.Lock()
-		if session.UserRelayList != nil {
-			relays = session.UserRelayList.Write
-		}
-		session.mu.Unlock()
-		if len(relays) == 0 {
-			relays = session.Relays
-		}
-		if len(relays) == 0 {
-			relays = defaultNostrConnectRelays
-		}
-
 		var profile ProfileInfo
-		var rawContent map[string]interface{}
+		var profileEventID string
 
-		events := fetchKind0(relays, userPubKeyHex)
+		events, confident := fetchKind0(relays, userPubKeyHex)
 		if len(events) > 0 {
 			if err := json.Unmarshal([]byte(events[0].Content), &profile); err != nil {
-				log.Printf("Failed to parse profile: %v", err)
+				slog.Warn("Failed to parse profile", "error", err)
 			}
-			// Keep raw content to preserve unknown fields
-			if err := json.Unmarshal([]byte(events[0].Content), &rawContent); err != nil {
-				rawContent = make(map[string]interface{})
-			}
-		} else {
-			rawContent = make(map[string]interface{})
+			profileEventID = events[0].ID
 		}
 
-		// Encode raw content for hidden field (to preserve unknown fields)
-		rawContentJSON, _ := json.Marshal(rawContent)
-
 		// Generate npub from hex pubkey
 		npub, _ := encodeBech32Pubkey(userPubKeyHex)
 
@@ -2239,14 +2378,16 @@ func htmlProfileEditHandler(w http.ResponseWriter, r *http.Request) {
 			IsSelf:     true,
 			// Edit mode fields
 			EditMode:   true,
-			RawContent: string(rawContentJSON),
+			ProfileEventID: profileEventID,
+			// Saving over a profile we couldn't verify could wipe fields
+			ProfileUnverified: !confident,
 			Error:      r.URL.Query().Get("error"),
 			Success:    r.URL.Query().Get("success"),
 		}
 
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		if err := cachedProfileTemplate.Execute(w, data); err != nil {
-			log.Printf("Template error: %v", err)
+			slog.Error("Error rendering profile edit", "error", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
 		return
@@ -2270,6 +2411,23 @@ func htmlProfileEditHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The edit form is hidden when the profile can't be verified, but check
+	// again here: relays may have stopped answering since the form was shown
+	events, confident := fetchKind0(relays, userPubKeyHex)
+	if !confident {
+		http.Redirect(w, r, "/html/profile/edit?error="+escapeURLParam("Couldn't load your current profile from enough relays; please try again"), http.StatusSeeOther)
+		return
+	}
+	// Saving a form filled from an older profile would undo changes made elsewhere
+	var currentID, currentContent string
+	if len(events) > 0 {
+		currentID, currentContent = events[0].ID, events[0].Content
+	}
+	if r.FormValue("profile_event_id") != currentID {
+		http.Redirect(w, r, "/html/profile/edit?error="+escapeURLParam("Your profile was changed elsewhere since this form was opened; review the latest version and save again"), http.StatusSeeOther)
+		return
+	}
+
 	// Get form values
 	displayName := strings.TrimSpace(r.FormValue("display_name"))
 	name := strings.TrimSpace(r.FormValue("name"))
@@ -2279,7 +2437,6 @@ func htmlProfileEditHandler(w http.ResponseWriter, r *http.Request) {
 	nip05 := strings.TrimSpace(r.FormValue("nip05"))
 	lud16 := strings.TrimSpace(r.FormValue("lud16"))
 	website := strings.TrimSpace(r.FormValue("website"))
-	rawContentStr := r.FormValue("raw_content")
 
 	// Basic URL validation for picture and banner
 	if picture != "" && !isValidURL(picture) {
@@ -2295,10 +2452,10 @@ func htmlProfileEditHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse raw content to preserve unknown fields
+	// Start from the current profile's content to preserve unknown fields
 	var profileData map[string]interface{}
-	if rawContentStr != "" {
-		if err := json.Unmarshal([]byte(rawContentStr), &profileData); err != nil {
+	if currentContent != "" {
+		if err := json.Unmarshal([]byte(currentContent), &profileData); err != nil {
 			profileData = make(map[string]interface{})
 		}
 	} else {
@@ -2339,37 +2496,23 @@ func htmlProfileEditHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Sign via bunker
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
 	defer cancel()
 
 	signedEvent, err := session.SignEvent(ctx, event)
 	if err != nil {
-		log.Printf("Failed to sign profile update: %v", err)
+		slog.Warn("Failed to sign profile update", "error", err)
 		http.Redirect(w, r, "/html/profile/edit?error="+escapeURLParam(sanitizeErrorForUser("Sign profile", err)), http.StatusSeeOther)
 		return
 	}
 
-	// Get relays
-	var relays []string
-	session.mu.Lock()
-	if session.UserRelayList != nil {
-		relays = session.UserRelayList.Write
-	}
-	session.mu.Unlock()
-	if len(relays) == 0 {
-		relays = session.Relays
-	}
-	if len(relays) == 0 {
-		relays = defaultNostrConnectRelays
-	}
-
 	// Publish to relays
 	publishEvent(ctx, relays, signedEvent)
 
 	// Invalidate cached profile
 	profileCache.Delete(userPubKeyHex)
 
-	log.Printf("Published profile update: %s (pubkey=%s)", signedEvent.ID, userPubKeyHex[:16])
+	slog.Info("Published profile update", "event", signedEvent.ID, "pubkey", shortID(userPubKeyHex))
 	http.Redirect(w, r, "/html/profile/"+userPubKeyHex+"?success="+escapeURLParam("Profile updated"), http.StatusSeeOther)
 }
 
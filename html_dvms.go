@@ -0,0 +1,106 @@
+package main
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// HTMLDVM is a content discovery DVM as rendered on the picker page
+type HTMLDVM struct {
+	Pubkey  string
+	Npub    string
+	Name    string
+	About   string
+	Picture string
+}
+
+// HTMLDVMsData is the data passed to the DVM picker template
+type HTMLDVMsData struct {
+	HTMLPageChrome
+	DVMs []HTMLDVM
+}
+
+var htmlDVMsTemplate = `{{define "page-style"}}
+    .dvm-card { display: flex; gap: 12px; align-items: flex-start; }
+    .dvm-picture { width: 48px; height: 48px; border-radius: 8px; object-fit: cover; flex-shrink: 0; }
+    .dvm-body { flex: 1; min-width: 0; }
+    .dvm-about { color: var(--text-secondary); font-size: 0.9rem; margin-top: 4px; overflow-wrap: anywhere; }
+{{end}}{{template "page-head" .}}
+    {{template "page-nav" .}}
+    <main>
+      <h2>Discover</h2>
+      <p class="text-sm text-muted" style="margin-bottom: 16px;">Algorithmic feeds from content discovery services (NIP-90 Data Vending Machines). Picking one sends it a feed request and shows the notes it recommends{{if .LoggedIn}}, personalized for you where the service supports it{{end}}.</p>
+      {{range .DVMs}}
+      <div class="card dvm-card">
+        {{if .Picture}}<img src="{{proxyImage .Picture 96}}" alt="" class="dvm-picture" loading="lazy">{{end}}
+        <div class="dvm-body">
+          <a href="/html/timeline?kinds=1&limit=20&feed=dvm:{{.Npub}}" class="card-title">{{.Name}}</a>
+          {{if .About}}<div class="dvm-about">{{.About}}</div>{{end}}
+        </div>
+        <a href="/html/timeline?kinds=1&limit=20&feed=dvm:{{.Npub}}" class="secondary-btn">View feed</a>
+      </div>
+      {{else}}
+      <div class="empty-state">
+        <p>No feed services found</p>
+        <p class="empty-state-hint">None of your relays returned a content discovery DVM announcement. Try again later.</p>
+      </div>
+      {{end}}
+    </main>
+    {{template "page-footer" .}}`
+
+var cachedDVMsTemplate *template.Template
+
+// htmlDVMsHandler lists content discovery DVMs to pick a feed from
+func htmlDVMsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session := getSessionFromRequest(r)
+	readRelays, _ := sessionRelays(session)
+
+	dvms := fetchContentDVMs(readRelays)
+	sort.Slice(dvms, func(i, j int) bool {
+		return strings.ToLower(dvms[i].Name) < strings.ToLower(dvms[j].Name)
+	})
+
+	htmlDVMs := make([]HTMLDVM, 0, len(dvms))
+	for _, d := range dvms {
+		npub, err := encodeBech32Pubkey(d.Pubkey)
+		if err != nil {
+			continue
+		}
+		picture := d.Picture
+		if !strings.HasPrefix(picture, "https://") {
+			picture = ""
+		}
+		htmlDVMs = append(htmlDVMs, HTMLDVM{
+			Pubkey:  d.Pubkey,
+			Npub:    npub,
+			Name:    d.Name,
+			About:   d.About,
+			Picture: picture,
+		})
+	}
+
+	data := HTMLDVMsData{
+		HTMLPageChrome: newPageChrome("Discover", r, session, readRelays),
+		DVMs:           htmlDVMs,
+	}
+	data.NavTab = "dvms"
+
+	html, err := executePageTemplate(cachedDVMsTemplate, data)
+	if err != nil {
+		slog.Error("Error rendering DVMs", "error", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(html))
+}
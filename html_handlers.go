@@ -3,7 +3,7 @@ package main
 import (
 	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"sort"
@@ -44,14 +44,17 @@ func htmlTimelineHandler(w http.ResponseWriter, r *http.Request) {
 	// Get session early to check for user's relay list
 	session := getSessionFromRequest(r)
 
-	relays := parseStringList(q.Get("relays"))
+	relays, ok := parseRequestRelays(w, r)
+	if !ok {
+		return
+	}
 	if len(relays) == 0 {
 		// Use user's read relays if logged in and have a relay list (NIP-65)
 		if session != nil && session.Connected {
 			// If relay list not fetched yet, try to fetch it now
 			if session.UserRelayList == nil && session.UserPubKey != nil {
 				pubkeyHex := hex.EncodeToString(session.UserPubKey)
-				log.Printf("Fetching relay list for user %s...", pubkeyHex[:12])
+				slog.Debug("Fetching relay list", "pubkey", shortID(pubkeyHex))
 				relayList := fetchRelayList(pubkeyHex)
 				if relayList != nil {
 					session.mu.Lock()
@@ -62,19 +65,13 @@ func htmlTimelineHandler(w http.ResponseWriter, r *http.Request) {
 
 			if session.UserRelayList != nil && len(session.UserRelayList.Read) > 0 {
 				relays = session.UserRelayList.Read
-				log.Printf("Using user's %d read relays from NIP-65", len(relays))
+				slog.Debug("Using NIP-65 read relays", "relays", len(relays))
 			}
 		}
 
 		// Fallback to default relays
 		if len(relays) == 0 {
-			relays = []string{
-				"wss://relay.damus.io",
-				"wss://relay.nostr.band",
-				"wss://relay.primal.net",
-				"wss://nos.lol",
-				"wss://nostr.mom",
-			}
+			relays = defaultReadRelays()
 		}
 	}
 
@@ -103,18 +100,18 @@ func htmlTimelineHandler(w http.ResponseWriter, r *http.Request) {
 		contacts, ok := contactCache.Get(pubkeyHex)
 		if !ok {
 			// Fetch from relays
-			log.Printf("Fetching contact list for %s...", pubkeyHex[:12])
+			slog.Debug("Fetching contact list", "pubkey", shortID(pubkeyHex))
 			contacts = fetchContactList(relays, pubkeyHex)
 			if contacts != nil {
 				contactCache.Set(pubkeyHex, contacts)
 			}
 		} else {
-			log.Printf("Contact cache hit for %s (%d contacts)", pubkeyHex[:12], len(contacts))
+			slog.Debug("Contact cache hit", "pubkey", shortID(pubkeyHex), "contacts", len(contacts))
 		}
 
 		if len(contacts) > 0 {
 			authors = contacts
-			log.Printf("Filtering to %d followed authors", len(authors))
+			slog.Debug("Filtering to followed authors", "authors", len(authors))
 		}
 	}
 
@@ -122,7 +119,51 @@ func htmlTimelineHandler(w http.ResponseWriter, r *http.Request) {
 	if feedMode == "me" && session != nil && session.Connected && len(authors) == 0 {
 		pubkeyHex := hex.EncodeToString(session.UserPubKey)
 		authors = []string{pubkeyHex}
-		log.Printf("Showing notes for user %s", pubkeyHex[:12])
+		slog.Debug("Showing notes for user", "pubkey", shortID(pubkeyHex))
+	}
+
+	// If feed=list:<d-tag>, show notes from the members of one of the user's
+	// NIP-51 follow sets or starter packs
+	if strings.HasPrefix(feedMode, "list:") && len(authors) == 0 {
+		if session == nil || !session.Connected {
+			http.Redirect(w, r, "/html/login?error=Please+login+first", http.StatusSeeOther)
+			return
+		}
+		pubkeyHex := hex.EncodeToString(session.UserPubKey)
+		lists, _ := fetchUserLists(relays, pubkeyHex)
+		list := findUserList(lists, strings.TrimPrefix(feedMode, "list:"))
+		if list == nil {
+			http.Redirect(w, r, "/html/lists?error=List+not+found", http.StatusSeeOther)
+			return
+		}
+		if len(list.Pubkeys) == 0 {
+			http.Redirect(w, r, "/html/lists?error="+escapeURLParam(list.Title+" has no members yet"), http.StatusSeeOther)
+			return
+		}
+		authors = list.Pubkeys
+		slog.Debug("Filtering to list authors", "authors", len(authors), "list", list.DTag)
+	}
+
+	// If feed=dvm:<pubkey>, ask a NIP-90 content discovery DVM for a feed
+	var dvmEventIDs []string
+	isDVMFeed := strings.HasPrefix(feedMode, "dvm:")
+	if isDVMFeed {
+		dvmPubkey, ok := parseDVMPubkey(strings.TrimPrefix(feedMode, "dvm:"))
+		if !ok {
+			http.Redirect(w, r, "/html/dvms?error=Invalid+feed+service", http.StatusSeeOther)
+			return
+		}
+		userPubkey := ""
+		if session != nil && session.Connected {
+			userPubkey = hex.EncodeToString(session.UserPubKey)
+		}
+		ids, err := fetchDVMFeedIDs(relays, dvmPubkey, userPubkey, limit)
+		if err != nil {
+			slog.Warn("DVM feed failed", "dvm", shortID(dvmPubkey), "error", err)
+			http.Redirect(w, r, "/html/dvms?error="+escapeURLParam(err.Error()), http.StatusSeeOther)
+			return
+		}
+		dvmEventIDs = ids
 	}
 
 	// Special handling for bookmarks (kind 10003)
@@ -131,7 +172,7 @@ func htmlTimelineHandler(w http.ResponseWriter, r *http.Request) {
 	isBookmarksView := len(kinds) == 1 && kinds[0] == 10003
 	if isBookmarksView && session != nil && session.Connected {
 		pubkeyHex := hex.EncodeToString(session.UserPubKey)
-		bookmarkEvents := fetchKind10003(relays, pubkeyHex)
+		bookmarkEvents, _ := fetchKind10003(relays, pubkeyHex)
 		if len(bookmarkEvents) > 0 {
 			// Extract event IDs from e tags
 			for _, tag := range bookmarkEvents[0].Tags {
@@ -139,14 +180,15 @@ func htmlTimelineHandler(w http.ResponseWriter, r *http.Request) {
 					bookmarkedEventIDs = append(bookmarkedEventIDs, tag[1])
 				}
 			}
-			log.Printf("Found %d bookmarked events for user %s", len(bookmarkedEventIDs), pubkeyHex[:12])
+			slog.Debug("Found bookmarked events", "events", len(bookmarkedEventIDs), "pubkey", shortID(pubkeyHex))
 		}
 		// Clear the kinds filter - we'll fetch the actual events by ID
 		kinds = nil
 	}
 
 	// Check if we should filter out replies (default to true like JSON handler)
-	noReplies := q.Get("no_replies") != "0"
+	// DVM feeds are already curated, so keep whatever the DVM recommends
+	noReplies := q.Get("no_replies") != "0" && !isDVMFeed
 
 	// Build filter - fetch more events if we're filtering replies, since many events are replies
 	fetchLimit := limit
@@ -164,11 +206,24 @@ func htmlTimelineHandler(w http.ResponseWriter, r *http.Request) {
 			Limit: len(bookmarkedEventIDs),
 		}
 		events, eose = fetchEventsFromRelaysCached(relays, filter)
-		log.Printf("Fetched %d bookmarked events", len(events))
+		slog.Debug("Fetched bookmarked events", "events", len(events))
 	} else if isBookmarksView {
 		// No bookmarks found
 		events = []Event{}
 		eose = true
+	} else if isDVMFeed {
+		// Fetch the recommended events by ID and keep the DVM's ranking
+		events = []Event{}
+		eose = true
+		if len(dvmEventIDs) > 0 {
+			filter := Filter{
+				IDs:   dvmEventIDs,
+				Limit: len(dvmEventIDs),
+			}
+			events, eose = fetchEventsFromRelaysCached(relays, filter)
+			events = orderEventsByIDs(events, dvmEventIDs)
+			slog.Debug("Fetched DVM recommended events", "events", len(events), "recommended", len(dvmEventIDs))
+		}
 	} else {
 		filter := Filter{
 			Authors: authors,
@@ -301,8 +356,8 @@ func htmlTimelineHandler(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	// Add pagination if we have results
-	if len(items) > 0 {
+	// Add pagination if we have results (DVM feeds are a single ranked page)
+	if len(items) > 0 && !isDVMFeed {
 		lastCreatedAt := items[len(items)-1].CreatedAt
 		resp.Page.Until = &lastCreatedAt
 		nextURL := buildPaginationURL(r.URL.Path, relays, authors, kinds, limit, lastCreatedAt)
@@ -310,7 +365,7 @@ func htmlTimelineHandler(w http.ResponseWriter, r *http.Request) {
 		if fast {
 			nextURL += "&fast=1"
 		}
-		nextURL += "&feed=" + feedMode
+		nextURL += "&feed=" + url.QueryEscape(feedMode)
 		resp.Page.Next = &nextURL
 
 		// Prefetch next page in background to warm the cache
@@ -338,9 +393,9 @@ func htmlTimelineHandler(w http.ResponseWriter, r *http.Request) {
 	hasUnreadNotifs := checkUnreadNotifications(r, session, relays)
 
 	// Render HTML - showReactions is opposite of fast mode
-	html, err := renderHTML(resp, relays, authors, kinds, limit, session, errorMsg, successMsg, !fast, feedMode, currentURL, themeClass, themeLabel, csrfToken, hasUnreadNotifs)
+	html, err := renderHTML(resp, relays, authors, kinds, limit, session, errorMsg, successMsg, !fast, feedMode, currentURL, themeClass, themeLabel, csrfToken, hasUnreadNotifs, q.Get("voted") != "", newMediaBlur(r, session), clientKey(r))
 	if err != nil {
-		log.Printf("Error rendering HTML: %v", err)
+		slog.Error("Error rendering timeline HTML", "error", err)
 		http.Error(w, "Error rendering page", http.StatusInternalServerError)
 		return
 	}
@@ -359,18 +414,15 @@ func htmlThreadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	q := r.URL.Query()
-	relays := parseStringList(q.Get("relays"))
+	relays, ok := parseRequestRelays(w, r)
+	if !ok {
+		return
+	}
 	if len(relays) == 0 {
-		relays = []string{
-			"wss://relay.damus.io",
-			"wss://relay.nostr.band",
-			"wss://relay.primal.net",
-			"wss://nos.lol",
-			"wss://nostr.mom",
-		}
+		relays = defaultReadRelays()
 	}
 
-	log.Printf("HTML: Fetching thread for event: %s", eventID)
+	slog.Debug("HTML: fetching thread", "event", eventID)
 
 	// Fetch the root event and replies in parallel
 	var rootEvent *Event
@@ -514,9 +566,9 @@ func htmlThreadHandler(w http.ResponseWriter, r *http.Request) {
 	hasUnreadNotifs := checkUnreadNotifications(r, session, relays)
 
 	// Render HTML
-	htmlContent, err := renderThreadHTML(resp, relays, session, currentURL, themeClass, themeLabel, successMsg, csrfToken, hasUnreadNotifs)
+	htmlContent, err := renderThreadHTML(resp, relays, session, currentURL, themeClass, themeLabel, successMsg, csrfToken, hasUnreadNotifs, q.Get("voted") != "", newMediaBlur(r, session), clientKey(r))
 	if err != nil {
-		log.Printf("Error rendering thread HTML: %v", err)
+		slog.Error("Error rendering thread HTML", "error", err)
 		http.Error(w, "Error rendering page", http.StatusInternalServerError)
 		return
 	}
@@ -545,67 +597,26 @@ func htmlProfileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	q := r.URL.Query()
-	relays := parseStringList(q.Get("relays"))
+	relays, ok := parseRequestRelays(w, r)
+	if !ok {
+		return
+	}
 	if len(relays) == 0 {
-		relays = []string{
-			"wss://relay.damus.io",
-			"wss://relay.nostr.band",
-			"wss://relay.primal.net",
-			"wss://nos.lol",
-			"wss://nostr.mom",
-		}
+		relays = defaultReadRelays()
 	}
 
 	limit := parseLimit(q.Get("limit"), 20)
 	until := parseInt64(q.Get("until"))
 
-	log.Printf("HTML: Fetching profile for pubkey: %s", pubkey[:16])
-
-	// Fetch profile and notes in parallel
-	var profile *ProfileInfo
-	var events []Event
-	var wg sync.WaitGroup
-
-	// Fetch profile (kind 0)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		profiles := fetchProfiles(relays, []string{pubkey})
-		profile = profiles[pubkey]
-	}()
-
-	// Fetch user's top-level notes (kind 1, filtered to exclude replies)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		filter := Filter{
-			Authors: []string{pubkey},
-			Kinds:   []int{1},
-			Limit:   limit * 2, // Fetch more since we'll filter out replies
-			Until:   until,
-		}
-		events, _ = fetchEventsFromRelays(relays, filter)
-	}()
-
-	wg.Wait()
-
-	// Filter out replies (notes with e tags)
-	topLevelNotes := make([]Event, 0, len(events))
-	for _, evt := range events {
-		if !isReply(evt) {
-			topLevelNotes = append(topLevelNotes, evt)
-		}
-	}
-
-	// Apply limit after filtering
-	if len(topLevelNotes) > limit {
-		topLevelNotes = topLevelNotes[:limit]
-	}
+	slog.Debug("HTML: fetching profile", "pubkey", shortID(pubkey))
+	resp := fetchProfilePage(relays, pubkey, limit, until, func(until int64) string {
+		return fmt.Sprintf("/html/profile/%s?limit=%d&until=%d", pubkey, limit, until)
+	})
 
 	// Extract and fetch profiles for mentioned pubkeys in content
-	contents := make([]string, len(topLevelNotes))
-	for i, evt := range topLevelNotes {
-		contents[i] = evt.Content
+	contents := make([]string, len(resp.Notes.Items))
+	for i, item := range resp.Notes.Items {
+		contents[i] = item.Content
 	}
 	mentionedPubkeys := ExtractMentionedPubkeys(contents)
 	if len(mentionedPubkeys) > 0 {
@@ -613,49 +624,6 @@ func htmlProfileHandler(w http.ResponseWriter, r *http.Request) {
 		fetchProfiles(relays, mentionedPubkeys)
 	}
 
-	// Build response items with enrichment
-	items := make([]EventItem, len(topLevelNotes))
-	for i, evt := range topLevelNotes {
-		items[i] = EventItem{
-			ID:            evt.ID,
-			Kind:          evt.Kind,
-			Pubkey:        evt.PubKey,
-			CreatedAt:     evt.CreatedAt,
-			Content:       evt.Content,
-			Tags:          evt.Tags,
-			Sig:           evt.Sig,
-			RelaysSeen:    evt.RelaysSeen,
-			AuthorProfile: profile, // Use the fetched profile for all notes
-		}
-	}
-
-	// Build pagination
-	var pageUntil *int64
-	var nextURL *string
-	if len(items) > 0 {
-		lastCreatedAt := items[len(items)-1].CreatedAt
-		pageUntil = &lastCreatedAt
-		next := fmt.Sprintf("/html/profile/%s?limit=%d&until=%d", pubkey, limit, lastCreatedAt)
-		nextURL = &next
-	}
-
-	resp := ProfileResponse{
-		Pubkey:  pubkey,
-		Profile: profile,
-		Notes: TimelineResponse{
-			Items: items,
-			Page: PageInfo{
-				Until: pageUntil,
-				Next:  nextURL,
-			},
-			Meta: MetaInfo{
-				QueriedRelays: len(relays),
-				EOSE:          true,
-				GeneratedAt:   time.Now(),
-			},
-		},
-	}
-
 	// Get theme from cookie
 	themeClass, themeLabel := getThemeFromRequest(r)
 
@@ -696,9 +664,17 @@ func htmlProfileHandler(w http.ResponseWriter, r *http.Request) {
 	hasUnreadNotifs := checkUnreadNotifications(r, session, relays)
 
 	// Render HTML
-	htmlContent, err := renderProfileHTML(resp, relays, limit, themeClass, themeLabel, loggedIn, currentURL, csrfToken, isFollowing, isSelf, hasUnreadNotifs)
+	// The user's lists, for the add/remove-from-list menu
+	var memberships []HTMLListMembership
+	if loggedIn && !isSelf {
+		userPubkeyHex := hex.EncodeToString(session.UserPubKey)
+		lists, _ := fetchUserLists(relays, userPubkeyHex)
+		memberships = listMemberships(lists, pubkey)
+	}
+
+	htmlContent, err := renderProfileHTML(resp, relays, limit, themeClass, themeLabel, loggedIn, currentURL, csrfToken, isFollowing, isSelf, hasUnreadNotifs, memberships, reactionPicker(session), newMediaBlur(r, session), clientKey(r))
 	if err != nil {
-		log.Printf("Error rendering profile HTML: %v", err)
+		slog.Error("Error rendering profile HTML", "error", err)
 		http.Error(w, "Error rendering page", http.StatusInternalServerError)
 		return
 	}
@@ -779,13 +755,7 @@ func htmlNotificationsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get user's relays
-	relays := []string{
-		"wss://relay.damus.io",
-		"wss://relay.nostr.band",
-		"wss://relay.primal.net",
-		"wss://nos.lol",
-		"wss://nostr.mom",
-	}
+	relays := defaultReadRelays()
 
 	// Use user's read relays if available
 	if session.UserRelayList != nil && len(session.UserRelayList.Read) > 0 {
@@ -867,9 +837,9 @@ func htmlNotificationsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Render template
-	htmlContent, err := renderNotificationsHTML(notifications, profiles, targetEvents, themeClass, themeLabel, userDisplayName, pubkeyHex, pagination)
+	htmlContent, err := renderNotificationsHTML(notifications, profiles, targetEvents, themeClass, themeLabel, userDisplayName, pubkeyHex, blurMediaEnabled(r), pagination)
 	if err != nil {
-		log.Printf("Error rendering notifications HTML: %v", err)
+		slog.Error("Error rendering notifications HTML", "error", err)
 		http.Error(w, "Error rendering page", http.StatusInternalServerError)
 		return
 	}
@@ -925,5 +895,5 @@ func prefetchNextPage(relays, authors []string, kinds []int, limit int, until in
 		fetchProfiles(relays, pubkeys)
 	}
 
-	log.Printf("Prefetch: warmed cache for next page (%d events, %d profiles)", len(events), len(pubkeySet))
+	slog.Debug("Prefetch: warmed cache for next page", "events", len(events), "profiles", len(pubkeySet))
 }
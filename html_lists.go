@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NIP-51 list kinds usable as feeds
+const (
+	kindFollowSet   = 30000
+	kindStarterPack = 39089
+)
+
+// UserList is a parsed NIP-51 follow set or starter pack
+type UserList struct {
+	Kind        int
+	DTag        string
+	Title       string
+	Description string
+	Pubkeys     []string
+	Event       Event
+}
+
+// Key identifies a list in forms ("<kind>:<d-tag>")
+func (l UserList) Key() string {
+	return strconv.Itoa(l.Kind) + ":" + l.DTag
+}
+
+// HTMLListMember is a pubkey shown on the lists page
+type HTMLListMember struct {
+	Pubkey    string
+	Npub      string
+	NpubShort string
+	Profile   *ProfileInfo
+}
+
+// HTMLList is a list as rendered on the lists page
+type HTMLList struct {
+	Key         string
+	DTag        string
+	Title       string
+	Description string
+	KindLabel   string
+	Members     []HTMLListMember
+}
+
+// HTMLListsData is the data passed to the lists template
+type HTMLListsData struct {
+	HTMLPageChrome
+	Lists []HTMLList
+}
+
+// HTMLListMembership tells the profile page whether a pubkey is in one of the user's lists
+type HTMLListMembership struct {
+	Key      string
+	Title    string
+	Contains bool
+}
+
+var htmlListsTemplate = `{{define "page-style"}}
+    .list-header { display: flex; align-items: center; gap: 12px; flex-wrap: wrap; }
+    .list-kind { font-size: 11px; padding: 2px 8px; border-radius: 10px; background: var(--bg-badge); color: var(--text-secondary); }
+    .list-description { color: var(--text-secondary); font-size: 0.9rem; margin-top: 4px; }
+    .list-members { margin-top: 8px; }
+    .list-members summary { cursor: pointer; font-size: 13px; color: var(--text-secondary); }
+    .member-row { display: flex; align-items: center; gap: 8px; padding: 4px 0; font-size: 14px; }
+    .member-row a { color: var(--text-primary); text-decoration: none; flex: 1; }
+    .member-row a:hover { text-decoration: underline; }
+    .rename-form { margin-top: 8px; }
+{{end}}{{template "page-head" .}}
+    {{template "page-nav" .}}
+    <main>
+      <h2>Lists</h2>
+      <p class="text-sm text-muted" style="margin-bottom: 16px;">Your follow sets (NIP-51 kind 30000) and starter packs (kind 39089). Open a list as a feed, or add people from their profile page.</p>
+      {{range .Lists}}
+      <div class="card">
+        <div class="list-header">
+          <a href="/html/timeline?kinds=1&limit=20&feed=list:{{.DTag}}" class="card-title">{{.Title}}</a>
+          <span class="list-kind">{{.KindLabel}}</span>
+          <span class="card-meta">{{len .Members}} {{if eq (len .Members) 1}}person{{else}}people{{end}}</span>
+          <a href="/html/timeline?kinds=1&limit=20&feed=list:{{.DTag}}" class="secondary-btn ml-auto">View feed</a>
+        </div>
+        {{if .Description}}<div class="list-description">{{.Description}}</div>{{end}}
+        {{if .Members}}
+        <details class="list-members">
+          <summary>Members</summary>
+          {{$list := .}}
+          {{range .Members}}
+          <div class="member-row">
+            <a href="/html/profile/{{.Npub}}">{{if .Profile}}{{if .Profile.DisplayName}}{{.Profile.DisplayName}}{{else if .Profile.Name}}{{.Profile.Name}}{{else}}{{.NpubShort}}{{end}}{{else}}{{.NpubShort}}{{end}}</a>
+            <form method="POST" action="/html/lists" class="inline-form">
+              <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
+              <input type="hidden" name="action" value="remove">
+              <input type="hidden" name="list" value="{{$list.Key}}">
+              <input type="hidden" name="pubkey" value="{{.Pubkey}}">
+              <input type="hidden" name="return_url" value="/html/lists">
+              <button type="submit" class="danger-btn">Remove</button>
+            </form>
+          </div>
+          {{end}}
+        </details>
+        {{end}}
+        <form method="POST" action="/html/lists" class="form-row rename-form">
+          <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
+          <input type="hidden" name="action" value="rename">
+          <input type="hidden" name="list" value="{{.Key}}">
+          <label for="rename-{{.Key}}" class="sr-only">New name</label>
+          <input id="rename-{{.Key}}" type="text" name="title" class="text-input" value="{{.Title}}" required>
+          <button type="submit" class="secondary-btn">Rename</button>
+        </form>
+      </div>
+      {{else}}
+      <div class="empty-state">
+        <p>No lists yet</p>
+        <p class="empty-state-hint">Create a list below, then add people to it from their profile.</p>
+      </div>
+      {{end}}
+
+      <h3>New list</h3>
+      <form method="POST" action="/html/lists" class="card">
+        <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+        <input type="hidden" name="action" value="create">
+        <div class="form-row">
+          <label for="list-title" class="sr-only">List name</label>
+          <input id="list-title" type="text" name="title" class="text-input wide" placeholder="List name" required>
+        </div>
+        <div class="form-row">
+          <label for="list-description" class="sr-only">Description</label>
+          <input id="list-description" type="text" name="description" class="text-input wide" placeholder="Description (optional)">
+          <button type="submit" class="primary-btn">Create</button>
+        </div>
+      </form>
+    </main>
+    {{template "page-footer" .}}`
+
+var cachedListsTemplate *template.Template
+
+// parseUserList extracts title, description and members from a list event
+func parseUserList(evt Event) UserList {
+	list := UserList{Kind: evt.Kind, Event: evt}
+	var name string
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "d":
+			list.DTag = tag[1]
+		case "title":
+			list.Title = tag[1]
+		case "name":
+			// Deprecated NIP-51 title tag, still used by some clients
+			name = tag[1]
+		case "description":
+			list.Description = tag[1]
+		case "p":
+			if isValidEventID(tag[1]) {
+				list.Pubkeys = append(list.Pubkeys, tag[1])
+			}
+		}
+	}
+	if list.Title == "" {
+		list.Title = name
+	}
+	if list.Title == "" {
+		list.Title = list.DTag
+	}
+	return list
+}
+
+// fetchUserLists fetches a user's follow sets and starter packs, keeping the
+// newest version of each addressable list. The bool reports whether enough
+// relays answered for the lists to be edited safely.
+func fetchUserLists(relays []string, pubkey string) ([]UserList, bool) {
+	filter := Filter{
+		Kinds:   []int{kindFollowSet, kindStarterPack},
+		Authors: []string{pubkey},
+		Limit:   100,
+	}
+	result := fetchReplaceable(relays, filter)
+
+	lists := make([]UserList, 0, len(result.Events))
+	for _, evt := range result.Events {
+		list := parseUserList(evt)
+		// Lists without a d tag can't be addressed or edited
+		if list.DTag == "" {
+			continue
+		}
+		lists = append(lists, list)
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		return strings.ToLower(lists[i].Title) < strings.ToLower(lists[j].Title)
+	})
+	return lists, result.Confident
+}
+
+// findUserList looks up a list by "<kind>:<d>" key, or by bare d-tag
+// (follow sets take precedence over starter packs)
+func findUserList(lists []UserList, key string) *UserList {
+	for _, kind := range []int{kindFollowSet, kindStarterPack} {
+		for i := range lists {
+			if lists[i].Key() == key || (lists[i].Kind == kind && lists[i].DTag == key) {
+				return &lists[i]
+			}
+		}
+	}
+	return nil
+}
+
+// htmlListsHandler shows the user's lists (GET) and edits them (POST)
+func htmlListsHandler(w http.ResponseWriter, r *http.Request) {
+	session := getSessionFromRequest(r)
+	if session == nil || !session.Connected {
+		http.Redirect(w, r, "/html/login?error=Please+login+first", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		htmlListsUpdate(w, r, session)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pubkeyHex := hex.EncodeToString(session.UserPubKey)
+	readRelays, _ := sessionRelays(session)
+	lists, _ := fetchUserLists(readRelays, pubkeyHex)
+
+	// Fetch member profiles in one batch
+	var members []string
+	for _, l := range lists {
+		members = append(members, l.Pubkeys...)
+	}
+	profiles := fetchProfiles(readRelays, dedupeStrings(members))
+
+	htmlLists := make([]HTMLList, len(lists))
+	for i, l := range lists {
+		kindLabel := "Follow set"
+		if l.Kind == kindStarterPack {
+			kindLabel = "Starter pack"
+		}
+		htmlMembers := make([]HTMLListMember, len(l.Pubkeys))
+		for j, pk := range l.Pubkeys {
+			npub, _ := encodeBech32Pubkey(pk)
+			htmlMembers[j] = HTMLListMember{
+				Pubkey:    pk,
+				Npub:      npub,
+				NpubShort: formatNpubShort(npub),
+				Profile:   profiles[pk],
+			}
+		}
+		htmlLists[i] = HTMLList{
+			Key:         l.Key(),
+			DTag:        l.DTag,
+			Title:       l.Title,
+			Description: l.Description,
+			KindLabel:   kindLabel,
+			Members:     htmlMembers,
+		}
+	}
+
+	data := HTMLListsData{
+		HTMLPageChrome: newPageChrome("Lists", r, session, readRelays),
+		Lists:          htmlLists,
+	}
+	data.NavTab = "lists"
+
+	html, err := executePageTemplate(cachedListsTemplate, data)
+	if err != nil {
+		slog.Error("Error rendering lists", "error", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(html))
+}
+
+// htmlListsUpdate handles create, rename, add and remove, signing the new
+// list version via the bunker
+func htmlListsUpdate(w http.ResponseWriter, r *http.Request, session *BunkerSession) {
+	if !validateCSRFToken(session.ID, r.FormValue("csrf_token")) {
+		http.Error(w, "Invalid or expired CSRF token", http.StatusForbidden)
+		return
+	}
+
+	action := r.FormValue("action")
+	returnURL := "/html/lists"
+	if action == "add" || action == "remove" {
+		returnURL = sanitizeReturnURL(strings.TrimSpace(r.FormValue("return_url")))
+	}
+	redirectWith := func(param, msg string) {
+		separator := "?"
+		if strings.Contains(returnURL, "?") {
+			separator = "&"
+		}
+		http.Redirect(w, r, returnURL+separator+param+"="+escapeURLParam(msg), http.StatusSeeOther)
+	}
+
+	pubkeyHex := hex.EncodeToString(session.UserPubKey)
+	readRelays, writeRelays := sessionRelays(session)
+
+	var kind int
+	var tags [][]string
+	content := ""
+
+	switch action {
+	case "create":
+		title := strings.TrimSpace(r.FormValue("title"))
+		if title == "" {
+			redirectWith("error", "List name is required")
+			return
+		}
+		kind = kindFollowSet
+		dTag := listSlug(title) + "-" + randomString(6)
+		tags = [][]string{{"d", dTag}, {"title", title}}
+		if description := strings.TrimSpace(r.FormValue("description")); description != "" {
+			tags = append(tags, []string{"description", description})
+		}
+
+	case "rename", "add", "remove":
+		lists, confident := fetchUserLists(readRelays, pubkeyHex)
+		if !confident {
+			redirectWith("error", "Couldn't load your current lists from enough relays; please try again")
+			return
+		}
+		list := findUserList(lists, r.FormValue("list"))
+		if list == nil {
+			redirectWith("error", "List not found")
+			return
+		}
+		kind = list.Kind
+		content = list.Event.Content // may hold encrypted private items; keep as is
+
+		target := strings.TrimSpace(r.FormValue("pubkey"))
+		if action != "rename" && !isValidEventID(target) {
+			redirectWith("error", "Invalid pubkey")
+			return
+		}
+		title := strings.TrimSpace(r.FormValue("title"))
+		if action == "rename" && title == "" {
+			redirectWith("error", "List name is required")
+			return
+		}
+
+		found := false
+		for _, tag := range list.Event.Tags {
+			if len(tag) >= 2 {
+				switch {
+				case action == "rename" && (tag[0] == "title" || tag[0] == "name"):
+					continue // replaced below
+				case tag[0] == "p" && tag[1] == target:
+					found = true
+					if action == "remove" {
+						continue
+					}
+				}
+			}
+			tags = append(tags, tag)
+		}
+
+		switch action {
+		case "rename":
+			tags = append(tags, []string{"title", title})
+		case "add":
+			if found {
+				redirectWith("success", "Already in "+list.Title)
+				return
+			}
+			tags = append(tags, []string{"p", target})
+		case "remove":
+			if !found {
+				http.Redirect(w, r, returnURL, http.StatusSeeOther)
+				return
+			}
+		}
+
+	default:
+		redirectWith("error", "Unknown action")
+		return
+	}
+
+	event := UnsignedEvent{
+		Kind:      kind,
+		Content:   content,
+		Tags:      tags,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
+	defer cancel()
+
+	signedEvent, err := session.SignEvent(ctx, event)
+	if err != nil {
+		slog.Warn("Failed to sign list", "error", err)
+		redirectWith("error", sanitizeErrorForUser("Sign event", err))
+		return
+	}
+
+	publishEvent(ctx, writeRelays, signedEvent)
+
+	slog.Info("Published list update", "event", signedEvent.ID, "kind", kind, "action", action)
+	redirectWith("success", "List updated")
+}
+
+// listMemberships reports which of the user's lists contain a pubkey
+func listMemberships(lists []UserList, pubkey string) []HTMLListMembership {
+	memberships := make([]HTMLListMembership, len(lists))
+	for i, l := range lists {
+		memberships[i] = HTMLListMembership{Key: l.Key(), Title: l.Title}
+		for _, pk := range l.Pubkeys {
+			if pk == pubkey {
+				memberships[i].Contains = true
+				break
+			}
+		}
+	}
+	return memberships
+}
+
+var listSlugInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+// listSlug turns a list title into a d-tag friendly slug
+func listSlug(title string) string {
+	slug := strings.Trim(listSlugInvalid.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(slug) > 32 {
+		slug = strings.Trim(slug[:32], "-")
+	}
+	if slug == "" {
+		slug = "list"
+	}
+	return slug
+}
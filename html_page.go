@@ -0,0 +1,424 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTMLPageChrome holds the fields shared by the simple logged-in pages
+// (settings, lists, feeds pickers, ...) rendered on top of htmlPageBaseTemplate.
+type HTMLPageChrome struct {
+	Title                  string
+	NavTab                 string // Highlights the matching nav tab ("lists", ...)
+	ThemeClass             string
+	ThemeLabel             string
+	BlurMedia              bool // Reader blurs media from authors they don't follow
+	CSRFToken              string
+	LoggedIn               bool
+	HasUnreadNotifications bool
+	Error                  string
+	Success                string
+	GeneratedAt            time.Time
+}
+
+// htmlPageBaseTemplate defines the shared "page-head", "page-nav" and
+// "page-footer" blocks. Page templates include them and may add their own
+// styles through a "page-style" block.
+var htmlPageBaseTemplate = `{{define "page-head"}}<!DOCTYPE html>
+<html lang="en"{{if .ThemeClass}} class="{{.ThemeClass}}"{{end}}>
+<head>
+  <meta charset="UTF-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1.0">
+  <title>{{.Title}} - Nostr Hypermedia</title>
+  <link rel="icon" href="/static/favicon.ico" />
+  <style>
+    :root {
+      --bg-page: #f5f5f5;
+      --bg-container: #ffffff;
+      --bg-card: #ffffff;
+      --bg-secondary: #f8f9fa;
+      --bg-input: #ffffff;
+      --bg-badge: #f0f0f0;
+      --bg-badge-hover: #e0e0e0;
+      --text-primary: #333333;
+      --text-secondary: #666666;
+      --text-muted: #999999;
+      --text-content: #24292e;
+      --border-color: #e1e4e8;
+      --border-light: #dee2e6;
+      --accent: #667eea;
+      --accent-hover: #5568d3;
+      --accent-secondary: #764ba2;
+      --success: #2e7d32;
+      --success-bg: #28a745;
+      --error-bg: #fff5f5;
+      --error-border: #fecaca;
+      --error-accent: #dc2626;
+      --shadow: rgba(0,0,0,0.1);
+    }
+    @media (prefers-color-scheme: dark) {
+      :root:not(.light) {
+        --bg-page: #121212;
+        --bg-container: #1e1e1e;
+        --bg-card: #1e1e1e;
+        --bg-secondary: #252525;
+        --bg-input: #2a2a2a;
+        --bg-badge: #2a2a2a;
+        --bg-badge-hover: #3a3a3a;
+        --text-primary: #e4e4e7;
+        --text-secondary: #a1a1aa;
+        --text-muted: #71717a;
+        --text-content: #e4e4e7;
+        --border-color: #333333;
+        --border-light: #333333;
+        --accent: #818cf8;
+        --accent-hover: #6366f1;
+        --accent-secondary: #a78bfa;
+        --error-bg: #2d1b1b;
+        --error-border: #7f1d1d;
+        --error-accent: #f87171;
+        --shadow: rgba(0,0,0,0.3);
+      }
+    }
+    html.dark {
+      --bg-page: #121212;
+      --bg-container: #1e1e1e;
+      --bg-card: #1e1e1e;
+      --bg-secondary: #252525;
+      --bg-input: #2a2a2a;
+      --bg-badge: #2a2a2a;
+      --bg-badge-hover: #3a3a3a;
+      --text-primary: #e4e4e7;
+      --text-secondary: #a1a1aa;
+      --text-muted: #71717a;
+      --text-content: #e4e4e7;
+      --border-color: #333333;
+      --border-light: #333333;
+      --accent: #818cf8;
+      --accent-hover: #6366f1;
+      --accent-secondary: #a78bfa;
+      --error-bg: #2d1b1b;
+      --error-border: #7f1d1d;
+      --error-accent: #f87171;
+      --shadow: rgba(0,0,0,0.3);
+    }
+    * { box-sizing: border-box; margin: 0; padding: 0; }
+    body {
+      font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
+      line-height: 1.6;
+      color: var(--text-primary);
+      background: var(--bg-page);
+      padding: 20px;
+    }
+    .container {
+      max-width: 800px;
+      margin: 0 auto;
+      background: var(--bg-container);
+      border-radius: 8px;
+      box-shadow: 0 2px 8px var(--shadow);
+    }
+    nav {
+      padding: 12px 15px;
+      background: var(--bg-secondary);
+      border-bottom: 1px solid var(--border-light);
+      display: flex;
+      align-items: center;
+      gap: 8px;
+      flex-wrap: wrap;
+    }
+    .nav-tab {
+      padding: 8px 16px;
+      background: var(--bg-badge);
+      color: var(--text-secondary);
+      text-decoration: none;
+      border-radius: 4px;
+      font-size: 14px;
+    }
+    .nav-tab:hover { background: var(--bg-badge-hover); }
+    .nav-tab.active { background: var(--accent); color: white; }
+    main { padding: 16px 20px 20px 20px; min-height: 400px; }
+    h2 { font-size: 1.2rem; margin-bottom: 12px; }
+    h3 { font-size: 1rem; margin: 16px 0 8px 0; }
+    footer {
+      text-align: center;
+      padding: 20px;
+      background: var(--bg-secondary);
+      color: var(--text-secondary);
+      font-size: 13px;
+      border-top: 1px solid var(--border-color);
+      border-radius: 0 0 8px 8px;
+    }
+    .settings-dropdown { position: relative; }
+    .settings-toggle { cursor: pointer; list-style: none; font-size: 16px; }
+    .settings-menu {
+      position: absolute;
+      right: 0;
+      top: 100%;
+      margin-top: 8px;
+      background: var(--bg-card);
+      border: 1px solid var(--border-color);
+      border-radius: 4px;
+      padding: 10px 14px;
+      box-shadow: 0 4px 12px var(--shadow);
+      z-index: 100;
+      white-space: nowrap;
+      font-size: 12px;
+      color: var(--text-secondary);
+    }
+    .settings-item { margin-bottom: 8px; }
+    .settings-item:last-child { margin-bottom: 0; }
+    .notification-bell { position: relative; text-decoration: none; font-size: 16px; }
+    .notification-badge {
+      position: absolute;
+      top: -4px;
+      right: -6px;
+      width: 8px;
+      height: 8px;
+      background: var(--accent);
+      border-radius: 50%;
+    }
+    .ml-auto { margin-left: auto; }
+    .flex-center { display: flex; align-items: center; }
+    .gap-md { gap: 12px; }
+    .text-link { color: var(--accent); text-decoration: none; }
+    .text-link:hover { text-decoration: underline; }
+    .text-muted { color: var(--text-secondary); text-decoration: none; }
+    .text-sm { font-size: 13px; }
+    .text-xs { font-size: 12px; }
+    .font-medium { font-weight: 500; }
+    .inline-form { display: inline; margin: 0; }
+    .ghost-btn {
+      background: none;
+      border: none;
+      color: var(--text-secondary);
+      cursor: pointer;
+      font-family: inherit;
+      padding: 0;
+    }
+    .error-box {
+      background: var(--error-bg);
+      color: var(--error-accent);
+      border: 1px solid var(--error-border);
+      padding: 12px;
+      border-radius: 4px;
+      margin-bottom: 16px;
+    }
+    .flash-message {
+      background: var(--success-bg);
+      color: white;
+      border: 1px solid var(--success);
+      border-radius: 4px;
+      padding: 12px;
+      margin-bottom: 16px;
+    }
+    .card {
+      background: var(--bg-card);
+      border: 1px solid var(--border-color);
+      border-radius: 6px;
+      padding: 14px 16px;
+      margin-bottom: 12px;
+    }
+    .card-title { font-weight: 600; color: var(--text-primary); text-decoration: none; }
+    .card-meta { color: var(--text-muted); font-size: 0.85rem; }
+    .form-row { display: flex; gap: 8px; align-items: center; flex-wrap: wrap; margin-bottom: 8px; }
+    .form-row label { font-size: 13px; color: var(--text-secondary); }
+    .text-input, textarea.text-input, select.text-input {
+      padding: 8px 10px;
+      border: 1px solid var(--border-color);
+      border-radius: 4px;
+      font-size: 14px;
+      font-family: inherit;
+      background: var(--bg-input);
+      color: var(--text-primary);
+    }
+    .text-input.wide { flex: 1; min-width: 200px; width: 100%; }
+    .primary-btn {
+      padding: 8px 16px;
+      background: linear-gradient(135deg, var(--accent) 0%, var(--accent-secondary) 100%);
+      color: white;
+      border: none;
+      border-radius: 4px;
+      font-size: 14px;
+      font-weight: 600;
+      cursor: pointer;
+    }
+    .secondary-btn {
+      padding: 6px 12px;
+      background: var(--bg-badge);
+      color: var(--text-secondary);
+      border: 1px solid var(--border-color);
+      border-radius: 4px;
+      font-size: 13px;
+      cursor: pointer;
+      text-decoration: none;
+    }
+    .secondary-btn:hover { background: var(--bg-badge-hover); }
+    .danger-btn {
+      padding: 6px 12px;
+      background: none;
+      color: var(--error-accent);
+      border: 1px solid var(--error-border);
+      border-radius: 4px;
+      font-size: 13px;
+      cursor: pointer;
+    }
+    .pagination {
+      display: flex;
+      justify-content: center;
+      gap: 12px;
+      margin: 12px 0 0 0;
+      padding: 12px 0;
+      border-top: 1px solid var(--border-color);
+    }
+    .link {
+      display: inline-flex;
+      align-items: center;
+      gap: 4px;
+      padding: 6px 12px;
+      background: var(--bg-card);
+      border: 1px solid var(--accent);
+      color: var(--accent);
+      text-decoration: none;
+      border-radius: 6px;
+      font-size: 0.9rem;
+    }
+    .link:hover { background: var(--bg-badge-hover); }
+    .empty-state { text-align: center; padding: 60px 20px; color: var(--text-muted); }
+    .empty-state-hint { margin-top: 8px; font-size: 0.9rem; }
+    .sr-only {
+      position: absolute;
+      width: 1px;
+      height: 1px;
+      padding: 0;
+      margin: -1px;
+      overflow: hidden;
+      clip: rect(0, 0, 0, 0);
+      white-space: nowrap;
+      border: 0;
+    }
+    {{block "page-style" .}}{{end}}
+  </style>
+</head>
+<body>
+  <div id="top" class="container">{{end}}
+
+{{define "page-nav"}}
+    <nav>
+      {{if .LoggedIn}}
+      <a href="/html/timeline?kinds=1&limit=20&feed=follows" class="nav-tab">Follows</a>
+      {{end}}
+      <a href="/html/timeline?kinds=1&limit=20&feed=global" class="nav-tab">Global</a>
+      {{if .LoggedIn}}
+      <a href="/html/timeline?kinds=1&limit=20&feed=me" class="nav-tab">Me</a>
+      <a href="/html/lists" class="nav-tab{{if eq .NavTab "lists"}} active{{end}}">Lists</a>
+      <a href="/html/write" class="nav-tab{{if eq .NavTab "write"}} active{{end}}">Write</a>
+      <a href="/html/calendar" class="nav-tab{{if eq .NavTab "calendar"}} active{{end}}">Calendar</a>
+      <a href="/html/communities" class="nav-tab{{if eq .NavTab "communities"}} active{{end}}">Communities</a>
+      {{end}}
+      <a href="/html/dvms" class="nav-tab{{if eq .NavTab "dvms"}} active{{end}}">Discover</a>
+      <div class="ml-auto flex-center gap-md">
+        {{if .LoggedIn}}
+        <a href="/html/notifications" class="notification-bell" title="Notifications">🔔{{if .HasUnreadNotifications}}<span class="notification-badge"></span>{{end}}</a>
+        {{end}}
+        <details class="settings-dropdown">
+          <summary class="settings-toggle" title="Settings">⚙️</summary>
+          <div class="settings-menu">
+            <div class="settings-item">
+              <form method="POST" action="/html/theme" class="inline-form">
+                <button type="submit" class="ghost-btn text-xs">Theme: {{.ThemeLabel}}</button>
+              </form>
+            </div>
+            {{if .LoggedIn}}
+            <div class="settings-item">
+              <form method="POST" action="/html/blur-media" class="inline-form">
+                <button type="submit" class="ghost-btn text-xs">Unfollowed media: {{if .BlurMedia}}Blurred{{else}}Shown{{end}}</button>
+              </form>
+            </div>
+            <div class="settings-item"><a href="/html/settings/relays" class="text-muted text-xs">Relays</a></div>
+            <div class="settings-item"><a href="/html/scheduled" class="text-muted text-xs">Scheduled posts</a></div>
+            {{end}}
+          </div>
+        </details>
+        {{if .LoggedIn}}
+        <a href="/html/logout" class="text-muted text-sm">Logout</a>
+        {{else}}
+        <a href="/html/login" class="text-link text-sm font-medium">Login</a>
+        {{end}}
+      </div>
+    </nav>
+    {{if .Error}}<div class="error-box" style="margin: 12px 20px 0 20px;">{{.Error}}</div>{{end}}
+    {{if .Success}}<div class="flash-message" style="margin: 12px 20px 0 20px;">{{.Success}}</div>{{end}}
+{{end}}
+
+{{define "page-footer"}}
+    <footer>
+      <p>Generated: {{.GeneratedAt.Format "15:04:05"}} · Zero-JS Hypermedia Browser</p>
+    </footer>
+  </div>
+</body>
+</html>{{end}}
+`
+
+// compilePageTemplate parses a page template together with the shared base.
+// It exits on error like the other template initializers.
+func compilePageTemplate(name, body string) *template.Template {
+	tmpl, err := template.New(name).Funcs(templateFuncMap).Parse(htmlPageBaseTemplate + body)
+	if err != nil {
+		log.Fatalf("Failed to compile %s template: %v", name, err)
+	}
+	return tmpl
+}
+
+// executePageTemplate renders a page template to a string
+func executePageTemplate(tmpl *template.Template, data interface{}) (string, error) {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// newPageChrome fills the shared page fields from the request
+func newPageChrome(title string, r *http.Request, session *BunkerSession, relays []string) HTMLPageChrome {
+	themeClass, themeLabel := getThemeFromRequest(r)
+	chrome := HTMLPageChrome{
+		Title:       title,
+		ThemeClass:  themeClass,
+		ThemeLabel:  themeLabel,
+		BlurMedia:   blurMediaEnabled(r),
+		Error:       r.URL.Query().Get("error"),
+		Success:     r.URL.Query().Get("success"),
+		GeneratedAt: time.Now(),
+	}
+	if session != nil && session.Connected {
+		chrome.LoggedIn = true
+		chrome.CSRFToken = generateCSRFToken(session.ID)
+		chrome.HasUnreadNotifications = checkUnreadNotifications(r, session, relays)
+	}
+	return chrome
+}
+
+// sessionRelays returns the relays to read from and publish to for a
+// logged-in user: their NIP-65 lists when known, otherwise the defaults
+func sessionRelays(session *BunkerSession) (read []string, write []string) {
+	read = defaultReadRelays()
+	write = defaultPublishRelays()
+	if session == nil {
+		return read, write
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.UserRelayList != nil {
+		if len(session.UserRelayList.Read) > 0 {
+			read = session.UserRelayList.Read
+		}
+		if len(session.UserRelayList.Write) > 0 {
+			write = session.UserRelayList.Write
+		}
+	}
+	return read, write
+}
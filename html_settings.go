@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTMLRelaySetting is one row of the relay settings page
+type HTMLRelaySetting struct {
+	URL         string
+	Read        bool
+	Write       bool
+	Status      string // "connected", "error" or "unknown"
+	StatusLabel string
+	LatencyMs   int64
+	Attempts    int
+	Failures    int
+	LastError   string
+}
+
+// HTMLRelaySettingsData is the data passed to the relay settings template
+type HTMLRelaySettingsData struct {
+	HTMLPageChrome
+	Relays       []HTMLRelaySetting
+	HasRelayList bool
+}
+
+var htmlRelaySettingsTemplate = `{{define "page-style"}}
+    .relay-row { display: flex; align-items: center; gap: 12px; flex-wrap: wrap; }
+    .relay-url { font-family: monospace; font-size: 14px; flex: 1; min-width: 200px; word-break: break-all; }
+    .relay-status { font-size: 12px; padding: 2px 8px; border-radius: 10px; background: var(--bg-badge); color: var(--text-secondary); }
+    .relay-status.connected { background: var(--success-bg); color: white; }
+    .relay-status.error { background: var(--error-bg); color: var(--error-accent); border: 1px solid var(--error-border); }
+    .relay-health { font-size: 12px; color: var(--text-muted); margin-top: 4px; }
+    .relay-toggle { font-size: 12px; }
+    .relay-toggle.on { border-color: var(--accent); color: var(--accent); }
+{{end}}{{template "page-head" .}}
+    {{template "page-nav" .}}
+    <main>
+      <h2>Relays</h2>
+      <p class="text-sm text-muted" style="margin-bottom: 16px;">Your NIP-65 relay list (kind 10002). Read relays are used to load your feeds; write relays receive what you publish.</p>
+      {{if not .HasRelayList}}
+      <div class="card text-sm">You haven't published a relay list yet. Default relays are used until you add one.</div>
+      {{end}}
+      {{range .Relays}}
+      <div class="card">
+        <div class="relay-row">
+          <span class="relay-url">{{.URL}}</span>
+          <span class="relay-status {{.Status}}">{{.StatusLabel}}</span>
+          <form method="POST" action="/html/settings/relays" class="inline-form">
+            <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
+            <input type="hidden" name="relay" value="{{.URL}}">
+            <input type="hidden" name="action" value="toggle_read">
+            <button type="submit" class="secondary-btn relay-toggle{{if .Read}} on{{end}}" title="Toggle read">{{if .Read}}✓ {{end}}Read</button>
+          </form>
+          <form method="POST" action="/html/settings/relays" class="inline-form">
+            <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
+            <input type="hidden" name="relay" value="{{.URL}}">
+            <input type="hidden" name="action" value="toggle_write">
+            <button type="submit" class="secondary-btn relay-toggle{{if .Write}} on{{end}}" title="Toggle write">{{if .Write}}✓ {{end}}Write</button>
+          </form>
+          <form method="POST" action="/html/settings/relays" class="inline-form">
+            <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
+            <input type="hidden" name="relay" value="{{.URL}}">
+            <input type="hidden" name="action" value="remove">
+            <button type="submit" class="danger-btn">Remove</button>
+          </form>
+        </div>
+        <div class="relay-health">
+          {{if .LatencyMs}}Connect: {{.LatencyMs}} ms · {{end}}{{if .Attempts}}{{.Failures}}/{{.Attempts}} failed connections{{else}}Not contacted yet{{end}}{{if .LastError}} · Last error: {{.LastError}}{{end}}
+        </div>
+      </div>
+      {{end}}
+
+      <h3>Add relay</h3>
+      <form method="POST" action="/html/settings/relays" class="card">
+        <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+        <input type="hidden" name="action" value="add">
+        <div class="form-row">
+          <label for="relay-url" class="sr-only">Relay URL</label>
+          <input id="relay-url" type="text" name="relay" class="text-input wide" placeholder="wss://relay.example.com" required>
+        </div>
+        <div class="form-row">
+          <label><input type="checkbox" name="read" value="1" checked> Read</label>
+          <label><input type="checkbox" name="write" value="1" checked> Write</label>
+          <button type="submit" class="primary-btn ml-auto">Add relay</button>
+        </div>
+      </form>
+    </main>
+    {{template "page-footer" .}}`
+
+var cachedRelaySettingsTemplate *template.Template
+
+// htmlRelaySettingsHandler shows and edits the user's NIP-65 relay list
+func htmlRelaySettingsHandler(w http.ResponseWriter, r *http.Request) {
+	session := getSessionFromRequest(r)
+	if session == nil || !session.Connected {
+		http.Redirect(w, r, "/html/login?error=Please+login+first", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		htmlRelaySettingsUpdate(w, r, session)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pubkeyHex := hex.EncodeToString(session.UserPubKey)
+	relayList := currentRelayList(session, pubkeyHex)
+
+	settings := relaySettingsFromList(relayList)
+	probeRelays(settings)
+
+	readRelays, _ := sessionRelays(session)
+
+	data := HTMLRelaySettingsData{
+		HTMLPageChrome: newPageChrome("Relays", r, session, readRelays),
+		Relays:         settings,
+		HasRelayList:   relayList != nil,
+	}
+
+	html, err := executePageTemplate(cachedRelaySettingsTemplate, data)
+	if err != nil {
+		slog.Error("Error rendering relay settings", "error", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(html))
+}
+
+// htmlRelaySettingsUpdate applies an add/remove/toggle and publishes a new kind 10002
+func htmlRelaySettingsUpdate(w http.ResponseWriter, r *http.Request, session *BunkerSession) {
+	if !validateCSRFToken(session.ID, r.FormValue("csrf_token")) {
+		http.Error(w, "Invalid or expired CSRF token", http.StatusForbidden)
+		return
+	}
+
+	const returnURL = "/html/settings/relays"
+	action := r.FormValue("action")
+	relayURL, ok := normalizeRelayURL(r.FormValue("relay"))
+	// The server dials these relays, so only wss:// ones can be added or
+	// enabled here; a ws:// entry from another client can still be removed
+	if !ok || (action != "remove" && !strings.HasPrefix(relayURL, "wss://")) {
+		http.Redirect(w, r, returnURL+"?error=Invalid+relay+URL+(must+start+with+wss://)", http.StatusSeeOther)
+		return
+	}
+
+	pubkeyHex := hex.EncodeToString(session.UserPubKey)
+	// Start from the indexers' current copy, not the session's, so an edit
+	// made elsewhere since login isn't overwritten
+	oldList, confident := fetchRelayListFresh(pubkeyHex)
+	if !confident {
+		http.Redirect(w, r, returnURL+"?error="+escapeURLParam("Couldn't load your current relay list from enough relays; please try again"), http.StatusSeeOther)
+		return
+	}
+	settings := relaySettingsFromList(oldList)
+
+	idx := -1
+	for i, s := range settings {
+		if s.URL == relayURL {
+			idx = i
+			break
+		}
+	}
+
+	switch action {
+	case "add":
+		read := r.FormValue("read") == "1"
+		write := r.FormValue("write") == "1"
+		if !read && !write {
+			http.Redirect(w, r, returnURL+"?error=Choose+read,+write+or+both", http.StatusSeeOther)
+			return
+		}
+		if idx >= 0 {
+			settings[idx].Read = read
+			settings[idx].Write = write
+		} else {
+			settings = append(settings, HTMLRelaySetting{URL: relayURL, Read: read, Write: write})
+		}
+	case "remove":
+		if idx < 0 {
+			http.Redirect(w, r, returnURL, http.StatusSeeOther)
+			return
+		}
+		settings = append(settings[:idx], settings[idx+1:]...)
+	case "toggle_read", "toggle_write":
+		if idx < 0 {
+			http.Redirect(w, r, returnURL+"?error=Relay+not+in+your+list", http.StatusSeeOther)
+			return
+		}
+		if action == "toggle_read" {
+			settings[idx].Read = !settings[idx].Read
+		} else {
+			settings[idx].Write = !settings[idx].Write
+		}
+		// A relay that is neither read nor write is dropped from the list
+		if !settings[idx].Read && !settings[idx].Write {
+			settings = append(settings[:idx], settings[idx+1:]...)
+		}
+	default:
+		http.Redirect(w, r, returnURL+"?error=Unknown+action", http.StatusSeeOther)
+		return
+	}
+
+	newList := &RelayList{Read: []string{}, Write: []string{}}
+	tags := [][]string{}
+	for _, s := range settings {
+		switch {
+		case s.Read && s.Write:
+			tags = append(tags, []string{"r", s.URL})
+		case s.Read:
+			tags = append(tags, []string{"r", s.URL, "read"})
+		case s.Write:
+			tags = append(tags, []string{"r", s.URL, "write"})
+		}
+		if s.Read {
+			newList.Read = append(newList.Read, s.URL)
+		}
+		if s.Write {
+			newList.Write = append(newList.Write, s.URL)
+		}
+	}
+
+	event := UnsignedEvent{
+		Kind:      10002,
+		Content:   "",
+		Tags:      tags,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
+	defer cancel()
+
+	signedEvent, err := session.SignEvent(ctx, event)
+	if err != nil {
+		slog.Warn("Failed to sign relay list", "error", err)
+		http.Redirect(w, r, returnURL+"?error="+escapeURLParam(sanitizeErrorForUser("Sign event", err)), http.StatusSeeOther)
+		return
+	}
+
+	// Publish to old and new write relays plus the indexers, so readers of
+	// either list (and fetchRelayList) see the update
+	targets := indexerRelays()
+	if oldList != nil {
+		targets = append(targets, oldList.Write...)
+	}
+	targets = append(targets, newList.Write...)
+	publishEvent(ctx, dedupeStrings(targets), signedEvent)
+
+	relayListCache.Set(pubkeyHex, newList)
+	session.mu.Lock()
+	session.UserRelayList = newList
+	session.mu.Unlock()
+
+	slog.Info("Published relay list", "event", signedEvent.ID, "relays", len(settings), "action", action)
+	http.Redirect(w, r, returnURL+"?success=Relay+list+updated", http.StatusSeeOther)
+}
+
+// currentRelayList returns the session's relay list, fetching it if needed
+func currentRelayList(session *BunkerSession, pubkeyHex string) *RelayList {
+	session.mu.Lock()
+	relayList := session.UserRelayList
+	session.mu.Unlock()
+	if relayList != nil {
+		return relayList
+	}
+
+	relayList = fetchRelayList(pubkeyHex)
+	if relayList != nil {
+		session.mu.Lock()
+		session.UserRelayList = relayList
+		session.mu.Unlock()
+	}
+	return relayList
+}
+
+// relaySettingsFromList merges read and write relays into ordered rows
+func relaySettingsFromList(relayList *RelayList) []HTMLRelaySetting {
+	if relayList == nil {
+		return nil
+	}
+
+	var settings []HTMLRelaySetting
+	index := make(map[string]int)
+	add := func(u string, read, write bool) {
+		if normalized, ok := normalizeRelayURL(u); ok {
+			u = normalized
+		}
+		if i, ok := index[u]; ok {
+			settings[i].Read = settings[i].Read || read
+			settings[i].Write = settings[i].Write || write
+			return
+		}
+		index[u] = len(settings)
+		settings = append(settings, HTMLRelaySetting{URL: u, Read: read, Write: write})
+	}
+	for _, u := range relayList.Read {
+		add(u, true, false)
+	}
+	for _, u := range relayList.Write {
+		add(u, false, true)
+	}
+	return settings
+}
+
+// probeRelays connects to relays we have no stats for yet, then fills in
+// the health fields for every row
+func probeRelays(settings []HTMLRelaySetting) {
+	var wg sync.WaitGroup
+	for _, s := range settings {
+		if _, known := relayPool.Health(s.URL); known {
+			continue
+		}
+		wg.Add(1)
+		go func(relayURL string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+			relayPool.Probe(ctx, relayURL)
+		}(s.URL)
+	}
+	wg.Wait()
+
+	for i := range settings {
+		h, known := relayPool.Health(settings[i].URL)
+		settings[i].Attempts = h.Attempts
+		settings[i].Failures = h.Failures
+		settings[i].LastError = h.LastError
+		settings[i].LatencyMs = h.ConnectLatency.Milliseconds()
+		switch {
+		case h.Connected:
+			settings[i].Status = "connected"
+			settings[i].StatusLabel = "Connected"
+		case known && h.LastErrorAt.After(h.LastConnectedAt):
+			settings[i].Status = "error"
+			settings[i].StatusLabel = "Unreachable"
+		default:
+			settings[i].Status = "unknown"
+			settings[i].StatusLabel = "Idle"
+		}
+	}
+}
+
+// normalizeRelayURL validates a ws(s) relay URL and returns it in a canonical form
+func normalizeRelayURL(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", false
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return "", false
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if scheme != "wss" && scheme != "ws" {
+		return "", false
+	}
+	normalized := scheme + "://" + strings.ToLower(parsed.Host) + strings.TrimSuffix(parsed.Path, "/")
+	if parsed.RawQuery != "" {
+		normalized += "?" + parsed.RawQuery
+	}
+	return normalized, true
+}
+
+// dedupeStrings removes duplicates while preserving order
+func dedupeStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NIP-23 long-form content kinds
+const (
+	kindArticle      = 30023
+	kindArticleDraft = 30024
+)
+
+// Articles are much larger than notes, so the composer gets its own body limit
+const maxArticleBodySize = 512 * 1024
+
+// ArticleForm holds the composer fields, from an existing event or a submitted form
+type ArticleForm struct {
+	DTag        string
+	Title       string
+	Summary     string
+	Image       string
+	Hashtags    string // Comma-separated, without '#'
+	Body        string
+	PublishedAt int64 // Kept when an article is edited, 0 for new articles
+}
+
+// HTMLArticleListItem is one of the user's articles or drafts in the "my articles" list
+type HTMLArticleListItem struct {
+	DTag       string
+	Title      string
+	Summary    string
+	EventID    string // Published version, for the view link
+	Published  bool
+	HasDraft   bool // The newest version is a draft (unpublished changes if Published)
+	UpdatedAt  int64
+	UpdatedAgo string
+}
+
+// HTMLWriteData is the data passed to the write template
+type HTMLWriteData struct {
+	HTMLPageChrome
+	Form        ArticleForm
+	Editing     bool // Form.DTag refers to an existing article or draft
+	IsPublished bool // The article being edited has been published
+	Preview     template.HTML
+	Articles    []HTMLArticleListItem
+	Schedule    ScheduleFields
+}
+
+var htmlWriteTemplate = `{{define "page-style"}}{{template "schedule-style"}}
+    .write-form .form-row { flex-direction: column; align-items: stretch; gap: 4px; }
+    .write-body { min-height: 360px; font-family: ui-monospace, SFMono-Regular, Menlo, monospace; font-size: 13px; line-height: 1.5; resize: vertical; }
+    .write-actions { display: flex; gap: 8px; align-items: center; flex-wrap: wrap; margin-top: 8px; }
+    .write-hint { font-size: 12px; color: var(--text-muted); }
+    .article-preview { border-top: 3px solid var(--accent); }
+    .article-preview h1 { font-size: 1.6rem; margin: 0 0 8px 0; }
+    .article-preview-summary { color: var(--text-secondary); font-style: italic; margin-bottom: 12px; }
+    .article-preview-image { width: 100%; max-height: 280px; object-fit: cover; border-radius: 6px; margin-bottom: 12px; }
+    .article-content { color: var(--text-content); overflow-wrap: anywhere; }
+    .article-content h1, .article-content h2, .article-content h3 { margin: 16px 0 8px 0; }
+    .article-content p, .article-content ul, .article-content ol, .article-content blockquote, .article-content pre { margin-bottom: 12px; }
+    .article-content ul, .article-content ol { padding-left: 24px; }
+    .article-content blockquote { border-left: 3px solid var(--border-color); padding-left: 12px; color: var(--text-secondary); }
+    .article-content pre { background: var(--bg-secondary); padding: 10px; border-radius: 4px; overflow-x: auto; }
+    .article-content img { max-width: 100%; }
+    .article-row { display: flex; align-items: center; gap: 10px; flex-wrap: wrap; }
+    .article-status { font-size: 11px; padding: 2px 8px; border-radius: 10px; background: var(--bg-badge); color: var(--text-secondary); }
+    .article-status.published { background: var(--success-bg); color: white; }
+{{end}}{{template "page-head" .}}
+    {{template "page-nav" .}}
+    <main>
+      <h2>{{if .Editing}}Edit {{if .IsPublished}}article{{else}}draft{{end}}{{else}}Write an article{{end}}</h2>
+      <p class="text-sm text-muted" style="margin-bottom: 16px;">Long-form posts (NIP-23) are written in Markdown. Drafts are saved to your relays as kind 30024 and only published when you choose.</p>
+
+      <form method="POST" action="/html/write" class="card write-form">
+        <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+        <input type="hidden" name="d" value="{{.Form.DTag}}">
+        {{if .Form.PublishedAt}}<input type="hidden" name="published_at" value="{{.Form.PublishedAt}}">{{end}}
+        <div class="form-row">
+          <label for="article-title">Title</label>
+          <input id="article-title" type="text" name="title" class="text-input wide" value="{{.Form.Title}}" maxlength="300" required>
+        </div>
+        <div class="form-row">
+          <label for="article-summary">Summary</label>
+          <input id="article-summary" type="text" name="summary" class="text-input wide" value="{{.Form.Summary}}" maxlength="1000" placeholder="Optional">
+        </div>
+        <div class="form-row">
+          <label for="article-image">Header image URL</label>
+          <input id="article-image" type="url" name="image" class="text-input wide" value="{{.Form.Image}}" placeholder="https://...">
+        </div>
+        <div class="form-row">
+          <label for="article-tags">Tags</label>
+          <input id="article-tags" type="text" name="hashtags" class="text-input wide" value="{{.Form.Hashtags}}" placeholder="nostr, writing">
+        </div>
+        <div class="form-row">
+          <label for="article-body">Body (Markdown)</label>
+          <textarea id="article-body" name="content" class="text-input wide write-body" required>{{.Form.Body}}</textarea>
+        </div>
+        {{template "schedule-fields" .Schedule}}
+        <div class="write-actions">
+          <button type="submit" name="action" value="preview" class="secondary-btn">Preview</button>
+          <button type="submit" name="action" value="draft" class="secondary-btn">Save draft</button>
+          <button type="submit" name="action" value="publish" class="primary-btn">{{if .IsPublished}}Update article{{else}}Publish{{end}}</button>
+          {{if .Editing}}<a href="/html/write" class="text-link text-sm ml-auto">New article</a>{{end}}
+        </div>
+        {{if .IsPublished}}<p class="write-hint" style="margin-top: 8px;">Updating replaces the published version everywhere it is shown.</p>{{end}}
+        <p class="write-hint" style="margin-top: 8px;">A scheduled time applies to {{if .IsPublished}}Update article{{else}}Publish{{end}}; drafts are saved right away.</p>
+      </form>
+
+      {{if .Preview}}
+      <h3 id="preview">Preview</h3>
+      <article class="card article-preview">
+        {{if .Form.Image}}<img src="{{proxyImage .Form.Image 800}}" alt="" class="article-preview-image">{{end}}
+        <h1>{{.Form.Title}}</h1>
+        {{if .Form.Summary}}<p class="article-preview-summary">{{.Form.Summary}}</p>{{end}}
+        <div class="article-content">{{.Preview}}</div>
+      </article>
+      {{end}}
+
+      <h3>My articles</h3>
+      {{range .Articles}}
+      <div class="card">
+        <div class="article-row">
+          <a href="/html/write?edit={{.DTag}}" class="card-title">{{.Title}}</a>
+          {{if .Published}}<span class="article-status published">Published</span>{{else}}<span class="article-status">Draft</span>{{end}}
+          {{if and .Published .HasDraft}}<span class="article-status">Unpublished changes</span>{{end}}
+          <span class="card-meta">{{.UpdatedAgo}}</span>
+          <span class="ml-auto flex-center gap-md">
+            {{if .EventID}}<a href="/html/thread/{{.EventID}}" class="secondary-btn">View</a>{{end}}
+            <a href="/html/write?edit={{.DTag}}" class="secondary-btn">Edit</a>
+          </span>
+        </div>
+        {{if .Summary}}<div class="card-meta" style="margin-top: 4px;">{{.Summary}}</div>{{end}}
+      </div>
+      {{else}}
+      <div class="empty-state" style="padding: 30px 20px;">
+        <p>No articles yet</p>
+      </div>
+      {{end}}
+    </main>
+    {{template "page-footer" .}}`
+
+var cachedWriteTemplate *template.Template
+
+// articleFormFromEvent fills the composer from a published article or draft
+func articleFormFromEvent(evt Event) ArticleForm {
+	form := ArticleForm{
+		DTag:    extractDTag(evt.Tags),
+		Title:   extractTitle(evt.Tags),
+		Summary: extractSummary(evt.Tags),
+		Image:   extractHeaderImage(evt.Tags),
+		Body:    evt.Content,
+	}
+	if evt.Kind == kindArticle {
+		form.PublishedAt = extractPublishedAt(evt.Tags)
+		if form.PublishedAt == 0 {
+			form.PublishedAt = evt.CreatedAt
+		}
+	}
+	var hashtags []string
+	for _, tag := range evt.Tags {
+		if len(tag) >= 2 && tag[0] == "t" && tag[1] != "" {
+			hashtags = append(hashtags, tag[1])
+		}
+	}
+	form.Hashtags = strings.Join(hashtags, ", ")
+	return form
+}
+
+// articleFormFromRequest reads the composer fields from a submitted form
+func articleFormFromRequest(r *http.Request) ArticleForm {
+	form := ArticleForm{
+		DTag:     strings.TrimSpace(r.FormValue("d")),
+		Title:    strings.TrimSpace(r.FormValue("title")),
+		Summary:  strings.TrimSpace(r.FormValue("summary")),
+		Image:    strings.TrimSpace(r.FormValue("image")),
+		Hashtags: strings.TrimSpace(r.FormValue("hashtags")),
+		// Normalize line endings so the body round-trips through the textarea
+		Body: strings.ReplaceAll(r.FormValue("content"), "\r\n", "\n"),
+	}
+	if ts, err := strconv.ParseInt(r.FormValue("published_at"), 10, 64); err == nil && ts > 0 {
+		form.PublishedAt = ts
+	}
+	return form
+}
+
+// parseHashtags splits a comma or space separated tag field into lowercase t tag values
+func parseHashtags(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	var hashtags []string
+	for _, f := range fields {
+		if f = strings.ToLower(strings.TrimLeft(f, "#")); f != "" {
+			hashtags = append(hashtags, f)
+		}
+	}
+	return dedupeStrings(hashtags)
+}
+
+// tags builds the NIP-23 tags for the form. Drafts carry the same tags as
+// articles so publishing a draft doesn't lose anything.
+func (f ArticleForm) tags() [][]string {
+	tags := [][]string{{"d", f.DTag}, {"title", f.Title}}
+	if f.Summary != "" {
+		tags = append(tags, []string{"summary", f.Summary})
+	}
+	if f.Image != "" {
+		tags = append(tags, []string{"image", f.Image})
+	}
+	if f.PublishedAt > 0 {
+		tags = append(tags, []string{"published_at", strconv.FormatInt(f.PublishedAt, 10)})
+	}
+	for _, t := range parseHashtags(f.Hashtags) {
+		tags = append(tags, []string{"t", t})
+	}
+	return tags
+}
+
+// fetchUserArticles fetches the newest version of each of a user's articles
+// and drafts
+func fetchUserArticles(relays []string, pubkey string) []Event {
+	result := fetchReplaceable(relays, Filter{
+		Kinds:   []int{kindArticle, kindArticleDraft},
+		Authors: []string{pubkey},
+		Limit:   200,
+	})
+	return result.Events
+}
+
+// buildArticleList merges articles and drafts that share a d tag
+func buildArticleList(events []Event) []HTMLArticleListItem {
+	byDTag := make(map[string]*HTMLArticleListItem)
+	for _, evt := range events {
+		dTag := extractDTag(evt.Tags)
+		if dTag == "" {
+			continue
+		}
+		item := byDTag[dTag]
+		if item == nil {
+			item = &HTMLArticleListItem{DTag: dTag}
+			byDTag[dTag] = item
+		}
+		if evt.Kind == kindArticle {
+			item.Published = true
+			item.EventID = evt.ID
+		}
+		if evt.CreatedAt >= item.UpdatedAt {
+			item.UpdatedAt = evt.CreatedAt
+			item.Title = extractTitle(evt.Tags)
+			item.Summary = extractSummary(evt.Tags)
+			item.HasDraft = evt.Kind == kindArticleDraft
+		}
+	}
+
+	items := make([]HTMLArticleListItem, 0, len(byDTag))
+	for _, item := range byDTag {
+		if item.Title == "" {
+			item.Title = item.DTag
+		}
+		item.UpdatedAgo = formatRelativeTime(item.UpdatedAt)
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].UpdatedAt > items[j].UpdatedAt
+	})
+	return items
+}
+
+// findArticleVersions returns the published article and draft with a d tag
+func findArticleVersions(events []Event, dTag string) (published, draft *Event) {
+	for i := range events {
+		if extractDTag(events[i].Tags) != dTag {
+			continue
+		}
+		switch events[i].Kind {
+		case kindArticle:
+			published = &events[i]
+		case kindArticleDraft:
+			draft = &events[i]
+		}
+	}
+	return published, draft
+}
+
+// htmlWriteHandler shows the article composer (GET) and previews, saves
+// drafts of, or publishes articles (POST)
+func htmlWriteHandler(w http.ResponseWriter, r *http.Request) {
+	session := getSessionFromRequest(r)
+	if session == nil || !session.Connected {
+		http.Redirect(w, r, "/html/login?error=Please+login+first", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		htmlWriteSubmit(w, r, session)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pubkeyHex := hex.EncodeToString(session.UserPubKey)
+	readRelays, _ := sessionRelays(session)
+	events := fetchUserArticles(readRelays, pubkeyHex)
+
+	data := HTMLWriteData{
+		Articles: buildArticleList(events),
+		Schedule: defaultScheduleFields("article"),
+	}
+	if dTag := strings.TrimSpace(r.URL.Query().Get("edit")); dTag != "" {
+		published, draft := findArticleVersions(events, dTag)
+		switch {
+		case draft != nil && (published == nil || draft.CreatedAt > published.CreatedAt):
+			data.Form = articleFormFromEvent(*draft)
+		case published != nil:
+			data.Form = articleFormFromEvent(*published)
+		default:
+			http.Redirect(w, r, "/html/write?error=Article+not+found", http.StatusSeeOther)
+			return
+		}
+		if published != nil {
+			// A draft of a published article keeps its original publication date
+			data.Form.PublishedAt = articleFormFromEvent(*published).PublishedAt
+		}
+		data.Editing = true
+		data.IsPublished = published != nil
+	}
+
+	renderWritePage(w, r, session, readRelays, data, "")
+}
+
+// htmlWriteSubmit handles the composer's preview, draft and publish buttons
+func htmlWriteSubmit(w http.ResponseWriter, r *http.Request, session *BunkerSession) {
+	if !validateCSRFToken(session.ID, r.FormValue("csrf_token")) {
+		http.Error(w, "Invalid or expired CSRF token", http.StatusForbidden)
+		return
+	}
+
+	pubkeyHex := hex.EncodeToString(session.UserPubKey)
+	readRelays, writeRelays := sessionRelays(session)
+	form := articleFormFromRequest(r)
+	action := r.FormValue("action")
+
+	// Errors and previews re-render the form so nothing typed is lost
+	rerender := func(errMsg string, preview template.HTML) {
+		data := HTMLWriteData{
+			Form:        form,
+			Editing:     form.DTag != "",
+			IsPublished: form.PublishedAt > 0,
+			Preview:     preview,
+			Articles:    buildArticleList(fetchUserArticles(readRelays, pubkeyHex)),
+			Schedule:    scheduleFieldsFromRequest("article", r),
+		}
+		renderWritePage(w, r, session, readRelays, data, errMsg)
+	}
+
+	if form.Title == "" || strings.TrimSpace(form.Body) == "" {
+		rerender("Title and body are required", "")
+		return
+	}
+	if form.Image != "" && !strings.HasPrefix(form.Image, "https://") && !strings.HasPrefix(form.Image, "http://") {
+		rerender("Header image must be an http(s) URL", "")
+		return
+	}
+
+	var kind int
+	var scheduleAt int64
+	var scheduleZone int
+	createdAt := time.Now().Unix()
+	switch action {
+	case "preview":
+		rerender("", renderMarkdown(form.Body))
+		return
+	case "draft":
+		kind = kindArticleDraft
+	case "publish":
+		kind = kindArticle
+		var err error
+		if scheduleAt, scheduleZone, err = parseScheduleForm(r); err != nil {
+			rerender(err.Error(), "")
+			return
+		}
+		if scheduleAt > 0 {
+			createdAt = scheduleAt
+		}
+		if form.PublishedAt == 0 {
+			form.PublishedAt = createdAt
+		}
+	default:
+		rerender("Unknown action", "")
+		return
+	}
+
+	// New articles get a slug d tag; edits keep theirs so they replace the old version
+	if form.DTag == "" {
+		form.DTag = listSlug(form.Title) + "-" + randomString(6)
+	}
+
+	event := UnsignedEvent{
+		Kind:      kind,
+		Content:   form.Body,
+		Tags:      form.tags(),
+		CreatedAt: createdAt,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
+	defer cancel()
+
+	signedEvent, err := session.SignEvent(ctx, event)
+	if err != nil {
+		slog.Warn("Failed to sign article", "kind", kind, "error", err)
+		rerender(sanitizeErrorForUser("Sign event", err), "")
+		return
+	}
+
+	if scheduleAt > 0 {
+		if msg := scheduleEvent(signedEvent, writeRelays, "article", scheduleZone); msg != "" {
+			rerender(msg, "")
+			return
+		}
+		http.Redirect(w, r, "/html/scheduled?success=Article+scheduled", http.StatusSeeOther)
+		return
+	}
+
+	publishEvent(ctx, writeRelays, signedEvent)
+	slog.Info("Published article", "event", signedEvent.ID, "kind", kind, "d", form.DTag)
+
+	if kind == kindArticleDraft {
+		http.Redirect(w, r, "/html/write?edit="+escapeURLParam(form.DTag)+"&success=Draft+saved", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/html/thread/"+signedEvent.ID+"?success=Article+published", http.StatusSeeOther)
+}
+
+// renderWritePage renders the composer page, with errMsg in place of any
+// message from the query string
+func renderWritePage(w http.ResponseWriter, r *http.Request, session *BunkerSession, relays []string, data HTMLWriteData, errMsg string) {
+	title := "Write"
+	if data.Editing {
+		title = "Edit article"
+	}
+	data.HTMLPageChrome = newPageChrome(title, r, session, relays)
+	if errMsg != "" {
+		data.Error = errMsg
+		data.Success = ""
+	}
+	data.NavTab = "write"
+
+	html, err := executePageTemplate(cachedWriteTemplate, data)
+	if err != nil {
+		slog.Error("Error rendering write page", "error", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(html))
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// iCalendar (RFC 5545) export of NIP-52 calendar events, so events and whole
+// calendars can be subscribed to from ordinary calendar apps.
+
+const mimeICalendar = "text/calendar"
+
+// icsMaxLineOctets is where content lines are folded
+const icsMaxLineOctets = 75
+
+// icsMaxRelayHints caps the naddr relay hints queried alongside the defaults
+const icsMaxRelayHints = 3
+
+// icsEscape escapes a TEXT property value
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// icsWriter builds an iCalendar object with CRLF line endings and folding
+type icsWriter struct {
+	sb strings.Builder
+}
+
+// line writes one content line, folded at 75 octets without splitting a
+// UTF-8 sequence
+func (w *icsWriter) line(name, value string) {
+	s := name + ":" + value
+	limit := icsMaxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.sb.WriteString(s[:cut])
+		w.sb.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts toward the limit
+		limit = icsMaxLineOctets - 1
+	}
+	w.sb.WriteString(s)
+	w.sb.WriteString("\r\n")
+}
+
+// event writes a VEVENT for a calendar event; description is the event's content
+func (w *icsWriter) event(cal *HTMLCalendarEvent, description, base string) {
+	w.line("BEGIN", "VEVENT")
+	w.line("UID", icsEscape(cal.Coordinate))
+	w.line("DTSTAMP", time.Unix(cal.UpdatedAt, 0).UTC().Format("20060102T150405Z"))
+	w.line("LAST-MODIFIED", time.Unix(cal.UpdatedAt, 0).UTC().Format("20060102T150405Z"))
+	if cal.AllDay {
+		w.line("DTSTART;VALUE=DATE", cal.Start.Format("20060102"))
+		// DTEND is exclusive in both NIP-52 and iCalendar
+		w.line("DTEND;VALUE=DATE", cal.lastMoment().Format("20060102"))
+	} else {
+		w.line("DTSTART", cal.Start.UTC().Format("20060102T150405Z"))
+		if !cal.End.IsZero() {
+			w.line("DTEND", cal.End.UTC().Format("20060102T150405Z"))
+		}
+	}
+	w.line("SUMMARY", icsEscape(cal.Title))
+	desc := strings.TrimSpace(description)
+	if desc == "" {
+		desc = cal.Summary
+	}
+	if desc != "" {
+		w.line("DESCRIPTION", icsEscape(desc))
+	}
+	if len(cal.Locations) > 0 {
+		w.line("LOCATION", icsEscape(strings.Join(cal.Locations, ", ")))
+	}
+	if len(cal.Hashtags) > 0 {
+		escaped := make([]string, len(cal.Hashtags))
+		for i, t := range cal.Hashtags {
+			escaped[i] = icsEscape(t)
+		}
+		w.line("CATEGORIES", strings.Join(escaped, ","))
+	}
+	w.line("URL", base+"/html/thread/"+cal.ID)
+	w.line("END", "VEVENT")
+}
+
+// calendarICSHandler serves /calendar/{naddr}.ics for a calendar event
+// (kind 31922/31923) or a calendar (kind 31924) and the events it lists
+func calendarICSHandler(w http.ResponseWriter, r *http.Request) {
+	naddr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/calendar/"), ".ics")
+	addr, err := DecodeNAddr(naddr)
+	if err != nil {
+		http.Error(w, "Invalid naddr", http.StatusBadRequest)
+		return
+	}
+	kind := int(addr.Kind)
+	if kind != kindCalendar && !isCalendarEventKind(kind) {
+		http.Error(w, "Not a calendar or calendar event", http.StatusBadRequest)
+		return
+	}
+
+	relays := defaultReadRelays()
+	for _, hint := range addr.RelayHints {
+		if relay, ok := normalizeRelayURL(hint); ok && len(relays) < len(defaultReadRelays())+icsMaxRelayHints {
+			relays = append(relays, relay)
+		}
+	}
+	relays = dedupeStrings(relays)
+
+	found := fetchReplaceable(relays, Filter{
+		Kinds:   []int{kind},
+		Authors: []string{addr.Author},
+		Tags:    map[string][]string{"d": {addr.DTag}},
+		Limit:   1,
+	}).Events
+	if len(found) == 0 {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	root := found[0]
+
+	name := ""
+	events := []Event{root}
+	if kind == kindCalendar {
+		name, events = extractTitle(root.Tags), fetchCalendarEvents(relays, root.Tags)
+	}
+
+	base := requestBaseURL(r)
+	var ics icsWriter
+	ics.line("BEGIN", "VCALENDAR")
+	ics.line("VERSION", "2.0")
+	ics.line("PRODID", "-//nostr-hypermedia//NIP-52//EN")
+	ics.line("CALSCALE", "GREGORIAN")
+	if name != "" {
+		ics.line("X-WR-CALNAME", icsEscape(name))
+	}
+	for _, evt := range events {
+		if cal := parseCalendarEvent(evt); cal != nil {
+			ics.event(cal, evt.Content, base)
+		}
+	}
+	ics.line("END", "VCALENDAR")
+
+	w.Header().Set("Content-Type", mimeICalendar+"; charset=utf-8")
+	filename := listSlug(addr.DTag)
+	if filename == "" {
+		filename = "calendar"
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s.ics"`, filename))
+	w.Header().Set("Cache-Control", "max-age=300")
+	w.Write([]byte(ics.sb.String()))
+}
+
+// fetchCalendarEvents looks up the events a kind 31924 calendar lists in its
+// a tags, newest version of each
+func fetchCalendarEvents(relays []string, tags [][]string) []Event {
+	wanted := make(map[string]bool)
+	var kinds []int
+	var authors, dTags []string
+	for _, tag := range tags {
+		if len(tag) < 2 || tag[0] != "a" {
+			continue
+		}
+		kind, pubkey, dTag, ok := parseCalendarCoordinate(tag[1])
+		if !ok {
+			continue
+		}
+		wanted[tag[1]] = true
+		kinds = append(kinds, kind)
+		authors = append(authors, pubkey)
+		dTags = append(dTags, dTag)
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	// One query for every author and d tag; events outside the list are dropped
+	found := fetchReplaceable(relays, Filter{
+		Kinds:   dedupeInts(kinds),
+		Authors: dedupeStrings(authors),
+		Tags:    map[string][]string{"d": dedupeStrings(dTags)},
+		Limit:   len(wanted) * 2,
+	}).Events
+
+	events := make([]Event, 0, len(found))
+	for _, evt := range found {
+		if wanted[fmt.Sprintf("%d:%s:%s", evt.Kind, evt.PubKey, extractDTag(evt.Tags))] {
+			events = append(events, evt)
+		}
+	}
+	return events
+}
+
+// dedupeInts removes duplicates while preserving order
+func dedupeInts(values []int) []int {
+	seen := make(map[int]bool, len(values))
+	result := make([]int, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
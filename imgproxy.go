@@ -0,0 +1,543 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"html"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Image proxy: pages load remote images through /img so readers' IPs aren't
+// sent to every image host and large images are shrunk before they reach
+// slow connections. Proxy URLs are signed so /img can't be used to fetch
+// arbitrary URLs. JPEG and PNG are resized to one of a few widths and
+// re-encoded (which also drops EXIF); GIF and WebP are passed through as-is,
+// since the stdlib can't re-encode animations or decode WebP. Results are
+// kept in a size-bounded directory on disk.
+
+// Widths the proxy resizes to: avatars, profile pictures and content images
+const (
+	imageWidthAvatar  = 96
+	imageWidthProfile = 256
+	imageWidthContent = 800
+)
+
+const (
+	imageFetchTimeout       = 10 * time.Second
+	maxImageSourceSize      = 15 << 20 // Largest image fetched from a host
+	maxImagePassthroughSize = 5 << 20  // Largest GIF or WebP served unresized
+	maxImagePixels          = 25_000_000
+	imageJPEGQuality        = 80
+	imageFailureTTL         = 10 * time.Minute // How long a failed fetch isn't retried
+	imageCacheMaxAge        = 86400
+	imageSweepInterval      = time.Minute
+)
+
+// imageHTTPClient fetches images, connecting only to public IPs
+var imageHTTPClient = &http.Client{
+	Timeout: imageFetchTimeout,
+	Transport: &http.Transport{
+		DialContext:           ssrfSafeDialContext,
+		MaxIdleConns:          20,
+		IdleConnTimeout:       30 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	},
+}
+
+// imgSrcRegex matches the src attribute of an <img> tag
+var imgSrcRegex = regexp.MustCompile(`(<img\s[^>]*?src=")([^"]*)(")`)
+
+// proxyImageURL returns the /img URL serving an image at the given width.
+// Anything that isn't an absolute http(s) URL (site-relative paths, data:
+// URIs, URLs already proxied) is returned unchanged.
+func proxyImageURL(raw string, width int) string {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, "https://") && !strings.HasPrefix(raw, "http://") {
+		return raw
+	}
+	return "/img?url=" + url.QueryEscape(raw) + "&w=" + strconv.Itoa(width) + "&s=" + imageSignature(raw, width)
+}
+
+// proxyImagesInHTML rewrites the src of every <img> in rendered HTML to go
+// through the proxy
+func proxyImagesInHTML(s string, width int) string {
+	if !strings.Contains(s, "<img") {
+		return s
+	}
+	return imgSrcRegex.ReplaceAllStringFunc(s, func(match string) string {
+		m := imgSrcRegex.FindStringSubmatch(match)
+		return m[1] + html.EscapeString(proxyImageURL(html.UnescapeString(m[2]), width)) + m[3]
+	})
+}
+
+// imageSignature signs an image URL and width with the server secret
+func imageSignature(raw string, width int) string {
+	mac := hmac.New(sha256.New, getCSRFSecret())
+	mac.Write([]byte("img|" + strconv.Itoa(width) + "|" + raw))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func isProxyWidth(width int) bool {
+	return width == imageWidthAvatar || width == imageWidthProfile || width == imageWidthContent
+}
+
+// proxiedImage is an image ready to serve
+type proxiedImage struct {
+	ContentType string
+	Data        []byte
+}
+
+// imageProxyError is a failure with the status code to answer it with
+type imageProxyError struct {
+	status int
+	msg    string
+}
+
+func (e *imageProxyError) Error() string { return e.msg }
+
+// imageFlight is a fetch in progress that other requests for the same image wait on
+type imageFlight struct {
+	done chan struct{}
+	img  *proxiedImage
+	err  error
+}
+
+var (
+	imageFlightsMu sync.Mutex
+	imageFlights   = make(map[string]*imageFlight)
+
+	imageFailuresMu sync.Mutex
+	imageFailures   = make(map[string]imageFailure) // Cache key -> recent failure
+
+	// Decoding and resizing are memory-heavy; cap how many run at once
+	imageResizeSem = make(chan struct{}, 4)
+
+	imageDiskHits     atomic.Int64
+	imageFetches      atomic.Int64
+	imageFetchErrors  atomic.Int64
+	imageDiskBytes    atomic.Int64
+	imageLastSweep    atomic.Int64 // Unix nanoseconds
+	imageSweepRunning atomic.Bool
+)
+
+type imageFailure struct {
+	err     *imageProxyError
+	expires time.Time
+}
+
+func init() {
+	registerCollector(func(pw *promWriter) {
+		pw.counter("nostr_image_proxy_disk_hits_total", "Proxied images served from the disk cache.", float64(imageDiskHits.Load()))
+		pw.counter("nostr_image_proxy_fetches_total", "Images fetched from their hosts.", float64(imageFetches.Load()))
+		pw.counter("nostr_image_proxy_fetch_errors_total", "Image fetches that failed or were rejected.", float64(imageFetchErrors.Load()))
+		pw.gauge("nostr_image_proxy_disk_bytes", "Approximate bytes in the image disk cache.", float64(imageDiskBytes.Load()))
+	})
+}
+
+// imageProxyHandler serves /img?url=<image>&w=<width>&s=<signature>
+func imageProxyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	src := q.Get("url")
+	width, _ := strconv.Atoi(q.Get("w"))
+	if src == "" || !isProxyWidth(width) {
+		http.Error(w, "Invalid image request", http.StatusBadRequest)
+		return
+	}
+	if !hmac.Equal([]byte(q.Get("s")), []byte(imageSignature(src, width))) {
+		http.Error(w, "Invalid image signature", http.StatusForbidden)
+		return
+	}
+
+	key := imageCacheKey(src, width)
+	etag := `"` + key[:32] + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		setImageCacheHeaders(w, etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	img, err := loadCachedImage(key)
+	if err != nil {
+		img, err = fetchImageOnce(r, src, width, key)
+	}
+	if err != nil {
+		var limited *rateLimitedError
+		if errors.As(err, &limited) {
+			writeRateLimited(w, limited.retryAfter)
+			return
+		}
+		status := http.StatusBadGateway
+		var perr *imageProxyError
+		if errors.As(err, &perr) {
+			status = perr.status
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	setImageCacheHeaders(w, etag)
+	w.Header().Set("Content-Type", img.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(img.Data)))
+	// Served images are never documents; keep anything odd from running
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(img.Data)
+}
+
+func setImageCacheHeaders(w http.ResponseWriter, etag string) {
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(imageCacheMaxAge))
+	w.Header().Set("ETag", etag)
+}
+
+// rateLimitedError reports that the client's image fetch bucket is empty
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string { return "rate limited" }
+
+// fetchImageOnce fetches and converts an image that isn't on disk, sharing
+// the work with concurrent requests for the same image. Recent failures are
+// answered without refetching.
+func fetchImageOnce(r *http.Request, src string, width int, key string) (*proxiedImage, error) {
+	imageFailuresMu.Lock()
+	if f, ok := imageFailures[key]; ok {
+		if time.Now().Before(f.expires) {
+			imageFailuresMu.Unlock()
+			return nil, f.err
+		}
+		delete(imageFailures, key)
+	}
+	imageFailuresMu.Unlock()
+
+	imageFlightsMu.Lock()
+	if flight, ok := imageFlights[key]; ok {
+		imageFlightsMu.Unlock()
+		<-flight.done
+		return flight.img, flight.err
+	}
+	if ok, retryAfter := imageLimiter.Allow(clientKey(r)); !ok {
+		imageFlightsMu.Unlock()
+		return nil, &rateLimitedError{retryAfter: retryAfter}
+	}
+	flight := &imageFlight{done: make(chan struct{})}
+	imageFlights[key] = flight
+	imageFlightsMu.Unlock()
+
+	// Not tied to the request: others may be waiting on this fetch
+	flight.img, flight.err = fetchImage(src, width)
+	if flight.err == nil {
+		storeCachedImage(key, flight.img)
+	} else {
+		imageFetchErrors.Add(1)
+		slog.Debug("Image proxy fetch failed", "url", src, "error", flight.err)
+		var perr *imageProxyError
+		if !errors.As(flight.err, &perr) {
+			perr = &imageProxyError{status: http.StatusBadGateway, msg: "Image unavailable"}
+			flight.err = perr
+		}
+		rememberImageFailure(key, perr)
+	}
+
+	imageFlightsMu.Lock()
+	delete(imageFlights, key)
+	imageFlightsMu.Unlock()
+	close(flight.done)
+	return flight.img, flight.err
+}
+
+func rememberImageFailure(key string, err *imageProxyError) {
+	now := time.Now()
+	imageFailuresMu.Lock()
+	defer imageFailuresMu.Unlock()
+	if len(imageFailures) >= 10000 {
+		for k, f := range imageFailures {
+			if now.After(f.expires) {
+				delete(imageFailures, k)
+			}
+		}
+	}
+	imageFailures[key] = imageFailure{err: err, expires: now.Add(imageFailureTTL)}
+}
+
+// fetchImage downloads an image and converts it for serving
+func fetchImage(src string, width int) (*proxiedImage, error) {
+	if !isURLSafeForSSRF(src) {
+		return nil, &imageProxyError{status: http.StatusForbidden, msg: "Image host not allowed"}
+	}
+	imageFetches.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), imageFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, &imageProxyError{status: http.StatusBadRequest, msg: "Invalid image URL"}
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; NostrImageProxy/1.0)")
+	req.Header.Set("Accept", "image/jpeg, image/png, image/gif, image/webp")
+
+	resp, err := imageHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &imageProxyError{status: http.StatusBadGateway, msg: "Image host returned " + resp.Status}
+	}
+	if resp.ContentLength > maxImageSourceSize {
+		return nil, &imageProxyError{status: http.StatusRequestEntityTooLarge, msg: "Image too large"}
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSourceSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageSourceSize {
+		return nil, &imageProxyError{status: http.StatusRequestEntityTooLarge, msg: "Image too large"}
+	}
+
+	// Trust the bytes, not the host's Content-Type; this also keeps SVG out
+	switch contentType := http.DetectContentType(data); contentType {
+	case "image/jpeg", "image/png":
+		return resizeImage(data, width)
+	case "image/gif", "image/webp":
+		if len(data) > maxImagePassthroughSize {
+			return nil, &imageProxyError{status: http.StatusRequestEntityTooLarge, msg: "Image too large"}
+		}
+		return &proxiedImage{ContentType: contentType, Data: data}, nil
+	default:
+		return nil, &imageProxyError{status: http.StatusUnsupportedMediaType, msg: "Unsupported image type"}
+	}
+}
+
+// resizeImage decodes a JPEG or PNG, shrinks it to at most width pixels wide
+// and re-encodes it: JPEG when fully opaque, PNG otherwise
+func resizeImage(data []byte, width int) (*proxiedImage, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, &imageProxyError{status: http.StatusUnsupportedMediaType, msg: "Unreadable image"}
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxImagePixels {
+		return nil, &imageProxyError{status: http.StatusRequestEntityTooLarge, msg: "Image dimensions too large"}
+	}
+
+	imageResizeSem <- struct{}{}
+	defer func() { <-imageResizeSem }()
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, &imageProxyError{status: http.StatusUnsupportedMediaType, msg: "Unreadable image"}
+	}
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	out := shrinkToWidth(rgba, width)
+
+	var buf bytes.Buffer
+	if out.Opaque() {
+		err = jpeg.Encode(&buf, out, &jpeg.Options{Quality: imageJPEGQuality})
+		if err == nil {
+			return &proxiedImage{ContentType: "image/jpeg", Data: buf.Bytes()}, nil
+		}
+	} else {
+		err = png.Encode(&buf, out)
+		if err == nil {
+			return &proxiedImage{ContentType: "image/png", Data: buf.Bytes()}, nil
+		}
+	}
+	return nil, err
+}
+
+// shrinkToWidth scales an image down to the given width, keeping its aspect
+// ratio, by averaging the source pixels each output pixel covers. Images
+// already narrow enough are returned unchanged.
+func shrinkToWidth(src *image.RGBA, width int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= width {
+		return src
+	}
+	height := max(1, sh*width/sw)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		y0 := y * sh / height
+		y1 := max((y+1)*sh/height, y0+1)
+		for x := range width {
+			x0 := x * sw / width
+			x1 := max((x+1)*sw/width, x0+1)
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[i])
+					g += uint32(src.Pix[i+1])
+					b += uint32(src.Pix[i+2])
+					a += uint32(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+			o := dst.PixOffset(x, y)
+			dst.Pix[o] = uint8(r / n)
+			dst.Pix[o+1] = uint8(g / n)
+			dst.Pix[o+2] = uint8(b / n)
+			dst.Pix[o+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// imageCacheKey names the cached copy of an image at a width
+func imageCacheKey(src string, width int) string {
+	sum := sha256.Sum256([]byte(strconv.Itoa(width) + "|" + src))
+	return hex.EncodeToString(sum[:])
+}
+
+// imageCachePath spreads cached images over subdirectories by key prefix
+func imageCachePath(key string) string {
+	return filepath.Join(currentConfig().ImageCache.Dir, key[:2], key)
+}
+
+// loadCachedImage reads an image from the disk cache. Each file is the
+// content type, a newline, then the image bytes.
+func loadCachedImage(key string) (*proxiedImage, error) {
+	path := imageCachePath(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	contentType, body, ok := bytes.Cut(data, []byte("\n"))
+	if !ok || !strings.HasPrefix(string(contentType), "image/") {
+		os.Remove(path)
+		return nil, errors.New("corrupt image cache entry")
+	}
+	// Bump the mtime so the sweep evicts least recently used first
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	imageDiskHits.Add(1)
+	return &proxiedImage{ContentType: string(contentType), Data: body}, nil
+}
+
+// storeCachedImage writes an image to the disk cache. Failures are logged
+// and otherwise ignored; the image is still served.
+func storeCachedImage(key string, img *proxiedImage) {
+	path := imageCachePath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		slog.Warn("Image cache directory unavailable", "error", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		slog.Warn("Image cache write failed", "error", err)
+		return
+	}
+	_, err = tmp.WriteString(img.ContentType + "\n")
+	if err == nil {
+		_, err = tmp.Write(img.Data)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		slog.Warn("Image cache write failed", "error", err)
+		return
+	}
+	imageDiskBytes.Add(int64(len(img.ContentType) + 1 + len(img.Data)))
+	maybeSweepImageCache()
+}
+
+// maybeSweepImageCache starts a sweep in the background if none ran in the
+// last minute
+func maybeSweepImageCache() {
+	now := time.Now().UnixNano()
+	if now-imageLastSweep.Load() < int64(imageSweepInterval) || !imageSweepRunning.CompareAndSwap(false, true) {
+		return
+	}
+	imageLastSweep.Store(now)
+	go func() {
+		defer imageSweepRunning.Store(false)
+		sweepImageCache()
+	}()
+}
+
+// sweepImageCache deletes the least recently used images until the cache is
+// back under 90% of its budget
+func sweepImageCache() {
+	cfg := currentConfig().ImageCache
+	type cachedFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cachedFile
+	var total int64
+	filepath.WalkDir(cfg.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, cachedFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+
+	budget := int64(cfg.MaxMB) << 20
+	if total > budget {
+		sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+		target := budget * 9 / 10
+		removed := 0
+		for _, f := range files {
+			if total <= target {
+				break
+			}
+			if os.Remove(f.path) == nil {
+				total -= f.size
+				removed++
+			}
+		}
+		slog.Info("Image cache swept", "removed", removed, "bytes", total)
+	}
+	imageDiskBytes.Store(total)
+}
@@ -5,7 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
@@ -191,7 +191,7 @@ func FetchLinkPreview(targetURL string) *LinkPreview {
 
 	// SSRF protection: validate URL before fetching
 	if !isURLSafeForSSRF(targetURL) {
-		log.Printf("Link preview blocked for SSRF risk: %s", targetURL)
+		slog.Warn("Link preview blocked for SSRF risk", "url", targetURL)
 		preview.Failed = true
 		return preview
 	}
@@ -208,14 +208,14 @@ func FetchLinkPreview(targetURL string) *LinkPreview {
 
 	resp, err := previewHTTPClient.Do(req)
 	if err != nil {
-		log.Printf("Link preview fetch failed for %s: %v", targetURL, err)
+		slog.Debug("Link preview fetch failed", "url", targetURL, "error", err)
 		preview.Failed = true
 		return preview
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Link preview got status %d for %s", resp.StatusCode, targetURL)
+		slog.Debug("Link preview got error status", "status", resp.StatusCode, "url", targetURL)
 		preview.Failed = true
 		return preview
 	}
@@ -278,8 +278,10 @@ func decodeHTMLEntities(s string) string {
 	return replacer.Replace(s)
 }
 
-// FetchLinkPreviews fetches multiple link previews in parallel
-func FetchLinkPreviews(urls []string) map[string]*LinkPreview {
+// FetchLinkPreviews fetches multiple link previews in parallel. Fetches
+// that miss the cache are charged to clientKey's link preview bucket; URLs
+// over the limit are left without a preview. An empty clientKey isn't limited.
+func FetchLinkPreviews(urls []string, clientKey string) map[string]*LinkPreview {
 	if len(urls) == 0 {
 		return nil
 	}
@@ -289,6 +291,13 @@ func FetchLinkPreviews(urls []string) map[string]*LinkPreview {
 	if len(missing) == 0 {
 		return cached
 	}
+	if clientKey != "" {
+		granted, _ := previewLimiter.Take(clientKey, len(missing))
+		if granted < len(missing) {
+			slog.Debug("Link preview fetches rate limited", "client", clientKey, "skipped", len(missing)-granted)
+			missing = missing[:granted]
+		}
+	}
 
 	// Fetch missing previews in parallel
 	var wg sync.WaitGroup
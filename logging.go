@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// initLogging installs the default slog logger. LOG_LEVEL is debug, info,
+// warn or error (default info); LOG_FORMAT is text or json (default text).
+// Cache hits and per-relay chatter log at debug.
+func initLogging() {
+	var level slog.Level
+	levelName := os.Getenv("LOG_LEVEL")
+	if levelName == "" {
+		levelName = "info"
+	}
+	levelErr := level.UnmarshalText([]byte(levelName))
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(os.Getenv("LOG_FORMAT")) {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+
+	if levelErr != nil {
+		slog.Warn("Ignoring invalid LOG_LEVEL, using info", "value", levelName)
+	}
+}
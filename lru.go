@@ -0,0 +1,244 @@
+package main
+
+import (
+	"container/list"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStats is a snapshot of one cache's size and counters
+type CacheStats struct {
+	Name        string `json:"name"`
+	Entries     int    `json:"entries"`
+	Bytes       int64  `json:"bytes"`
+	MaxBytes    int64  `json:"max_bytes"`
+	Hits        int64  `json:"hits"`
+	PartialHits int64  `json:"partial_hits,omitempty"` // Partly answered from the cache
+	Misses      int64  `json:"misses"`
+	Evictions   int64  `json:"evictions"`   // Removed to stay within the byte budget
+	Expirations int64  `json:"expirations"` // Removed because they outlived their TTL
+}
+
+// statsProvider is implemented by every cache listed on the admin endpoint;
+// the budget can be changed when the config is reloaded
+type statsProvider interface {
+	Stats() CacheStats
+	SetMaxBytes(maxBytes int64)
+}
+
+// registeredCache is a cache in the registry with the budget it started with
+type registeredCache struct {
+	provider     statsProvider
+	defaultBytes int64
+}
+
+var (
+	cacheRegistryMu sync.Mutex
+	cacheRegistry   []registeredCache
+)
+
+// registerCache adds a cache to the stats registry
+func registerCache(c statsProvider) {
+	cacheRegistryMu.Lock()
+	defer cacheRegistryMu.Unlock()
+	cacheRegistry = append(cacheRegistry, registeredCache{provider: c, defaultBytes: c.Stats().MaxBytes})
+}
+
+// registeredCaches returns a snapshot of the registry
+func registeredCaches() []registeredCache {
+	cacheRegistryMu.Lock()
+	defer cacheRegistryMu.Unlock()
+	return append([]registeredCache(nil), cacheRegistry...)
+}
+
+// allCacheStats returns stats for every registered cache, sorted by name
+func allCacheStats() []CacheStats {
+	caches := registeredCaches()
+	stats := make([]CacheStats, 0, len(caches))
+	for _, c := range caches {
+		stats = append(stats, c.provider.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// cacheBudget reads a cache budget in megabytes from the environment,
+// falling back to defaultMB
+func cacheBudget(envName string, defaultMB int) int64 {
+	mb := defaultMB
+	if v := os.Getenv(envName); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			mb = parsed
+		} else {
+			slog.Warn("Ignoring invalid cache budget", "env", envName, "value", v, "default_mb", defaultMB)
+		}
+	}
+	return int64(mb) << 20
+}
+
+// BoundedCache is a string-keyed LRU cache limited by an estimate of the
+// bytes its entries hold. Expiry rules stay with the caller, which passes a
+// validity check to Get.
+type BoundedCache[V any] struct {
+	name     string
+	maxBytes int64
+	sizeOf   func(key string, value V) int64
+
+	mu    sync.Mutex
+	order *list.List // Front is most recently used
+	items map[string]*list.Element
+	bytes int64
+
+	hits        atomic.Int64
+	misses      atomic.Int64
+	evictions   atomic.Int64
+	expirations atomic.Int64
+}
+
+type boundedEntry[V any] struct {
+	key      string
+	value    V
+	size     int64
+	storedAt time.Time
+}
+
+// NewBoundedCache creates a cache and registers it for stats
+func NewBoundedCache[V any](name string, maxBytes int64, sizeOf func(key string, value V) int64) *BoundedCache[V] {
+	c := &BoundedCache[V]{
+		name:     name,
+		maxBytes: maxBytes,
+		sizeOf:   sizeOf,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+	registerCache(c)
+	return c
+}
+
+// Get returns the value for key if present and valid reports it as still
+// usable; invalid entries are removed and counted as expired
+func (c *BoundedCache[V]) Get(key string, valid func(value V, storedAt time.Time) bool) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	elem, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		return zero, false
+	}
+	entry := elem.Value.(*boundedEntry[V])
+	if valid != nil && !valid(entry.value, entry.storedAt) {
+		c.removeElement(elem)
+		c.expirations.Add(1)
+		c.misses.Add(1)
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	c.hits.Add(1)
+	return entry.value, true
+}
+
+// Set stores value under key, evicting least recently used entries to stay
+// within the byte budget. Values larger than the whole budget aren't stored.
+func (c *BoundedCache[V]) Set(key string, value V) {
+	size := c.sizeOf(key, value)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+	if size > c.maxBytes {
+		return
+	}
+
+	entry := &boundedEntry[V]{key: key, value: value, size: size, storedAt: time.Now()}
+	c.items[key] = c.order.PushFront(entry)
+	c.bytes += size
+	c.evictOverBudget()
+}
+
+// SetMaxBytes changes the byte budget, evicting if the cache is now over it
+func (c *BoundedCache[V]) SetMaxBytes(maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes = maxBytes
+	c.evictOverBudget()
+}
+
+// evictOverBudget drops least recently used entries until within budget (must hold lock)
+func (c *BoundedCache[V]) evictOverBudget() {
+	for c.bytes > c.maxBytes {
+		oldest := c.order.Back()
+		if oldest == nil {
+			break
+		}
+		c.removeElement(oldest)
+		c.evictions.Add(1)
+	}
+}
+
+// Delete removes key from the cache
+func (c *BoundedCache[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// removeElement unlinks an entry (must hold lock)
+func (c *BoundedCache[V]) removeElement(elem *list.Element) {
+	entry := elem.Value.(*boundedEntry[V])
+	c.order.Remove(elem)
+	delete(c.items, entry.key)
+	c.bytes -= entry.size
+}
+
+// Stats returns the cache's current size and counters
+func (c *BoundedCache[V]) Stats() CacheStats {
+	c.mu.Lock()
+	entries, bytes, maxBytes := len(c.items), c.bytes, c.maxBytes
+	c.mu.Unlock()
+	return CacheStats{
+		Name:        c.name,
+		Entries:     entries,
+		Bytes:       bytes,
+		MaxBytes:    maxBytes,
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
+
+// Size estimates: string bytes plus rough per-value overheads for headers,
+// pointers and map/list bookkeeping
+
+const entryOverhead = 128
+
+func stringsSize(values []string) int64 {
+	size := int64(24) // slice header
+	for _, v := range values {
+		size += 16 + int64(len(v))
+	}
+	return size
+}
+
+func eventSize(evt Event) int64 {
+	size := int64(200) + int64(len(evt.ID)+len(evt.PubKey)+len(evt.Content)+len(evt.Sig))
+	for _, tag := range evt.Tags {
+		size += stringsSize(tag)
+	}
+	size += stringsSize(evt.RelaysSeen)
+	return size
+}
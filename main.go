@@ -1,9 +1,14 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 // Request body size limits
@@ -11,6 +16,17 @@ const (
 	maxBodySize = 32 * 1024 // 32KB for POST requests
 )
 
+// HTTP server timeouts. Writes allow for a remote signer round-trip plus
+// publishing; posts with an attachment extend their own read and write
+// deadlines (see uploadRequestTimeout). Shutdown waits this long for in-flight requests.
+const (
+	serverReadHeaderTimeout = 10 * time.Second
+	serverReadTimeout       = 30 * time.Second
+	serverWriteTimeout      = 60 * time.Second
+	serverIdleTimeout       = 120 * time.Second
+	shutdownTimeout         = 25 * time.Second
+)
+
 // limitBody wraps an HTTP handler to limit request body size
 func limitBody(next http.HandlerFunc, maxBytes int64) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -26,13 +42,13 @@ func securityHeaders(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Content Security Policy - defense in depth against XSS
 		// - default-src 'self': only load resources from same origin by default
-		// - img-src * data:: allow images from anywhere (user avatars, embedded images)
+		// - img-src 'self' data:: remote images are loaded through the /img proxy
 		// - media-src *: allow audio/video from anywhere
 		// - frame-src youtube.com youtube-nocookie.com: allow YouTube embeds
 		// - style-src 'self' 'unsafe-inline': allow inline styles for theming
 		// - script-src 'self': only allow scripts from same origin
 		csp := "default-src 'self'; " +
-			"img-src * data:; " +
+			"img-src 'self' data:; " +
 			"media-src *; " +
 			"frame-src https://www.youtube.com https://www.youtube-nocookie.com; " +
 			"style-src 'self' 'unsafe-inline'; " +
@@ -56,10 +72,16 @@ func securityHeaders(next http.HandlerFunc) http.HandlerFunc {
 }
 
 func main() {
+	initLogging()
+
 	// Initialize templates at startup for better performance
 	initTemplates()
 	initAuthTemplates()
 
+	// Load relay sets, timeouts and cache budgets; SIGHUP reloads them
+	initConfig()
+	reloadConfigOnSIGHUP()
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -72,6 +94,13 @@ func main() {
 	// API endpoints (these handle content negotiation internally)
 	http.HandleFunc("/timeline", timelineHandler)
 	http.HandleFunc("/thread/", threadHandler)
+	http.HandleFunc("/profile/", profileHandler)
+	http.HandleFunc("/events", limitBody(publishEventHandler, maxBodySize))
+
+	// RSS, Atom and JSON Feed for feed readers
+	http.HandleFunc("/feed/profile/", feedProfileHandler)
+	http.HandleFunc("/feed/tag/", feedTagHandler)
+	http.HandleFunc("/calendar/", calendarICSHandler)
 
 	// Root path redirects to HTML timeline, everything else 404
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -88,27 +117,86 @@ func main() {
 	http.HandleFunc("/html/profile/", securityHeaders(htmlProfileHandler))
 	http.HandleFunc("/html/login", securityHeaders(limitBody(htmlLoginHandler, maxBodySize)))
 	http.HandleFunc("/html/logout", securityHeaders(htmlLogoutHandler))
-	http.HandleFunc("/html/post", securityHeaders(limitBody(htmlPostNoteHandler, maxBodySize)))
-	http.HandleFunc("/html/reply", securityHeaders(limitBody(htmlReplyHandler, maxBodySize)))
+	http.HandleFunc("/html/post", securityHeaders(limitBody(htmlPostNoteHandler, maxUploadBodySize)))
+	http.HandleFunc("/html/reply", securityHeaders(limitBody(htmlReplyHandler, maxUploadBodySize)))
 	http.HandleFunc("/html/react", securityHeaders(limitBody(htmlReactHandler, maxBodySize)))
+	http.HandleFunc("/html/reactions/", securityHeaders(htmlReactionsHandler))
 	http.HandleFunc("/html/bookmark", securityHeaders(limitBody(htmlBookmarkHandler, maxBodySize)))
+	http.HandleFunc("/html/poll/vote", securityHeaders(limitBody(htmlPollVoteHandler, maxBodySize)))
 	http.HandleFunc("/html/repost", securityHeaders(limitBody(htmlRepostHandler, maxBodySize)))
 	http.HandleFunc("/html/follow", securityHeaders(limitBody(htmlFollowHandler, maxBodySize)))
 	http.HandleFunc("/html/quote/", securityHeaders(htmlQuoteHandler))
 	http.HandleFunc("/html/check-connection", securityHeaders(htmlCheckConnectionHandler))
 	http.HandleFunc("/html/reconnect", securityHeaders(htmlReconnectHandler))
 	http.HandleFunc("/html/theme", securityHeaders(htmlThemeHandler))
+	http.HandleFunc("/html/blur-media", securityHeaders(htmlBlurMediaHandler))
 	http.HandleFunc("/html/notifications", securityHeaders(htmlNotificationsHandler))
+	http.HandleFunc("/html/lists", securityHeaders(limitBody(htmlListsHandler, maxBodySize)))
+	http.HandleFunc("/html/dvms", securityHeaders(htmlDVMsHandler))
+	http.HandleFunc("/html/write", securityHeaders(limitBody(htmlWriteHandler, maxArticleBodySize)))
+	http.HandleFunc("/html/calendar", securityHeaders(htmlCalendarHandler))
+	http.HandleFunc("/html/calendar/rsvp", securityHeaders(limitBody(htmlCalendarRSVPHandler, maxBodySize)))
+	http.HandleFunc("/html/communities", securityHeaders(htmlCommunitiesHandler))
+	http.HandleFunc("/html/community/", securityHeaders(htmlCommunityHandler))
+	http.HandleFunc("/html/community/post", securityHeaders(limitBody(htmlCommunityPostHandler, maxBodySize)))
+	http.HandleFunc("/html/group", securityHeaders(htmlGroupHandler))
+	http.HandleFunc("/html/group/join", securityHeaders(limitBody(htmlGroupJoinHandler, maxBodySize)))
+	http.HandleFunc("/html/group/post", securityHeaders(limitBody(htmlGroupPostHandler, maxBodySize)))
+	http.HandleFunc("/html/scheduled", securityHeaders(limitBody(htmlScheduledHandler, maxBodySize)))
+	http.HandleFunc("/html/settings/relays", securityHeaders(limitBody(htmlRelaySettingsHandler, maxBodySize)))
+	http.HandleFunc("/img", imageProxyHandler)
 	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/metrics", metricsHandler)
+	http.HandleFunc("/admin/cache-stats", requireAdmin(adminCacheStatsHandler))
 
 	// Start NIP-46 connection listener for nostrconnect:// flow
-	StartConnectionListener(defaultNostrConnectRelays)
+	background, stopBackground := context.WithCancel(context.Background())
+	StartConnectionListener(background, nostrConnectRelays())
+
+	// Publish scheduled posts as they come due
+	scheduleQueue.Start(background, currentConfig().Schedule.File)
+
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           instrumentMux(http.DefaultServeMux, rateLimitReads(http.DefaultServeMux)),
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		ReadTimeout:       serverReadTimeout,
+		WriteTimeout:      serverWriteTimeout,
+		IdleTimeout:       serverIdleTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Starting server", "addr", srv.Addr, "url", "http://localhost:"+port)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-serveErr:
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
+	case sig := <-stop:
+		slog.Info("Shutting down, draining requests", "signal", sig.String(), "timeout", shutdownTimeout)
+	}
 
-	log.Printf("Starting server on :%s", port)
-	log.Printf("Open http://localhost:%s in your browser", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatal(err)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("Shutdown deadline passed with requests still running", "error", err)
 	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Server failed", "error", err)
+	}
+
+	// Stop background work, then drop relay connections
+	stopBackground()
+	queryWarmer.Stop()
+	eventStore.Close()
+	bunkerSessions.StopCleanup()
+	relayPool.Shutdown()
+	slog.Info("Shutdown complete")
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Prometheus metrics in the text exposition format. Request latency, relay
+// fan-out timing and bunker round-trips are recorded as they happen; cache,
+// pool, coalescing and negentropy numbers are read from their owners on
+// each scrape.
+
+// latencyBuckets are histogram upper bounds in seconds, from cache hits to
+// slow relays and remote signers
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// histogram is a cumulative-bucket histogram for one label set
+type histogram struct {
+	counts  []atomic.Uint64 // Per bucket (non-cumulative), plus +Inf at the end
+	count   atomic.Uint64
+	sumBits atomic.Uint64 // float64 sum of observations
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	i := sort.SearchFloat64s(buckets, v)
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	for {
+		old := h.sumBits.Load()
+		if h.sumBits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.RWMutex
+	series map[string]*histogram // Joined label values -> histogram
+}
+
+var (
+	metricsMu         sync.Mutex
+	metricHistograms  []*HistogramVec
+	metricsCollectors []func(pw *promWriter)
+)
+
+// newHistogramVec creates and registers a histogram
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogram)}
+	metricsMu.Lock()
+	metricHistograms = append(metricHistograms, h)
+	metricsMu.Unlock()
+	return h
+}
+
+// registerCollector adds a function that writes metrics read at scrape time
+func registerCollector(collect func(pw *promWriter)) {
+	metricsMu.Lock()
+	metricsCollectors = append(metricsCollectors, collect)
+	metricsMu.Unlock()
+}
+
+// Observe records a value for the given label values (in label order)
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.mu.RLock()
+	s := h.series[key]
+	h.mu.RUnlock()
+	if s == nil {
+		h.mu.Lock()
+		if s = h.series[key]; s == nil {
+			s = &histogram{counts: make([]atomic.Uint64, len(h.buckets)+1)}
+			h.series[key] = s
+		}
+		h.mu.Unlock()
+	}
+	s.observe(h.buckets, v)
+}
+
+// ObserveSince records the seconds elapsed since start
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Request-path metrics
+var (
+	httpRequestDuration = newHistogramVec("nostr_http_request_duration_seconds",
+		"HTTP request latency by route, method and status code.", latencyBuckets, "route", "method", "code")
+	relayFanoutDuration = newHistogramVec("nostr_relay_fanout_duration_seconds",
+		"Time to collect a query from all relays, by how the collection ended.", latencyBuckets, "outcome")
+	relayEOSEDuration = newHistogramVec("nostr_relay_eose_duration_seconds",
+		"Time from subscribing to a single relay until it sent EOSE.", latencyBuckets)
+	bunkerRequestDuration = newHistogramVec("nostr_bunker_request_duration_seconds",
+		"NIP-46 remote signer round-trip time by method and outcome.", latencyBuckets, "method", "outcome")
+	httpRequestsInFlight atomic.Int64
+)
+
+// promWriter writes samples in the Prometheus text format
+type promWriter struct {
+	w *bufio.Writer
+}
+
+// header writes the HELP and TYPE lines for a metric family
+func (pw *promWriter) header(name, help, typ string) {
+	pw.w.WriteString("# HELP " + name + " " + help + "\n")
+	pw.w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// sample writes one sample; labels alternate names and values
+func (pw *promWriter) sample(name string, value float64, labels ...string) {
+	pw.w.WriteString(name)
+	if len(labels) > 0 {
+		pw.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				pw.w.WriteByte(',')
+			}
+			pw.w.WriteString(labels[i] + `="` + escapeLabelValue(labels[i+1]) + `"`)
+		}
+		pw.w.WriteByte('}')
+	}
+	pw.w.WriteByte(' ')
+	pw.w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	pw.w.WriteByte('\n')
+}
+
+// gauge writes a single unlabeled gauge
+func (pw *promWriter) gauge(name, help string, value float64) {
+	pw.header(name, help, "gauge")
+	pw.sample(name, value)
+}
+
+// counter writes a single unlabeled counter
+func (pw *promWriter) counter(name, help string, value float64) {
+	pw.header(name, help, "counter")
+	pw.sample(name, value)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+// labelPairs zips label names with the values joined in a series key
+func labelPairs(names []string, key string) []string {
+	if len(names) == 0 {
+		return nil
+	}
+	values := strings.Split(key, "\xff")
+	pairs := make([]string, 0, 2*len(names))
+	for i, name := range names {
+		pairs = append(pairs, name, values[i])
+	}
+	return pairs
+}
+
+// sortedKeys returns a map's keys in order so scrapes are stable
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (h *HistogramVec) write(pw *promWriter) {
+	pw.header(h.name, h.help, "histogram")
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		labels := labelPairs(h.labels, key)
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i].Load()
+			pw.sample(h.name+"_bucket", float64(cumulative), append(labels, "le", strconv.FormatFloat(bound, 'g', -1, 64))...)
+		}
+		cumulative += s.counts[len(h.buckets)].Load()
+		pw.sample(h.name+"_bucket", float64(cumulative), append(labels, "le", "+Inf")...)
+		pw.sample(h.name+"_sum", math.Float64frombits(s.sumBits.Load()), labels...)
+		pw.sample(h.name+"_count", float64(s.count.Load()), labels...)
+	}
+}
+
+func init() {
+	registerCollector(collectCacheMetrics)
+	registerCollector(collectRelayPoolMetrics)
+	registerCollector(collectCoalescingMetrics)
+	registerCollector(collectNegentropyMetrics)
+	registerCollector(func(pw *promWriter) {
+		pw.gauge("nostr_http_requests_in_flight", "HTTP requests currently being served.", float64(httpRequestsInFlight.Load()))
+		pw.gauge("nostr_bunker_sessions", "Logged-in NIP-46 sessions.", float64(bunkerSessions.Len()))
+	})
+}
+
+// collectCacheMetrics reports every registered cache by name
+func collectCacheMetrics(pw *promWriter) {
+	stats := allCacheStats()
+	families := []struct {
+		name, help, typ string
+		value           func(CacheStats) int64
+	}{
+		{"nostr_cache_hits_total", "Cache lookups answered from the cache.", "counter", func(s CacheStats) int64 { return s.Hits }},
+		{"nostr_cache_partial_hits_total", "Cache lookups partly answered from the cache.", "counter", func(s CacheStats) int64 { return s.PartialHits }},
+		{"nostr_cache_misses_total", "Cache lookups that went to relays.", "counter", func(s CacheStats) int64 { return s.Misses }},
+		{"nostr_cache_evictions_total", "Entries removed to stay within the byte budget.", "counter", func(s CacheStats) int64 { return s.Evictions }},
+		{"nostr_cache_expirations_total", "Entries removed because they outlived their TTL.", "counter", func(s CacheStats) int64 { return s.Expirations }},
+		{"nostr_cache_entries", "Entries currently cached.", "gauge", func(s CacheStats) int64 { return int64(s.Entries) }},
+		{"nostr_cache_bytes", "Estimated bytes held by the cache.", "gauge", func(s CacheStats) int64 { return s.Bytes }},
+		{"nostr_cache_max_bytes", "Byte budget of the cache.", "gauge", func(s CacheStats) int64 { return s.MaxBytes }},
+	}
+	for _, f := range families {
+		pw.header(f.name, f.help, f.typ)
+		for _, s := range stats {
+			pw.sample(f.name, float64(f.value(s)), "cache", s.Name)
+		}
+	}
+}
+
+// collectRelayPoolMetrics reports pooled connections and what runs on them
+func collectRelayPoolMetrics(pw *promWriter) {
+	pool := relayPool.Stats()
+	pw.gauge("nostr_relay_connections", "Open pooled relay connections.", float64(pool.Connections))
+	pw.gauge("nostr_relay_subscriptions_active", "Open REQ subscriptions across pooled connections.", float64(pool.Subscriptions))
+	pw.gauge("nostr_relay_negentropy_sessions_active", "Open NIP-77 reconciliations across pooled connections.", float64(pool.NegSessions))
+	pw.gauge("nostr_relay_count_requests_pending", "NIP-45 COUNT requests awaiting an answer.", float64(pool.PendingCounts))
+}
+
+func collectCoalescingMetrics(pw *promWriter) {
+	c := coalescing.Snapshot()
+	pw.counter("nostr_coalescing_queries_total", "Filter queries started.", float64(c.Queries))
+	pw.counter("nostr_coalescing_queries_identical_total", "Queries that joined an identical in-flight query.", float64(c.QueriesIdentical))
+	pw.counter("nostr_coalescing_queries_subsumed_total", "Queries answered from a broader in-flight query.", float64(c.QueriesSubsumed))
+	pw.counter("nostr_coalescing_profile_lookups_total", "Pubkeys looked up on relays.", float64(c.ProfileLookups))
+	pw.counter("nostr_coalescing_profiles_shared_total", "Pubkeys taken from another in-flight batch.", float64(c.ProfilesShared))
+	pw.counter("nostr_coalescing_reaction_lookups_total", "Reaction fetches started.", float64(c.ReactionLookups))
+	pw.counter("nostr_coalescing_reactions_shared_total", "Reaction fetches that joined an identical in-flight fetch.", float64(c.ReactionsShared))
+}
+
+func collectNegentropyMetrics(pw *promWriter) {
+	n := negentropyCounters.Snapshot()
+	pw.counter("nostr_negentropy_syncs_total", "Completed NIP-77 reconciliations.", float64(n.Syncs))
+	pw.counter("nostr_negentropy_fallbacks_total", "Reconciliations that fell back to REQ.", float64(n.Fallbacks))
+	pw.counter("nostr_negentropy_events_skipped_total", "Events not downloaded because they were already stored.", float64(n.EventsSkipped))
+	pw.counter("nostr_negentropy_events_fetched_total", "Events downloaded after reconciliation.", float64(n.EventsFetched))
+}
+
+// metricsHandler serves all metrics in the Prometheus text format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	metricsMu.Lock()
+	histograms := append([]*HistogramVec(nil), metricHistograms...)
+	collectors := append([]func(pw *promWriter){}, metricsCollectors...)
+	metricsMu.Unlock()
+
+	pw := &promWriter{w: bufio.NewWriter(w)}
+	for _, h := range histograms {
+		h.write(pw)
+	}
+	for _, collect := range collectors {
+		collect(pw)
+	}
+	pw.w.Flush()
+}
+
+// statusRecorder captures the status code a handler writes
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Flush lets streaming handlers keep working through the recorder
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection, so handlers can
+// still change their read and write deadlines
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrumentMux records latency for every request served by next, labeled
+// with the mux pattern that matched so arbitrary paths don't create new series
+func instrumentMux(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		start := time.Now()
+		httpRequestsInFlight.Add(1)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			httpRequestsInFlight.Add(-1)
+			httpRequestDuration.ObserveSince(start, route, metricMethod(r.Method), strconv.Itoa(rec.status))
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// metricMethod keeps client-chosen methods from creating new series
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// NIP-77 negentropy sync: instead of re-downloading a window of events we
+// mostly hold already, reconcile the set of IDs with the relay and fetch only
+// the ones we're missing. Relays that don't support it get a plain REQ.
+
+const (
+	negentropyProtocolVersion = 0x61 // Negentropy protocol V1
+	negentropyIDSize          = 32
+	negentropyFingerprintSize = 16
+	negentropyBuckets         = 16
+	negentropyMaxTimestamp    = math.MaxUint64 // The "infinity" bound
+
+	negModeSkip        = 0
+	negModeFingerprint = 1
+	negModeIDList      = 2
+
+	negentropyMinAuthors   = 20  // Smaller author sets aren't worth a reconciliation
+	negentropyMaxRounds    = 8   // Give up on reconciliations that don't converge
+	negentropyMaxFetch     = 500 // Fall back to REQ rather than fetch more IDs than this
+	negentropyProbeTimeout = 5 * time.Second
+	negentropySupportedTTL = 6 * time.Hour
+	negentropyRejectedTTL  = 1 * time.Hour
+	negentropyRetryTTL     = 5 * time.Minute // After a probe failed to connect
+)
+
+// NegentropyStats counts reconciliations for the metrics endpoint
+type NegentropyStats struct {
+	Syncs         int64 `json:"syncs"`          // Reconciliations completed
+	Fallbacks     int64 `json:"fallbacks"`      // Failed reconciliations answered by REQ
+	EventsSkipped int64 `json:"events_skipped"` // Events the relay had that we already held
+	EventsFetched int64 `json:"events_fetched"` // Missing event IDs fetched after a reconciliation
+}
+
+type negentropyCounterSet struct {
+	syncs         atomic.Int64
+	fallbacks     atomic.Int64
+	eventsSkipped atomic.Int64
+	eventsFetched atomic.Int64
+}
+
+var negentropyCounters negentropyCounterSet
+
+// Snapshot returns the current counter values
+func (c *negentropyCounterSet) Snapshot() NegentropyStats {
+	return NegentropyStats{
+		Syncs:         c.syncs.Load(),
+		Fallbacks:     c.fallbacks.Load(),
+		EventsSkipped: c.eventsSkipped.Load(),
+		EventsFetched: c.eventsFetched.Load(),
+	}
+}
+
+// negentropyPlan is a feed window the event store can seed a reconciliation with
+type negentropyPlan struct {
+	window Filter  // The original filter narrowed to a since, without a limit
+	local  []Event // Every stored event in the window
+}
+
+// planNegentropySync returns a plan when the store already holds a full page
+// for filter. The window runs from the oldest event of that page to the
+// filter's until, so once it is reconciled its newest events are the page.
+func planNegentropySync(filter Filter) *negentropyPlan {
+	if len(filter.IDs) > 0 || len(filter.Authors) < negentropyMinAuthors || filter.Limit <= 0 {
+		return nil
+	}
+
+	page := eventStore.Query(filter)
+	if len(page) < filter.Limit {
+		return nil
+	}
+
+	window := filter
+	since := page[len(page)-1].CreatedAt
+	window.Since = &since
+	window.Limit = 0
+	return &negentropyPlan{window: window, local: eventStore.Query(window)}
+}
+
+// syncFromRelay answers filter from one relay, reconciling plan's window with
+// negentropy when the relay supports it and falling back to a plain REQ
+func syncFromRelay(ctx context.Context, relayURL string, filter Filter, plan *negentropyPlan, eventChan chan<- Event, eoseChan chan<- bool) {
+	if plan == nil || !relayPool.SupportsNegentropy(relayURL) {
+		fetchFromRelay(ctx, relayURL, filter, eventChan, eoseChan)
+		return
+	}
+
+	need, err := negentropySync(ctx, relayURL, buildReqFilter(plan.window), plan.local)
+	if err == nil && len(need) > negentropyMaxFetch {
+		err = fmt.Errorf("relay has %d events we don't", len(need))
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("Negentropy sync failed, falling back to REQ", "relay", relayURL, "error", err)
+		negentropyCounters.fallbacks.Add(1)
+		fetchFromRelay(ctx, relayURL, filter, eventChan, eoseChan)
+		return
+	}
+
+	negentropyCounters.syncs.Add(1)
+	negentropyCounters.eventsFetched.Add(int64(len(need)))
+	slog.Debug("Negentropy sync", "relay", relayURL, "local", len(plan.local), "missing", len(need))
+
+	if len(need) == 0 {
+		eoseChan <- true
+		return
+	}
+	fetchFromRelay(ctx, relayURL, Filter{IDs: need, Limit: len(need)}, eventChan, eoseChan)
+}
+
+// negentropyRelayError is a NEG-ERR sent by the relay
+type negentropyRelayError struct {
+	reason string
+}
+
+func (e *negentropyRelayError) Error() string {
+	return "NEG-ERR: " + e.reason
+}
+
+// negentropySync reconciles local with the relay's events for filter and
+// returns the IDs the relay has that local doesn't
+func negentropySync(ctx context.Context, relayURL string, filter map[string]interface{}, local []Event) ([]string, error) {
+	neg := newNegentropy(local)
+	subID := "neg-" + randomString(8)
+
+	sess, err := relayPool.NegOpen(ctx, relayURL, subID, filter, hex.EncodeToString(neg.initiate()))
+	if err != nil {
+		return nil, err
+	}
+	defer relayPool.NegClose(relayURL, sess)
+
+	var need []string
+	for round := 0; round < negentropyMaxRounds; round++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-sess.Done:
+			return nil, errors.New("connection closed")
+		case reason := <-sess.ErrChan:
+			return nil, &negentropyRelayError{reason: reason}
+		case msgHex := <-sess.MsgChan:
+			msg, err := hex.DecodeString(msgHex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid NEG-MSG: %w", err)
+			}
+			next, roundNeed, err := neg.reconcile(msg)
+			if err != nil {
+				return nil, err
+			}
+			need = append(need, roundNeed...)
+			if next == nil {
+				negentropyCounters.eventsSkipped.Add(int64(neg.matched))
+				return need, nil
+			}
+			if err := relayPool.NegSend(relayURL, sess, hex.EncodeToString(next)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, errors.New("reconciliation did not converge")
+}
+
+// negentropySupport is what a probe learned about a relay
+type negentropySupport struct {
+	supported bool
+	recheckAt time.Time
+	probing   bool
+}
+
+// SupportsNegentropy reports whether the relay is known to speak NIP-77.
+// Unknown relays are probed in the background and report false meanwhile.
+func (p *RelayPool) SupportsNegentropy(relayURL string) bool {
+	p.negMu.Lock()
+	defer p.negMu.Unlock()
+
+	s := p.negSupport[relayURL]
+	if s == nil {
+		s = &negentropySupport{}
+		p.negSupport[relayURL] = s
+	}
+	if !s.probing && time.Now().After(s.recheckAt) {
+		s.probing = true
+		go p.probeNegentropy(relayURL)
+	}
+	return s.supported
+}
+
+// probeNegentropy reconciles an empty set over a window that should be empty.
+// A reply means support; NEG-ERR or silence (relays without NIP-77 ignore or
+// NOTICE the message) means none.
+func (p *RelayPool) probeNegentropy(relayURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), negentropyProbeTimeout)
+	defer cancel()
+
+	now := time.Now().Unix()
+	filter := map[string]interface{}{"kinds": []int{0}, "since": now, "until": now}
+	_, err := negentropySync(ctx, relayURL, filter, nil)
+
+	var relayErr *negentropyRelayError
+	supported := err == nil
+	recheck := negentropySupportedTTL
+	switch {
+	case supported:
+		slog.Info("Relay supports negentropy", "relay", relayURL)
+	case errors.As(err, &relayErr), errors.Is(err, context.DeadlineExceeded):
+		slog.Info("Relay doesn't support negentropy", "relay", relayURL, "error", err)
+		recheck = negentropyRejectedTTL
+	default:
+		recheck = negentropyRetryTTL
+	}
+
+	p.negMu.Lock()
+	p.negSupport[relayURL] = &negentropySupport{supported: supported, recheckAt: time.Now().Add(recheck)}
+	p.negMu.Unlock()
+}
+
+// Negentropy protocol (initiator side). Items are (created_at, id) pairs in
+// ascending order; messages are a version byte followed by ranges, each an
+// upper bound, a mode and a payload.
+
+type negItem struct {
+	timestamp uint64
+	id        [negentropyIDSize]byte
+}
+
+type negBound struct {
+	timestamp uint64
+	idPrefix  []byte
+}
+
+// negentropy holds our side of one reconciliation
+type negentropy struct {
+	items   []negItem
+	matched int // Relay items found in our set so far
+
+	lastTimestampIn  uint64
+	lastTimestampOut uint64
+}
+
+func newNegentropy(events []Event) *negentropy {
+	n := &negentropy{}
+	seen := make(map[string]bool, len(events))
+	for _, evt := range events {
+		raw, err := hex.DecodeString(evt.ID)
+		if err != nil || len(raw) != negentropyIDSize || seen[evt.ID] || evt.CreatedAt < 0 {
+			continue
+		}
+		seen[evt.ID] = true
+		item := negItem{timestamp: uint64(evt.CreatedAt)}
+		copy(item.id[:], raw)
+		n.items = append(n.items, item)
+	}
+	sort.Slice(n.items, func(i, j int) bool {
+		a, b := n.items[i], n.items[j]
+		if a.timestamp != b.timestamp {
+			return a.timestamp < b.timestamp
+		}
+		return bytes.Compare(a.id[:], b.id[:]) < 0
+	})
+	return n
+}
+
+// initiate builds the opening message
+func (n *negentropy) initiate() []byte {
+	n.lastTimestampOut = 0
+	out := []byte{negentropyProtocolVersion}
+	return n.splitRange(out, 0, len(n.items), negBound{timestamp: negentropyMaxTimestamp})
+}
+
+// reconcile processes a relay message, returning our reply (nil once the
+// sets are reconciled) and the IDs the relay has that we don't
+func (n *negentropy) reconcile(msg []byte) ([]byte, []string, error) {
+	n.lastTimestampIn, n.lastTimestampOut = 0, 0
+	in := &negReader{buf: msg}
+
+	version, err := in.byte()
+	if err != nil {
+		return nil, nil, err
+	}
+	if version != negentropyProtocolVersion {
+		return nil, nil, fmt.Errorf("unsupported negentropy version 0x%x", version)
+	}
+
+	out := []byte{negentropyProtocolVersion}
+	var need []string
+	prevIndex := 0
+	prevBound := negBound{}
+	skip := false
+
+	for !in.empty() {
+		currBound, err := n.decodeBound(in)
+		if err != nil {
+			return nil, nil, err
+		}
+		mode, err := in.varint()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		lower := prevIndex
+		upper := n.findLowerBound(prevIndex, len(n.items), currBound)
+		// A pending skip is only written out if a later range needs a reply
+		flushSkip := func() {
+			if skip {
+				skip = false
+				out = n.encodeBound(out, prevBound)
+				out = appendVarint(out, negModeSkip)
+			}
+		}
+
+		switch mode {
+		case negModeSkip:
+			skip = true
+
+		case negModeFingerprint:
+			theirs, err := in.bytes(negentropyFingerprintSize)
+			if err != nil {
+				return nil, nil, err
+			}
+			ours := n.fingerprint(lower, upper)
+			if !bytes.Equal(theirs, ours[:]) {
+				flushSkip()
+				out = n.splitRange(out, lower, upper, currBound)
+			} else {
+				n.matched += upper - lower
+				skip = true
+			}
+
+		case negModeIDList:
+			count, err := in.varint()
+			if err != nil {
+				return nil, nil, err
+			}
+			theirs := make(map[[negentropyIDSize]byte]bool)
+			for i := uint64(0); i < count; i++ {
+				raw, err := in.bytes(negentropyIDSize)
+				if err != nil {
+					return nil, nil, err
+				}
+				var id [negentropyIDSize]byte
+				copy(id[:], raw)
+				theirs[id] = true
+			}
+			for _, item := range n.items[lower:upper] {
+				if theirs[item.id] {
+					delete(theirs, item.id)
+					n.matched++
+				}
+			}
+			for id := range theirs {
+				need = append(need, hex.EncodeToString(id[:]))
+			}
+			skip = true
+
+		default:
+			return nil, nil, fmt.Errorf("unexpected negentropy mode %d", mode)
+		}
+
+		prevIndex = upper
+		prevBound = currBound
+	}
+
+	if len(out) == 1 {
+		return nil, need, nil
+	}
+	return out, need, nil
+}
+
+// splitRange describes items[lower:upper] to the relay: small ranges as ID
+// lists, larger ones as fingerprinted buckets
+func (n *negentropy) splitRange(out []byte, lower, upper int, upperBound negBound) []byte {
+	count := upper - lower
+	if count < negentropyBuckets*2 {
+		out = n.encodeBound(out, upperBound)
+		out = appendVarint(out, negModeIDList)
+		out = appendVarint(out, uint64(count))
+		for _, item := range n.items[lower:upper] {
+			out = append(out, item.id[:]...)
+		}
+		return out
+	}
+
+	perBucket := count / negentropyBuckets
+	withExtra := count % negentropyBuckets
+	curr := lower
+	for i := 0; i < negentropyBuckets; i++ {
+		size := perBucket
+		if i < withExtra {
+			size++
+		}
+		fp := n.fingerprint(curr, curr+size)
+		curr += size
+
+		next := upperBound
+		if curr != upper {
+			next = minimalBound(n.items[curr-1], n.items[curr])
+		}
+		out = n.encodeBound(out, next)
+		out = appendVarint(out, negModeFingerprint)
+		out = append(out, fp[:]...)
+	}
+	return out
+}
+
+// minimalBound is the shortest bound that sorts after prev and not after curr
+func minimalBound(prev, curr negItem) negBound {
+	if curr.timestamp != prev.timestamp {
+		return negBound{timestamp: curr.timestamp}
+	}
+	shared := 0
+	for shared < negentropyIDSize && curr.id[shared] == prev.id[shared] {
+		shared++
+	}
+	return negBound{timestamp: curr.timestamp, idPrefix: append([]byte(nil), curr.id[:shared+1]...)}
+}
+
+// findLowerBound returns the first index in [begin, end) not below bound
+func (n *negentropy) findLowerBound(begin, end int, bound negBound) int {
+	return begin + sort.Search(end-begin, func(i int) bool {
+		item := n.items[begin+i]
+		if item.timestamp != bound.timestamp {
+			return item.timestamp > bound.timestamp
+		}
+		return bytes.Compare(item.id[:], bound.idPrefix) >= 0
+	})
+}
+
+// fingerprint hashes items[lower:upper]: the IDs summed as little-endian
+// 256-bit integers, followed by the count
+func (n *negentropy) fingerprint(lower, upper int) [negentropyFingerprintSize]byte {
+	var sum [negentropyIDSize]byte
+	for _, item := range n.items[lower:upper] {
+		carry := 0
+		for i := 0; i < negentropyIDSize; i++ {
+			v := int(sum[i]) + int(item.id[i]) + carry
+			sum[i] = byte(v)
+			carry = v >> 8
+		}
+	}
+
+	h := sha256.Sum256(appendVarint(sum[:], uint64(upper-lower)))
+	var fp [negentropyFingerprintSize]byte
+	copy(fp[:], h[:negentropyFingerprintSize])
+	return fp
+}
+
+// encodeBound appends a bound; timestamps are deltas from the previous
+// bound in the message, plus one, with 0 meaning infinity
+func (n *negentropy) encodeBound(out []byte, bound negBound) []byte {
+	if bound.timestamp == negentropyMaxTimestamp {
+		n.lastTimestampOut = negentropyMaxTimestamp
+		out = appendVarint(out, 0)
+	} else {
+		delta := bound.timestamp - n.lastTimestampOut
+		n.lastTimestampOut = bound.timestamp
+		out = appendVarint(out, delta+1)
+	}
+	out = appendVarint(out, uint64(len(bound.idPrefix)))
+	return append(out, bound.idPrefix...)
+}
+
+func (n *negentropy) decodeBound(in *negReader) (negBound, error) {
+	encoded, err := in.varint()
+	if err != nil {
+		return negBound{}, err
+	}
+
+	timestamp := uint64(negentropyMaxTimestamp)
+	if encoded != 0 {
+		timestamp = encoded - 1
+	}
+	if n.lastTimestampIn == negentropyMaxTimestamp || timestamp == negentropyMaxTimestamp {
+		timestamp = negentropyMaxTimestamp
+	} else {
+		timestamp += n.lastTimestampIn
+	}
+	n.lastTimestampIn = timestamp
+
+	length, err := in.varint()
+	if err != nil {
+		return negBound{}, err
+	}
+	if length > negentropyIDSize {
+		return negBound{}, errors.New("negentropy bound prefix too long")
+	}
+	prefix, err := in.bytes(int(length))
+	if err != nil {
+		return negBound{}, err
+	}
+	return negBound{timestamp: timestamp, idPrefix: prefix}, nil
+}
+
+// appendVarint appends n as a big-endian base-128 varint
+func appendVarint(out []byte, n uint64) []byte {
+	var digits [10]byte
+	i := len(digits) - 1
+	digits[i] = byte(n & 0x7f)
+	for n >>= 7; n != 0; n >>= 7 {
+		i--
+		digits[i] = byte(n&0x7f) | 0x80
+	}
+	return append(out, digits[i:]...)
+}
+
+// negReader decodes a negentropy message
+type negReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *negReader) empty() bool {
+	return r.pos >= len(r.buf)
+}
+
+func (r *negReader) byte() (byte, error) {
+	if r.empty() {
+		return 0, errors.New("negentropy message truncated")
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *negReader) bytes(n int) ([]byte, error) {
+	if n < 0 || len(r.buf)-r.pos < n {
+		return nil, errors.New("negentropy message truncated")
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *negReader) varint() (uint64, error) {
+	var n uint64
+	for i := 0; i < 10; i++ {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		n = n<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			return n, nil
+		}
+	}
+	return 0, errors.New("negentropy varint too long")
+}
@@ -8,7 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/url"
 	"strings"
 	"sync"
@@ -72,11 +72,15 @@ func (s *BunkerSession) checkSignRateLimit() error {
 type BunkerSessionStore struct {
 	sessions map[string]*BunkerSession
 	mu       sync.RWMutex
+
+	done     chan struct{} // Closed by StopCleanup
+	stopOnce sync.Once
 }
 
 // Global session store
 var bunkerSessions = &BunkerSessionStore{
 	sessions: make(map[string]*BunkerSession),
+	done:     make(chan struct{}),
 }
 
 // Session cleanup interval
@@ -87,8 +91,14 @@ func init() {
 	// Uses sessionMaxAge from html_auth.go (24 hours)
 	go func() {
 		ticker := time.NewTicker(sessionCleanupInterval)
-		for range ticker.C {
-			bunkerSessions.CleanupExpired(sessionMaxAge)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				bunkerSessions.CleanupExpired(sessionMaxAge)
+			case <-bunkerSessions.done:
+				return
+			}
 		}
 	}()
 }
@@ -223,7 +233,7 @@ func (s *BunkerSession) Connect(ctx context.Context) error {
 	s.UserPubKey = userPubKey
 	s.Connected = true
 
-	log.Printf("NIP-46: Connected to bunker, user pubkey: %s", userPubKeyHex)
+	slog.Info("NIP-46: connected to bunker", "pubkey", userPubKeyHex)
 
 	// Fetch user's NIP-65 relay list in background
 	go func() {
@@ -301,15 +311,18 @@ func (s *BunkerSession) sendRequest(ctx context.Context, method string, params [
 	requestEvent := createNIP46Event(s.ClientPrivKey, s.ClientPubKey, s.RemoteSignerPubKey, encryptedContent)
 
 	// Try each relay until we get a response
+	start := time.Now()
 	for _, relay := range s.Relays {
 		result, err := s.sendToRelay(ctx, relay, requestEvent, reqID)
 		if err != nil {
-			log.Printf("NIP-46: Relay %s failed: %v", relay, err)
+			slog.Warn("NIP-46: relay failed", "relay", relay, "error", err)
 			continue
 		}
+		bunkerRequestDuration.ObserveSince(start, method, "ok")
 		return result, nil
 	}
 
+	bunkerRequestDuration.ObserveSince(start, method, "error")
 	return "", errors.New("all relays failed")
 }
 
@@ -384,13 +397,13 @@ func (s *BunkerSession) sendToRelay(ctx context.Context, relayURL string, event
 				// Decrypt response
 				decrypted, err := Nip44Decrypt(responseEvent.Content, s.ConversationKey)
 				if err != nil {
-					log.Printf("NIP-46: Failed to decrypt response: %v", err)
+					slog.Warn("NIP-46: failed to decrypt response", "error", err)
 					continue
 				}
 
 				var response NIP46Response
 				if err := json.Unmarshal([]byte(decrypted), &response); err != nil {
-					log.Printf("NIP-46: Failed to parse response: %v", err)
+					slog.Warn("NIP-46: failed to parse response", "error", err)
 					continue
 				}
 
@@ -411,7 +424,7 @@ func (s *BunkerSession) sendToRelay(ctx context.Context, relayURL string, event
 
 			case "NOTICE":
 				if len(msg) >= 2 {
-					log.Printf("NIP-46: Relay notice: %v", msg[1])
+					slog.Info("NIP-46: relay notice", "notice", msg[1])
 				}
 			}
 		}
@@ -455,25 +468,25 @@ func calculateEventID(event *Event) string {
 
 func signEvent(privKeyBytes []byte, eventID string) string {
 	if len(privKeyBytes) == 0 {
-		log.Printf("Failed to sign event: empty private key")
+		slog.Error("Failed to sign event: empty private key")
 		return ""
 	}
 
 	privKey, _ := btcec.PrivKeyFromBytes(privKeyBytes)
 	if privKey == nil {
-		log.Printf("Failed to sign event: invalid private key")
+		slog.Error("Failed to sign event: invalid private key")
 		return ""
 	}
 
 	eventIDBytes, err := hex.DecodeString(eventID)
 	if err != nil {
-		log.Printf("Failed to sign event: invalid event ID hex: %v", err)
+		slog.Error("Failed to sign event: invalid event ID hex", "error", err)
 		return ""
 	}
 
 	sig, err := schnorr.Sign(privKey, eventIDBytes)
 	if err != nil {
-		log.Printf("Failed to sign event: %v", err)
+		slog.Error("Failed to sign event", "error", err)
 		return ""
 	}
 
@@ -515,6 +528,18 @@ func (store *BunkerSessionStore) Delete(sessionID string) {
 	delete(store.sessions, sessionID)
 }
 
+// StopCleanup stops the expired session cleanup goroutine
+func (store *BunkerSessionStore) StopCleanup() {
+	store.stopOnce.Do(func() { close(store.done) })
+}
+
+// Len returns the number of stored sessions
+func (store *BunkerSessionStore) Len() int {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return len(store.sessions)
+}
+
 // CleanupExpired removes sessions older than the given duration
 func (store *BunkerSessionStore) CleanupExpired(maxAge time.Duration) {
 	store.mu.Lock()
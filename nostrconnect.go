@@ -7,7 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/url"
 	"os"
 	"sync"
@@ -92,7 +92,7 @@ func loadOrCreateKeypair() (*ServerKeypair, error) {
 			if decodeErr == nil && len(privKey) == 32 {
 				pubKey, pkErr := GetPublicKey(privKey)
 				if pkErr == nil {
-					log.Printf("NIP-46: Loaded persistent dev keypair: %s", hex.EncodeToString(pubKey))
+					slog.Info("NIP-46: loaded persistent dev keypair", "pubkey", hex.EncodeToString(pubKey))
 					return &ServerKeypair{PrivKey: privKey, PubKey: pubKey}, nil
 				}
 			}
@@ -112,12 +112,12 @@ func loadOrCreateKeypair() (*ServerKeypair, error) {
 	if devMode {
 		// Save for next time
 		if err := os.WriteFile(devKeypairFile, []byte(hex.EncodeToString(privKey)), 0600); err != nil {
-			log.Printf("Warning: failed to save dev keypair: %v", err)
+			slog.Warn("Failed to save dev keypair", "error", err)
 		} else {
-			log.Printf("NIP-46: Created and saved new dev keypair: %s", hex.EncodeToString(pubKey))
+			slog.Info("NIP-46: created and saved new dev keypair", "pubkey", hex.EncodeToString(pubKey))
 		}
 	} else {
-		log.Printf("NIP-46: Generated ephemeral keypair: %s", hex.EncodeToString(pubKey))
+		slog.Info("NIP-46: generated ephemeral keypair", "pubkey", hex.EncodeToString(pubKey))
 	}
 
 	return &ServerKeypair{PrivKey: privKey, PubKey: pubKey}, nil
@@ -166,37 +166,48 @@ func GenerateNostrConnectURL(relays []string) (string, string, error) {
 }
 
 // StartConnectionListener starts listening for signer responses on relays
-func StartConnectionListener(relays []string) {
+// until ctx is cancelled
+func StartConnectionListener(ctx context.Context, relays []string) {
 	kp, err := GetServerKeypair()
 	if err != nil {
-		log.Printf("NIP-46: Failed to get server keypair for listener: %v", err)
+		slog.Error("NIP-46: failed to get server keypair for listener", "error", err)
 		return
 	}
 
 	for _, relay := range relays {
-		go listenForConnections(relay, kp)
+		go listenForConnections(ctx, relay, kp)
 	}
 }
 
-func listenForConnections(relayURL string, kp *ServerKeypair) {
+func listenForConnections(ctx context.Context, relayURL string, kp *ServerKeypair) {
 	for {
-		err := listenOnRelay(relayURL, kp)
+		err := listenOnRelay(ctx, relayURL, kp)
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
-			log.Printf("NIP-46: Relay listener error (%s): %v, reconnecting...", relayURL, err)
+			slog.Warn("NIP-46: relay listener error, reconnecting", "relay", relayURL, "error", err)
+		}
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+			return
 		}
-		time.Sleep(5 * time.Second)
 	}
 }
 
-func listenOnRelay(relayURL string, kp *ServerKeypair) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func listenOnRelay(ctx context.Context, relayURL string, kp *ServerKeypair) error {
+	dialCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	conn, _, err := websocket.DefaultDialer.DialContext(ctx, relayURL, nil)
+	conn, _, err := websocket.DefaultDialer.DialContext(dialCtx, relayURL, nil)
 	if err != nil {
 		return fmt.Errorf("connect failed: %v", err)
 	}
 	defer conn.Close()
+	// Unblock the read loop on shutdown
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
 	// Subscribe to kind 24133 events p-tagged to our pubkey
 	subID := "nc-listener"
@@ -210,7 +221,7 @@ func listenOnRelay(relayURL string, kp *ServerKeypair) error {
 		return fmt.Errorf("subscribe failed: %v", err)
 	}
 
-	log.Printf("NIP-46: Listening for connections on %s", relayURL)
+	slog.Info("NIP-46: listening for connections", "relay", relayURL)
 
 	// Read loop
 	for {
@@ -254,7 +265,7 @@ func handlePotentialConnectResponse(event Event, kp *ServerKeypair) {
 	// Compute conversation key
 	convKey, err := GetConversationKey(kp.PrivKey, remoteSignerPubKey)
 	if err != nil {
-		log.Printf("NIP-46: Failed to compute conversation key: %v", err)
+		slog.Warn("NIP-46: failed to compute conversation key", "error", err)
 		return
 	}
 
@@ -268,7 +279,7 @@ func handlePotentialConnectResponse(event Event, kp *ServerKeypair) {
 	// Parse response
 	var response NIP46Response
 	if err := json.Unmarshal([]byte(decrypted), &response); err != nil {
-		log.Printf("NIP-46: Failed to parse response: %v", err)
+		slog.Warn("NIP-46: failed to parse response", "error", err)
 		return
 	}
 
@@ -285,7 +296,7 @@ func handlePotentialConnectResponse(event Event, kp *ServerKeypair) {
 		return
 	}
 
-	log.Printf("NIP-46: Received connect response for secret %s from %s", response.Result[:8], event.PubKey[:16])
+	slog.Info("NIP-46: received connect response", "secret", response.Result[:8], "signer", shortID(event.PubKey))
 
 	// Update pending connection
 	pending.RemoteSignerPubKey = remoteSignerPubKey
@@ -303,7 +314,7 @@ func fetchUserPubKey(pending *PendingConnection, remoteSignerPubKeyHex string) {
 	// Send get_public_key request
 	reqIDBytes := make([]byte, 8)
 	if _, err := rand.Read(reqIDBytes); err != nil {
-		log.Printf("NIP-46: Failed to generate request ID: %v", err)
+		slog.Error("NIP-46: failed to generate request ID", "error", err)
 		return
 	}
 	reqID := hex.EncodeToString(reqIDBytes)
@@ -317,7 +328,7 @@ func fetchUserPubKey(pending *PendingConnection, remoteSignerPubKeyHex string) {
 	requestJSON, _ := json.Marshal(request)
 	encryptedContent, err := Nip44Encrypt(string(requestJSON), pending.ConversationKey)
 	if err != nil {
-		log.Printf("NIP-46: Failed to encrypt get_public_key request: %v", err)
+		slog.Error("NIP-46: failed to encrypt get_public_key request", "error", err)
 		return
 	}
 
@@ -327,18 +338,18 @@ func fetchUserPubKey(pending *PendingConnection, remoteSignerPubKeyHex string) {
 	for _, relay := range pending.Relays {
 		userPubKey, err := sendAndWaitForResponse(ctx, relay, requestEvent, reqID, pending.ConversationKey, remoteSignerPubKeyHex)
 		if err != nil {
-			log.Printf("NIP-46: get_public_key failed on %s: %v", relay, err)
+			slog.Warn("NIP-46: get_public_key failed", "relay", relay, "error", err)
 			continue
 		}
 
 		userPubKeyBytes, err := hex.DecodeString(userPubKey)
 		if err != nil {
-			log.Printf("NIP-46: Invalid user pubkey: %v", err)
+			slog.Warn("NIP-46: invalid user pubkey", "error", err)
 			continue
 		}
 
 		pending.UserPubKey = userPubKeyBytes
-		log.Printf("NIP-46: Got user pubkey: %s", userPubKey)
+		slog.Info("NIP-46: got user pubkey", "pubkey", userPubKey)
 
 		// Fetch user's NIP-65 relay list in background
 		go func(pubkeyHex string) {
@@ -465,12 +476,6 @@ func CheckConnection(secret string) *BunkerSession {
 	return session
 }
 
-// Default relays for nostrconnect
-var defaultNostrConnectRelays = []string{
-	"wss://relay.nsec.app",
-	"wss://relay.damus.io",
-}
-
 // TryReconnectToSigner attempts to reconnect to an existing approved signer
 // This works when the signer has already approved our server pubkey
 func TryReconnectToSigner(signerPubKeyHex string, relays []string) (*BunkerSession, error) {
@@ -518,13 +523,13 @@ func TryReconnectToSigner(signerPubKeyHex string, relays []string) (*BunkerSessi
 	for _, relay := range relays {
 		userPubKey, err := sendAndWaitForResponse(ctx, relay, requestEvent, reqID, convKey, signerPubKeyHex)
 		if err != nil {
-			log.Printf("NIP-46: reconnect get_public_key failed on %s: %v", relay, err)
+			slog.Warn("NIP-46: reconnect get_public_key failed", "relay", relay, "error", err)
 			continue
 		}
 
 		userPubKeyBytes, err := hex.DecodeString(userPubKey)
 		if err != nil {
-			log.Printf("NIP-46: Invalid user pubkey from reconnect: %v", err)
+			slog.Warn("NIP-46: invalid user pubkey from reconnect", "error", err)
 			continue
 		}
 
@@ -541,7 +546,7 @@ func TryReconnectToSigner(signerPubKeyHex string, relays []string) (*BunkerSessi
 			CreatedAt:          time.Now(),
 		}
 
-		log.Printf("NIP-46: Reconnected to signer %s, user pubkey: %s", signerPubKeyHex[:16], userPubKey)
+		slog.Info("NIP-46: reconnected to signer", "signer", shortID(signerPubKeyHex), "pubkey", userPubKey)
 		return session, nil
 	}
 
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NIP-88 polls. A kind 1068 event asks the question in its content and lists
+// options in tags; votes are kind 1018 responses referencing the poll. Results
+// are tallied when a poll is rendered, counting only the latest response of
+// each pubkey sent before the poll closed.
+
+const (
+	kindPoll         = 1068
+	kindPollResponse = 1018
+)
+
+const (
+	maxPollOptions      = 10
+	maxPollOptionLength = 100
+	maxPollRelays       = 3    // Relays from a poll's relay tags that are asked for responses
+	pollResponseLimit   = 1000 // Responses fetched per poll
+)
+
+// pollDurations are the closing times offered by the compose form, in seconds
+var pollDurations = map[string]int64{
+	"1h": 60 * 60,
+	"1d": 24 * 60 * 60,
+	"3d": 3 * 24 * 60 * 60,
+	"1w": 7 * 24 * 60 * 60,
+}
+
+// PollOption is one answer of a poll and its share of the votes
+type PollOption struct {
+	ID      string
+	Label   string
+	Votes   int
+	Percent int
+	Chosen  bool // The reader's counted response includes this option
+}
+
+// HTMLPoll holds a parsed kind 1068 poll and its results
+type HTMLPoll struct {
+	ID       string
+	Options  []PollOption
+	Multiple bool  // polltype multiplechoice: a response may pick several options
+	EndsAt   int64 // 0 if the poll never closes
+	Ended    bool
+	EndsText string // "Closes ..." or "Closed ..." for display
+	Relays   []string
+	Voters   int
+	Voted    bool // The reader has a counted response
+	// Vote form state for the page the poll is rendered on
+	CanVote   bool
+	CSRFToken string
+	ReturnURL string
+}
+
+// parsePoll reads the options, type, closing time and relays of a poll event.
+// It returns nil when the event has fewer than two options.
+func parsePoll(id string, tags [][]string) *HTMLPoll {
+	poll := &HTMLPoll{ID: id}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "option":
+			if len(tag) < 3 || tag[1] == "" || seen[tag[1]] || len(poll.Options) >= maxPollOptions {
+				continue
+			}
+			seen[tag[1]] = true
+			poll.Options = append(poll.Options, PollOption{ID: tag[1], Label: tag[2]})
+		case "polltype":
+			poll.Multiple = tag[1] == "multiplechoice"
+		case "endsAt":
+			if ts, err := strconv.ParseInt(tag[1], 10, 64); err == nil && ts > 0 {
+				poll.EndsAt = ts
+			}
+		case "relay":
+			if relay, ok := normalizeRelayURL(tag[1]); ok && len(poll.Relays) < maxPollRelays {
+				poll.Relays = append(poll.Relays, relay)
+			}
+		}
+	}
+	if len(poll.Options) < 2 {
+		return nil
+	}
+
+	if poll.EndsAt > 0 {
+		if time.Now().Unix() >= poll.EndsAt {
+			poll.Ended = true
+			poll.EndsText = "Closed " + formatRelativeTime(poll.EndsAt)
+		} else {
+			poll.EndsText = "Closes " + time.Unix(poll.EndsAt, 0).UTC().Format("Jan 2, 2006 15:04 UTC")
+		}
+	}
+	return poll
+}
+
+// responseOptions returns the options a response picks that exist in the
+// poll, in order and without repeats. Single choice polls take the first.
+func (p *HTMLPoll) responseOptions(tags [][]string) []string {
+	var chosen []string
+	for _, tag := range tags {
+		if len(tag) < 2 || tag[0] != "response" || !p.hasOption(tag[1]) {
+			continue
+		}
+		chosen = append(chosen, tag[1])
+		if !p.Multiple {
+			break
+		}
+	}
+	return dedupeStrings(chosen)
+}
+
+func (p *HTMLPoll) hasOption(id string) bool {
+	for _, opt := range p.Options {
+		if opt.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// tally counts responses: one per pubkey, the latest winning, ignoring any
+// sent after the poll closed. reader marks the reader's own choices.
+func (p *HTMLPoll) tally(responses []Event, reader string) {
+	latest := make(map[string]Event)
+	for _, ev := range responses {
+		if ev.Kind != kindPollResponse || !eventReferences(ev, p.ID) {
+			continue
+		}
+		if p.EndsAt > 0 && ev.CreatedAt > p.EndsAt {
+			continue
+		}
+		if prev, ok := latest[ev.PubKey]; ok && (prev.CreatedAt > ev.CreatedAt || (prev.CreatedAt == ev.CreatedAt && prev.ID > ev.ID)) {
+			continue
+		}
+		latest[ev.PubKey] = ev
+	}
+
+	index := make(map[string]int, len(p.Options))
+	for i, opt := range p.Options {
+		index[opt.ID] = i
+	}
+	for pubkey, ev := range latest {
+		chosen := p.responseOptions(ev.Tags)
+		if len(chosen) == 0 {
+			continue
+		}
+		p.Voters++
+		for _, id := range chosen {
+			opt := &p.Options[index[id]]
+			opt.Votes++
+			if pubkey == reader {
+				opt.Chosen = true
+			}
+		}
+		if pubkey == reader {
+			p.Voted = true
+		}
+	}
+
+	if p.Voters > 0 {
+		for i := range p.Options {
+			p.Options[i].Percent = (p.Options[i].Votes*100 + p.Voters/2) / p.Voters
+		}
+	}
+}
+
+// eventReferences reports whether ev has an e tag for id
+func eventReferences(ev Event, id string) bool {
+	for _, tag := range ev.Tags {
+		if len(tag) >= 2 && tag[0] == "e" && tag[1] == id {
+			return true
+		}
+	}
+	return false
+}
+
+// preparePolls fetches the responses to every poll on a page, one query per
+// poll so a busy poll can't crowd out the others, tallies them, and sets up
+// the vote forms. reader is the logged-in user's hex pubkey, or "" for
+// anonymous readers, who only see results. Responses come from the event
+// store unless fresh is set, as it is on the page a voter is sent back to.
+func preparePolls(polls []*HTMLPoll, relays []string, reader, csrfToken, returnURL string, fresh bool) {
+	if len(polls) == 0 {
+		return
+	}
+
+	fetch := fetchEventsFromRelaysCached
+	if fresh {
+		fetch = fetchPollResponsesFresh
+	}
+
+	responses := make([][]Event, len(polls))
+	var wg sync.WaitGroup
+	for i, poll := range polls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i], _ = fetch(dedupeStrings(append(append([]string{}, relays...), poll.Relays...)), Filter{
+				Kinds: []int{kindPollResponse},
+				Tags:  map[string][]string{"e": {poll.ID}},
+				Limit: pollResponseLimit,
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i, poll := range polls {
+		poll.tally(responses[i], reader)
+		poll.CanVote = reader != "" && !poll.Ended && !poll.Voted
+		poll.CSRFToken = csrfToken
+		poll.ReturnURL = returnURL
+	}
+}
+
+// fetchPollResponsesFresh asks relays directly so a vote shows up on the page
+// the voter is sent back to, and stores the answer for later renders
+func fetchPollResponsesFresh(relays []string, filter Filter) ([]Event, bool) {
+	events, eose := fetchEventsFromRelays(relays, filter)
+	recordFetch(coverageKey(relays, filter), filter, events, eose)
+	return events, eose
+}
+
+// collectPolls returns the polls among items
+func collectPolls(items []HTMLEventItem) []*HTMLPoll {
+	var polls []*HTMLPoll
+	for i := range items {
+		if items[i].Poll != nil {
+			polls = append(polls, items[i].Poll)
+		}
+	}
+	return polls
+}
+
+// pollTagsFromForm builds the tags of a new poll from the compose form's
+// poll fields. The closing time counts from createdAt, so scheduled polls
+// run for the chosen duration after they're published. It returns nil tags
+// when no options were entered; errors are shown to the user as they are.
+func pollTagsFromForm(r *http.Request, relays []string, createdAt int64) ([][]string, error) {
+	var labels []string
+	for _, line := range strings.Split(r.FormValue("poll_options"), "\n") {
+		if label := strings.TrimSpace(line); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	labels = dedupeStrings(labels)
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	if len(labels) < 2 {
+		return nil, errors.New("A poll needs at least two options")
+	}
+	if len(labels) > maxPollOptions {
+		return nil, fmt.Errorf("A poll can have at most %d options", maxPollOptions)
+	}
+
+	tags := make([][]string, 0, len(labels)+len(relays)+2)
+	for _, label := range labels {
+		if runes := []rune(label); len(runes) > maxPollOptionLength {
+			label = string(runes[:maxPollOptionLength])
+		}
+		tags = append(tags, []string{"option", randomString(9), label})
+	}
+	pollType := "singlechoice"
+	if r.FormValue("poll_multiple") == "1" {
+		pollType = "multiplechoice"
+	}
+	tags = append(tags, []string{"polltype", pollType})
+	if duration, ok := pollDurations[r.FormValue("poll_ends")]; ok {
+		tags = append(tags, []string{"endsAt", strconv.FormatInt(createdAt+duration, 10)})
+	}
+	// Responses are looked for on the relays the poll is published to
+	for _, relay := range relays {
+		tags = append(tags, []string{"relay", relay})
+	}
+	return tags, nil
+}
+
+// htmlPollVoteHandler signs and publishes a kind 1018 response to a poll
+func htmlPollVoteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/html/timeline?kinds=1&limit=20", http.StatusSeeOther)
+		return
+	}
+
+	session := getSessionFromRequest(r)
+	if session == nil || !session.Connected {
+		http.Redirect(w, r, "/html/login?error=Please+login+first", http.StatusSeeOther)
+		return
+	}
+
+	if !validateCSRFToken(session.ID, r.FormValue("csrf_token")) {
+		http.Error(w, "Invalid or expired CSRF token", http.StatusForbidden)
+		return
+	}
+
+	returnURL := sanitizeReturnURL(strings.TrimSpace(r.FormValue("return_url")))
+	separator := "?"
+	if strings.Contains(returnURL, "?") {
+		separator = "&"
+	}
+	fail := func(msg string) {
+		http.Redirect(w, r, returnURL+separator+"error="+escapeURLParam(msg), http.StatusSeeOther)
+	}
+
+	pollID := strings.TrimSpace(r.FormValue("poll_id"))
+	if !isValidEventID(pollID) {
+		fail("Invalid poll")
+		return
+	}
+
+	// Options and closing time come from the poll itself, not the form
+	readRelays, writeRelays := sessionRelays(session)
+	events, _ := fetchEventsFromRelaysCached(readRelays, Filter{IDs: []string{pollID}, Kinds: []int{kindPoll}, Limit: 1})
+	if len(events) == 0 {
+		fail("Poll not found")
+		return
+	}
+	poll := parsePoll(pollID, events[0].Tags)
+	if poll == nil {
+		fail("Poll not found")
+		return
+	}
+	if poll.Ended {
+		fail("This poll has closed")
+		return
+	}
+
+	var responseTags [][]string
+	for _, option := range r.Form["option"] {
+		responseTags = append(responseTags, []string{"response", option})
+	}
+	chosen := poll.responseOptions(responseTags)
+	if len(chosen) == 0 {
+		fail("Choose an option to vote")
+		return
+	}
+
+	tags := [][]string{{"e", pollID}}
+	for _, option := range chosen {
+		tags = append(tags, []string{"response", option})
+	}
+	event := UnsignedEvent{
+		Kind:      kindPollResponse,
+		Content:   "",
+		Tags:      tags,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Sign)
+	defer cancel()
+
+	signedEvent, err := session.SignEvent(ctx, event)
+	if err != nil {
+		slog.Warn("Failed to sign poll response", "poll", shortID(pollID), "error", err)
+		fail(sanitizeErrorForUser("Sign event", err))
+		return
+	}
+
+	publishEvent(ctx, dedupeStrings(append(append([]string{}, writeRelays...), poll.Relays...)), signedEvent)
+
+	slog.Info("Published poll response", "poll", shortID(pollID), "voter", shortID(hex.EncodeToString(session.UserPubKey)), "options", len(chosen))
+	// voted makes the page skip the event store so the new vote is counted
+	http.Redirect(w, r, returnURL+separator+"success=Vote+recorded&voted=1", http.StatusSeeOther)
+}
+
+// htmlPollTemplate renders a poll: a vote form for readers who can vote,
+// results for everyone else. It's added to the timeline and thread templates,
+// which call "poll" with an *HTMLPoll and include "poll-style" in their CSS.
+var htmlPollTemplate = `{{define "poll"}}
+        <div class="poll">
+          {{if .CanVote}}
+          <form method="POST" action="/html/poll/vote" class="poll-form">
+            <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+            <input type="hidden" name="poll_id" value="{{.ID}}">
+            <input type="hidden" name="return_url" value="{{.ReturnURL}}">
+            {{$multiple := .Multiple}}
+            {{range .Options}}
+            <label class="poll-choice"><input type="{{if $multiple}}checkbox{{else}}radio{{end}}" name="option" value="{{.ID}}"{{if not $multiple}} required{{end}}> {{.Label}}</label>
+            {{end}}
+            <button type="submit">Vote</button>
+          </form>
+          {{else}}
+          {{range .Options}}
+          <div class="poll-result{{if .Chosen}} chosen{{end}}">
+            <div class="poll-result-label"><span>{{.Label}}{{if .Chosen}} ✓{{end}}</span><span>{{.Percent}}%</span></div>
+            <progress max="100" value="{{.Percent}}" aria-label="{{.Label}}: {{.Votes}} votes">{{.Percent}}%</progress>
+          </div>
+          {{end}}
+          {{end}}
+          <div class="poll-meta">{{if .Multiple}}Multiple choice · {{end}}{{.Voters}} {{if eq .Voters 1}}vote{{else}}votes{{end}}{{if .EndsText}} · {{.EndsText}}{{end}}</div>
+        </div>
+{{end}}{{define "poll-style"}}
+    /* Poll (kind 1068) styles */
+    .poll { margin: 10px 0; padding: 12px; border: 1px solid var(--border-color); border-radius: 8px; background: var(--bg-secondary); }
+    .poll-form { display: flex; flex-direction: column; gap: 8px; }
+    .poll-choice { display: flex; align-items: center; gap: 8px; cursor: pointer; }
+    .poll-form button { align-self: flex-start; }
+    .poll-result { margin-bottom: 8px; }
+    .poll-result-label { display: flex; justify-content: space-between; gap: 8px; font-size: 14px; }
+    .poll-result.chosen .poll-result-label { font-weight: 600; }
+    .poll-result progress { width: 100%; height: 8px; accent-color: var(--accent); }
+    .poll-meta { font-size: 12px; color: var(--text-muted); margin-top: 4px; }
+{{end}}`
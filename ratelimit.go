@@ -0,0 +1,254 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Per-client token buckets for public instances. Logged-in users are keyed
+// by session, everyone else by IP. Limits come from the config on every
+// call, so a SIGHUP reload applies to existing buckets.
+
+// RateLimiter holds one token bucket per client key
+type RateLimiter struct {
+	name  string
+	limit func() RateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+
+	rejected atomic.Int64
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   []*RateLimiter
+)
+
+// NewRateLimiter creates a limiter that reads its rate from limit
+func NewRateLimiter(name string, limit func() RateLimit) *RateLimiter {
+	l := &RateLimiter{
+		name:      name,
+		limit:     limit,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+	rateLimitersMu.Lock()
+	rateLimiters = append(rateLimiters, l)
+	rateLimitersMu.Unlock()
+	return l
+}
+
+var (
+	readLimiter    = NewRateLimiter("read", func() RateLimit { return currentConfig().RateLimits.Read })
+	relayLimiter   = NewRateLimiter("custom_relays", func() RateLimit { return currentConfig().RateLimits.CustomRelays })
+	previewLimiter = NewRateLimiter("link_previews", func() RateLimit { return currentConfig().RateLimits.LinkPreviews })
+	imageLimiter   = NewRateLimiter("images", func() RateLimit { return currentConfig().RateLimits.Images })
+)
+
+// Take removes up to n tokens from key's bucket and returns how many it got.
+// When it got fewer than n, retryAfter is how long until the next token.
+func (l *RateLimiter) Take(key string, n int) (granted int, retryAfter time.Duration) {
+	return l.take(key, n, true)
+}
+
+// AllowN takes n tokens only if all n are available
+func (l *RateLimiter) AllowN(key string, n int) (bool, time.Duration) {
+	granted, retryAfter := l.take(key, n, false)
+	return granted == n, retryAfter
+}
+
+// Allow takes one token, reporting whether the client may proceed
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	return l.AllowN(key, 1)
+}
+
+func (l *RateLimiter) take(key string, n int, partial bool) (granted int, retryAfter time.Duration) {
+	limit := l.limit()
+	if limit.PerMinute <= 0 || n <= 0 {
+		return n, 0
+	}
+	perSecond := limit.PerMinute / 60
+	burst := float64(limit.Burst)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now, perSecond, burst)
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*perSecond)
+	b.updated = now
+
+	granted = min(n, int(b.tokens))
+	if granted < n && !partial {
+		granted = 0
+	}
+	b.tokens -= float64(granted)
+	if granted < n {
+		l.rejected.Add(int64(n - granted))
+		// Time until enough tokens for the whole request (or one, if partial)
+		want := 1.0
+		if !partial {
+			want = math.Min(float64(n), burst)
+		}
+		retryAfter = time.Duration((want - b.tokens) / perSecond * float64(time.Second))
+	}
+	return granted, retryAfter
+}
+
+// sweep drops buckets that have refilled, at most once a minute (must hold lock)
+func (l *RateLimiter) sweep(now time.Time, perSecond, burst float64) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*perSecond >= burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// clientKey identifies the client a request is charged to
+func clientKey(r *http.Request) string {
+	if session := getSessionFromRequest(r); session != nil {
+		return "session:" + session.ID
+	}
+	return "ip:" + clientIP(r)
+}
+
+// clientIP returns the request's client address. Behind a trusted proxy the
+// rightmost X-Forwarded-For entry is used, since that's the one our proxy added.
+func clientIP(r *http.Request) string {
+	if currentConfig().TrustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeRateLimited sends a 429 with a Retry-After in whole seconds
+func writeRateLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	http.Error(w, "Too many requests, please slow down", http.StatusTooManyRequests)
+}
+
+// rateLimitReads charges GET and HEAD requests to the client's read bucket.
+// Static files, health checks, metrics and admin endpoints aren't limited,
+// nor is /img (a page has many images; misses are charged to imageLimiter).
+// POSTs are covered by the per-session signing limit.
+func rateLimitReads(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			path := r.URL.Path
+			exempt := strings.HasPrefix(path, "/static/") || strings.HasPrefix(path, "/admin/") ||
+				path == "/health" || path == "/metrics" || path == "/favicon.ico" || path == "/img"
+			if !exempt {
+				if ok, retryAfter := readLimiter.Allow(clientKey(r)); !ok {
+					writeRateLimited(w, retryAfter)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseRequestRelays reads the ?relays= parameter. It rejects requests that
+// name more than limits.max_relays_per_request relays and charges relays
+// outside the configured sets (and the user's own relay list) to the
+// client's custom relay bucket. On failure it writes the response and
+// returns false. An empty result means the caller should use its defaults.
+func parseRequestRelays(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var relays []string
+	for _, relay := range parseStringList(r.URL.Query().Get("relays")) {
+		if relay = strings.TrimSpace(relay); relay != "" {
+			relays = append(relays, relay)
+		}
+	}
+	relays = dedupeStrings(relays)
+	if len(relays) == 0 {
+		return nil, true
+	}
+
+	maxRelays := currentConfig().Limits.MaxRelaysPerRequest
+	if len(relays) > maxRelays {
+		http.Error(w, "Too many relays (at most "+strconv.Itoa(maxRelays)+")", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if !chargeCustomRelays(w, r, relays) {
+		return nil, false
+	}
+	return relays, true
+}
+
+// chargeCustomRelays charges the relays in a request that are neither
+// configured nor in the user's own relay list to the client's custom relay
+// bucket. When the bucket is empty it writes the response and returns false.
+func chargeCustomRelays(w http.ResponseWriter, r *http.Request, relays []string) bool {
+	known := make(map[string]bool)
+	session := getSessionFromRequest(r)
+	if session != nil {
+		read, write := sessionRelays(session)
+		for _, relay := range append(read, write...) {
+			if u, ok := normalizeRelayURL(relay); ok {
+				known[u] = true
+			}
+		}
+	}
+	custom := 0
+	for _, relay := range relays {
+		u, ok := normalizeRelayURL(relay)
+		if !ok || !(known[u] || isConfiguredRelay(u)) {
+			custom++
+		}
+	}
+	if custom > 0 {
+		if ok, retryAfter := relayLimiter.AllowN(clientKey(r), custom); !ok {
+			writeRateLimited(w, retryAfter)
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	registerCollector(func(pw *promWriter) {
+		rateLimitersMu.Lock()
+		limiters := append([]*RateLimiter{}, rateLimiters...)
+		rateLimitersMu.Unlock()
+
+		pw.header("nostr_rate_limited_total", "Requests or fetches refused by a per-client rate limit.", "counter")
+		for _, l := range limiters {
+			pw.sample("nostr_rate_limited_total", float64(l.rejected.Load()), "limiter", l.name)
+		}
+	})
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// The reaction picker on react forms (common emoji, the user's recently used
+// reactions and their NIP-30 emoji list), and the /html/reactions/{id} page
+// listing who reacted to or reposted a note.
+
+// commonReactions are always offered by the reaction picker
+var commonReactions = []string{"❤️", "👍", "😂", "🔥", "🤙", "👀", "😢", "🫂"}
+
+const (
+	maxRecentReactions        = 8   // Recently used reactions offered by the picker
+	recentReactionsFetchLimit = 100 // Own kind 7 events scanned for recent reactions
+	maxReactionLength         = 64  // Longest reaction content accepted from the form
+	reactionsPageLimit        = 50  // Default entries per reactions page
+	reactionsPageMaxLimit     = 100
+)
+
+// ReactionPicker holds the choices offered by a react form
+type ReactionPicker struct {
+	Common []string
+	Recent []string      // Recently used reactions not already in Common
+	Emojis []CustomEmoji // The user's NIP-30 emoji list
+}
+
+// reactionPicker returns the reaction choices for a logged-in user, or nil
+func reactionPicker(session *BunkerSession) *ReactionPicker {
+	if session == nil || !session.Connected {
+		return nil
+	}
+	picker := &ReactionPicker{Common: commonReactions}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		picker.Recent = recentReactions(session)
+	}()
+	go func() {
+		defer wg.Done()
+		picker.Emojis = userEmojis(session)
+	}()
+	wg.Wait()
+	return picker
+}
+
+// normalizeReaction maps the NIP-25 like ("+" or empty) to ❤️
+func normalizeReaction(reaction string) string {
+	if reaction == "" || reaction == "+" {
+		return "❤️"
+	}
+	return reaction
+}
+
+// isCommonReaction reports whether the picker always offers a reaction
+func isCommonReaction(reaction string) bool {
+	for _, r := range commonReactions {
+		if r == reaction {
+			return true
+		}
+	}
+	return false
+}
+
+// RecentReactionCache stores the reactions each user used lately
+type RecentReactionCache struct {
+	reactions *BoundedCache[*cachedRecentReactions]
+	ttl       time.Duration
+}
+
+type cachedRecentReactions struct {
+	reactions []string
+	fetchedAt time.Time
+}
+
+// Global recent reaction cache - 10 minute TTL, kept current by Remember
+var recentReactionCache = &RecentReactionCache{
+	reactions: NewBoundedCache("recent_reactions", cacheBudget("CACHE_RECENT_REACTIONS_MB", 2), func(pubkey string, c *cachedRecentReactions) int64 {
+		return int64(entryOverhead+len(pubkey)) + stringsSize(c.reactions)
+	}),
+	ttl: 10 * time.Minute,
+}
+
+// Get retrieves a user's recent reactions from cache if not expired
+func (c *RecentReactionCache) Get(pubkey string) ([]string, bool) {
+	cached, ok := c.reactions.Get(pubkey, func(cached *cachedRecentReactions, _ time.Time) bool {
+		return time.Since(cached.fetchedAt) <= c.ttl
+	})
+	if !ok {
+		return nil, false
+	}
+	return cached.reactions, true
+}
+
+// Set stores a user's recent reactions in the cache
+func (c *RecentReactionCache) Set(pubkey string, reactions []string) {
+	c.reactions.Set(pubkey, &cachedRecentReactions{
+		reactions: reactions,
+		fetchedAt: time.Now(),
+	})
+}
+
+// Remember moves a reaction the user just sent to the front of their cached
+// recent reactions, so the picker shows it without refetching
+func (c *RecentReactionCache) Remember(pubkey, reaction string) {
+	if isCommonReaction(reaction) || isCustomEmojiShortcode(reaction) {
+		return
+	}
+	recent, ok := c.Get(pubkey)
+	if !ok {
+		return
+	}
+	updated := []string{reaction}
+	for _, r := range recent {
+		if r != reaction && len(updated) < maxRecentReactions {
+			updated = append(updated, r)
+		}
+	}
+	c.Set(pubkey, updated)
+}
+
+// recentReactions returns the distinct reactions a user sent most recently,
+// leaving out the common ones and custom emoji (offered from the emoji list)
+func recentReactions(session *BunkerSession) []string {
+	pubkey := hex.EncodeToString(session.UserPubKey)
+	if recent, ok := recentReactionCache.Get(pubkey); ok {
+		return recent
+	}
+
+	_, write := sessionRelays(session)
+	relays := dedupeStrings(append(append([]string(nil), write...), defaultReadRelays()...))
+	events, _ := fetchEventsFromRelays(relays, Filter{
+		Authors: []string{pubkey},
+		Kinds:   []int{7},
+		Limit:   recentReactionsFetchLimit,
+	})
+	sortEventsNewestFirst(events)
+
+	seen := make(map[string]bool)
+	var recent []string
+	for _, evt := range events {
+		reaction := normalizeReaction(strings.TrimSpace(evt.Content))
+		if seen[reaction] || isCommonReaction(reaction) || isCustomEmojiShortcode(reaction) ||
+			reaction == "-" || len(reaction) > maxReactionLength {
+			continue
+		}
+		seen[reaction] = true
+		recent = append(recent, reaction)
+		if len(recent) >= maxRecentReactions {
+			break
+		}
+	}
+	recentReactionCache.Set(pubkey, recent)
+	return recent
+}
+
+// htmlReactionPickerTemplate defines the "reaction-picker" block shown next
+// to Like, and its styles. Each choice is a submit button of the react form.
+const htmlReactionPickerTemplate = `{{define "reaction-picker"}}
+{{if .}}
+<details class="reaction-picker">
+  <summary class="text-link" title="More reactions">React</summary>
+  <div class="reaction-picker-choices">
+    {{range .Common}}<button type="submit" name="reaction" value="{{.}}" class="reaction-choice">{{.}}</button>{{end}}
+    {{if .Recent}}<span class="reaction-picker-label">Recent</span>
+    {{range .Recent}}<button type="submit" name="reaction" value="{{.}}" class="reaction-choice">{{.}}</button>{{end}}{{end}}
+    {{if .Emojis}}<span class="reaction-picker-label">Emoji</span>
+    {{range .Emojis}}<button type="submit" name="emoji" value="{{.Shortcode}}" class="reaction-choice" title=":{{.Shortcode}}:"><img class="custom-emoji" src="{{proxyImage .URL 96}}" alt=":{{.Shortcode}}:" loading="lazy"></button>{{end}}{{end}}
+  </div>
+</details>
+{{end}}
+{{end}}
+{{define "reaction-picker-style"}}
+    .reaction-picker {
+      display: inline-block;
+    }
+    .reaction-picker > summary {
+      list-style: none;
+      cursor: pointer;
+    }
+    .reaction-picker > summary::-webkit-details-marker { display: none; }
+    .reaction-picker-choices {
+      display: flex;
+      flex-wrap: wrap;
+      align-items: center;
+      gap: 4px;
+      max-width: 300px;
+      margin-top: 6px;
+      padding: 6px;
+      background: var(--bg-card);
+      border: 1px solid var(--border-color);
+      border-radius: 8px;
+    }
+    .reaction-picker-label {
+      width: 100%;
+      font-size: 11px;
+      color: var(--text-muted);
+    }
+    button[type="submit"].reaction-choice {
+      padding: 2px 4px;
+      margin: 0;
+      background: transparent;
+      border: none;
+      border-radius: 6px;
+      font-size: 18px;
+      line-height: 1.2;
+      cursor: pointer;
+    }
+    button[type="submit"].reaction-choice:hover {
+      background: var(--bg-badge-hover);
+    }
+{{end}}
+`
+
+// HTMLReactionEntry is one reaction or repost on the reactions page
+type HTMLReactionEntry struct {
+	Pubkey    string
+	Npub      string
+	NpubShort string
+	Profile   *ProfileInfo
+	Repost    bool
+	Reaction  string       // Emoji or text reaction
+	Emoji     *CustomEmoji // Set for a NIP-30 custom emoji reaction
+	CreatedAt int64
+}
+
+// HTMLReactionsData is the data for the reactions page
+type HTMLReactionsData struct {
+	HTMLPageChrome
+	EventID     string
+	NoteAuthor  string // Display name of the note's author, if found
+	NotePreview string // Start of the note's content, if found
+	Filter      string // "", "reactions" or "reposts"
+	Entries     []HTMLReactionEntry
+	Pagination  *HTMLPagination
+}
+
+var htmlReactionsTemplate = `{{define "page-style"}}{{template "emoji-style"}}
+    .note-preview { color: var(--text-secondary); font-size: 14px; white-space: pre-wrap; word-break: break-word; }
+    .reactions-filter { display: flex; gap: 8px; margin: 12px 0; }
+    .reactions-filter .active { background: var(--accent); color: white; border-color: var(--accent); }
+    .reaction-entry { display: flex; align-items: center; gap: 10px; padding: 8px 0; border-bottom: 1px solid var(--border-color); }
+    .reaction-entry:last-child { border-bottom: none; }
+    .reaction-entry-value { width: 2.2em; text-align: center; font-size: 20px; flex-shrink: 0; }
+    .reaction-entry-author { flex: 1; color: var(--text-primary); text-decoration: none; font-weight: 500; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+    .reaction-entry-time { color: var(--text-muted); font-size: 12px; }
+{{end}}{{template "page-head" .}}
+    {{template "page-nav" .}}
+    <main>
+      <h2>Reactions</h2>
+      <div class="card">
+        {{if .NotePreview}}
+        <div class="text-sm" style="margin-bottom: 4px;">{{if .NoteAuthor}}{{.NoteAuthor}}{{else}}Note{{end}}</div>
+        <div class="note-preview">{{.NotePreview}}</div>
+        {{end}}
+        <a href="/html/thread/{{.EventID}}" class="text-link text-sm">View thread &rarr;</a>
+      </div>
+      <div class="reactions-filter">
+        <a href="/html/reactions/{{.EventID}}" class="secondary-btn{{if eq .Filter ""}} active{{end}}">All</a>
+        <a href="/html/reactions/{{.EventID}}?type=reactions" class="secondary-btn{{if eq .Filter "reactions"}} active{{end}}">Reactions</a>
+        <a href="/html/reactions/{{.EventID}}?type=reposts" class="secondary-btn{{if eq .Filter "reposts"}} active{{end}}">Reposts</a>
+      </div>
+      {{range .Entries}}
+      <div class="reaction-entry">
+        <span class="reaction-entry-value">{{if .Repost}}🔁{{else if .Emoji}}<img class="custom-emoji" src="{{proxyImage .Emoji.URL 96}}" alt=":{{.Emoji.Shortcode}}:" title=":{{.Emoji.Shortcode}}:" loading="lazy">{{else}}{{.Reaction}}{{end}}</span>
+        <a href="/html/profile/{{.Npub}}" class="reaction-entry-author">{{if and .Profile (or .Profile.DisplayName .Profile.Name)}}{{if .Profile.DisplayName}}{{.Profile.DisplayName}}{{else}}{{.Profile.Name}}{{end}}{{else}}{{.NpubShort}}{{end}}</a>
+        <span class="reaction-entry-time">{{if .Repost}}reposted{{else}}reacted{{end}} {{formatTime .CreatedAt}}</span>
+      </div>
+      {{else}}
+      <div class="empty-state">
+        <p>No {{if eq .Filter "reposts"}}reposts{{else if eq .Filter "reactions"}}reactions{{else}}reactions or reposts{{end}} found.</p>
+      </div>
+      {{end}}
+      {{if .Pagination}}
+      <div class="pagination">
+        <a href="{{.Pagination.Next}}" class="link">Older &rarr;</a>
+      </div>
+      {{end}}
+    </main>
+    {{template "page-footer" .}}`
+
+var cachedReactionsTemplate *template.Template
+
+// reactionTarget returns the event a reaction or repost is about: the last
+// e tag of a reaction (NIP-25), the first e tag of a repost (NIP-18)
+func reactionTarget(evt Event) string {
+	target := ""
+	for _, tag := range evt.Tags {
+		if len(tag) >= 2 && tag[0] == "e" {
+			if evt.Kind == 6 {
+				return tag[1]
+			}
+			target = tag[1]
+		}
+	}
+	return target
+}
+
+// fetchReactionEvents returns a page of reactions and reposts of an event,
+// newest first, and whether there may be older ones. Reactions fetchReactions
+// already downloaded are served from the event store alongside the relays'.
+func fetchReactionEvents(relays []string, eventID string, kinds []int, limit int, until *int64) ([]Event, bool) {
+	filter := Filter{
+		Kinds: kinds,
+		Tags:  map[string][]string{"e": {eventID}},
+		Limit: limit + 1,
+		Until: until,
+	}
+	fetched, _ := fetchEventsFromRelaysCached(relays, filter)
+	stored := eventStore.Query(filter)
+
+	seen := make(map[string]bool, len(fetched)+len(stored))
+	var events []Event
+	for _, evt := range append(fetched, stored...) {
+		if seen[evt.ID] {
+			continue
+		}
+		seen[evt.ID] = true
+		events = append(events, evt)
+	}
+	sortEventsNewestFirst(events)
+
+	more := len(events) > limit
+	if more {
+		events = events[:limit]
+	}
+	return events, more
+}
+
+// htmlReactionsHandler shows who reacted to and reposted a note:
+// /html/reactions/{eventId}?type=reactions|reposts&until=...
+func htmlReactionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	eventID := strings.TrimPrefix(r.URL.Path, "/html/reactions/")
+	if !isValidEventID(eventID) {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	session := getSessionFromRequest(r)
+	relays, _ := sessionRelays(session)
+
+	filter := q.Get("type")
+	kinds := []int{7, 6}
+	switch filter {
+	case "reactions":
+		kinds = []int{7}
+	case "reposts":
+		kinds = []int{6}
+	default:
+		filter = ""
+	}
+	limit := parseLimit(q.Get("limit"), reactionsPageLimit)
+	if limit > reactionsPageMaxLimit {
+		limit = reactionsPageMaxLimit
+	}
+	until := parseInt64(q.Get("until"))
+
+	var events []Event
+	var more bool
+	var note *Event
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		events, more = fetchReactionEvents(relays, eventID, kinds, limit, until)
+	}()
+	go func() {
+		defer wg.Done()
+		if found, _ := fetchEventsFromRelaysCached(relays, Filter{IDs: []string{eventID}, Limit: 1}); len(found) > 0 {
+			note = &found[0]
+		}
+	}()
+	wg.Wait()
+
+	entries := make([]HTMLReactionEntry, 0, len(events))
+	pubkeys := make([]string, 0, len(events)+1)
+	for _, evt := range events {
+		if reactionTarget(evt) != eventID {
+			continue
+		}
+		npub, _ := encodeBech32Pubkey(evt.PubKey)
+		entry := HTMLReactionEntry{
+			Pubkey:    evt.PubKey,
+			Npub:      npub,
+			NpubShort: formatNpubShort(npub),
+			Repost:    evt.Kind == 6,
+			CreatedAt: evt.CreatedAt,
+		}
+		if !entry.Repost {
+			if emoji, ok := reactionEmoji(evt); ok {
+				entry.Emoji = &emoji
+			} else {
+				// Cut on runes so a long reaction doesn't end mid-character
+				reaction := []rune(evt.Content)
+				if len(reaction) > maxReactionLength {
+					reaction = reaction[:maxReactionLength]
+				}
+				entry.Reaction = normalizeReaction(string(reaction))
+				if !utf8.ValidString(evt.Content) {
+					entry.Reaction = "❤️"
+				}
+			}
+		}
+		entries = append(entries, entry)
+		pubkeys = append(pubkeys, evt.PubKey)
+	}
+	if note != nil {
+		pubkeys = append(pubkeys, note.PubKey)
+	}
+
+	profiles := fetchProfiles(profileRelays(), dedupeStrings(pubkeys))
+	for i := range entries {
+		entries[i].Profile = profiles[entries[i].Pubkey]
+	}
+
+	data := HTMLReactionsData{
+		HTMLPageChrome: newPageChrome("Reactions", r, session, relays),
+		EventID:        eventID,
+		Filter:         filter,
+		Entries:        entries,
+	}
+	if note != nil {
+		preview := []rune(note.Content)
+		if len(preview) > 200 {
+			preview = append(preview[:200], '…')
+		}
+		data.NotePreview = string(preview)
+		if p := profiles[note.PubKey]; p != nil {
+			data.NoteAuthor = p.DisplayName
+			if data.NoteAuthor == "" {
+				data.NoteAuthor = p.Name
+			}
+		}
+	}
+	if more && len(events) > 0 {
+		next := fmt.Sprintf("/html/reactions/%s?until=%d", eventID, events[len(events)-1].CreatedAt)
+		if filter != "" {
+			next += "&type=" + filter
+		}
+		if limit != reactionsPageLimit {
+			next += fmt.Sprintf("&limit=%d", limit)
+		}
+		data.Pagination = &HTMLPagination{Next: next}
+	}
+
+	html, err := executePageTemplate(cachedReactionsTemplate, data)
+	if err != nil {
+		slog.Error("Error rendering reactions", "error", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(html))
+}
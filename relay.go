@@ -5,7 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"sort"
 	"strings"
 	"sync"
@@ -15,7 +15,7 @@ import (
 )
 
 // isCustomEmojiShortcode checks if a reaction is a custom emoji shortcode (:name:)
-// Custom emoji shortcodes can't be rendered as they require image URLs from emoji tags
+// The image comes from the reaction's NIP-30 emoji tag (see reactionEmoji)
 func isCustomEmojiShortcode(reaction string) bool {
 	return len(reaction) >= 3 && strings.HasPrefix(reaction, ":") && strings.HasSuffix(reaction, ":")
 }
@@ -44,6 +44,7 @@ type Filter struct {
 	Since   *int64
 	Until   *int64
 	PTags   []string // Filter by p-tag (events mentioning these pubkeys)
+	Tags    map[string][]string // Other single-letter tag filters, e.g. "k" -> ["5300"] (sent as "#k")
 }
 
 type Event struct {
@@ -106,7 +107,7 @@ func parseEventFromInterface(data interface{}) (Event, bool) {
 
 	// Validate signature if present
 	if evt.Sig != "" && !validateEventSignature(&evt) {
-		log.Printf("Event signature validation failed for event %s", shortID(evt.ID))
+		slog.Warn("Event signature validation failed", "event", shortID(evt.ID))
 		return Event{}, false
 	}
 
@@ -160,30 +161,133 @@ func validateEventSignature(evt *Event) bool {
 }
 
 func fetchEventsFromRelays(relays []string, filter Filter) ([]Event, bool) {
-	return fetchEventsFromRelaysWithTimeout(relays, filter, 1500*time.Millisecond)
+	return fetchEventsFromRelaysWithTimeout(relays, filter, currentConfig().Timeouts.Query)
 }
 
-// fetchEventsFromRelaysCached checks cache first, then fetches from relays
+// fetchEventsFromRelaysCached answers a filter from the event store where it
+// can, and only asks relays for IDs or time ranges the store doesn't cover
 func fetchEventsFromRelaysCached(relays []string, filter Filter) ([]Event, bool) {
-	// Check cache first
-	if events, eose, ok := eventCache.Get(relays, filter); ok {
-		log.Printf("Cache hit for query (limit=%d, authors=%d)", filter.Limit, len(filter.Authors))
+	// ID lookups: serve what's stored, fetch only the missing IDs
+	if len(filter.IDs) > 0 {
+		_, missing := eventStore.GetByIDs(filter.IDs)
+		eventStore.recordLookup(len(missing) < len(filter.IDs), len(missing) > 0 && len(missing) < len(filter.IDs))
+		if len(missing) == 0 {
+			slog.Debug("Cache hit for events by ID", "ids", len(filter.IDs))
+			return eventStore.Query(filter), true
+		}
+		slog.Debug("Cache miss for events by ID", "missing", len(missing), "ids", len(filter.IDs))
+		idFilter := filter
+		idFilter.IDs = missing
+		idFilter.Limit = len(missing)
+		events, eose := fetchEventsFromRelays(relays, idFilter)
+		eventStore.Add(events)
+		return eventStore.Query(filter), eose
+	}
+
+	key := coverageKey(relays, filter)
+	var since int64
+	if filter.Since != nil {
+		since = *filter.Since
+	}
+
+	// Feed-top queries feed the warm-up scheduler's popularity counts
+	if filter.Until == nil {
+		queryWarmer.Observe(relays, filter)
+	}
+
+	low, complete, stale, ok := eventStore.Covered(key, filter)
+	if stale {
+		// Serve what's stored now and bring the window up to date in the background
+		refreshQueryAsync(relays, filter)
+	}
+	if !ok {
+		// Cache miss - fetch from relays
+		eventStore.recordLookup(false, false)
+		slog.Debug("Cache miss for query", "limit", filter.Limit, "authors", len(filter.Authors))
+		events, eose := fetchEventsFromRelays(relays, filter)
+		recordFetch(key, filter, events, eose)
 		return events, eose
 	}
 
-	// Cache miss - fetch from relays
-	log.Printf("Cache miss for query (limit=%d, authors=%d)", filter.Limit, len(filter.Authors))
-	events, eose := fetchEventsFromRelays(relays, filter)
+	// Serve the covered part of the window locally. A fetch that stopped
+	// before EOSE only covered down to its oldest event, so anything older
+	// is fetched as the gap below.
+	covered := filter
+	coveredSince := max(low, since)
+	covered.Since = &coveredSince
+	events := eventStore.Query(covered)
+	if (filter.Limit > 0 && len(events) >= filter.Limit) || low <= since {
+		eventStore.recordLookup(true, false)
+		slog.Debug("Cache hit for query", "limit", filter.Limit, "authors", len(filter.Authors), "stale", stale, "incomplete", !complete)
+		return events, complete
+	}
+
+	// Partial hit - fetch only the older, uncovered part of the window
+	eventStore.recordLookup(true, true)
+	slog.Debug("Partial cache hit for query, fetching older events",
+		"limit", filter.Limit, "authors", len(filter.Authors), "cached", len(events), "until", low)
+	gap := filter
+	gapUntil := low
+	gap.Until = &gapUntil
+	if filter.Limit > 0 {
+		gap.Limit = filter.Limit - len(events)
+	}
+	gapEvents, eose := fetchEventsFromRelays(relays, gap)
+	recordFetch(key, gap, gapEvents, eose)
+	return eventStore.Query(filter), complete && eose
+}
 
-	// Store in cache
-	eventCache.Set(relays, filter, events, eose)
+// recordFetch stores fetched events and marks the window they cover. When the
+// limit was reached, or relays timed out before EOSE, only the span down to
+// the oldest returned event is covered.
+func recordFetch(key string, filter Filter, events []Event, eose bool) {
+	fetchedAt := time.Now()
+	eventStore.Add(events)
 
-	return events, eose
+	until := time.Now().Unix()
+	open := filter.Until == nil
+	if !open {
+		until = *filter.Until
+	}
+	var since int64
+	if filter.Since != nil {
+		since = *filter.Since
+	}
+	if filter.Limit > 0 && len(events) >= filter.Limit {
+		// Other events may share the oldest timestamp, so stop just above it
+		since = events[len(events)-1].CreatedAt + 1
+	} else if !eose {
+		// A short answer without EOSE says nothing about older events, nor
+		// about others sharing the oldest timestamp
+		if len(events) == 0 {
+			return
+		}
+		oldest := events[0].CreatedAt
+		for _, evt := range events[1:] {
+			oldest = min(oldest, evt.CreatedAt)
+		}
+		since = max(since, oldest+1)
+	}
+	eventStore.MarkCovered(key, since, until, open, eose, fetchedAt, getCoverageTTL(filter))
 }
 
+// fetchEventsFromRelaysWithTimeout queries relays, sharing the round-trip with
+// any identical or broader in-flight query
 func fetchEventsFromRelaysWithTimeout(relays []string, filter Filter, timeout time.Duration) ([]Event, bool) {
+	return queryGroup.Do(relays, filter, func() ([]Event, bool) {
+		return fetchEventsFromRelaysDirect(relays, filter, timeout)
+	})
+}
+
+// fetchEventsFromRelaysDirect fans a filter out to relays and collects the results
+func fetchEventsFromRelaysDirect(relays []string, filter Filter, timeout time.Duration) ([]Event, bool) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+	start := time.Now()
+
+	// For large author sets we may already hold most of the answer; relays
+	// that speak negentropy then only send what we're missing
+	plan := planNegentropySync(filter)
 
 	var wg sync.WaitGroup
 	eventChan := make(chan Event, 1000)
@@ -193,7 +297,7 @@ func fetchEventsFromRelaysWithTimeout(relays []string, filter Filter, timeout ti
 		wg.Add(1)
 		go func(relayURL string) {
 			defer wg.Done()
-			fetchFromRelay(ctx, relayURL, filter, eventChan, eoseChan)
+			syncFromRelay(ctx, relayURL, filter, plan, eventChan, eoseChan)
 		}(relay)
 	}
 
@@ -208,7 +312,13 @@ func fetchEventsFromRelaysWithTimeout(relays []string, filter Filter, timeout ti
 	// Wait for at least 2 relays to EOSE before considering timeout
 	seenIDs := make(map[string]bool)
 	events := []Event{}
-	targetCount := filter.Limit * 2 // Collect 2x limit to allow for deduplication
+	if plan != nil {
+		for _, evt := range plan.local {
+			seenIDs[evt.ID] = true
+		}
+		events = append(events, plan.local...)
+	}
+	targetCount := len(events) + filter.Limit*2 // Collect 2x limit to allow for deduplication
 	eoseCount := 0
 	minEOSE := 2
 	if len(relays) < minEOSE {
@@ -217,6 +327,7 @@ func fetchEventsFromRelaysWithTimeout(relays []string, filter Filter, timeout ti
 
 	// Grace period after we have enough EOSEs - collect remaining events briefly
 	var graceTimer <-chan time.Time
+	outcome := "closed" // How collection ended, for the fan-out histogram
 
 collectLoop:
 	for {
@@ -230,31 +341,36 @@ collectLoop:
 				events = append(events, evt)
 				// Early exit once we have enough events
 				if len(events) >= targetCount {
-					log.Printf("Got %d events, returning early", len(events))
+					slog.Debug("Got enough events, returning early", "events", len(events))
 					cancel() // Cancel remaining relay operations
+					outcome = "early"
 					break collectLoop
 				}
 			}
 		case <-eoseChan:
 			eoseCount++
-			log.Printf("EOSE count: %d/%d relays", eoseCount, len(relays))
+			slog.Debug("EOSE received", "eose", eoseCount, "relays", len(relays))
 			// Once we have enough EOSEs, start a short grace period
 			if eoseCount >= minEOSE && graceTimer == nil {
 				graceTimer = time.After(500 * time.Millisecond)
 			}
 			// If all relays sent EOSE, we're done
 			if eoseCount >= len(relays) {
-				log.Printf("All %d relays sent EOSE, got %d events", len(relays), len(events))
+				slog.Debug("All relays sent EOSE", "relays", len(relays), "events", len(events))
+				outcome = "all_eose"
 				break collectLoop
 			}
 		case <-graceTimer:
-			log.Printf("Grace period ended after %d EOSEs, got %d events", eoseCount, len(events))
+			slog.Debug("Grace period ended", "eose", eoseCount, "events", len(events))
+			outcome = "grace"
 			break collectLoop
 		case <-ctx.Done():
-			log.Printf("Context timeout, got %d events (EOSE from %d relays)", len(events), eoseCount)
+			slog.Debug("Query timed out", "events", len(events), "eose", eoseCount)
+			outcome = "timeout"
 			break collectLoop
 		}
 	}
+	relayFanoutDuration.ObserveSince(start, outcome)
 
 	allEOSE := eoseCount == len(relays)
 
@@ -275,34 +391,15 @@ collectLoop:
 }
 
 func fetchFromRelay(ctx context.Context, relayURL string, filter Filter, eventChan chan<- Event, eoseChan chan<- bool) {
-	// Build filter
 	subID := "sub-" + randomString(8)
-	reqFilter := map[string]interface{}{
-		"limit": filter.Limit,
-	}
-	if len(filter.IDs) > 0 {
-		reqFilter["ids"] = filter.IDs
-	}
-	if len(filter.Authors) > 0 {
-		reqFilter["authors"] = filter.Authors
-	}
-	if len(filter.Kinds) > 0 {
-		reqFilter["kinds"] = filter.Kinds
-	}
-	if filter.Since != nil {
-		reqFilter["since"] = *filter.Since
-	}
-	if filter.Until != nil {
-		reqFilter["until"] = *filter.Until
-	}
-	if len(filter.PTags) > 0 {
-		reqFilter["#p"] = filter.PTags
-	}
+	reqFilter := buildReqFilter(filter)
+	reqFilter["limit"] = filter.Limit
 
 	// Subscribe using the pool
+	start := time.Now()
 	sub, err := relayPool.Subscribe(ctx, relayURL, subID, reqFilter)
 	if err != nil {
-		log.Printf("Failed to subscribe to %s: %v", relayURL, err)
+		slog.Warn("Failed to subscribe", "relay", relayURL, "error", err)
 		return
 	}
 	defer relayPool.Unsubscribe(relayURL, sub)
@@ -321,13 +418,43 @@ func fetchFromRelay(ctx context.Context, relayURL string, filter Filter, eventCh
 				return
 			}
 		case <-sub.EOSEChan:
-			log.Printf("Received EOSE from %s", relayURL)
+			slog.Debug("Received EOSE", "relay", relayURL)
+			relayEOSEDuration.ObserveSince(start)
 			eoseChan <- true
 			return
 		}
 	}
 }
 
+// buildReqFilter converts a Filter to its NIP-01 JSON form, without a limit
+func buildReqFilter(filter Filter) map[string]interface{} {
+	reqFilter := map[string]interface{}{}
+	if len(filter.IDs) > 0 {
+		reqFilter["ids"] = filter.IDs
+	}
+	if len(filter.Authors) > 0 {
+		reqFilter["authors"] = filter.Authors
+	}
+	if len(filter.Kinds) > 0 {
+		reqFilter["kinds"] = filter.Kinds
+	}
+	if filter.Since != nil {
+		reqFilter["since"] = *filter.Since
+	}
+	if filter.Until != nil {
+		reqFilter["until"] = *filter.Until
+	}
+	if len(filter.PTags) > 0 {
+		reqFilter["#p"] = filter.PTags
+	}
+	for tagName, values := range filter.Tags {
+		if len(values) > 0 {
+			reqFilter["#"+tagName] = values
+		}
+	}
+	return reqFilter
+}
+
 func randomString(n int) string {
 	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
 	b := make([]byte, n)
@@ -411,25 +538,43 @@ func fetchSingleEvent(ctx context.Context, relayURL string, eventID string, even
 	}
 }
 
-// Specialized relay for profile lookups - has better coverage for kind 0 events
-const profileRelay = "wss://purplepag.es"
-
 // fetchProfiles fetches kind 0 (profile metadata) events for the given pubkeys
 // Uses the global profileCache to avoid redundant relay queries
-// Tries purplepag.es first for faster lookups, falls back to provided relays
+// Tries the configured profile relays first for faster lookups, falls back to provided relays
 func fetchProfiles(relays []string, pubkeys []string) map[string]*ProfileInfo {
 	if len(pubkeys) == 0 {
 		return nil
 	}
 
-	// Check cache first
-	cached, missing := profileCache.GetMultiple(pubkeys)
+	// Check cache first; stale profiles are served now and refreshed in the background
+	cached, missing, stale := profileCache.GetMultiple(pubkeys)
+	if len(stale) > 0 {
+		refreshProfilesAsync(relays, stale)
+	}
 	if len(missing) == 0 {
-		log.Printf("Profile cache hit for all %d pubkeys", len(pubkeys))
+		slog.Debug("Profile cache hit for all pubkeys", "pubkeys", len(pubkeys))
 		return cached
 	}
-	log.Printf("Profile cache: %d hits, %d misses", len(cached), len(missing))
+	slog.Debug("Profile cache lookup", "hits", len(cached), "misses", len(missing))
 
+	// Overlapping batches from concurrent requests share one fetch
+	freshProfiles := fetchProfilesCoalesced(relays, missing)
+
+	// Merge cached and fresh profiles
+	result := make(map[string]*ProfileInfo, len(cached)+len(freshProfiles))
+	for pk, p := range cached {
+		result[pk] = p
+	}
+	for pk, p := range freshProfiles {
+		result[pk] = p
+	}
+
+	return result
+}
+
+// fetchProfilesFromRelays fetches and caches kind 0 profiles for pubkeys,
+// trying the profile relays before the given relays
+func fetchProfilesFromRelays(relays []string, missing []string) map[string]*ProfileInfo {
 	// Build filter for missing profiles
 	filter := Filter{
 		Authors: missing,
@@ -437,10 +582,12 @@ func fetchProfiles(relays []string, pubkeys []string) map[string]*ProfileInfo {
 		Limit:   len(missing),
 	}
 
-	// Try purplepag.es first with a short timeout (specialized profile relay)
+	// Try the profile relays first with a short timeout (specialized for kind 0)
 	var events []Event
-	purpleEvents, _ := fetchEventsFromRelaysWithTimeout([]string{profileRelay}, filter, 1500*time.Millisecond)
-	events = append(events, purpleEvents...)
+	if profileSet := profileRelays(); len(profileSet) > 0 {
+		profileEvents, _ := fetchEventsFromRelaysWithTimeout(profileSet, filter, currentConfig().Timeouts.Query)
+		events = append(events, profileEvents...)
+	}
 
 	// Check which pubkeys we still need
 	foundPubkeys := make(map[string]bool)
@@ -459,7 +606,7 @@ func fetchProfiles(relays []string, pubkeys []string) map[string]*ProfileInfo {
 	}
 
 	if len(stillMissing) > 0 {
-		log.Printf("purplepag.es found %d/%d profiles, falling back to relays for %d", len(foundPubkeys), len(missing), len(stillMissing))
+		slog.Debug("Profile relays found some profiles, falling back to relays", "found", len(foundPubkeys), "wanted", len(missing), "fallback", len(stillMissing))
 		fallbackFilter := Filter{
 			Authors: stillMissing,
 			Kinds:   []int{0},
@@ -468,10 +615,12 @@ func fetchProfiles(relays []string, pubkeys []string) map[string]*ProfileInfo {
 		fallbackEvents, _ := fetchEventsFromRelaysWithTimeout(relays, fallbackFilter, 2000*time.Millisecond)
 		events = append(events, fallbackEvents...)
 	} else {
-		log.Printf("purplepag.es found all %d profiles", len(missing))
+		slog.Debug("Profile relays found all profiles", "profiles", len(missing))
 	}
 
-	// Parse profile content and build map
+	// Parse profile content and build map. Relays answer in any order, so
+	// sort first to make the newest kind 0 per pubkey win.
+	sortEventsNewestFirst(events)
 	freshProfiles := make(map[string]*ProfileInfo)
 	for _, evt := range events {
 		if evt.Kind != 0 {
@@ -510,19 +659,10 @@ func fetchProfiles(relays []string, pubkeys []string) map[string]*ProfileInfo {
 	// Store freshly fetched profiles in cache
 	if len(freshProfiles) > 0 {
 		profileCache.SetMultiple(freshProfiles)
-		log.Printf("Cached %d new profiles", len(freshProfiles))
-	}
-
-	// Merge cached and fresh profiles
-	result := make(map[string]*ProfileInfo, len(cached)+len(freshProfiles))
-	for pk, p := range cached {
-		result[pk] = p
-	}
-	for pk, p := range freshProfiles {
-		result[pk] = p
+		slog.Debug("Cached new profiles", "profiles", len(freshProfiles))
 	}
 
-	return result
+	return freshProfiles
 }
 
 // fetchReactions fetches kind 7 (reaction) events for the given event IDs
@@ -537,8 +677,22 @@ func fetchReactions(relays []string, eventIDs []string) map[string]*ReactionsSum
 		eventIDSet[id] = true
 	}
 
+	// Totals come from NIP-45 COUNT where relays support it, asked alongside
+	// the download below, which is still needed for the per-emoji breakdown
+	var totals map[string]CountResult
+	countDone := make(chan struct{})
+	go func() {
+		defer close(countDone)
+		totals = countByTagValue(relays, []int{7}, "e", eventIDs)
+	}()
+
 	// Fetch reactions referencing the event IDs via #e tag filter
-	events, _ := fetchEventsFromRelaysWithETags(relays, eventIDs)
+	events, _ := fetchReactionEventsCoalesced(relays, eventIDs, 500, func() ([]Event, bool) {
+		events, eose := fetchEventsFromRelaysWithETags(relays, eventIDs)
+		// Keep the reactions for the /html/reactions page, not just the counts
+		eventStore.Add(events)
+		return events, eose
+	})
 
 	// Build reaction summaries per event
 	reactions := make(map[string]*ReactionsSummary)
@@ -581,18 +735,43 @@ func fetchReactions(relays []string, eventIDs []string) map[string]*ReactionsSum
 		if reactionType == "" || reactionType == "+" {
 			reactionType = "❤️"
 		}
-		// Skip custom emoji shortcodes (e.g., :amy:, :turtlehappy_sm:) that can't be rendered
+		// Custom emoji shortcodes (e.g., :amy:, :turtlehappy_sm:) are counted by
+		// image; ones without an emoji tag can't be rendered and are skipped
 		if isCustomEmojiShortcode(reactionType) {
+			if emoji, ok := reactionEmoji(evt); ok {
+				summary.addEmoji(emoji)
+			}
 			continue
 		}
 		summary.ByType[reactionType]++
 	}
 
+	<-countDone
+	for id, total := range totals {
+		if total.Count == 0 {
+			continue
+		}
+		summary, ok := reactions[id]
+		if !ok {
+			summary = &ReactionsSummary{ByType: make(map[string]int)}
+			reactions[id] = summary
+		}
+		if total.Count > summary.Total {
+			summary.Total = total.Count
+		}
+	}
+
 	return reactions
 }
 
 // fetchEventsFromRelaysWithETags fetches reactions referencing specific event IDs
 func fetchEventsFromRelaysWithETags(relays []string, eventIDs []string) ([]Event, bool) {
+	return fetchReactionEventsFromRelays(relays, eventIDs, 500)
+}
+
+// fetchReactionEventsFromRelays fetches up to limit reactions per relay
+// referencing specific event IDs
+func fetchReactionEventsFromRelays(relays []string, eventIDs []string, limit int) ([]Event, bool) {
 	// Longer timeout for reactions - they can be slow to query
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -605,7 +784,7 @@ func fetchEventsFromRelaysWithETags(relays []string, eventIDs []string) ([]Event
 		wg.Add(1)
 		go func(relayURL string) {
 			defer wg.Done()
-			fetchReactionsFromRelay(ctx, relayURL, eventIDs, eventChan, eoseChan)
+			fetchReactionsFromRelay(ctx, relayURL, eventIDs, limit, eventChan, eoseChan)
 		}(relay)
 	}
 
@@ -631,7 +810,7 @@ collectLoop:
 				events = append(events, evt)
 			}
 		case <-ctx.Done():
-			log.Printf("Reactions fetch timeout, got %d events", len(events))
+			slog.Debug("Reactions fetch timed out", "events", len(events))
 			break collectLoop
 		}
 	}
@@ -643,17 +822,17 @@ collectLoop:
 	return events, eoseCount == len(relays)
 }
 
-func fetchReactionsFromRelay(ctx context.Context, relayURL string, eventIDs []string, eventChan chan<- Event, eoseChan chan<- bool) {
+func fetchReactionsFromRelay(ctx context.Context, relayURL string, eventIDs []string, limit int, eventChan chan<- Event, eoseChan chan<- bool) {
 	subID := "react-" + randomString(8)
 	reqFilter := map[string]interface{}{
 		"kinds": []int{7},
 		"#e":    eventIDs,
-		"limit": 500,
+		"limit": limit,
 	}
 
 	sub, err := relayPool.Subscribe(ctx, relayURL, subID, reqFilter)
 	if err != nil {
-		log.Printf("Failed to subscribe to %s for reactions: %v", relayURL, err)
+		slog.Warn("Failed to subscribe for reactions", "relay", relayURL, "error", err)
 		return
 	}
 	defer relayPool.Unsubscribe(relayURL, sub)
@@ -671,7 +850,7 @@ func fetchReactionsFromRelay(ctx context.Context, relayURL string, eventIDs []st
 				return
 			}
 		case <-sub.EOSEChan:
-			log.Printf("Received EOSE from %s", relayURL)
+			slog.Debug("Received EOSE", "relay", relayURL)
 			eoseChan <- true
 			return
 		}
@@ -718,12 +897,12 @@ collectLoop:
 				events = append(events, evt)
 			}
 		case <-ctx.Done():
-			log.Printf("Replies fetch timeout, got %d events", len(events))
+			slog.Debug("Replies fetch timed out", "events", len(events))
 			break collectLoop
 		}
 	}
 
-	log.Printf("Fetched %d replies for thread", len(events))
+	slog.Debug("Fetched replies for thread", "replies", len(events))
 	return events
 }
 
@@ -737,7 +916,7 @@ func fetchRepliesFromRelay(ctx context.Context, relayURL string, eventIDs []stri
 
 	sub, err := relayPool.Subscribe(ctx, relayURL, subID, reqFilter)
 	if err != nil {
-		log.Printf("Failed to subscribe to %s for replies: %v", relayURL, err)
+		slog.Warn("Failed to subscribe for replies", "relay", relayURL, "error", err)
 		return
 	}
 	defer relayPool.Unsubscribe(relayURL, sub)
@@ -755,18 +934,50 @@ func fetchRepliesFromRelay(ctx context.Context, relayURL string, eventIDs []stri
 				return
 			}
 		case <-sub.EOSEChan:
-			log.Printf("Received EOSE for replies from %s", relayURL)
+			slog.Debug("Received EOSE for replies", "relay", relayURL)
 			return
 		}
 	}
 }
 
-// fetchReplyCounts fetches reply counts for the given event IDs
+// fetchReplyCounts fetches reply counts for the given event IDs, using
+// NIP-45 COUNT where relays support it and downloading replies to count the
+// rest
 func fetchReplyCounts(relays []string, eventIDs []string) map[string]int {
 	if len(eventIDs) == 0 {
 		return nil
 	}
 
+	// Both run at once so the page doesn't wait for COUNT before the download
+	var counts map[string]CountResult
+	var downloaded map[string]int
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		counts = countByTagValue(relays, []int{1}, "e", eventIDs)
+	}()
+	go func() {
+		defer wg.Done()
+		downloaded = downloadReplyCounts(relays, eventIDs)
+	}()
+	wg.Wait()
+
+	replyCounts := make(map[string]int)
+	for _, id := range eventIDs {
+		n := downloaded[id]
+		if c, ok := counts[id]; ok {
+			n = c.Count
+		}
+		if n > 0 {
+			replyCounts[id] = n
+		}
+	}
+	return replyCounts
+}
+
+// downloadReplyCounts counts replies by fetching them
+func downloadReplyCounts(relays []string, eventIDs []string) map[string]int {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
@@ -831,32 +1042,36 @@ func fetchRelayList(pubkey string) *RelayList {
 	// Check cache first
 	if relayList, notFound, ok := relayListCache.Get(pubkey); ok {
 		if notFound {
-			log.Printf("Relay list cache hit (not found) for %s", shortID(pubkey))
+			slog.Debug("Relay list cache hit (not found)", "pubkey", shortID(pubkey))
 			return nil
 		}
-		log.Printf("Relay list cache hit for %s", shortID(pubkey))
+		slog.Debug("Relay list cache hit", "pubkey", shortID(pubkey))
 		return relayList
 	}
 
-	// Use well-known indexer relays to find relay lists
-	indexerRelays := []string{
-		"wss://purplepag.es",
-		"wss://relay.nostr.band",
-		"wss://relay.damus.io",
-	}
+	relayList, _ := fetchRelayListFresh(pubkey)
+	return relayList
+}
 
+// fetchRelayListFresh fetches a user's relay list from the indexers, skipping
+// the cache. The bool reports whether enough indexers answered to treat the
+// result as current; callers that modify and republish the list need that.
+func fetchRelayListFresh(pubkey string) (*RelayList, bool) {
 	filter := Filter{
 		Authors: []string{pubkey},
 		Kinds:   []int{10002},
 		Limit:   1,
 	}
 
-	events, _ := fetchEventsFromRelaysWithTimeout(indexerRelays, filter, 2*time.Second)
+	result := fetchReplaceable(indexerRelays(), filter)
+	events := result.Events
 	if len(events) == 0 {
-		log.Printf("No relay list found for %s", shortID(pubkey))
-		// Cache the "not found" result
-		relayListCache.Set(pubkey, nil)
-		return nil
+		slog.Debug("No relay list found", "pubkey", shortID(pubkey))
+		// Only remember "not found" if the indexers actually agreed on it
+		if result.Confident {
+			relayListCache.Set(pubkey, nil)
+		}
+		return nil, result.Confident
 	}
 
 	// Parse the relay list from tags
@@ -888,12 +1103,12 @@ func fetchRelayList(pubkey string) *RelayList {
 		}
 	}
 
-	log.Printf("Found relay list for %s: %d read, %d write relays", shortID(pubkey), len(relayList.Read), len(relayList.Write))
+	slog.Debug("Found relay list", "pubkey", shortID(pubkey), "read", len(relayList.Read), "write", len(relayList.Write))
 
 	// Cache the result
 	relayListCache.Set(pubkey, relayList)
 
-	return relayList
+	return relayList, result.Confident
 }
 
 // fetchContactList fetches a user's kind:3 contact list (who they follow)
@@ -904,9 +1119,9 @@ func fetchContactList(relays []string, pubkey string) []string {
 		Limit:   1,
 	}
 
-	events, _ := fetchEventsFromRelaysWithTimeout(relays, filter, 3*time.Second)
+	events := fetchReplaceable(relays, filter).Events
 	if len(events) == 0 {
-		log.Printf("No contact list found for %s", shortID(pubkey))
+		slog.Debug("No contact list found", "pubkey", shortID(pubkey))
 		return nil
 	}
 
@@ -918,7 +1133,7 @@ func fetchContactList(relays []string, pubkey string) []string {
 		}
 	}
 
-	log.Printf("Found %d contacts for %s", len(contacts), shortID(pubkey))
+	slog.Debug("Found contacts", "contacts", len(contacts), "pubkey", shortID(pubkey))
 	return contacts
 }
 
@@ -1013,7 +1228,7 @@ func fetchNotifications(relays []string, userPubkey string, limit int, until *in
 		notifications = notifications[:limit]
 	}
 
-	log.Printf("Fetched %d notifications for %s", len(notifications), shortID(userPubkey))
+	slog.Debug("Fetched notifications", "notifications", len(notifications), "pubkey", shortID(userPubkey))
 	return notifications
 }
 
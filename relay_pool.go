@@ -3,7 +3,8 @@ package main
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"net"
 	"net/url"
 	"sync"
@@ -134,16 +135,48 @@ type RelayConn struct {
 	mu            sync.Mutex
 	writeMu       sync.Mutex
 	subscriptions map[string]*Subscription
+	negSessions   map[string]*NegSession // NIP-77 reconciliations by subscription ID
+	pendingCounts map[string]chan countReply // NIP-45 COUNT requests awaiting an answer
 	closed        bool
 	lastActivity  time.Time
 }
 
+// RelayHealth records connection outcomes for a relay
+type RelayHealth struct {
+	Connected       bool
+	Attempts        int
+	Failures        int
+	LastError       string
+	LastErrorAt     time.Time
+	LastConnectedAt time.Time
+	ConnectLatency  time.Duration
+}
+
 // RelayPool manages connections to multiple relays
 type RelayPool struct {
 	mu          sync.RWMutex
 	connections map[string]*RelayConn // relayURL -> connection
+
+	healthMu sync.Mutex
+	health   map[string]*RelayHealth // relayURL -> connection stats
+
+	negMu      sync.Mutex
+	negSupport map[string]*negentropySupport // relayURL -> NIP-77 probe result
+
+	countMu          sync.Mutex
+	countUnsupported map[string]time.Time // relayURL -> when to try COUNT again
+	countTimeouts    map[string]int       // relayURL -> COUNT rounds in a row with no answer
+
+	done     chan struct{} // Closed by Shutdown to stop the cleanup loop
+	shutdown bool          // Set by Shutdown; no new connections are opened
 }
 
+// errPoolShutdown is returned for connection attempts after Shutdown
+var errPoolShutdown = errors.New("relay pool shut down")
+
+// errPoolFull is returned when limits.max_pool_connections connections are open
+var errPoolFull = errors.New("relay pool full")
+
 // Global relay pool
 var relayPool = NewRelayPool()
 
@@ -151,6 +184,12 @@ var relayPool = NewRelayPool()
 func NewRelayPool() *RelayPool {
 	pool := &RelayPool{
 		connections: make(map[string]*RelayConn),
+		health:      make(map[string]*RelayHealth),
+		negSupport:  make(map[string]*negentropySupport),
+
+		countUnsupported: make(map[string]time.Time),
+		countTimeouts:    make(map[string]int),
+		done:             make(chan struct{}),
 	}
 	go pool.cleanupLoop()
 	return pool
@@ -180,10 +219,19 @@ func (p *RelayPool) getOrCreateConn(ctx context.Context, relayURL string) (*Rela
 	if rc != nil && !rc.closed {
 		return rc, nil
 	}
+	if p.shutdown {
+		return nil, errPoolShutdown
+	}
+	// Configured relays always get a connection; others share the cap
+	if !isConfiguredRelay(relayURL) && p.openConnections() >= currentConfig().Limits.MaxPoolConnections {
+		return nil, errPoolFull
+	}
 
 	// Create new connection
-	log.Printf("Pool: creating new connection to %s", relayURL)
+	slog.Debug("Pool: creating new connection", "relay", relayURL)
+	dialStart := time.Now()
 	conn, _, err := websocket.DefaultDialer.DialContext(ctx, relayURL, nil)
+	p.recordConnect(relayURL, time.Since(dialStart), err)
 	if err != nil {
 		return nil, err
 	}
@@ -192,6 +240,8 @@ func (p *RelayPool) getOrCreateConn(ctx context.Context, relayURL string) (*Rela
 		conn:          conn,
 		relayURL:      relayURL,
 		subscriptions: make(map[string]*Subscription),
+		negSessions:   make(map[string]*NegSession),
+		pendingCounts: make(map[string]chan countReply),
 		lastActivity:  time.Now(),
 	}
 
@@ -203,15 +253,13 @@ func (p *RelayPool) getOrCreateConn(ctx context.Context, relayURL string) (*Rela
 	return rc, nil
 }
 
-// Subscribe creates a new subscription on the relay
-func (p *RelayPool) Subscribe(ctx context.Context, relayURL string, subID string, filter map[string]interface{}) (*Subscription, error) {
+// openConn returns a live connection to the relay with rc.mu held, so the
+// caller can register a subscription before the connection can close
+func (p *RelayPool) openConn(ctx context.Context, relayURL string) (*RelayConn, error) {
 	const maxRetries = 3
-	var rc *RelayConn
-	var err error
-	var connected bool
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
-		rc, err = p.getOrCreateConn(ctx, relayURL)
+		rc, err := p.getOrCreateConn(ctx, relayURL)
 		if err != nil {
 			return nil, err
 		}
@@ -226,12 +274,17 @@ func (p *RelayPool) Subscribe(ctx context.Context, relayURL string, subID string
 			p.mu.Unlock()
 			continue
 		}
-		connected = true
-		break
+		return rc, nil
 	}
 
-	if !connected {
-		return nil, errors.New("failed to establish connection after retries")
+	return nil, errors.New("failed to establish connection after retries")
+}
+
+// Subscribe creates a new subscription on the relay
+func (p *RelayPool) Subscribe(ctx context.Context, relayURL string, subID string, filter map[string]interface{}) (*Subscription, error) {
+	rc, err := p.openConn(ctx, relayURL)
+	if err != nil {
+		return nil, err
 	}
 
 	sub := &Subscription{
@@ -241,7 +294,7 @@ func (p *RelayPool) Subscribe(ctx context.Context, relayURL string, subID string
 		Done:      make(chan struct{}),
 	}
 
-	// Register subscription (rc.mu is already locked from the loop)
+	// Register subscription (rc.mu is already locked by openConn)
 	rc.subscriptions[subID] = sub
 	rc.mu.Unlock()
 
@@ -312,7 +365,7 @@ func (rc *RelayConn) readLoop() {
 			closed := rc.closed
 			rc.mu.Unlock()
 			if !closed {
-				log.Printf("Pool: read error from %s: %v", rc.relayURL, err)
+				slog.Debug("Pool: read error", "relay", rc.relayURL, "error", err)
 			}
 			return
 		}
@@ -388,21 +441,250 @@ func (rc *RelayConn) readLoop() {
 				if sub != nil {
 					delete(rc.subscriptions, subID)
 				}
+				countCh := rc.pendingCounts[subID]
 				rc.mu.Unlock()
 				if sub != nil {
 					sub.Close()
 				}
+				if countCh != nil {
+					// A COUNT the relay refused
+					reason := "closed"
+					if len(msg) >= 3 {
+						if r, ok := msg[2].(string); ok && r != "" {
+							reason = r
+						}
+					}
+					select {
+					case countCh <- countReply{refused: reason}:
+					default:
+					}
+				}
+			}
+
+		case "COUNT":
+			if len(msg) < 3 {
+				continue
+			}
+			subID, _ := msg[1].(string)
+			body, ok := msg[2].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			count, ok := body["count"].(float64)
+			if !ok {
+				continue
+			}
+			approximate, _ := body["approximate"].(bool)
+
+			rc.mu.Lock()
+			countCh := rc.pendingCounts[subID]
+			rc.mu.Unlock()
+			if countCh != nil {
+				select {
+				case countCh <- countReply{count: int(count), approximate: approximate}:
+				default:
+				}
+			}
+
+		case "NEG-MSG", "NEG-ERR":
+			if len(msg) < 3 {
+				continue
+			}
+			subID, _ := msg[1].(string)
+			payload, _ := msg[2].(string)
+
+			rc.mu.Lock()
+			sess := rc.negSessions[subID]
+			if sess != nil && msgType == "NEG-ERR" {
+				// The relay has already closed its side
+				delete(rc.negSessions, subID)
+			}
+			rc.mu.Unlock()
+
+			if sess != nil {
+				ch := sess.MsgChan
+				if msgType == "NEG-ERR" {
+					ch = sess.ErrChan
+				}
+				select {
+				case ch <- payload:
+				case <-sess.Done:
+				default:
+				}
 			}
 
 		case "NOTICE":
 			if len(msg) >= 2 {
 				notice, _ := msg[1].(string)
-				log.Printf("Pool: NOTICE from %s: %s", rc.relayURL, notice)
+				slog.Info("Pool: NOTICE", "relay", rc.relayURL, "notice", notice)
 			}
 		}
 	}
 }
 
+// NegSession is an open NIP-77 reconciliation on a relay connection
+type NegSession struct {
+	ID        string
+	MsgChan   chan string // Hex payloads of NEG-MSG replies
+	ErrChan   chan string // Reason from NEG-ERR
+	Done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Close safely closes the Done channel exactly once
+func (s *NegSession) Close() {
+	s.closeOnce.Do(func() {
+		close(s.Done)
+	})
+}
+
+// NegOpen starts a negentropy reconciliation for filter with our initial
+// message (hex encoded)
+func (p *RelayPool) NegOpen(ctx context.Context, relayURL string, subID string, filter map[string]interface{}, initialMsg string) (*NegSession, error) {
+	rc, err := p.openConn(ctx, relayURL)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &NegSession{
+		ID:      subID,
+		MsgChan: make(chan string, 4),
+		ErrChan: make(chan string, 1),
+		Done:    make(chan struct{}),
+	}
+	rc.negSessions[subID] = sess
+	rc.mu.Unlock()
+
+	if err := p.writeMessage(rc, []interface{}{"NEG-OPEN", subID, filter, initialMsg}); err != nil {
+		rc.mu.Lock()
+		delete(rc.negSessions, subID)
+		rc.mu.Unlock()
+		rc.markClosed()
+		return nil, err
+	}
+	return sess, nil
+}
+
+// NegSend sends our next reconciliation message (hex encoded)
+func (p *RelayPool) NegSend(relayURL string, sess *NegSession, msg string) error {
+	p.mu.RLock()
+	rc := p.connections[relayURL]
+	p.mu.RUnlock()
+	if rc == nil {
+		return errors.New("connection closed")
+	}
+
+	rc.mu.Lock()
+	_, open := rc.negSessions[sess.ID]
+	open = open && !rc.closed
+	rc.mu.Unlock()
+	if !open {
+		return errors.New("negentropy session closed")
+	}
+	return p.writeMessage(rc, []interface{}{"NEG-MSG", sess.ID, msg})
+}
+
+// NegClose ends a reconciliation, telling the relay unless it already has
+func (p *RelayPool) NegClose(relayURL string, sess *NegSession) {
+	if sess == nil {
+		return
+	}
+
+	p.mu.RLock()
+	rc := p.connections[relayURL]
+	p.mu.RUnlock()
+
+	if rc != nil {
+		rc.mu.Lock()
+		_, exists := rc.negSessions[sess.ID]
+		shouldSendClose := !rc.closed && exists
+		if exists {
+			delete(rc.negSessions, sess.ID)
+		}
+		rc.mu.Unlock()
+
+		// Best effort, connection may be closed
+		if shouldSendClose {
+			p.writeMessage(rc, []interface{}{"NEG-CLOSE", sess.ID})
+		}
+	}
+
+	sess.Close()
+}
+
+// countReply is a relay's answer to a COUNT request
+type countReply struct {
+	count       int
+	approximate bool
+	refused     string // CLOSED reason
+	connLost    bool   // The connection went away before an answer
+}
+
+// errCountRefused means the relay answered a COUNT with CLOSED
+var errCountRefused = errors.New("COUNT refused")
+
+// errCountConnLost means the connection dropped before the COUNT was
+// answered; it says nothing about whether the relay supports COUNT
+var errCountConnLost = errors.New("connection closed before COUNT reply")
+
+// CountResult is a NIP-45 count from one relay
+type CountResult struct {
+	Count       int
+	Approximate bool // The relay says the count is an estimate
+}
+
+// Count sends a NIP-45 COUNT for filter and waits for the relay's answer
+func (p *RelayPool) Count(ctx context.Context, relayURL string, filter map[string]interface{}) (CountResult, error) {
+	rc, err := p.openConn(ctx, relayURL)
+	if err != nil {
+		return CountResult{}, err
+	}
+
+	subID := "count-" + randomString(8)
+	reply := make(chan countReply, 1)
+	rc.pendingCounts[subID] = reply
+	rc.mu.Unlock()
+
+	defer func() {
+		rc.mu.Lock()
+		delete(rc.pendingCounts, subID)
+		rc.mu.Unlock()
+	}()
+
+	if err := p.writeMessage(rc, []interface{}{"COUNT", subID, filter}); err != nil {
+		rc.markClosed()
+		return CountResult{}, err
+	}
+
+	select {
+	case r := <-reply:
+		if r.connLost {
+			return CountResult{}, errCountConnLost
+		}
+		if r.refused != "" {
+			return CountResult{}, fmt.Errorf("%w: %s", errCountRefused, r.refused)
+		}
+		return CountResult{Count: r.count, Approximate: r.approximate}, nil
+	case <-ctx.Done():
+		return CountResult{}, ctx.Err()
+	}
+}
+
+// writeMessage sends a message outside the REQ flow and records activity
+func (p *RelayPool) writeMessage(rc *RelayConn, msg []interface{}) error {
+	rc.writeMu.Lock()
+	err := rc.conn.WriteJSON(msg)
+	rc.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	rc.mu.Lock()
+	rc.lastActivity = time.Now()
+	rc.mu.Unlock()
+	return nil
+}
+
 // markClosed marks the connection as closed and cleans up
 func (rc *RelayConn) markClosed() {
 	rc.mu.Lock()
@@ -420,13 +702,41 @@ func (rc *RelayConn) markClosed() {
 		sub.Close()
 	}
 	rc.subscriptions = make(map[string]*Subscription)
+	for _, sess := range rc.negSessions {
+		sess.Close()
+	}
+	rc.negSessions = make(map[string]*NegSession)
+	for _, countCh := range rc.pendingCounts {
+		select {
+		case countCh <- countReply{connLost: true}:
+		default:
+		}
+	}
+	rc.pendingCounts = make(map[string]chan countReply)
 }
 
-// cleanupLoop periodically removes stale connections
+// openConnections counts live pooled connections (must hold p.mu)
+func (p *RelayPool) openConnections() int {
+	open := 0
+	for _, rc := range p.connections {
+		if !rc.closed {
+			open++
+		}
+	}
+	return open
+}
+
+// cleanupLoop periodically removes stale connections until Shutdown
 func (p *RelayPool) cleanupLoop() {
 	ticker := time.NewTicker(60 * time.Second)
-	for range ticker.C {
-		p.cleanup()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.cleanup()
+		case <-p.done:
+			return
+		}
 	}
 }
 
@@ -438,12 +748,13 @@ func (p *RelayPool) cleanup() {
 	now := time.Now()
 	for url, rc := range p.connections {
 		rc.mu.Lock()
-		idle := len(rc.subscriptions) == 0 && now.Sub(rc.lastActivity) > 2*time.Minute
+		idle := len(rc.subscriptions) == 0 && len(rc.negSessions) == 0 && len(rc.pendingCounts) == 0 &&
+			now.Sub(rc.lastActivity) > 2*time.Minute
 		rc.mu.Unlock()
 
 		if rc.closed || idle {
 			if !rc.closed {
-				log.Printf("Pool: closing idle connection to %s", url)
+				slog.Debug("Pool: closing idle connection", "relay", url)
 				rc.markClosed()
 			}
 			delete(p.connections, url)
@@ -451,6 +762,57 @@ func (p *RelayPool) cleanup() {
 	}
 }
 
+// recordConnect updates health stats after a dial attempt
+func (p *RelayPool) recordConnect(relayURL string, latency time.Duration, err error) {
+	p.healthMu.Lock()
+	defer p.healthMu.Unlock()
+
+	h := p.health[relayURL]
+	if h == nil {
+		h = &RelayHealth{}
+		p.health[relayURL] = h
+	}
+	h.Attempts++
+	if err != nil {
+		h.Failures++
+		h.LastError = err.Error()
+		h.LastErrorAt = time.Now()
+		return
+	}
+	h.LastConnectedAt = time.Now()
+	h.ConnectLatency = latency
+}
+
+// Health returns a snapshot of a relay's connection stats.
+// The second return value is false if we never tried to connect.
+func (p *RelayPool) Health(relayURL string) (RelayHealth, bool) {
+	p.healthMu.Lock()
+	h := p.health[relayURL]
+	var snapshot RelayHealth
+	if h != nil {
+		snapshot = *h
+	}
+	p.healthMu.Unlock()
+
+	p.mu.RLock()
+	rc := p.connections[relayURL]
+	p.mu.RUnlock()
+	if rc != nil {
+		rc.mu.Lock()
+		snapshot.Connected = !rc.closed
+		rc.mu.Unlock()
+	}
+
+	return snapshot, h != nil
+}
+
+// Probe connects to a relay (reusing a pooled connection if present) so
+// its health can be reported
+func (p *RelayPool) Probe(ctx context.Context, relayURL string) error {
+	_, err := p.getOrCreateConn(ctx, relayURL)
+	return err
+}
+
 // CloseRelay closes a specific relay connection
 func (p *RelayPool) CloseRelay(relayURL string) {
 	p.mu.Lock()
@@ -463,6 +825,57 @@ func (p *RelayPool) CloseRelay(relayURL string) {
 	}
 }
 
+// Shutdown closes every connection, which ends their subscriptions, and
+// stops the cleanup loop. Later connection attempts fail with errPoolShutdown.
+func (p *RelayPool) Shutdown() {
+	p.mu.Lock()
+	if p.shutdown {
+		p.mu.Unlock()
+		return
+	}
+	p.shutdown = true
+	close(p.done)
+	conns := p.connections
+	p.connections = make(map[string]*RelayConn)
+	p.mu.Unlock()
+
+	for _, rc := range conns {
+		rc.markClosed()
+	}
+	slog.Info("Pool: closed relay connections", "connections", len(conns))
+}
+
+// PoolStats counts pooled connections and the work running on them
+type PoolStats struct {
+	Connections   int
+	Subscriptions int
+	NegSessions   int
+	PendingCounts int
+}
+
+// Stats returns the pool's current connection and subscription counts
+func (p *RelayPool) Stats() PoolStats {
+	p.mu.RLock()
+	conns := make([]*RelayConn, 0, len(p.connections))
+	for _, rc := range p.connections {
+		conns = append(conns, rc)
+	}
+	p.mu.RUnlock()
+
+	var stats PoolStats
+	for _, rc := range conns {
+		rc.mu.Lock()
+		if !rc.closed {
+			stats.Connections++
+			stats.Subscriptions += len(rc.subscriptions)
+			stats.NegSessions += len(rc.negSessions)
+			stats.PendingCounts += len(rc.pendingCounts)
+		}
+		rc.mu.Unlock()
+	}
+	return stats
+}
+
 // PooledConn is a compatibility wrapper for code that expects the old interface
 type PooledConn struct {
 	pool     *RelayPool
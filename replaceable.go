@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ReplaceableResult is the outcome of a replaceable/addressable event lookup
+type ReplaceableResult struct {
+	Events    []Event // Newest version per (kind, pubkey, d-tag), newest first
+	Responded int     // Relays that sent EOSE
+	Queried   int
+	Confident bool // A quorum of relays answered, so Events can be trusted as current
+}
+
+// isAddressableKind reports whether kind is NIP-01 addressable (d-tag keyed)
+func isAddressableKind(kind int) bool {
+	return kind >= 30000 && kind < 40000
+}
+
+// replaceableKey identifies the slot a replaceable or addressable event occupies
+func replaceableKey(evt Event) string {
+	key := strconv.Itoa(evt.Kind) + ":" + evt.PubKey
+	if isAddressableKind(evt.Kind) {
+		key += ":" + extractDTag(evt.Tags)
+	}
+	return key
+}
+
+// replaceableQuorum is how many relays must send EOSE before a lookup is
+// trusted: a majority, and at least one
+func replaceableQuorum(relayCount int) int {
+	return relayCount/2 + 1
+}
+
+// fetchReplaceable looks up replaceable (kind 0, 3, 1xxxx) or addressable
+// (3xxxx) events. Unlike fetchEventsFromRelays it doesn't stop at the first
+// results: it waits for EOSE from a quorum of relays (plus a short grace for
+// the rest) and keeps only the newest version of each event, so callers that
+// modify and republish a list don't start from a stale copy.
+func fetchReplaceable(relays []string, filter Filter) ReplaceableResult {
+	result := ReplaceableResult{Queried: len(relays)}
+	if len(relays) == 0 {
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().Timeouts.Replaceable)
+	defer cancel()
+
+	eventChan := make(chan Event, 1000)
+	eoseChan := make(chan bool, len(relays))
+	doneChan := make(chan struct{}, len(relays))
+
+	var wg sync.WaitGroup
+	for _, relay := range relays {
+		wg.Add(1)
+		go func(relayURL string) {
+			defer wg.Done()
+			fetchFromRelay(ctx, relayURL, filter, eventChan, eoseChan)
+			doneChan <- struct{}{}
+		}(relay)
+	}
+	go func() {
+		wg.Wait()
+		close(eventChan)
+	}()
+
+	newest := make(map[string]Event)
+	keep := func(evt Event) {
+		key := replaceableKey(evt)
+		existing, seen := newest[key]
+		// Newest wins; on a created_at tie the lowest ID wins (NIP-01)
+		if !seen || evt.CreatedAt > existing.CreatedAt ||
+			(evt.CreatedAt == existing.CreatedAt && evt.ID < existing.ID) {
+			newest[key] = evt
+		}
+	}
+
+	quorum := replaceableQuorum(len(relays))
+	finished := 0
+	var graceTimer <-chan time.Time
+
+collectLoop:
+	for {
+		select {
+		case evt, ok := <-eventChan:
+			if !ok {
+				break collectLoop
+			}
+			keep(evt)
+		case <-eoseChan:
+			result.Responded++
+			if result.Responded >= quorum && graceTimer == nil {
+				graceTimer = time.After(300 * time.Millisecond)
+			}
+		case <-doneChan:
+			finished++
+			if finished == len(relays) {
+				// Every relay answered or failed, so the event channel is
+				// about to close; read what's left
+				for evt := range eventChan {
+					keep(evt)
+				}
+				break collectLoop
+			}
+		case <-graceTimer:
+			break collectLoop
+		case <-ctx.Done():
+			break collectLoop
+		}
+	}
+	// Pick up events and EOSEs buffered when the loop ended
+drainLoop:
+	for {
+		select {
+		case evt, ok := <-eventChan:
+			if !ok {
+				break drainLoop
+			}
+			keep(evt)
+		default:
+			break drainLoop
+		}
+	}
+	for len(eoseChan) > 0 {
+		<-eoseChan
+		result.Responded++
+	}
+
+	for _, evt := range newest {
+		result.Events = append(result.Events, evt)
+	}
+	sortEventsNewestFirst(result.Events)
+	result.Confident = result.Responded >= quorum
+
+	if !result.Confident {
+		slog.Warn("Replaceable lookup not confident",
+			"kinds", filter.Kinds, "authors", len(filter.Authors), "eose", result.Responded, "relays", result.Queried)
+	}
+
+	// Keep the event store in step with the authoritative versions
+	eventStore.Add(result.Events)
+	return result
+}
@@ -0,0 +1,629 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheduled posts. A remote signer has to be reachable to sign, so instead
+// of signing later the signer signs now with a future created_at. The
+// signed event waits in a queue, saved to disk so restarts don't lose it,
+// and is published once its created_at arrives. Cancelling before then
+// means it is never sent anywhere.
+
+const (
+	minScheduleLead      = time.Minute          // Earliest a post can be scheduled
+	maxScheduleAhead     = 365 * 24 * time.Hour // Latest a post can be scheduled
+	maxScheduledPerUser  = 50
+	maxScheduleAttempts  = 5 // Publish attempts before a post is marked failed
+	schedulePublishWait  = 10 * time.Second
+	scheduleIdleInterval = time.Hour // Wake-up interval when nothing is due
+)
+
+var (
+	errScheduleFull      = fmt.Errorf("You can have at most %d scheduled posts", maxScheduledPerUser)
+	errScheduleDuplicate = errors.New("This post is already scheduled")
+)
+
+// ScheduledEvent is a signed event waiting for its created_at
+type ScheduledEvent struct {
+	Event     *Event   `json:"event"`
+	Relays    []string `json:"relays"`
+	What      string   `json:"what"` // "note", "reply" or "article", for the scheduled page
+	Zone      int      `json:"zone"` // UTC offset in minutes the time was picked in
+	Attempts  int      `json:"attempts,omitempty"`
+	NextTry   int64    `json:"next_try,omitempty"` // Retry time after a failed attempt
+	LastError string   `json:"last_error,omitempty"`
+	Failed    bool     `json:"failed,omitempty"` // Gave up after maxScheduleAttempts
+
+	publishing bool // Being sent right now; can't be cancelled
+}
+
+// dueAt is when the event should next be published
+func (s *ScheduledEvent) dueAt() int64 {
+	if s.NextTry > s.Event.CreatedAt {
+		return s.NextTry
+	}
+	return s.Event.CreatedAt
+}
+
+// ScheduleQueue holds scheduled events, soonest first, and mirrors them to a file
+type ScheduleQueue struct {
+	mu     sync.Mutex
+	path   string
+	events []*ScheduledEvent
+	wake   chan struct{}
+}
+
+var scheduleQueue = &ScheduleQueue{wake: make(chan struct{}, 1)}
+
+// Start loads the queue file and publishes events as they come due until
+// ctx is cancelled
+func (q *ScheduleQueue) Start(ctx context.Context, path string) {
+	q.mu.Lock()
+	q.path = path
+	q.load()
+	count := len(q.events)
+	q.mu.Unlock()
+
+	slog.Info("Schedule queue started", "file", path, "pending", count)
+	go q.run(ctx)
+}
+
+// load reads the queue file. Entries that don't verify are dropped.
+// Caller holds q.mu.
+func (q *ScheduleQueue) load() {
+	data, err := os.ReadFile(q.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Schedule queue file unreadable", "file", q.path, "error", err)
+		}
+		return
+	}
+	var events []*ScheduledEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		slog.Warn("Schedule queue file corrupt", "file", q.path, "error", err)
+		return
+	}
+	for _, s := range events {
+		if s == nil || s.Event == nil || calculateEventID(s.Event) != s.Event.ID || !validateEventSignature(s.Event) {
+			slog.Warn("Dropping invalid scheduled event", "file", q.path)
+			continue
+		}
+		q.events = append(q.events, s)
+	}
+	q.sort()
+}
+
+// save writes the queue file atomically. Caller holds q.mu.
+func (q *ScheduleQueue) save() error {
+	if q.path == "" {
+		return errors.New("schedule queue not started")
+	}
+	data, err := json.Marshal(q.events)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(q.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".scheduled-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), q.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// sort orders the queue soonest first. Caller holds q.mu.
+func (q *ScheduleQueue) sort() {
+	sort.SliceStable(q.events, func(i, j int) bool {
+		return q.events[i].Event.CreatedAt < q.events[j].Event.CreatedAt
+	})
+}
+
+// signal wakes the publisher to recompute its next deadline
+func (q *ScheduleQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Add queues a signed event. It is only kept if it could be saved to disk.
+func (q *ScheduleQueue) Add(event *Event, relays []string, what string, zone int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	count := 0
+	for _, s := range q.events {
+		if s.Event.ID == event.ID {
+			return errScheduleDuplicate
+		}
+		if s.Event.PubKey == event.PubKey {
+			count++
+		}
+	}
+	if count >= maxScheduledPerUser {
+		return errScheduleFull
+	}
+
+	q.events = append(q.events, &ScheduledEvent{
+		Event:  event,
+		Relays: dedupeStrings(relays),
+		What:   what,
+		Zone:   zone,
+	})
+	q.sort()
+	if err := q.save(); err != nil {
+		q.remove(event.ID)
+		return err
+	}
+	q.signal()
+	return nil
+}
+
+// remove drops an event from the queue. Caller holds q.mu.
+func (q *ScheduleQueue) remove(id string) {
+	for i, s := range q.events {
+		if s.Event.ID == id {
+			q.events = append(q.events[:i], q.events[i+1:]...)
+			return
+		}
+	}
+}
+
+// Cancel removes a user's scheduled event. It returns false if the event
+// isn't queued, isn't theirs, or is being published right now.
+func (q *ScheduleQueue) Cancel(pubkey, id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, s := range q.events {
+		if s.Event.ID != id {
+			continue
+		}
+		if s.Event.PubKey != pubkey || s.publishing {
+			return false
+		}
+		q.remove(id)
+		if err := q.save(); err != nil {
+			slog.Warn("Failed to save schedule queue", "error", err)
+		}
+		q.signal()
+		return true
+	}
+	return false
+}
+
+// ForUser returns copies of a user's scheduled events, soonest first
+func (q *ScheduleQueue) ForUser(pubkey string) []ScheduledEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var events []ScheduledEvent
+	for _, s := range q.events {
+		if s.Event.PubKey == pubkey {
+			events = append(events, *s)
+		}
+	}
+	return events
+}
+
+// run publishes due events, sleeping until the next one is due
+func (q *ScheduleQueue) run(ctx context.Context) {
+	for {
+		wait := q.publishDue(ctx)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-q.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// publishDue publishes every event that is due and returns how long to
+// sleep until the next one
+func (q *ScheduleQueue) publishDue(ctx context.Context) time.Duration {
+	now := time.Now().Unix()
+	var due []*ScheduledEvent
+	wait := scheduleIdleInterval
+
+	q.mu.Lock()
+	for _, s := range q.events {
+		if s.Failed || s.publishing {
+			continue
+		}
+		if at := s.dueAt(); at <= now {
+			s.publishing = true
+			due = append(due, s)
+		} else if d := time.Duration(at-now) * time.Second; d < wait {
+			wait = d
+		}
+	}
+	q.mu.Unlock()
+
+	if len(due) == 0 {
+		return wait
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range due {
+		wg.Add(1)
+		go func(s *ScheduledEvent) {
+			defer wg.Done()
+			q.finish(ctx, s, publishScheduled(ctx, s))
+		}(s)
+	}
+	wg.Wait()
+	// Retries may now be due sooner than the old deadline
+	return 0
+}
+
+// finish records the outcome of publishing a scheduled event
+func (q *ScheduleQueue) finish(ctx context.Context, s *ScheduledEvent, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	s.publishing = false
+	if err != nil && ctx.Err() != nil {
+		// Shutting down; the next start tries again without counting this
+		return
+	}
+	if err == nil {
+		q.remove(s.Event.ID)
+		eventStore.Add([]Event{*s.Event})
+		slog.Info("Published scheduled event", "event", s.Event.ID, "kind", s.Event.Kind, "relays", len(s.Relays))
+	} else {
+		s.Attempts++
+		s.LastError = err.Error()
+		if s.Attempts >= maxScheduleAttempts {
+			s.Failed = true
+			slog.Warn("Gave up on scheduled event", "event", s.Event.ID, "attempts", s.Attempts, "error", err)
+		} else {
+			// Back off 1, 2, 4, 8 minutes
+			s.NextTry = time.Now().Add(time.Minute << (s.Attempts - 1)).Unix()
+			slog.Warn("Scheduled event not published, will retry", "event", s.Event.ID, "attempt", s.Attempts, "error", err)
+		}
+	}
+	if err := q.save(); err != nil {
+		slog.Warn("Failed to save schedule queue", "error", err)
+	}
+}
+
+// publishScheduled sends an event to its relays and succeeds if any accept it
+func publishScheduled(ctx context.Context, s *ScheduledEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, schedulePublishWait)
+	defer cancel()
+
+	errs := make(chan error, len(s.Relays))
+	for _, relay := range s.Relays {
+		go func(relay string) {
+			errs <- publishToRelay(ctx, relay, s.Event)
+		}(relay)
+	}
+	var lastErr error = errors.New("no relays to publish to")
+	for range s.Relays {
+		err := <-errs
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+// scheduleZones are the UTC offsets offered on the compose forms, in minutes
+var scheduleZones = []int{
+	-720, -660, -600, -570, -540, -480, -420, -360, -300, -240, -210, -180, -120, -60,
+	0, 60, 120, 180, 210, 240, 270, 300, 330, 345, 360, 390, 420, 480, 525, 540, 570,
+	600, 630, 660, 720, 765, 780, 840,
+}
+
+// zoneLabel formats a UTC offset in minutes as "UTC+05:30"
+func zoneLabel(zone int) string {
+	sign := "+"
+	if zone < 0 {
+		sign = "-"
+		zone = -zone
+	}
+	return fmt.Sprintf("UTC%s%02d:%02d", sign, zone/60, zone%60)
+}
+
+// ScheduleZone is an option of the time zone select
+type ScheduleZone struct {
+	Offset   int
+	Label    string
+	Selected bool
+}
+
+// ScheduleFields is the state of a compose form's schedule fields
+type ScheduleFields struct {
+	ID    string // Prefix for element ids, so several forms can share a page
+	At    string // datetime-local value
+	Zones []ScheduleZone
+}
+
+// newScheduleFields returns schedule fields with zone selected
+func newScheduleFields(id, at string, zone int) ScheduleFields {
+	f := ScheduleFields{ID: id, At: at}
+	for _, z := range scheduleZones {
+		f.Zones = append(f.Zones, ScheduleZone{Offset: z, Label: zoneLabel(z), Selected: z == zone})
+	}
+	return f
+}
+
+// defaultScheduleFields returns empty schedule fields in UTC, for templates
+func defaultScheduleFields(id string) ScheduleFields {
+	return newScheduleFields(id, "", 0)
+}
+
+// scheduleFieldsFromRequest keeps a submitted form's schedule fields so a
+// re-rendered form doesn't lose them
+func scheduleFieldsFromRequest(id string, r *http.Request) ScheduleFields {
+	zone, _ := strconv.Atoi(r.FormValue("schedule_tz"))
+	return newScheduleFields(id, strings.TrimSpace(r.FormValue("schedule_at")), zone)
+}
+
+// parseScheduleForm reads a compose form's schedule fields. It returns a
+// zero time when the post isn't scheduled; errors are shown to the user as
+// they are.
+func parseScheduleForm(r *http.Request) (int64, int, error) {
+	at := strings.TrimSpace(r.FormValue("schedule_at"))
+	if at == "" {
+		return 0, 0, nil
+	}
+	zone, err := strconv.Atoi(r.FormValue("schedule_tz"))
+	if err != nil || zone < -720 || zone > 840 {
+		return 0, 0, errors.New("Pick a time zone for the scheduled time")
+	}
+	loc := time.FixedZone(zoneLabel(zone), zone*60)
+
+	var t time.Time
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05"} {
+		if t, err = time.ParseInLocation(layout, at, loc); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return 0, 0, errors.New("The scheduled time isn't a valid date and time")
+	}
+	now := time.Now()
+	if t.Before(now.Add(minScheduleLead)) {
+		return 0, 0, errors.New("Pick a scheduled time at least a minute from now")
+	}
+	if t.After(now.Add(maxScheduleAhead)) {
+		return 0, 0, errors.New("Posts can be scheduled at most a year ahead")
+	}
+	return t.Unix(), zone, nil
+}
+
+// formatTimeUntil describes how long until a future timestamp
+func formatTimeUntil(ts int64) string {
+	d := time.Until(time.Unix(ts, 0))
+	switch {
+	case d < time.Minute:
+		return "any moment now"
+	case d < 2*time.Minute:
+		return "in 1 min"
+	case d < time.Hour:
+		return fmt.Sprintf("in %d mins", int(d.Minutes()))
+	case d < 2*time.Hour:
+		return "in 1 hour"
+	case d < 48*time.Hour:
+		return fmt.Sprintf("in %d hours", int(d.Hours()))
+	default:
+		return fmt.Sprintf("in %d days", int(d.Hours()/24))
+	}
+}
+
+// htmlScheduleTemplateBlocks are the schedule fields shared by the note,
+// reply and article forms
+const htmlScheduleTemplateBlocks = `{{define "schedule-fields"}}
+<details class="post-schedule"{{if .At}} open{{end}}>
+  <summary>Schedule</summary>
+  <div class="post-schedule-settings">
+    <label for="{{.ID}}-schedule-at">Publish at</label>
+    <input id="{{.ID}}-schedule-at" type="datetime-local" name="schedule_at" value="{{.At}}">
+    <label for="{{.ID}}-schedule-tz" class="sr-only">Time zone</label>
+    <select id="{{.ID}}-schedule-tz" name="schedule_tz">
+      {{range .Zones}}<option value="{{.Offset}}"{{if .Selected}} selected{{end}}>{{.Label}}</option>{{end}}
+    </select>
+  </div>
+  <p class="post-schedule-hint">Your signer signs it now and the server publishes it then. <a href="/html/scheduled">Scheduled posts</a></p>
+</details>
+{{end}}
+{{define "schedule-style"}}
+    .post-schedule { flex-basis: 100%; }
+    .post-schedule summary { cursor: pointer; }
+    .post-schedule-settings { display: flex; align-items: center; gap: 8px; flex-wrap: wrap; margin-top: 4px; }
+    .post-schedule-hint { font-size: 12px; color: var(--text-muted); margin: 4px 0 0 0; }
+{{end}}
+`
+
+// HTMLScheduledItem is a post on the scheduled page
+type HTMLScheduledItem struct {
+	ID        string
+	What      string
+	Preview   string
+	At        string // In the zone it was scheduled in
+	Until     string
+	Relays    int
+	Attempts  int
+	LastError string
+	Failed    bool
+}
+
+// HTMLScheduledData is the data for the scheduled page
+type HTMLScheduledData struct {
+	HTMLPageChrome
+	Items []HTMLScheduledItem
+}
+
+var htmlScheduledTemplate = `{{define "page-style"}}
+    .scheduled-row { display: flex; align-items: center; gap: 10px; flex-wrap: wrap; }
+    .scheduled-what { font-size: 11px; padding: 2px 8px; border-radius: 10px; background: var(--bg-badge); color: var(--text-secondary); }
+    .scheduled-preview { margin-top: 6px; white-space: pre-wrap; word-break: break-word; color: var(--text-content); }
+    .scheduled-error { margin-top: 6px; font-size: 12px; color: var(--error-accent); }
+{{end}}{{template "page-head" .}}
+    {{template "page-nav" .}}
+    <main>
+      <h2>Scheduled posts</h2>
+      <p class="text-sm text-muted" style="margin-bottom: 16px;">These posts are already signed and wait on this server until their time comes. Cancelling one means it's never sent to any relay.</p>
+      {{range .Items}}
+      <div class="card">
+        <div class="scheduled-row">
+          <span class="scheduled-what">{{.What}}</span>
+          <span class="card-title">{{.At}}</span>
+          <span class="card-meta">{{if .Failed}}not published{{else}}{{.Until}}{{end}} · {{.Relays}} relay{{if ne .Relays 1}}s{{end}}</span>
+          <form method="POST" action="/html/scheduled" class="inline-form ml-auto">
+            <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
+            <input type="hidden" name="action" value="cancel">
+            <input type="hidden" name="id" value="{{.ID}}">
+            <button type="submit" class="secondary-btn">{{if .Failed}}Remove{{else}}Cancel{{end}}</button>
+          </form>
+        </div>
+        <div class="scheduled-preview">{{.Preview}}</div>
+        {{if .LastError}}<div class="scheduled-error">{{if .Failed}}Gave up after {{.Attempts}} attempts{{else}}Attempt {{.Attempts}} failed, retrying{{end}}: {{.LastError}}</div>{{end}}
+      </div>
+      {{else}}
+      <div class="empty-state">
+        <p>Nothing scheduled.</p>
+        <p class="empty-state-hint">Open Schedule on the note, reply or article form to pick a time.</p>
+      </div>
+      {{end}}
+    </main>
+    {{template "page-footer" .}}`
+
+var cachedScheduledTemplate *template.Template
+
+// htmlScheduledHandler lists the user's scheduled posts (GET) and cancels
+// them (POST action=cancel)
+func htmlScheduledHandler(w http.ResponseWriter, r *http.Request) {
+	session := getSessionFromRequest(r)
+	if session == nil || !session.Connected {
+		http.Redirect(w, r, "/html/login?error=Please+login+first", http.StatusSeeOther)
+		return
+	}
+	pubkeyHex := hex.EncodeToString(session.UserPubKey)
+
+	if r.Method == http.MethodPost {
+		if !validateCSRFToken(session.ID, r.FormValue("csrf_token")) {
+			http.Error(w, "Invalid or expired CSRF token", http.StatusForbidden)
+			return
+		}
+		id := strings.TrimSpace(r.FormValue("id"))
+		if r.FormValue("action") != "cancel" || !isValidEventID(id) {
+			http.Redirect(w, r, "/html/scheduled?error=Invalid+request", http.StatusSeeOther)
+			return
+		}
+		if !scheduleQueue.Cancel(pubkeyHex, id) {
+			http.Redirect(w, r, "/html/scheduled?error="+escapeURLParam("That post was already published or is being published now"), http.StatusSeeOther)
+			return
+		}
+		slog.Info("Cancelled scheduled event", "event", id)
+		http.Redirect(w, r, "/html/scheduled?success=Scheduled+post+cancelled", http.StatusSeeOther)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var items []HTMLScheduledItem
+	for _, s := range scheduleQueue.ForUser(pubkeyHex) {
+		preview := s.Event.Content
+		if s.Event.Kind == kindArticle {
+			preview = extractTitle(s.Event.Tags)
+		}
+		if runes := []rune(preview); len(runes) > 280 {
+			preview = string(runes[:280]) + "…"
+		}
+		loc := time.FixedZone(zoneLabel(s.Zone), s.Zone*60)
+		items = append(items, HTMLScheduledItem{
+			ID:        s.Event.ID,
+			What:      s.What,
+			Preview:   preview,
+			At:        time.Unix(s.Event.CreatedAt, 0).In(loc).Format("Mon 2 Jan 2006 15:04") + " " + zoneLabel(s.Zone),
+			Until:     formatTimeUntil(s.dueAt()),
+			Relays:    len(s.Relays),
+			Attempts:  s.Attempts,
+			LastError: s.LastError,
+			Failed:    s.Failed,
+		})
+	}
+
+	readRelays, _ := sessionRelays(session)
+	data := HTMLScheduledData{
+		HTMLPageChrome: newPageChrome("Scheduled posts", r, session, readRelays),
+		Items:          items,
+	}
+	data.NavTab = "write"
+
+	html, err := executePageTemplate(cachedScheduledTemplate, data)
+	if err != nil {
+		slog.Error("Error rendering scheduled page", "error", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(html))
+}
+
+// scheduleEvent queues a signed event, returning a message for the user
+// when the queue refuses it
+func scheduleEvent(event *Event, relays []string, what string, zone int) string {
+	if err := scheduleQueue.Add(event, relays, what, zone); err != nil {
+		if errors.Is(err, errScheduleFull) || errors.Is(err, errScheduleDuplicate) {
+			return err.Error()
+		}
+		slog.Error("Failed to save scheduled event", "event", event.ID, "error", err)
+		return "The scheduled post couldn't be saved"
+	}
+	slog.Info("Scheduled event", "event", event.ID, "kind", event.Kind, "at", event.CreatedAt)
+	return ""
+}
+
+// scheduleSigned queues a signed event and redirects to the scheduled page.
+// errorURL gets the error message appended when the queue refuses it.
+func scheduleSigned(w http.ResponseWriter, r *http.Request, event *Event, relays []string, what string, zone int, errorURL string) {
+	if msg := scheduleEvent(event, relays, what, zone); msg != "" {
+		separator := "?"
+		if strings.Contains(errorURL, "?") {
+			separator = "&"
+		}
+		http.Redirect(w, r, errorURL+separator+"error="+escapeURLParam(msg), http.StatusSeeOther)
+		return
+	}
+	label := strings.ToUpper(what[:1]) + what[1:]
+	http.Redirect(w, r, "/html/scheduled?success="+escapeURLParam(label+" scheduled"), http.StatusSeeOther)
+}
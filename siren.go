@@ -27,12 +27,23 @@ type SirenLink struct {
 }
 
 type SirenAction struct {
-	Name   string        `json:"name"`
-	Title  string        `json:"title,omitempty"`
-	Method string        `json:"method"`
-	Href   string        `json:"href"`
-	Type   string        `json:"type,omitempty"`
-	Fields []SirenField  `json:"fields,omitempty"`
+	Name     string              `json:"name"`
+	Class    []string            `json:"class,omitempty"`
+	Title    string              `json:"title,omitempty"`
+	Method   string              `json:"method"`
+	Href     string              `json:"href"`
+	Type     string              `json:"type,omitempty"`
+	Fields   []SirenField        `json:"fields,omitempty"`
+	Template *SirenEventTemplate `json:"event_template,omitempty"`
+}
+
+// SirenEventTemplate describes the unsigned event a client must build and sign
+// (e.g. with a NIP-07 extension) before submitting an action of class
+// "nostr-sign". A form field named "content" replaces the template content.
+type SirenEventTemplate struct {
+	Kind    int        `json:"kind"`
+	Content string     `json:"content"`
+	Tags    [][]string `json:"tags"`
 }
 
 type SirenField struct {
@@ -54,7 +65,11 @@ func toSirenTimeline(resp TimelineResponse, relays []string, authors []string, k
 		},
 		Entities: []SirenSubEntity{},
 		Links:    []SirenLink{},
-		Actions:  []SirenAction{},
+		Actions: []SirenAction{
+			signAction("post-note", "Post Note", 1, "", [][]string{}, []SirenField{
+				{Name: "content", Type: "textarea", Title: "What's happening?"},
+			}),
+		},
 	}
 
 	// Add event entities
@@ -75,28 +90,35 @@ func toSirenTimeline(resp TimelineResponse, relays []string, authors []string, k
 			props["author_profile"] = map[string]interface{}{
 				"name":         item.AuthorProfile.Name,
 				"display_name": item.AuthorProfile.DisplayName,
-				"picture":      item.AuthorProfile.Picture,
+				"picture":      proxyImageURL(item.AuthorProfile.Picture, imageWidthAvatar),
 				"nip05":        item.AuthorProfile.Nip05,
 			}
 		}
 
 		// Add reactions if available
 		if item.Reactions != nil {
-			props["reactions"] = map[string]interface{}{
+			reactions := map[string]interface{}{
 				"total":   item.Reactions.Total,
 				"by_type": item.Reactions.ByType,
 			}
+			if len(item.Reactions.ByEmoji) > 0 {
+				reactions["by_emoji"] = proxyEmojiReactions(item.Reactions.ByEmoji)
+			}
+			props["reactions"] = reactions
 		}
 
 		// Add reply count
 		props["reply_count"] = item.ReplyCount
+		if item.ContentWarning != nil {
+			props["content_warning"] = *item.ContentWarning
+		}
 
 		subEntity := SirenSubEntity{
 			Class:      []string{"event", "note"},
 			Rel:        []string{"item"},
 			Properties: props,
 			Links:      []SirenLink{},
-			Actions:    []SirenAction{},
+			Actions:    noteSignActions(item),
 		}
 
 		entity.Entities = append(entity.Entities, subEntity)
@@ -120,6 +142,73 @@ func toSirenTimeline(resp TimelineResponse, relays []string, authors []string, k
 	return entity
 }
 
+// signAction builds an action that the client fulfils by signing the event
+// template itself and POSTing the signed event to /events.
+func signAction(name, title string, kind int, content string, tags [][]string, fields []SirenField) SirenAction {
+	return SirenAction{
+		Name:   name,
+		Class:  []string{"nostr-sign"},
+		Title:  title,
+		Method: "POST",
+		Href:   "/events",
+		Type:   "application/json",
+		Fields: fields,
+		Template: &SirenEventTemplate{
+			Kind:    kind,
+			Content: content,
+			Tags:    tags,
+		},
+	}
+}
+
+// noteSignActions returns the reply, react and repost actions for an event
+func noteSignActions(item EventItem) []SirenAction {
+	kindStr := strconv.Itoa(item.Kind)
+
+	// NIP-10: keep the thread root, mark the item itself as the reply target
+	replyTags := [][]string{}
+	for _, tag := range item.Tags {
+		if len(tag) >= 4 && tag[0] == "e" && tag[3] == "root" {
+			replyTags = append(replyTags, []string{"e", tag[1], "", "root"})
+			break
+		}
+	}
+	if len(replyTags) == 0 {
+		replyTags = append(replyTags, []string{"e", item.ID, "", "root"})
+	} else {
+		replyTags = append(replyTags, []string{"e", item.ID, "", "reply"})
+	}
+	replyTags = append(replyTags, []string{"p", item.Pubkey})
+
+	// NIP-18: repost content is the stringified original event
+	original := Event{
+		ID:        item.ID,
+		PubKey:    item.Pubkey,
+		CreatedAt: item.CreatedAt,
+		Kind:      item.Kind,
+		Tags:      item.Tags,
+		Content:   item.Content,
+		Sig:       item.Sig,
+	}
+
+	return []SirenAction{
+		signAction("reply", "Reply", 1, "", replyTags, []SirenField{
+			{Name: "content", Type: "textarea", Title: "Reply"},
+		}),
+		signAction("react", "React", 7, "+", [][]string{
+			{"e", item.ID},
+			{"p", item.Pubkey},
+			{"k", kindStr},
+		}, []SirenField{
+			{Name: "content", Type: "text", Value: "+", Title: "Reaction"},
+		}),
+		signAction("repost", "Repost", 6, mustJSON(original), [][]string{
+			{"e", item.ID},
+			{"p", item.Pubkey},
+		}, nil),
+	}
+}
+
 func buildTimelineURL(base string, relays []string, authors []string, kinds []int, limit int, until *int64, fast bool) string {
 	parts := []string{base + "?"}
 
@@ -146,3 +235,93 @@ func buildTimelineURL(base string, relays []string, authors []string, kinds []in
 
 	return strings.Join(parts, "&")
 }
+
+// toSirenProfile converts a profile response to a Siren entity with the
+// notes as sub-entities
+func toSirenProfile(resp ProfileResponse, relays []string, limit int) SirenEntity {
+	props := map[string]interface{}{
+		"pubkey": resp.Pubkey,
+	}
+	if npub, err := encodeBech32Pubkey(resp.Pubkey); err == nil {
+		props["npub"] = npub
+	}
+	if p := resp.Profile; p != nil {
+		props["name"] = p.Name
+		props["display_name"] = p.DisplayName
+		props["picture"] = proxyImageURL(p.Picture, imageWidthAvatar)
+		props["nip05"] = p.Nip05
+		props["about"] = p.About
+	}
+	if resp.Counts != nil {
+		props["followers"] = resp.Counts.Followers
+		props["following"] = resp.Counts.Following
+		props["counts_approximate"] = resp.Counts.Approximate
+	}
+
+	entity := SirenEntity{
+		Class:      []string{"profile"},
+		Properties: props,
+		Entities:   []SirenSubEntity{},
+		Links: []SirenLink{
+			{Rel: []string{"self"}, Href: buildProfileURL(resp.Pubkey, relays, limit, nil)},
+			{Rel: []string{"timeline"}, Href: buildTimelineURL("/timeline", relays, []string{resp.Pubkey}, []int{1}, limit, nil, false)},
+		},
+	}
+
+	for _, item := range resp.Notes.Items {
+		props := map[string]interface{}{
+			"id":          item.ID,
+			"kind":        item.Kind,
+			"pubkey":      item.Pubkey,
+			"created_at":  item.CreatedAt,
+			"content":     item.Content,
+			"tags":        item.Tags,
+			"sig":         item.Sig,
+			"relays_seen": item.RelaysSeen,
+		}
+		if item.ContentWarning != nil {
+			props["content_warning"] = *item.ContentWarning
+		}
+		entity.Entities = append(entity.Entities, SirenSubEntity{
+			Class:      []string{"event", "note"},
+			Rel:        []string{"item"},
+			Properties: props,
+			Links: []SirenLink{
+				{Rel: []string{"thread"}, Href: "/thread/" + item.ID},
+			},
+			Actions: noteSignActions(item),
+		})
+	}
+
+	if resp.Notes.Page.Next != nil {
+		entity.Links = append(entity.Links, SirenLink{
+			Rel:  []string{"next"},
+			Href: *resp.Notes.Page.Next,
+		})
+	}
+
+	return entity
+}
+
+func buildProfileURL(pubkey string, relays []string, limit int, until *int64) string {
+	u := "/profile/" + pubkey + "?limit=" + strconv.Itoa(limit)
+	if len(relays) > 0 {
+		u += "&relays=" + strings.Join(relays, ",")
+	}
+	if until != nil {
+		u += "&until=" + strconv.FormatInt(*until, 10)
+	}
+	return u
+}
+
+// proxyEmojiReactions copies byEmoji with each image routed through the proxy;
+// the summary is shared with the HTML renderer, so it isn't modified in place
+func proxyEmojiReactions(byEmoji map[string]*EmojiReaction) map[string]*EmojiReaction {
+	proxied := make(map[string]*EmojiReaction, len(byEmoji))
+	for key, r := range byEmoji {
+		copied := *r
+		copied.URL = proxyImageURL(r.URL, imageWidthAvatar)
+		proxied[key] = &copied
+	}
+	return proxied
+}
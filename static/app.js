@@ -636,6 +636,20 @@ function renderNote(props) {
       reactionsDiv.appendChild(reactionSpan);
     }
 
+    // NIP-30 custom emoji, keyed by image URL
+    for (const emoji of Object.values(props.reactions.by_emoji || {})) {
+      const reactionSpan = document.createElement('span');
+      reactionSpan.className = 'reaction-badge';
+      const img = document.createElement('img');
+      img.className = 'custom-emoji';
+      img.src = emoji.url;
+      img.alt = `:${emoji.shortcode}:`;
+      img.title = `:${emoji.shortcode}:`;
+      reactionSpan.appendChild(img);
+      reactionSpan.appendChild(document.createTextNode(` ${emoji.count}`));
+      reactionsDiv.appendChild(reactionSpan);
+    }
+
     noteDiv.appendChild(reactionsDiv);
   }
 
@@ -752,9 +766,9 @@ function renderActions(actions) {
       fieldsDiv.classList.toggle('visible');
     };
 
-    // Render fields
-    if (action.fields && action.fields.length > 0) {
-      action.fields.forEach(field => {
+    // Render fields (signing actions always get a submit button)
+    if ((action.fields && action.fields.length > 0) || isSignAction(action)) {
+      (action.fields || []).forEach(field => {
         const fieldDiv = document.createElement('div');
         fieldDiv.className = 'action-field';
 
@@ -785,7 +799,7 @@ function renderActions(actions) {
       const submitBtn = document.createElement('button');
       submitBtn.type = 'submit';
       submitBtn.className = 'action-submit';
-      submitBtn.textContent = `Submit ${action.name}`;
+      submitBtn.textContent = isSignAction(action) ? `Sign & ${action.name}` : `Submit ${action.name}`;
       fieldsDiv.appendChild(submitBtn);
     }
 
@@ -797,6 +811,64 @@ function renderActions(actions) {
   return actionsDiv;
 }
 
+// Actions of class "nostr-sign" carry an event template the client must sign
+function isSignAction(action) {
+  return !!(action.class && action.class.includes('nostr-sign') && action.event_template);
+}
+
+// Build an unsigned event from an action's template and form values
+function buildEventFromTemplate(template, data) {
+  return {
+    kind: template.kind,
+    created_at: Math.floor(Date.now() / 1000),
+    tags: template.tags || [],
+    content: data.content !== undefined ? data.content : (template.content || '')
+  };
+}
+
+// Sign an action's event with a NIP-07 extension and POST it to the action href
+async function executeSignedAction(action, data) {
+  if (!window.nostr) {
+    alert('This action needs a NIP-07 signing extension (e.g. nos2x or Alby).');
+    return;
+  }
+
+  try {
+    const unsigned = buildEventFromTemplate(action.event_template, data);
+    if (action.event_template.kind === 1 && !unsigned.content.trim()) {
+      alert('Content is required');
+      return;
+    }
+
+    // Extensions fill in pubkey and id when signing, but some require pubkey up front
+    unsigned.pubkey = await window.nostr.getPublicKey();
+    const signed = await window.nostr.signEvent(unsigned);
+
+    const response = await fetch(action.href, {
+      method: action.method || 'POST',
+      headers: {
+        'Content-Type': action.type || 'application/json',
+      },
+      body: JSON.stringify(signed)
+    });
+
+    if (response.ok) {
+      alert(`Action "${action.name}" signed and published!`);
+      if (currentEntity && currentEntity.links) {
+        const selfLink = currentEntity.links.find(l => l.rel.includes('self'));
+        if (selfLink) {
+          navigate(selfLink.href);
+        }
+      }
+    } else {
+      const error = await response.text();
+      alert(`Action failed: ${response.status} ${error}`);
+    }
+  } catch (error) {
+    alert(`Signing failed: ${error.message}`);
+  }
+}
+
 // Execute a Siren action
 async function executeAction(action, form) {
   const formData = new FormData(form);
@@ -806,6 +878,10 @@ async function executeAction(action, form) {
     data[key] = value;
   }
 
+  if (isSignAction(action)) {
+    return executeSignedAction(action, data);
+  }
+
   try {
     const response = await fetch(action.href, {
       method: action.method || 'POST',
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Register decoders for dimensions and blurhash
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Media uploads from the post and reply forms. Files go to the user's own
+// media server: a Blossom server from their kind 10063 list, or a NIP-96
+// server from their kind 10096 list, authorized by an event the bunker signs.
+// Servers are user-chosen, so requests go through the SSRF-safe dialer.
+
+const (
+	maxUploadFileSize = 20 << 20                  // Largest file accepted from the form
+	maxUploadBodySize = maxUploadFileSize + 1<<20 // Body limit for forms that accept a file
+	maxBlurhashPixels = 40_000_000                // Don't fully decode larger images
+	uploadTimeout     = 45 * time.Second
+	uploadAuthExpiry  = 5 * time.Minute
+
+	// A request with an attachment may take this long in total. Uploads stop
+	// early enough to leave room for signing the note and replying.
+	uploadRequestTimeout = 150 * time.Second
+	uploadReplyMargin    = 10 * time.Second
+)
+
+// Media server list and upload authorization kinds
+const (
+	kindBlossomServers = 10063
+	kindNIP96Servers   = 10096
+	kindBlossomAuth    = 24242
+	kindHTTPAuth       = 27235 // NIP-98
+)
+
+var uploadHTTPClient = &http.Client{
+	Timeout: uploadTimeout,
+	Transport: &http.Transport{
+		DialContext:           ssrfSafeDialContext,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	},
+}
+
+// uploadError is an upload failure whose message is safe to show the user
+type uploadError struct {
+	msg string
+}
+
+func (e *uploadError) Error() string { return e.msg }
+
+// uploadErrorMessage turns an upload failure into a message for the user
+func uploadErrorMessage(err error) string {
+	var userErr *uploadError
+	if errors.As(err, &userErr) {
+		return userErr.msg
+	}
+	return sanitizeErrorForUser("Upload media", err)
+}
+
+// MediaServers are a user's preferred upload servers, in order of preference
+type MediaServers struct {
+	Blossom []string
+	NIP96   []string
+}
+
+// fetchMediaServers reads a user's Blossom (kind 10063) and NIP-96 (kind 10096) server lists
+func fetchMediaServers(relays []string, pubkey string) MediaServers {
+	result := fetchReplaceable(relays, Filter{
+		Kinds:   []int{kindBlossomServers, kindNIP96Servers},
+		Authors: []string{pubkey},
+		Limit:   2,
+	})
+
+	var servers MediaServers
+	for _, evt := range result.Events {
+		for _, tag := range evt.Tags {
+			if len(tag) < 2 || tag[0] != "server" {
+				continue
+			}
+			server := strings.TrimRight(strings.TrimSpace(tag[1]), "/")
+			if !strings.HasPrefix(server, "https://") && !strings.HasPrefix(server, "http://") {
+				continue
+			}
+			if evt.Kind == kindBlossomServers {
+				servers.Blossom = append(servers.Blossom, server)
+			} else {
+				servers.NIP96 = append(servers.NIP96, server)
+			}
+		}
+	}
+	return servers
+}
+
+// UploadedMedia describes a stored file for its NIP-92 imeta tag
+type UploadedMedia struct {
+	URL      string
+	MimeType string
+	SHA256   string
+	Size     int
+	Dim      string
+	Blurhash string
+	Alt      string
+}
+
+// imetaTag builds the NIP-92 imeta tag read back by parseImetaTag
+func (m *UploadedMedia) imetaTag() []string {
+	tag := []string{"imeta", "url " + m.URL}
+	if m.MimeType != "" {
+		tag = append(tag, "m "+m.MimeType)
+	}
+	if m.SHA256 != "" {
+		tag = append(tag, "x "+m.SHA256)
+	}
+	if m.Size > 0 {
+		tag = append(tag, "size "+strconv.Itoa(m.Size))
+	}
+	if m.Dim != "" {
+		tag = append(tag, "dim "+m.Dim)
+	}
+	if m.Blurhash != "" {
+		tag = append(tag, "blurhash "+m.Blurhash)
+	}
+	if m.Alt != "" {
+		tag = append(tag, "alt "+m.Alt)
+	}
+	return tag
+}
+
+// mergeNIP94Tags fills in fields from a server's NIP-94 style tags. The
+// server's values win, since it may have transcoded or stripped the file.
+func (m *UploadedMedia) mergeNIP94Tags(tags [][]string) {
+	for _, tag := range tags {
+		if len(tag) < 2 || tag[1] == "" {
+			continue
+		}
+		switch tag[0] {
+		case "url":
+			m.URL = tag[1]
+		case "m":
+			m.MimeType = tag[1]
+		case "x":
+			m.SHA256 = tag[1]
+		case "size":
+			if size, err := strconv.Atoi(tag[1]); err == nil {
+				m.Size = size
+			}
+		case "dim":
+			m.Dim = tag[1]
+		case "blurhash":
+			m.Blurhash = tag[1]
+		}
+	}
+}
+
+// uploadFormMedia uploads the form's "media" file, if there is one, to the
+// user's media servers. It returns nil with no error when no file was attached.
+// Servers are tried until deadline, from uploadDeadline, passes.
+func uploadFormMedia(r *http.Request, session *BunkerSession, deadline time.Time) (*UploadedMedia, error) {
+	file, header, err := r.FormFile("media")
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if header.Size == 0 {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUploadFileSize {
+		return nil, &uploadError{fmt.Sprintf("File is too large (at most %d MB)", maxUploadFileSize>>20)}
+	}
+
+	media := describeMedia(data, header.Header.Get("Content-Type"))
+	if !strings.HasPrefix(media.MimeType, "image/") && !strings.HasPrefix(media.MimeType, "video/") {
+		return nil, &uploadError{"Only images and videos can be attached"}
+	}
+	media.Alt = strings.TrimSpace(r.FormValue("media_alt"))
+
+	pubkeyHex := hex.EncodeToString(session.UserPubKey)
+	readRelays, _ := sessionRelays(session)
+	servers := fetchMediaServers(dedupeStrings(append(indexerRelays(), readRelays...)), pubkeyHex)
+	if len(servers.Blossom) == 0 && len(servers.NIP96) == 0 {
+		return nil, &uploadError{"No media server configured. Add a Blossom (kind 10063) or NIP-96 (kind 10096) server list to your profile first."}
+	}
+
+	ctx, cancel := context.WithDeadline(r.Context(), deadline)
+	defer cancel()
+
+	// Try servers in order of the user's preference, Blossom first
+	var lastErr error
+	for _, server := range servers.Blossom {
+		if ctx.Err() != nil {
+			break
+		}
+		stored, err := uploadBlossom(ctx, session, server, data, media)
+		if err == nil {
+			slog.Info("Uploaded media", "server", server, "protocol", "blossom", "size", len(data))
+			return stored, nil
+		}
+		slog.Warn("Blossom upload failed", "server", server, "error", err)
+		lastErr = err
+	}
+	for _, server := range servers.NIP96 {
+		if ctx.Err() != nil {
+			break
+		}
+		stored, err := uploadNIP96(ctx, session, server, data, header.Filename, media)
+		if err == nil {
+			slog.Info("Uploaded media", "server", server, "protocol", "nip96", "size", len(data))
+			return stored, nil
+		}
+		slog.Warn("NIP-96 upload failed", "server", server, "error", err)
+		lastErr = err
+	}
+	if ctx.Err() != nil {
+		return nil, &uploadError{"The upload took too long. Try a smaller file or another media server."}
+	}
+	return nil, fmt.Errorf("upload failed on all media servers: %w", lastErr)
+}
+
+// uploadDeadline extends the read and write deadlines of a request that may
+// carry an attachment, so a large file on a slow link can be received and
+// uploaded, and returns when uploading has to stop so the note can still be
+// signed and the response written in time. It must be called before the
+// form is parsed, which reads the body.
+func uploadDeadline(w http.ResponseWriter, r *http.Request) time.Time {
+	end := time.Now().Add(serverWriteTimeout)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		extended := time.Now().Add(uploadRequestTimeout)
+		rc := http.NewResponseController(w)
+		if err := rc.SetReadDeadline(extended); err != nil {
+			slog.Warn("Can't extend read deadline for upload", "error", err)
+		}
+		if err := rc.SetWriteDeadline(extended); err != nil {
+			// Can't extend it; stay within the server's usual write timeout
+			slog.Warn("Can't extend write deadline for upload", "error", err)
+		} else {
+			end = extended
+		}
+	}
+	return end.Add(-currentConfig().Timeouts.Sign - uploadReplyMargin)
+}
+
+// describeMedia works out the type, hash, dimensions and blurhash of a file.
+// The type is sniffed from the content; the browser's claim is only used
+// when sniffing can't tell.
+func describeMedia(data []byte, claimedType string) UploadedMedia {
+	sum := sha256.Sum256(data)
+	media := UploadedMedia{
+		SHA256: hex.EncodeToString(sum[:]),
+		Size:   len(data),
+	}
+
+	mimeType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	if mimeType == "application/octet-stream" {
+		mimeType, _, _ = strings.Cut(claimedType, ";")
+	}
+	media.MimeType = strings.ToLower(strings.TrimSpace(mimeType))
+
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		media.Dim = fmt.Sprintf("%dx%d", cfg.Width, cfg.Height)
+		if cfg.Width*cfg.Height <= maxBlurhashPixels {
+			if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+				media.Blurhash = encodeBlurhash(img)
+			}
+		}
+	}
+	return media
+}
+
+// signAuthHeader signs an authorization event via the bunker and encodes it
+// as a "Nostr <base64>" Authorization header (Blossom BUD-02 and NIP-98)
+func signAuthHeader(ctx context.Context, session *BunkerSession, event UnsignedEvent) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, currentConfig().Timeouts.Sign)
+	defer cancel()
+
+	signed, err := session.SignEvent(ctx, event)
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(signed)
+	if err != nil {
+		return "", err
+	}
+	return "Nostr " + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// uploadFailure describes a non-2xx response from a media server
+func uploadFailure(resp *http.Response) error {
+	reason := resp.Header.Get("X-Reason")
+	if reason == "" {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		reason = strings.TrimSpace(string(body))
+	}
+	return fmt.Errorf("server returned %s: %s", resp.Status, reason)
+}
+
+// uploadBlossom PUTs a blob to a Blossom server (BUD-02)
+func uploadBlossom(ctx context.Context, session *BunkerSession, server string, data []byte, media UploadedMedia) (*UploadedMedia, error) {
+	auth, err := signAuthHeader(ctx, session, UnsignedEvent{
+		Kind:    kindBlossomAuth,
+		Content: "Upload " + media.MimeType,
+		Tags: [][]string{
+			{"t", "upload"},
+			{"x", media.SHA256},
+			{"expiration", strconv.FormatInt(time.Now().Add(uploadAuthExpiry).Unix(), 10)},
+		},
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, server+"/upload", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Type", media.MimeType)
+
+	resp, err := uploadHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, uploadFailure(resp)
+	}
+
+	var descriptor struct {
+		URL    string     `json:"url"`
+		SHA256 string     `json:"sha256"`
+		Size   int        `json:"size"`
+		Type   string     `json:"type"`
+		NIP94  [][]string `json:"nip94"` // Optional (BUD-08)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&descriptor); err != nil {
+		return nil, fmt.Errorf("invalid blob descriptor: %w", err)
+	}
+	if descriptor.URL == "" {
+		return nil, errors.New("blob descriptor has no url")
+	}
+
+	stored := media
+	stored.URL = descriptor.URL
+	if descriptor.SHA256 != "" {
+		stored.SHA256 = descriptor.SHA256
+	}
+	if descriptor.Size > 0 {
+		stored.Size = descriptor.Size
+	}
+	if descriptor.Type != "" {
+		stored.MimeType = descriptor.Type
+	}
+	stored.mergeNIP94Tags(descriptor.NIP94)
+	return &stored, nil
+}
+
+// nip96APIURL reads a NIP-96 server's upload endpoint from its well-known document
+func nip96APIURL(ctx context.Context, server string) (string, error) {
+	var info struct {
+		APIURL         string `json:"api_url"`
+		DelegatedToURL string `json:"delegated_to_url"`
+	}
+	for range 2 {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server+"/.well-known/nostr/nip96.json", nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := uploadHTTPClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		err = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&info)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("invalid nip96.json: %w", err)
+		}
+		if info.APIURL != "" || info.DelegatedToURL == "" {
+			break
+		}
+		// Servers may hand uploads to another server (one hop only)
+		server = strings.TrimRight(info.DelegatedToURL, "/")
+	}
+	if !strings.HasPrefix(info.APIURL, "https://") && !strings.HasPrefix(info.APIURL, "http://") {
+		return "", errors.New("nip96.json has no api_url")
+	}
+	return info.APIURL, nil
+}
+
+// uploadNIP96 POSTs a file to a NIP-96 server with NIP-98 authorization
+func uploadNIP96(ctx context.Context, session *BunkerSession, server string, data []byte, filename string, media UploadedMedia) (*UploadedMedia, error) {
+	apiURL, err := nip96APIURL(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if filename == "" {
+		filename = "upload"
+	}
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	part.Write(data)
+	mw.WriteField("content_type", media.MimeType)
+	mw.WriteField("size", strconv.Itoa(len(data)))
+	if media.Alt != "" {
+		mw.WriteField("alt", media.Alt)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	payload := sha256.Sum256(body.Bytes())
+	auth, err := signAuthHeader(ctx, session, UnsignedEvent{
+		Kind: kindHTTPAuth,
+		Tags: [][]string{
+			{"u", apiURL},
+			{"method", http.MethodPost},
+			{"payload", hex.EncodeToString(payload[:])},
+		},
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := uploadHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, uploadFailure(resp)
+	}
+
+	var result struct {
+		Status     string `json:"status"`
+		Message    string `json:"message"`
+		NIP94Event struct {
+			Tags [][]string `json:"tags"`
+		} `json:"nip94_event"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid upload response: %w", err)
+	}
+	if result.Status != "success" {
+		// Delayed processing (202) isn't supported: we need the URL now
+		return nil, fmt.Errorf("upload not completed (%s): %s", result.Status, result.Message)
+	}
+
+	stored := media
+	stored.URL = ""
+	stored.mergeNIP94Tags(result.NIP94Event.Tags)
+	if stored.URL == "" {
+		return nil, errors.New("upload response has no url")
+	}
+	return &stored, nil
+}